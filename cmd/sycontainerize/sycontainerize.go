@@ -29,6 +29,9 @@ func main() {
 	debug := flag.Bool("d", false, "Enable debug mode")
 	appContainizer := flag.String("conf", "", "Path to the configuration file for automatically containerization an application")
 	upload := flag.Bool("upload", false, "Upload generated images (appropriate configuration files need to specify the registry's URL")
+	appExe := flag.String("app-exe", "", "Path of the application's executable inside the container, recorded in the image's metadata (overwrites app_exe_path from the configuration file)")
+	syCacheDir := flag.String("singularity-cachedir", "", "Cache directory of Singularity (SINGULARITY_CACHEDIR) used while building images, e.g., on a large filesystem; overwrites "+sy.SingularityCacheDirKey+" from the sympi configuration file")
+	syTmpDir := flag.String("singularity-tmpdir", "", "Temporary directory of Singularity (SINGULARITY_TMPDIR) used while building images; overwrites "+sy.SingularityTmpDirKey+" from the sympi configuration file")
 	noinstall := flag.Bool("noinstall", false, "Keep the MPI installations on the host and the container images in the specified directory (instead of deleting everything once an experiment terminates). Default is '~/.sympi', set SYMPI_INSTALL_DIR to overwrite")
 
 	flag.Parse()
@@ -53,7 +56,7 @@ func main() {
 	if *debug {
 		sysCfg.Debug = true
 		sysCfg.Verbose = true
-		err = checker.CheckSystemConfig()
+		err = checker.CheckSystemConfig(&sysCfg)
 		if err != nil {
 			log.Fatalf("the system is not correctly setup: %s", err)
 		}
@@ -61,8 +64,15 @@ func main() {
 
 	sysCfg.AppContainizer = *appContainizer
 	sysCfg.Upload = *upload
+	sysCfg.AppExe = *appExe
 	sysCfg.Verbose = *verbose
 	sysCfg.Debug = *debug
+	if *syCacheDir != "" {
+		sysCfg.SingularityCacheDir = *syCacheDir
+	}
+	if *syTmpDir != "" {
+		sysCfg.SingularityTmpDir = *syTmpDir
+	}
 	if !*noinstall {
 		sysCfg.Persistent = sys.GetSympiDir()
 	}
@@ -6,28 +6,55 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/app"
+	"github.com/sylabs/singularity-mpi/internal/pkg/bugreport"
 	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
 	"github.com/sylabs/singularity-mpi/internal/pkg/builder"
+	"github.com/sylabs/singularity-mpi/internal/pkg/bundle"
 	"github.com/sylabs/singularity-mpi/internal/pkg/checker"
+	"github.com/sylabs/singularity-mpi/internal/pkg/configcheck"
 	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/diagnostics"
+	"github.com/sylabs/singularity-mpi/internal/pkg/freeze"
 	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
 	"github.com/sylabs/singularity-mpi/internal/pkg/jm"
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
 	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
 	"github.com/sylabs/singularity-mpi/internal/pkg/launcher"
+	"github.com/sylabs/singularity-mpi/internal/pkg/lock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/modulefile"
 	"github.com/sylabs/singularity-mpi/internal/pkg/mpi"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mpidiff"
+	"github.com/sylabs/singularity-mpi/internal/pkg/network"
+	"github.com/sylabs/singularity-mpi/internal/pkg/osu"
+	"github.com/sylabs/singularity-mpi/internal/pkg/prompt"
+	"github.com/sylabs/singularity-mpi/internal/pkg/provenance"
+	"github.com/sylabs/singularity-mpi/internal/pkg/remote"
+	"github.com/sylabs/singularity-mpi/internal/pkg/results"
+	"github.com/sylabs/singularity-mpi/internal/pkg/scratch"
+	"github.com/sylabs/singularity-mpi/internal/pkg/session"
+	"github.com/sylabs/singularity-mpi/internal/pkg/smoketest"
+	sybuilder "github.com/sylabs/singularity-mpi/internal/pkg/sy"
+	"github.com/sylabs/singularity-mpi/internal/pkg/syexec"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
@@ -40,23 +67,92 @@ func getHostMPIInstalls(entries []os.FileInfo) ([]string, error) {
 	for _, entry := range entries {
 		matched, err := regexp.MatchString(sys.MPIInstallDirPrefix+`.*`, entry.Name())
 		if err != nil {
-			return hostInstalls, fmt.Errorf("failed to parse %s: %s", entry, err)
+			return hostInstalls, fmt.Errorf("failed to parse %s: %w", entry, err)
 		}
 		if matched {
 			s := strings.Replace(entry.Name(), sys.MPIInstallDirPrefix, "", -1)
-			hostInstalls = append(hostInstalls, strings.Replace(s, "-", ":", -1))
+			// The tag of a variant may contain '-', e.g., openmpi-4.1.4+gcc-11
+			hostInstalls = append(hostInstalls, strings.Replace(s, "-", ":", 1))
 		}
 	}
 
 	return hostInstalls, nil
 }
 
+// infoLog is the logger for informational messages about the progress of the operations,
+// silenced in quiet mode; errors are displayed on stderr and results on stdout
+var infoLog = log.New(os.Stdout, "", 0)
+
+// hostMPIInstall represents a MPI installed on the host, either by the user or system-wide
+type hostMPIInstall struct {
+	// ID identifies the MPI, e.g., openmpi:4.0.1
+	ID string
+
+	// Dir is the installation directory
+	Dir string
+
+	// System specifies whether MPI is installed in the system-wide directory
+	System bool
+
+	// Target is the directory the installation links to, e.g., a MPI registered with -register
+	// or installed from the same source than another version (empty if not a link)
+	Target string
+}
+
+// getAllHostMPIInstalls returns the MPI installed in the user's directory followed
+// by the MPI installed in the system-wide directory
+func getAllHostMPIInstalls() ([]hostMPIInstall, error) {
+	var installs []hostMPIInstall
+
+	dirs := []string{sys.GetSympiDir()}
+	systemDir := sys.GetSystemSympiDir()
+	if systemDir != sys.GetSympiDir() && util.PathExists(systemDir) {
+		dirs = append(dirs, systemDir)
+	}
+
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return installs, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		ids, err := getHostMPIInstalls(entries)
+		if err != nil {
+			return installs, err
+		}
+		for _, id := range ids {
+			installDir := filepath.Join(dir, sys.MPIInstallDirPrefix+strings.Replace(id, ":", "-", -1))
+			install := hostMPIInstall{ID: id, Dir: installDir, System: dir == systemDir}
+			if target, err := os.Readlink(installDir); err == nil {
+				install.Target = target
+			}
+			installs = append(installs, install)
+		}
+	}
+
+	return installs, nil
+}
+
+// getHostMPIInstallDir returns the installation directory of a MPI on the host, the user's
+// installation being preferred over the system-wide installation
+func getHostMPIInstallDir(id string) (string, error) {
+	installs, err := getAllHostMPIInstalls()
+	if err != nil {
+		return "", err
+	}
+	for _, i := range installs {
+		if i.ID == id {
+			return i.Dir, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", id, sympierr.ErrMPINotInstalled)
+}
+
 func getContainerInstalls(entries []os.FileInfo) ([]string, error) {
 	var containers []string
 	for _, entry := range entries {
 		matched, err := regexp.MatchString(sys.ContainerInstallDirPrefix+`.*`, entry.Name())
 		if err != nil {
-			return containers, fmt.Errorf("failed to parse %s: %s", entry, err)
+			return containers, fmt.Errorf("failed to parse %s: %w", entry, err)
 		}
 		if matched {
 			containers = append(containers, strings.Replace(entry.Name(), sys.ContainerInstallDirPrefix, "", -1))
@@ -70,7 +166,7 @@ func getSingularityInstalls(entries []os.FileInfo) ([]string, error) {
 	for _, entry := range entries {
 		matched, err := regexp.MatchString(sys.SingularityInstallDirPrefix+`.*`, entry.Name())
 		if err != nil {
-			return singularities, fmt.Errorf("failed to parse %s: %s", entry, err)
+			return singularities, fmt.Errorf("failed to parse %s: %w", entry, err)
 		}
 		if matched {
 			singularities = append(singularities, strings.Replace(entry.Name(), sys.SingularityInstallDirPrefix, "", -1))
@@ -79,58 +175,185 @@ func getSingularityInstalls(entries []os.FileInfo) ([]string, error) {
 	return singularities, nil
 }
 
-func displayInstalled(dir string) error {
+// listFilter selects the software displayed by sympi -list
+type listFilter struct {
+	// Impl is the MPI implementation to display, e.g., openmpi (all implementations if empty)
+	Impl string
+
+	// Containers specifies whether only the containers are displayed
+	Containers bool
+
+	// Loaded specifies whether only the loaded MPI and Singularity are displayed
+	Loaded bool
+}
+
+// installedSoftware is the software installed by sympi
+type installedSoftware struct {
+	singularities []string
+	hostMPIs      []hostMPIInstall
+	containers    []string
+}
+
+// check returns an error if the filter cannot be used
+func (f listFilter) check() error {
+	if f.Containers && f.Loaded {
+		return fmt.Errorf("containers are not loaded, -containers and -loaded cannot be used together")
+	}
+	return nil
+}
+
+// showSingularity specifies whether the Singularity installations are displayed
+func (f listFilter) showSingularity() bool {
+	return !f.Containers && f.Impl == ""
+}
+
+// showMPI specifies whether the MPI installations are displayed
+func (f listFilter) showMPI() bool {
+	return !f.Containers
+}
+
+// showContainers specifies whether the containers are displayed; when an implementation is
+// selected, only the containers based on the implementation are displayed
+func (f listFilter) showContainers() bool {
+	return !f.Loaded && (f.Impl == "" || f.Containers)
+}
+
+// matchImpl checks whether a MPI, e.g., openmpi:4.0.1, is of the selected implementation
+func (f listFilter) matchImpl(mpiID string) bool {
+	return f.Impl == "" || strings.Split(mpiID, ":")[0] == f.Impl
+}
+
+// apply returns the installed software that matches the filter. The containers are not
+// filtered by implementation since it requires inspecting their image.
+func (f listFilter) apply(inst installedSoftware, curMPIDir string, curSingularityVersion string) installedSoftware {
+	var res installedSoftware
+	if f.showSingularity() {
+		for _, sy := range inst.singularities {
+			if !f.Loaded || sy == curSingularityVersion {
+				res.singularities = append(res.singularities, sy)
+			}
+		}
+	}
+	if f.showMPI() {
+		for _, mpi := range inst.hostMPIs {
+			if f.matchImpl(mpi.ID) && (!f.Loaded || mpi.Dir == curMPIDir) {
+				res.hostMPIs = append(res.hostMPIs, mpi)
+			}
+		}
+	}
+	if f.showContainers() {
+		res.containers = inst.containers
+	}
+	return res
+}
+
+func displayInstalled(dir string, filter listFilter, sysCfg *sys.Config) error {
+	err := filter.check()
+	if err != nil {
+		return err
+	}
 
 	entries, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("failed to read %s: %s", dir, err)
+		return fmt.Errorf("failed to read %s: %w", dir, err)
 	}
 
-	curMPIVersion := getLoadedMPI()
+	curMPIDir := getLoadedMPIDir()
 	curSingularityVersion := getLoadedSingularity()
 
-	hostInstalls, err := getHostMPIInstalls(entries)
+	var inst installedSoftware
+	inst.hostMPIs, err = getAllHostMPIInstalls()
 	if err != nil {
-		return fmt.Errorf("unable to get the install of MPIs installed on the host: %s", err)
+		return fmt.Errorf("unable to get the install of MPIs installed on the host: %w", err)
 	}
-	containers, err := getContainerInstalls(entries)
+	inst.containers, err = getContainerInstalls(entries)
 	if err != nil {
-		return fmt.Errorf("unable to get the list of containers stored on the host: %s", err)
+		return fmt.Errorf("unable to get the list of containers stored on the host: %w", err)
 	}
-	singularities, err := getSingularityInstalls(entries)
+	inst.singularities, err = getSingularityInstalls(entries)
 	if err != nil {
-		return fmt.Errorf("unable to get the list of singularity installs on the host: %s", err)
+		return fmt.Errorf("unable to get the list of singularity installs on the host: %w", err)
 	}
+	inst = filter.apply(inst, curMPIDir, curSingularityVersion)
 
-	if len(singularities) > 0 {
-		fmt.Printf("Available Singularity installation(s) on the host:\n")
-		for _, sy := range singularities {
-			if sy == curSingularityVersion {
-				sy = sy + " (L)"
+	if filter.showSingularity() {
+		if len(inst.singularities) > 0 {
+			fmt.Printf("Available Singularity installation(s) on the host:\n")
+			for _, sy := range inst.singularities {
+				if sy == curSingularityVersion {
+					sy = sy + " (L)"
+				}
+				fmt.Printf("\tsingularity:%s\n", sy)
 			}
-			fmt.Printf("\tsingularity:%s\n", sy)
+			fmt.Printf("\n")
+		} else {
+			fmt.Printf("No Singularity available on the host\n\n")
 		}
-		fmt.Printf("\n")
-	} else {
-		fmt.Printf("No Singularity available on the host\n\n")
 	}
 
-	if len(hostInstalls) > 0 {
-		fmt.Printf("Available MPI installation(s) on the host:\n")
-		for _, mpi := range hostInstalls {
-			if mpi == curMPIVersion {
-				mpi = mpi + " (L)"
+	if filter.showMPI() {
+		if len(inst.hostMPIs) > 0 {
+			fmt.Printf("Available MPI installation(s) on the host:\n")
+			for _, mpi := range inst.hostMPIs {
+				entry := mpi.ID + " [user]"
+				if mpi.System {
+					entry = mpi.ID + " [system]"
+				}
+				if mpi.Target != "" {
+					entry = mpi.ID + " [link: " + mpi.Target + "]"
+				}
+				if p, err := provenance.Load(mpi.Dir); err == nil && p != nil && p.BuildType == provenance.DebugBuild {
+					entry = entry + " [debug]"
+				}
+				if mpi.Dir == curMPIDir {
+					entry = entry + " (L)"
+				}
+				fmt.Printf("\t%s\n", entry)
 			}
-			fmt.Printf("\t%s\n", mpi)
+			fmt.Printf("\n")
+		} else {
+			fmt.Printf("No MPI available on the host\n\n")
 		}
-		fmt.Printf("\n")
-	} else {
-		fmt.Printf("No MPI available on the host\n\n")
 	}
 
-	if len(containers) > 0 {
-		fmt.Printf("Available container(s):\n\t")
-		fmt.Println(strings.Join(containers, "\n\t"))
+	if !filter.showContainers() {
+		return nil
+	}
+
+	// Inspecting images is slow and requires Singularity: the metadata cached by previous
+	// inspections is displayed, the other images are only inspected in verbose mode or to
+	// select the containers of an implementation, their name being displayed otherwise
+	metadata := make(map[string]container.Metadata)
+	inspect := sysCfg.SingularityBin != "" && (sysCfg.Verbose || filter.Impl != "")
+	var imgPaths []string
+	for _, c := range inst.containers {
+		imgPath := filepath.Join(dir, sys.ContainerInstallDirPrefix+c, c+".sif")
+		if cfg, mpiCfg, ok := container.GetCachedMetadata(imgPath); ok {
+			metadata[c] = container.Metadata{Container: cfg, MPI: mpiCfg}
+		} else if inspect {
+			imgPaths = append(imgPaths, imgPath)
+		}
+	}
+	if len(imgPaths) > 0 {
+		for name, md := range container.InspectImages(imgPaths, container.DefaultInspectWorkers, sysCfg) {
+			metadata[name] = md
+		}
+	}
+	var lines []string
+	for _, c := range inst.containers {
+		md, ok := metadata[c]
+		known := ok && md.Err == nil && md.MPI.ID != ""
+		if filter.Impl != "" && (!known || md.MPI.ID != filter.Impl) {
+			continue
+		}
+		if known {
+			lines = append(lines, fmt.Sprintf("\t%s (%s:%s)\n", c, md.MPI.ID, md.MPI.Version))
+		} else {
+			lines = append(lines, fmt.Sprintf("\t%s\n", c))
+		}
+	}
+	if len(lines) > 0 {
+		fmt.Printf("Available container(s):\n%s", strings.Join(lines, ""))
 	} else {
 		fmt.Printf("No container available\n\n")
 	}
@@ -138,61 +361,80 @@ func displayInstalled(dir string) error {
 	return nil
 }
 
-func getPPPID() (int, error) {
-	// We need to find the parent of our parent process
-	ppid := os.Getppid()
-	pppid := 0 // Only for now
-	parentInfoFile := filepath.Join("/proc", strconv.Itoa(ppid), "status")
-	procFile, err := os.Open(parentInfoFile)
-	if err != nil {
-		return -1, fmt.Errorf("failed to open %s: %s", parentInfoFile, err)
+func displayLoaded() {
+	var loaded []string
+	if mpi := getLoadedMPI(); mpi != "" {
+		loaded = append(loaded, mpi)
 	}
-	defer procFile.Close()
-	for s := bufio.NewScanner(procFile); s.Scan(); {
-		var temp int
-		if n, _ := fmt.Sscanf(s.Text(), "PPid:\t%d", &temp); n == 1 {
-			pppid = temp
-		}
+	if sy := getLoadedSingularity(); sy != "" {
+		loaded = append(loaded, "singularity:"+sy)
 	}
-
-	return pppid, nil
+	for _, m := range session.GetNamespacedMPIs(os.Environ()) {
+		loaded = append(loaded, m.Namespace+"="+getMPIIDFromDir(m.Dir))
+	}
+	fmt.Println(strings.Join(loaded, " "))
 }
 
 func getEnvFile() (string, error) {
-	pppid, err := getPPPID()
+	return session.GetFile(session.DefaultProcDir, os.Getppid())
+}
+
+// startNewSession creates a fresh session file for the shell sympi is executed from, based on
+// the current environment, and prints the commands making the shell use it
+func startNewSession() error {
+	file := session.GetDefaultFile(os.Getppid())
+	err := updateEnvFile(file, os.Getenv("PATH"), os.Getenv("LD_LIBRARY_PATH"))
 	if err != nil {
-		return "", fmt.Errorf("failed to get PPPID: %s", err)
+		return err
 	}
-	filename := "sympi_" + strconv.Itoa(pppid)
-	return filepath.Join("/tmp", filename), nil
+	fmt.Printf("export %s=%s; export PROMPT_COMMAND=\"source %s\"\n", session.FileEnv, file, file)
+	return nil
 }
 
+// updateEnvFile updates the environment file of the session with new PATH and LD_LIBRARY_PATH,
+// the markers of the loaded software being kept
 func updateEnvFile(file string, pathEnv string, ldlibEnv string) error {
+	return writeEnvFile(file, pathEnv, ldlibEnv, session.GetLoaded(os.Environ()), nil)
+}
+
+// writeEnvFile writes the environment file of the session with the markers of the loaded
+// software and of the software to unload
+func writeEnvFile(file string, pathEnv string, ldlibEnv string, loaded []session.Loaded, unloaded []string) error {
 	// sanity checks
 	if len(pathEnv) == 0 {
 		return fmt.Errorf("invalid parameter, empty PATH")
 	}
 
-	f, err := os.Create(file)
+	// The file is sourced by the shell so it must never be observed half-written
+	content := session.GenerateEnvFile(pathEnv, ldlibEnv, loaded, unloaded)
+	err := util.WriteFileAtomic(file, []byte(content), 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create %s: %s", file, err)
+		return fmt.Errorf("failed to update %s: %w", file, err)
 	}
-	defer f.Close()
-	_, err = f.WriteString("export PATH=" + pathEnv + "\n")
+	return nil
+}
+
+// repairEnvFile recreates the environment file of the current session from the current environment.
+// It can safely be called multiple times.
+func repairEnvFile() error {
+	file, err := getEnvFile()
 	if err != nil {
-		return fmt.Errorf("failed to write to %s: %s", file, err)
+		return err
 	}
-	_, err = f.WriteString("export LD_LIBRARY_PATH=" + ldlibEnv + "\n")
+
+	release, err := lockState(true)
 	if err != nil {
-		return fmt.Errorf("failed to write to %s: %s", file, err)
+		return err
 	}
-	return nil
+	defer release()
+
+	return updateEnvFile(file, os.Getenv("PATH"), os.Getenv("LD_LIBRARY_PATH"))
 }
 
 func getSyDetails(desc string) string {
 	tokens := strings.Split(desc, ":")
 	if len(tokens) != 2 {
-		fmt.Println("invalid Singularity description string, execute 'sympi -list' to get the list of available installations")
+		fmt.Fprintln(os.Stderr, "invalid Singularity description string, execute 'sympi -list' to get the list of available installations")
 		return ""
 	}
 	return tokens[1]
@@ -201,188 +443,407 @@ func getSyDetails(desc string) string {
 func getMPIDetails(desc string) (string, string) {
 	tokens := strings.Split(desc, ":")
 	if len(tokens) != 2 {
-		fmt.Println("invalid MPI, execute 'sympi -list' to get the list of available installations")
+		fmt.Fprintln(os.Stderr, "invalid MPI, execute 'sympi -list' to get the list of available installations")
 		return "", ""
 	}
-	return tokens[0], tokens[1]
+	return tokens[0], implem.NormalizeVersion(tokens[1])
+}
+
+// findLegacyDir returns the installation directory of a software loaded before sympi marked the
+// loaded software, based on the entries of PATH that are not marked and are the bin directory of
+// an installation; empty if none
+func findLegacyDir(isInstallDir func(dir string) bool) string {
+	pathTokens := strings.Split(os.Getenv("PATH"), ":")
+	pathTokens = session.RemoveEntries(pathTokens, getMarkedEntries("")...)
+	for _, t := range pathTokens {
+		if filepath.Base(t) == "bin" && isInstallDir(filepath.Dir(t)) {
+			return filepath.Dir(t)
+		}
+	}
+	return ""
+}
+
+// getMarkedEntries returns the entries of PATH and LD_LIBRARY_PATH of the loaded software, except
+// the software marked by an environment variable
+func getMarkedEntries(exceptEnv string) []string {
+	var entries []string
+	for _, l := range session.GetLoaded(os.Environ()) {
+		if l.Env != exceptEnv {
+			bin, lib := session.GetPathEntries(l.Dir)
+			entries = append(entries, bin, lib)
+		}
+	}
+	return entries
 }
 
-func getSyMPIBaseDir() string {
-	baseDir := sys.GetSympiDir()
-	// We need to make sure that we do not end up with a / we do not want
-	if string(baseDir[len(baseDir)-1]) != "/" {
-		baseDir = baseDir + "/"
+// getLoadedSingularityDir returns the installation directory of the loaded Singularity
+func getLoadedSingularityDir() string {
+	if dir := os.Getenv(session.SingularityDirEnv); dir != "" {
+		return dir
 	}
-	return baseDir
+	return findLegacyDir(func(dir string) bool {
+		return filepath.Dir(dir) == filepath.Clean(sys.GetSympiDir()) && strings.HasPrefix(filepath.Base(dir), sys.SingularityInstallDirPrefix)
+	})
 }
 
 func getLoadedSingularity() string {
-	curPath := os.Getenv("PATH")
-	pathTokens := strings.Split(curPath, ":")
-	for _, t := range pathTokens {
-		if strings.Contains(t, sys.SingularityInstallDirPrefix) {
-			baseDir := getSyMPIBaseDir()
-			t = strings.Replace(t, baseDir, "", -1)
-			t = strings.Replace(t, sys.SingularityInstallDirPrefix, "", -1)
-			t = strings.Replace(t, "/bin", "", -1)
-			return strings.Replace(t, "-", ":", -1)
-		}
+	dir := getLoadedSingularityDir()
+	if dir == "" {
+		return ""
 	}
+	t := strings.Replace(filepath.Base(dir), sys.SingularityInstallDirPrefix, "", -1)
+	return strings.Replace(t, "-", ":", -1)
+}
 
-	return ""
+// getLoadedMPIDir returns the installation directory of the MPI loaded by default, i.e., not in a namespace
+func getLoadedMPIDir() string {
+	if dir := os.Getenv(session.MPIDirEnv); dir != "" {
+		return dir
+	}
+	// The MPI may be installed in the user's or system-wide directory
+	installs, err := getAllHostMPIInstalls()
+	if err != nil {
+		return ""
+	}
+	return findLegacyDir(func(dir string) bool {
+		for _, i := range installs {
+			if filepath.Clean(i.Dir) == filepath.Clean(dir) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// getMPIIDFromDir returns the MPI installed in a directory, e.g., openmpi:4.0.2
+func getMPIIDFromDir(dir string) string {
+	t := strings.Replace(filepath.Base(dir), sys.MPIInstallDirPrefix, "", -1)
+	return strings.Replace(t, "-", ":", 1)
 }
 
 func getLoadedMPI() string {
-	curPath := os.Getenv("PATH")
-	pathTokens := strings.Split(curPath, ":")
-	for _, t := range pathTokens {
-		if strings.Contains(t, sys.MPIInstallDirPrefix) {
-			baseDir := getSyMPIBaseDir()
-			t = strings.Replace(t, baseDir, "", -1)
-			t = strings.Replace(t, sys.MPIInstallDirPrefix, "", -1)
-			t = strings.Replace(t, "/bin", "", -1)
-			return strings.Replace(t, "-", ":", -1)
-		}
+	dir := getLoadedMPIDir()
+	if dir == "" {
+		return ""
 	}
+	return getMPIIDFromDir(dir)
+}
 
-	return ""
+// getMPISoftware returns the description of a MPI installed in a directory for the scripts
+// setting up the environment, with its modulefile if any
+func getMPISoftware(dir string, sysCfg *sys.Config) session.Software {
+	id, version := getMPIDetails(getMPIIDFromDir(dir))
+	s := session.Software{Name: id, Version: version, InstallDir: dir}
+	if sysCfg.ModulefilesDir != "" && util.FileExists(modulefile.GetPath(sysCfg.ModulefilesDir, sysCfg.ModulefileFormat, id, version)) {
+		s.ModulefilesDir = sysCfg.ModulefilesDir
+	}
+	return s
 }
 
-func cleanupEnvVar(prefix string) ([]string, []string) {
-	var newPath []string
-	var newLDLIB []string
+// saveEnv writes a script setting up the environment with the MPI, including the ones loaded in
+// namespaces, and Singularity loaded in the current environment, so it can be sourced by other
+// shells or batch scripts
+func saveEnv(file string, sysCfg *sys.Config) error {
+	var software []session.Software
+	if dir := getLoadedMPIDir(); dir != "" {
+		software = append(software, getMPISoftware(dir, sysCfg))
+	}
+	for _, m := range session.GetNamespacedMPIs(os.Environ()) {
+		s := getMPISoftware(m.Dir, sysCfg)
+		s.Namespace = m.Namespace
+		software = append(software, s)
+	}
+	if version := getLoadedSingularity(); version != "" {
+		software = append(software, session.Software{Name: "singularity", Version: version, InstallDir: getLoadedSingularityDir()})
+	}
+	if len(software) == 0 {
+		return fmt.Errorf("neither MPI nor Singularity is loaded, execute 'sympi -load' first")
+	}
 
-	curPath := os.Getenv("PATH")
-	curLDLIB := os.Getenv("LD_LIBRARY_PATH")
+	err := util.WriteFileAtomic(file, []byte(session.GenerateScript(software, sysCfg.PathOrder)), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
 
-	pathTokens := strings.Split(curPath, ":")
-	for _, t := range pathTokens {
-		if !strings.Contains(t, prefix) {
-			newPath = append(newPath, t)
+// loadSoftware updates the environment of the session to use a software installed in a directory,
+// its entries being added to PATH and LD_LIBRARY_PATH in a given order and the software being marked
+// by an environment variable. The entries of the software previously installed in curDir, if any,
+// are removed so that only one software is marked by a variable.
+func loadSoftware(env string, curDir string, dir string, order string) error {
+	path, ldlib := removeSoftwareEntries(env, curDir)
+	var loaded []session.Loaded
+	for _, l := range session.GetLoaded(os.Environ()) {
+		if l.Env != env {
+			loaded = append(loaded, l)
 		}
 	}
+	loaded = append(loaded, session.Loaded{Env: env, Dir: dir})
+	bin, lib := session.GetPathEntries(dir)
+
+	file, err := getEnvFile()
+	if err != nil || !util.FileExists(file) {
+		return fmt.Errorf("file %s does not exist: %w", file, sympierr.ErrNotInitialized)
+	}
+	return writeEnvFile(file, sys.AddToPathList(path, bin, order), sys.AddToPathList(ldlib, lib, order), loaded, nil)
+}
 
-	ldlibTokens := strings.Split(curLDLIB, ":")
-	for _, t := range ldlibTokens {
-		if !strings.Contains(t, prefix) {
-			newLDLIB = append(newLDLIB, t)
+// unloadSoftware removes exactly the entries of PATH and LD_LIBRARY_PATH of a software installed
+// in a directory and marked by an environment variable from the environment of the session
+func unloadSoftware(env string, dir string) error {
+	path, ldlib := removeSoftwareEntries(env, dir)
+	var loaded []session.Loaded
+	for _, l := range session.GetLoaded(os.Environ()) {
+		if l.Env != env {
+			loaded = append(loaded, l)
 		}
 	}
 
-	return newPath, newLDLIB
+	file, err := getEnvFile()
+	if err != nil || !util.FileExists(file) {
+		return fmt.Errorf("file %s does not exist: %w", file, sympierr.ErrNotInitialized)
+	}
+	return writeEnvFile(file, strings.Join(path, ":"), strings.Join(ldlib, ":"), loaded, []string{env})
 }
 
-func getCleanedUpSyEnvVars() ([]string, []string) {
-	return cleanupEnvVar(sys.SingularityInstallDirPrefix)
+// removeSoftwareEntries returns PATH and LD_LIBRARY_PATH without the entries of a software
+// installed in a directory and marked by an environment variable. The entries also used by
+// another loaded software, e.g., the same MPI loaded in a namespace, are kept.
+func removeSoftwareEntries(env string, dir string) ([]string, []string) {
+	path := strings.Split(os.Getenv("PATH"), ":")
+	ldlib := strings.Split(os.Getenv("LD_LIBRARY_PATH"), ":")
+	if dir == "" {
+		return path, ldlib
+	}
+	bin, lib := session.GetPathEntries(dir)
+	kept := getMarkedEntries(env)
+	if len(session.RemoveEntries([]string{bin}, kept...)) > 0 {
+		path = session.RemoveEntries(path, bin)
+	}
+	if len(session.RemoveEntries([]string{lib}, kept...)) > 0 {
+		ldlib = session.RemoveEntries(ldlib, lib)
+	}
+	return path, ldlib
 }
 
-func getCleanedUpMPIEnvVars() ([]string, []string) {
-	return cleanupEnvVar(sys.MPIInstallDirPrefix)
+// linkMPIInstall creates the installation directory of a MPI as a link to an existing installation.
+// Links always point to the actual directory so removing a link never breaks another one.
+func linkMPIInstall(installDir string, targetDir string) error {
+	if _, err := os.Lstat(installDir); err == nil {
+		return fmt.Errorf("%s: %w", installDir, sympierr.ErrFileExists)
+	}
+	target, err := filepath.EvalSymlinks(targetDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", targetDir, err)
+	}
+	return os.Symlink(target, installDir)
 }
 
-func loadMPI(id string) error {
-	// We can change the env multiple times during the execution of a single command
-	// and these modifications will NOT be reflected in the actual environment until
-	// we exit the command and let bash do some magic to update it. Fortunately, we
-	// know that we can have one and only one MPI in the environment of a single time
-	// so when we load a MPI, we make sure that we remove a previous load changes.
-	cleanedPath, cleanedLDLIB := getCleanedUpMPIEnvVars()
+// getMPIInstallLinks returns the MPI installs that are links to a directory
+func getMPIInstallLinks(dir string) ([]string, error) {
+	var links []string
 
-	implem, ver := getMPIDetails(id)
-	if implem == "" || ver == "" {
-		fmt.Println("invalid installation of MPI, execute 'sympi -list' to get the list of available installations")
-		return nil
+	target, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
 	}
+	installs, err := getAllHostMPIInstalls()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range installs {
+		if i.Target != "" && i.Dir != dir && filepath.Clean(i.Target) == target {
+			links = append(links, i.ID)
+		}
+	}
+	return links, nil
+}
 
-	sympiDir := sys.GetSympiDir()
-	mpiBaseDir := filepath.Join(sympiDir, sys.MPIInstallDirPrefix+implem+"-"+ver)
-	mpiBinDir := filepath.Join(mpiBaseDir, "bin")
-	mpiLibDir := filepath.Join(mpiBaseDir, "lib")
-
-	path := strings.Join(cleanedPath, ":")
-	ldlib := strings.Join(cleanedLDLIB, ":")
-	path = mpiBinDir + ":" + path
-	ldlib = mpiLibDir + ":" + ldlib
+// findDuplicateMPIInstall returns the directory of an installed version of a MPI built from the
+// same source than another version, e.g., when two versions are aliases (empty if none)
+func findDuplicateMPIInstall(mpiCfg *implem.Info, kvs []kv.KV) string {
+	installs, err := getAllHostMPIInstalls()
+	if err != nil {
+		return ""
+	}
+	for _, i := range installs {
+		id, version := getMPIDetails(i.ID)
+		if i.System || id != mpiCfg.ID || version == mpiCfg.Version {
+			continue
+		}
+		// Variants are built differently than the versions they are based on
+		if _, variant := implem.SplitVariant(version); variant != "" {
+			continue
+		}
+		var installed implem.Info
+		installed.SetURLs(kv.GetValue(kvs, version))
+		if installed.URL == mpiCfg.URL {
+			return i.Dir
+		}
+	}
+	return ""
+}
 
-	file, err := getEnvFile()
-	if err != nil || !util.FileExists(file) {
-		return fmt.Errorf("file %s does not exist", file)
+// registerMPI makes a MPI installed outside of sympi, e.g., by a package manager, available
+// like the MPI installed by sympi, without installing it again. The MPI can also be another
+// installed version, e.g., to use a different name for it.
+func registerMPI(id string, dir string) error {
+	mpiID, version := getMPIDetails(id)
+	if mpiID == "" || version == "" {
+		return fmt.Errorf("invalid MPI %s, it should be of the form <implementation>:<version>, e.g., openmpi:4.0.2", id)
+	}
+	_, variant := implem.SplitVariant(version)
+	if err := implem.CheckVariant(variant); err != nil {
+		return err
 	}
 
-	err = updateEnvFile(file, path, ldlib)
+	if !strings.Contains(dir, string(filepath.Separator)) {
+		if installDir, err := getHostMPIInstallDir(dir); err == nil {
+			dir = installDir
+		}
+	}
+	mpiDir, err := filepath.Abs(dir)
 	if err != nil {
-		return fmt.Errorf("failed to update %s: %s", file, err)
+		return fmt.Errorf("invalid directory %s: %w", dir, err)
+	}
+	if !util.FileExists(filepath.Join(mpiDir, "bin", "mpirun")) && !util.FileExists(filepath.Join(mpiDir, "bin", "mpiexec")) {
+		return fmt.Errorf("%s does not seem to be a MPI installation, neither bin/mpirun nor bin/mpiexec exists", mpiDir)
 	}
 
+	installDir := filepath.Join(sys.GetSympiDir(), sys.MPIInstallDirPrefix+mpiID+"-"+version)
+	err = linkMPIInstall(installDir, mpiDir)
+	if err != nil {
+		return fmt.Errorf("failed to register %s: %w", mpiDir, err)
+	}
 	return nil
 }
 
-func loadSingularity(id string) error {
+// loadMPI updates the environment of the session to use a MPI, its directories being added
+// to PATH and LD_LIBRARY_PATH in a given order
+func loadMPI(id string, order string) error {
 	// We can change the env multiple times during the execution of a single command
 	// and these modifications will NOT be reflected in the actual environment until
 	// we exit the command and let bash do some magic to update it. Fortunately, we
-	// know that we can have one and only one Singularity in the environment of a
-	// single time so when we load a specific version of Singularity, we make sure
-	// that we remove a previous load changes.
-	cleanedPath, cleanedLDLIB := getCleanedUpSyEnvVars()
-
-	ver := getSyDetails(id)
-	if ver == "" {
-		fmt.Println("invalid installation of MPI, execute 'sympi -list' to get the list of available installations")
+	// know that we can have one and only one MPI loaded by default at a single time
+	// so when we load a MPI, we make sure that we remove the entries of the previous one.
+	implem, ver := getMPIDetails(id)
+	if implem == "" || ver == "" {
+		fmt.Fprintln(os.Stderr, "invalid installation of MPI, execute 'sympi -list' to get the list of available installations")
 		return nil
 	}
 
-	sympiDir := sys.GetSympiDir()
-	syBaseDir := filepath.Join(sympiDir, sys.SingularityInstallDirPrefix+ver)
-	syBinDir := filepath.Join(syBaseDir, "bin")
-	syLibDir := filepath.Join(syBaseDir, "lib")
-
-	path := strings.Join(cleanedPath, ":")
-	ldlib := strings.Join(cleanedLDLIB, ":")
-	path = syBinDir + ":" + path
-	ldlib = syLibDir + ":" + ldlib
-
-	file, err := getEnvFile()
-	if err != nil || !util.FileExists(file) {
-		return fmt.Errorf("file %s does not exist", file)
+	mpiBaseDir, err := getHostMPIInstallDir(implem + ":" + ver)
+	if err != nil {
+		return err
 	}
+	return loadSoftware(session.MPIDirEnv, getLoadedMPIDir(), mpiBaseDir, order)
+}
 
-	err = updateEnvFile(file, path, ldlib)
+// loadNamespacedMPI updates the environment of the session to use a MPI in a namespace, in
+// addition to the other MPIs, its directories being added to PATH and LD_LIBRARY_PATH in a given
+// order. The MPI previously loaded in the same namespace, if any, is replaced.
+func loadNamespacedMPI(id string, namespace string, order string) error {
+	err := session.CheckNamespace(namespace)
 	if err != nil {
-		return fmt.Errorf("failed to update %s: %s", file, err)
+		return err
 	}
-
-	return nil
+	mpiID, ver := getMPIDetails(id)
+	if mpiID == "" || ver == "" {
+		return fmt.Errorf("invalid MPI %s, execute 'sympi -list' to get the list of available installations", id)
+	}
+	mpiBaseDir, err := getHostMPIInstallDir(mpiID + ":" + ver)
+	if err != nil {
+		return err
+	}
+	env := session.GetNamespaceEnv(namespace)
+	return loadSoftware(env, os.Getenv(env), mpiBaseDir, order)
 }
 
-func updateEnv(newPath []string, newLDLIB []string) error {
-	// Sanity checks
-	if len(newPath) == 0 {
-		return fmt.Errorf("new PATH is empty")
+// unloadNamespacedMPI removes the MPI loaded in a namespace from the environment of the session,
+// the other MPIs being left untouched
+func unloadNamespacedMPI(namespace string) error {
+	env := session.GetNamespaceEnv(namespace)
+	dir := os.Getenv(env)
+	if dir == "" {
+		return fmt.Errorf("no MPI loaded in namespace %s", namespace)
 	}
+	return unloadSoftware(env, dir)
+}
 
-	file, err := getEnvFile()
-	if err != nil || !util.FileExists(file) {
-		return fmt.Errorf("file %s does not exist", file)
-	}
-	err = updateEnvFile(file, strings.Join(newPath, ":"), strings.Join(newLDLIB, ":"))
-	if err != nil {
-		return fmt.Errorf("failed to update %s: %s", file, err)
+// loadSingularity updates the environment of the session to use a version of Singularity, its
+// directories being added to PATH and LD_LIBRARY_PATH in a given order
+func loadSingularity(id string, order string) error {
+	// Like for MPI, only one Singularity can be loaded at a single time so the entries of the
+	// previous one are removed.
+	ver := getSyDetails(id)
+	if ver == "" {
+		fmt.Fprintln(os.Stderr, "invalid installation of MPI, execute 'sympi -list' to get the list of available installations")
+		return nil
 	}
 
-	return nil
+	syBaseDir := filepath.Join(sys.GetSympiDir(), sys.SingularityInstallDirPrefix+ver)
+	return loadSoftware(session.SingularityDirEnv, getLoadedSingularityDir(), syBaseDir, order)
 }
 
 func unloadSingularity() error {
-	newPath, newLDLIB := getCleanedUpSyEnvVars()
-
-	return updateEnv(newPath, newLDLIB)
+	return unloadSoftware(session.SingularityDirEnv, getLoadedSingularityDir())
 }
 
 func unloadMPI() error {
-	newPath, newLDLIB := getCleanedUpMPIEnvVars()
+	return unloadSoftware(session.MPIDirEnv, getLoadedMPIDir())
+}
+
+// stateLock is the lock of the sympi directory held by sympi, stateLockDepth the number of
+// nested lockState calls holding it
+var (
+	stateLock      *lock.Lock
+	stateLockDepth int
+)
+
+// lockState gets the lock protecting the state of the sympi directory, i.e., the installs, the
+// environment files and the results of the runs, and returns the function releasing it. Calls
+// can be nested, e.g., an install triggered by a run. Without wait, sympierr.ErrLocked is
+// returned right away if another process holds the lock. A sympi directory that is not
+// writable, e.g., managed by administrators, cannot be locked nor modified: read-only
+// operations such as loads and runs do not need the lock, and the operations modifying it
+// fail on their own writability check.
+func lockState(wait bool) (func(), error) {
+	if stateLockDepth > 0 {
+		stateLockDepth++
+		return releaseState, nil
+	}
+	if sys.CheckSympiDirWritable() != nil {
+		log.Printf("* %s is not writable, it is not locked", sys.GetSympiDir())
+		return func() {}, nil
+	}
+
+	timeout := time.Duration(0)
+	if wait {
+		timeout = lock.DefaultTimeout
+	}
+	l, err := lock.Acquire(sys.GetSympiDir(), timeout, func() {
+		infoLog.Printf("%s, waiting...\n", sympierr.ErrLocked)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stateLock = l
+	stateLockDepth = 1
+	return releaseState, nil
+}
 
-	return updateEnv(newPath, newLDLIB)
+// releaseState releases the lock got with lockState once all the nested calls are done
+func releaseState() {
+	stateLockDepth--
+	if stateLockDepth > 0 {
+		return
+	}
+	err := stateLock.Release()
+	if err != nil {
+		log.Printf("[WARN] %s", err)
+	}
+	stateLock = nil
 }
 
 func getDefaultSysConfig() sys.Config {
@@ -395,193 +856,1683 @@ func getDefaultSysConfig() sys.Config {
 	return sysCfg
 }
 
-func uninstallMPIfromHost(mpiDesc string, sysCfg *sys.Config) error {
-	var mpiCfg implem.Info
-	mpiCfg.ID, mpiCfg.Version = getMPIDetails(mpiDesc)
+// isInteractive checks whether the standard input is a terminal the user can answer questions from
+func isInteractive() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
 
-	var buildEnv buildenv.Info
-	err := buildenv.CreateDefaultHostEnvCfg(&buildEnv, &mpiCfg, sysCfg)
+// errNotConfirmed is the error returned when the user does not confirm a destructive action
+var errNotConfirmed = errors.New("action not confirmed")
+
+// confirmAction asks the user to confirm a destructive action, e.g., "uninstall openmpi:4.0.2",
+// unless assumeYes is set. Without terminal to ask the question, the action is refused so
+// scripts neither hang nor destroy anything by accident.
+func confirmAction(action string, assumeYes bool) error {
+	if assumeYes {
+		return nil
+	}
+	if !isInteractive() {
+		return fmt.Errorf("%s requires a confirmation, use -y to proceed without it", action)
+	}
+	ok, err := prompt.New(os.Stdin, os.Stdout).Confirm(fmt.Sprintf("Do you really want to %s?", action), false)
 	if err != nil {
-		return fmt.Errorf("failed to set host build environment: %s", err)
+		return err
 	}
+	if !ok {
+		return errNotConfirmed
+	}
+	return nil
+}
 
-	b, err := builder.Load(&mpiCfg)
+// checkMPIDependents warns on w about the installed containers running with a host MPI that is
+// about to be uninstalled and returns an error, unless forced, if some of them would be left
+// without any compatible MPI
+func checkMPIDependents(w io.Writer, hostMPI implem.Info, force bool, sysCfg *sys.Config) error {
+	mpiDesc := hostMPI.ID + ":" + hostMPI.Version
+	dependents, err := getMPIDependents(hostMPI, sysCfg)
 	if err != nil {
-		return fmt.Errorf("failed to load a builder: %s", err)
+		return fmt.Errorf("unable to check the containers relying on %s: %w", mpiDesc, err)
 	}
-
-	execRes := b.UninstallHost(&mpiCfg, &buildEnv, sysCfg)
-	if execRes.Err != nil {
-		return fmt.Errorf("failed to install MPI on the host: %s", execRes.Err)
+	var broken []string
+	for _, d := range dependents {
+		if d.fallback.ID != "" {
+			fmt.Fprintf(w, "[WARN] %s (%s %s) runs with %s, it will run with %s %s instead\n", d.name, d.containerMPI.ID, d.containerMPI.Version, mpiDesc, d.fallback.ID, d.fallback.Version)
+			continue
+		}
+		fmt.Fprintf(w, "[WARN] %s (%s %s) runs with %s, no other installed MPI is compatible with it\n", d.name, d.containerMPI.ID, d.containerMPI.Version, mpiDesc)
+		broken = append(broken, d.name)
+	}
+	if len(broken) > 0 && !force {
+		return fmt.Errorf("%s is required by %s, use -force to uninstall it anyway", mpiDesc, strings.Join(broken, ", "))
 	}
-
 	return nil
 }
 
-func installMPIonHost(mpiDesc string, sysCfg *sys.Config) error {
+func uninstallMPIfromHost(mpiDesc string, force bool, sysCfg *sys.Config) error {
+	err := sys.CheckSympiDirWritable()
+	if err != nil {
+		return err
+	}
+
 	var mpiCfg implem.Info
 	mpiCfg.ID, mpiCfg.Version = getMPIDetails(mpiDesc)
 
-	sysCfg.ScratchDir = buildenv.GetDefaultScratchDir(&mpiCfg)
-	// When installing a MPI with sympi, we are always in persistent mode
-	sysCfg.Persistent = sys.GetSympiDir()
-
-	err := util.DirInit(sysCfg.ScratchDir)
+	// Containers relying on the MPI would otherwise only break at their next run
+	err = checkMPIDependents(os.Stderr, mpiCfg, force, sysCfg)
 	if err != nil {
-		return fmt.Errorf("unable to initialize scratch directory %s: %s", sysCfg.ScratchDir, err)
+		return err
 	}
-	defer os.RemoveAll(sysCfg.ScratchDir)
 
-	mpiConfigFile := mpi.GetMPIConfigFile(mpiCfg.ID, sysCfg)
-	kvs, err := kv.LoadKeyValueConfig(mpiConfigFile)
-	if err != nil {
-		return fmt.Errorf("unable to load configuration file %s: %s", mpiConfigFile, err)
+	// Links are simply removed, the installation they point to is left untouched; an installation
+	// cannot be removed while other versions link to it
+	installDir := filepath.Join(sys.GetSympiDir(), sys.MPIInstallDirPrefix+mpiCfg.ID+"-"+mpiCfg.Version)
+	if fi, err := os.Lstat(installDir); err == nil {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return os.Remove(installDir)
+		}
+		links, err := getMPIInstallLinks(installDir)
+		if err != nil {
+			return err
+		}
+		if len(links) > 0 {
+			return fmt.Errorf("%s is used by %s, uninstall them first", mpiDesc, strings.Join(links, ", "))
+		}
 	}
-	mpiCfg.URL = kv.GetValue(kvs, mpiCfg.Version)
 
-	b, err := builder.Load(&mpiCfg)
+	var buildEnv buildenv.Info
+	err = buildenv.CreateDefaultHostEnvCfg(&buildEnv, &mpiCfg, sysCfg)
 	if err != nil {
-		return fmt.Errorf("failed to load a builder: %s", err)
+		return fmt.Errorf("failed to set host build environment: %w", err)
 	}
 
-	var buildEnv buildenv.Info
-	err = buildenv.CreateDefaultHostEnvCfg(&buildEnv, &mpiCfg, sysCfg)
+	b, err := builder.Load(&mpiCfg)
 	if err != nil {
-		return fmt.Errorf("failed to set host build environment: %s", err)
+		return fmt.Errorf("failed to load a builder: %w", err)
 	}
-	defer os.RemoveAll(buildEnv.BuildDir)
 
-	execRes := b.InstallOnHost(&mpiCfg, &buildEnv, sysCfg)
+	execRes := b.UninstallHost(&mpiCfg, &buildEnv, sysCfg)
 	if execRes.Err != nil {
-		return fmt.Errorf("failed to install MPI on the host: %s", execRes.Err)
+		return fmt.Errorf("failed to install MPI on the host: %w", execRes.Err)
 	}
 
 	return nil
 }
 
-func findCompatibleMPI(targetMPI implem.Info) (implem.Info, error) {
-	var mpi implem.Info
-	mpi.ID = targetMPI.ID
-
-	entries, err := ioutil.ReadDir(sys.GetSympiDir())
+// removeMPIInstall removes the installation directory of a MPI, e.g., before rebuilding it. Links
+// are removed without touching the installation they point to and an installation other versions
+// link to is not removed.
+func removeMPIInstall(installDir string) error {
+	fi, err := os.Lstat(installDir)
 	if err != nil {
-		return mpi, fmt.Errorf("failed to read %s: %s", sys.GetSympiDir(), err)
+		return fmt.Errorf("failed to access %s: %w", installDir, err)
 	}
-
-	hostInstalls, err := getHostMPIInstalls(entries)
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(installDir)
+	}
+	links, err := getMPIInstallLinks(installDir)
+	if err != nil {
+		return err
+	}
+	if len(links) > 0 {
+		return fmt.Errorf("%s is used by %s, uninstall them first", installDir, strings.Join(links, ", "))
+	}
+	return os.RemoveAll(installDir)
+}
+
+func installMPIonHost(ctx context.Context, mpiDesc string, sysCfg *sys.Config) error {
+	// Checked first so installs do not fail mid-way with permission errors from the builder
+	err := sys.CheckSympiDirWritable()
+	if err != nil {
+		return err
+	}
+
+	var mpiCfg implem.Info
+	mpiCfg.ID, mpiCfg.Version = getMPIDetails(mpiDesc)
+
+	sysCfg.ScratchDir = buildenv.GetDefaultScratchDir(&mpiCfg, sysCfg)
+	// When installing a MPI with sympi, we are always in persistent mode
+	sysCfg.Persistent = sys.GetSympiDir()
+
+	err = util.DirInit(sysCfg.ScratchDir)
+	if err != nil {
+		return fmt.Errorf("unable to initialize scratch directory %s: %w", sysCfg.ScratchDir, err)
+	}
+	defer os.RemoveAll(sysCfg.ScratchDir)
+
+	mpiConfigFile := mpi.GetMPIConfigFile(mpiCfg.ID, sysCfg)
+	kvs, err := mpi.LoadMPIConfig(ctx, mpiCfg.ID, sysCfg)
+	if err != nil {
+		return fmt.Errorf("unable to load the configuration of %s: %w", mpiCfg.ID, err)
+	}
+	// A variant, e.g., openmpi:4.1.4+gcc11, is built from the source of its version but installed separately
+	version, variant := implem.SplitVariant(mpiCfg.Version)
+	err = implem.CheckVariant(variant)
+	if err != nil {
+		return err
+	}
+	mpiCfg.SetURLs(kv.GetValue(kvs, version))
+	if mpiCfg.URL == "" {
+		return fmt.Errorf("%s %s is not listed in the configuration of %s (%s): %w", mpiCfg.ID, version, mpiCfg.ID, mpiConfigFile, sympierr.ErrVersionNotFound)
+	}
+
+	// Debug builds are installed as a variant so they coexist with the optimized builds
+	if sysCfg.DebugBuild {
+		if mpiCfg.ID == implem.IMPI {
+			return fmt.Errorf("%s is distributed as binaries, it cannot be built with debug symbols", mpiCfg.ID)
+		}
+		mpiCfg.Version = implem.GetDebugVersion(mpiCfg.Version)
+		infoLog.Printf("Building %s with debug symbols, it will be available as %s:%s\n", mpiDesc, mpiCfg.ID, mpiCfg.Version)
+	}
+
+	// Versions built from the same source share the same installation, unless they are built differently
+	installDir := filepath.Join(sys.GetSympiDir(), sys.MPIInstallDirPrefix+mpiCfg.ID+"-"+mpiCfg.Version)
+	if dupDir := findDuplicateMPIInstall(&mpiCfg, kvs); dupDir != "" && !sysCfg.DebugBuild && variant == "" && !util.PathExists(installDir) {
+		infoLog.Printf("%s %s has the same source than %s, linking to it\n", mpiCfg.ID, mpiCfg.Version, dupDir)
+		return linkMPIInstall(installDir, dupDir)
+	}
+
+	// Repeated installs are a fast no-op, e.g., when provisioning from a lockfile
+	complete := provenance.IsComplete(installDir)
+	if complete && !sysCfg.ForceReinstall {
+		return fmt.Errorf("%s %s is installed in %s: %w", mpiCfg.ID, mpiCfg.Version, installDir, sympierr.ErrAlreadyInstalled)
+	}
+	// Whatever is in the installation directory, e.g., a corrupted build or the leftovers of an
+	// interrupted install, is removed so the new installation starts from scratch
+	if _, err := os.Lstat(installDir); err == nil {
+		if complete {
+			infoLog.Printf("Removing the existing installation of %s %s\n", mpiCfg.ID, mpiCfg.Version)
+		} else {
+			infoLog.Printf("Removing the incomplete installation of %s %s\n", mpiCfg.ID, mpiCfg.Version)
+		}
+		err = removeMPIInstall(installDir)
+		if err != nil {
+			return fmt.Errorf("failed to remove the existing installation: %w", err)
+		}
+	}
+
+	b, err := builder.Load(&mpiCfg)
+	if err != nil {
+		return fmt.Errorf("failed to load a builder: %w", err)
+	}
+	b.Progress = func(msg string) {
+		infoLog.Printf("\t%s\n", msg)
+	}
+
+	var buildEnv buildenv.Info
+	err = buildenv.CreateDefaultHostEnvCfg(&buildEnv, &mpiCfg, sysCfg)
+	if err != nil {
+		return fmt.Errorf("failed to set host build environment: %w", err)
+	}
+	defer os.RemoveAll(buildEnv.BuildDir)
+
+	infoLog.Printf("Installing %s %s in %s\n", mpiCfg.ID, mpiCfg.Version, buildEnv.InstallDir)
+	execRes := b.InstallOnHost(ctx, &mpiCfg, &buildEnv, sysCfg)
+	if execRes.Err != nil {
+		return fmt.Errorf("failed to install MPI on the host: %w", execRes.Err)
+	}
+
+	if sysCfg.VerifyInstall {
+		return verifyMPIInstall(ctx, &mpiCfg, &buildEnv, sysCfg)
+	}
+
+	return nil
+}
+
+// verifyMPIInstall compiles and runs a smoke test against a MPI that was just installed on the
+// host and records the result in its provenance. A MPI failing the test is uninstalled if
+// sysCfg.RollbackUnverified is set.
+func verifyMPIInstall(ctx context.Context, mpiCfg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) error {
+	infoLog.Printf("Verifying %s %s with a %d-rank smoke test\n", mpiCfg.ID, mpiCfg.Version, smoketest.NP)
+	err := smoketest.Run(ctx, mpiCfg, env, sysCfg)
+	if err != nil {
+		if !sysCfg.RollbackUnverified {
+			return fmt.Errorf("%s %s is installed but failed the smoke test: %w", mpiCfg.ID, mpiCfg.Version, err)
+		}
+		// The MPI was just installed and does not work, nothing can rely on it
+		uninstallErr := uninstallMPIfromHost(mpiCfg.ID+":"+mpiCfg.Version, true, sysCfg)
+		if uninstallErr != nil {
+			return fmt.Errorf("%s %s failed the smoke test (%s) and cannot be uninstalled: %w", mpiCfg.ID, mpiCfg.Version, err, uninstallErr)
+		}
+		return fmt.Errorf("%s %s failed the smoke test and was uninstalled: %w", mpiCfg.ID, mpiCfg.Version, err)
+	}
+
+	p, err := provenance.Load(env.InstallDir)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		p = &provenance.Provenance{ID: mpiCfg.ID, Version: mpiCfg.Version}
+	}
+	p.Verified = true
+	err = provenance.Write(env.InstallDir, p)
+	if err != nil {
+		return fmt.Errorf("failed to record the result of the smoke test: %w", err)
+	}
+	infoLog.Printf("%s %s passed the smoke test\n", mpiCfg.ID, mpiCfg.Version)
+	return nil
+}
+
+// getHostMPIs returns the MPIs installed on the host; the same version may be installed in both
+// the user and system-wide directories, it is returned only once
+func getHostMPIs() ([]implem.Info, error) {
+	hostInstalls, err := getAllHostMPIInstalls()
 	if err != nil {
-		return mpi, fmt.Errorf("unable to get the install of MPIs installed on the host: %s", err)
+		return nil, fmt.Errorf("unable to get the install of MPIs installed on the host: %w", err)
 	}
 
-	versionDetails := strings.Split(targetMPI.Version, ".")
-	major := versionDetails[0]
-	ver := ""
+	var hostMPIs []implem.Info
+	seen := make(map[string]bool)
 	for _, entry := range hostInstalls {
-		tokens := strings.Split(entry, ":")
-		if tokens[0] == targetMPI.ID {
-			if tokens[1] == targetMPI.Version {
-				// We have the exact version available
-				mpi.Version = tokens[1]
-				return mpi, nil
-			}
-			if ver == "" {
-				t := strings.Split(tokens[1], ".")
-				if t[0] >= major && ver == "" {
-					// At first we accept any version from the same major release
-					ver = tokens[1]
-				}
-			} else {
-				if ver < tokens[1] {
-					ver = tokens[1]
-				}
+		tokens := strings.Split(entry.ID, ":")
+		if len(tokens) != 2 || seen[entry.ID] {
+			continue
+		}
+		seen[entry.ID] = true
+		hostMPIs = append(hostMPIs, implem.Info{ID: tokens[0], Version: tokens[1]})
+	}
+	return hostMPIs, nil
+}
+
+// matchHostMPI selects the host MPI to use with a container using a given MPI
+func matchHostMPI(targetMPI implem.Info, sysCfg *sys.Config) (mpi.MatchResult, error) {
+	hostMPIs, err := getHostMPIs()
+	if err != nil {
+		return mpi.MatchResult{Target: targetMPI}, err
+	}
+	return mpi.MatchHostMPI(targetMPI, hostMPIs, sysCfg.MPICompatPolicy), nil
+}
+
+// mpiDependent is an installed container running with a given host MPI
+type mpiDependent struct {
+	// name is the name of the container
+	name string
+
+	// containerMPI is the MPI of the container
+	containerMPI implem.Info
+
+	// fallback is the host MPI the container runs with once the MPI is uninstalled, its ID
+	// being empty if no other installed MPI is compatible
+	fallback implem.Info
+}
+
+// getMPIDependents returns the installed containers that run with a host MPI, i.e., for which it
+// is the compatible MPI selected by the compatibility policy, and the host MPI each of them would
+// run with if it was uninstalled
+func getMPIDependents(hostMPI implem.Info, sysCfg *sys.Config) ([]mpiDependent, error) {
+	hostMPIs, err := getHostMPIs()
+	if err != nil {
+		return nil, err
+	}
+	var others []implem.Info
+	for _, m := range hostMPIs {
+		if m.ID != hostMPI.ID || m.Version != hostMPI.Version {
+			others = append(others, m)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(sys.GetSympiDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sys.GetSympiDir(), err)
+	}
+	containers, err := getContainerInstalls(entries)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the list of containers: %w", err)
+	}
+
+	var dependents []mpiDependent
+	for _, name := range containers {
+		imgPath := filepath.Join(sys.GetSympiDir(), sys.ContainerInstallDirPrefix+name, name+".sif")
+		_, containerMPI, err := container.GetMetadata(imgPath, sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] failed to extract the metadata of %s: %s\n", name, err)
+			continue
+		}
+		res := mpi.MatchHostMPI(containerMPI, hostMPIs, sysCfg.MPICompatPolicy)
+		if res.Rule == "" || res.Selected.ID != hostMPI.ID || res.Selected.Version != hostMPI.Version {
+			continue
+		}
+		d := mpiDependent{name: name, containerMPI: containerMPI}
+		if res = mpi.MatchHostMPI(containerMPI, others, sysCfg.MPICompatPolicy); res.Rule != "" {
+			d.fallback = res.Selected
+		}
+		dependents = append(dependents, d)
+	}
+	return dependents, nil
+}
+
+func findCompatibleMPI(targetMPI implem.Info, sysCfg *sys.Config) (implem.Info, error) {
+	res, err := matchHostMPI(targetMPI, sysCfg)
+	if err != nil {
+		return implem.Info{ID: targetMPI.ID}, err
+	}
+	log.Printf("* Selection of the host MPI:\n%s", res.Explain())
+
+	if res.Rule == "" {
+		return implem.Info{ID: targetMPI.ID}, fmt.Errorf("no compatible version of %s %s available with the %s policy: %w", targetMPI.ID, targetMPI.Version, res.Policy, sympierr.ErrIncompatibleMPI)
+	}
+	return res.Selected, nil
+}
+
+// displayProvenance displays how an installed MPI was built
+func displayProvenance(id string) error {
+	installDir, err := getHostMPIInstallDir(id)
+	if err != nil {
+		return err
+	}
+	p, err := provenance.Load(installDir)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("no provenance recorded in %s, %s was installed by a previous version of sympi or registered", installDir, id)
+	}
+	fmt.Print(p.Describe())
+	return nil
+}
+
+// displayBuildStats displays the durations of the builds of the installed MPI, recorded in
+// their provenance; links to other installations are skipped to not count their builds twice
+func displayBuildStats() error {
+	installs, err := getAllHostMPIInstalls()
+	if err != nil {
+		return err
+	}
+	var provs []*provenance.Provenance
+	for _, i := range installs {
+		if i.Target != "" {
+			continue
+		}
+		p, err := provenance.Load(i.Dir)
+		if err != nil {
+			return err
+		}
+		provs = append(provs, p)
+	}
+	return provenance.WriteBuildStats(os.Stdout, provs)
+}
+
+// diffMPI displays the differences between two installed MPI
+func diffMPI(ctx context.Context, idA string, idB string, sysCfg *sys.Config) error {
+	dirA, err := getHostMPIInstallDir(idA)
+	if err != nil {
+		return err
+	}
+	dirB, err := getHostMPIInstallDir(idB)
+	if err != nil {
+		return err
+	}
+	report, err := mpidiff.Compare(ctx, mpidiff.Install{ID: idA, Dir: dirA}, mpidiff.Install{ID: idB, Dir: dirB}, sysCfg)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report.Format())
+	return nil
+}
+
+// explainMatch displays how the host MPI to use with an installed container is selected
+func explainMatch(name string, sysCfg *sys.Config) error {
+	imgPath := filepath.Join(sys.GetSympiDir(), sys.ContainerInstallDirPrefix+name, name+".sif")
+	if !util.FileExists(imgPath) {
+		return fmt.Errorf("%s does not exist", imgPath)
+	}
+	_, containerMPI, err := container.GetMetadata(imgPath, sysCfg)
+	if err != nil {
+		return fmt.Errorf("failed to extract container's metadata: %w", err)
+	}
+
+	res, err := matchHostMPI(containerMPI, sysCfg)
+	if err != nil {
+		return err
+	}
+	fmt.Print(res.Explain())
+	return nil
+}
+
+// listCompatibleContainers displays the installed containers that can be run with a given host
+// MPI, i.e., whose MPI is compatible with it according to the compatibility policy
+func listCompatibleContainers(hostDesc string, sysCfg *sys.Config) error {
+	var hostMPI implem.Info
+	hostMPI.ID, hostMPI.Version = getMPIDetails(hostDesc)
+	if hostMPI.ID == "" || hostMPI.Version == "" {
+		return fmt.Errorf("invalid MPI %s, it should be of the form <implementation>:<version>, e.g., openmpi:4.1.4", hostDesc)
+	}
+
+	entries, err := ioutil.ReadDir(sys.GetSympiDir())
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", sys.GetSympiDir(), err)
+	}
+	containers, err := getContainerInstalls(entries)
+	if err != nil {
+		return fmt.Errorf("unable to get the list of containers: %w", err)
+	}
+
+	found := false
+	for _, name := range containers {
+		imgPath := filepath.Join(sys.GetSympiDir(), sys.ContainerInstallDirPrefix+name, name+".sif")
+		containerInfo, containerMPI, err := container.GetMetadata(imgPath, sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] failed to extract the metadata of %s: %s\n", name, err)
+			continue
+		}
+		c := mpi.CheckCompatibility(containerMPI, hostMPI, sysCfg.MPICompatPolicy)
+		if c.Rule == "" {
+			log.Printf("* %s (%s %s) is not compatible: %s", name, containerMPI.ID, containerMPI.Version, c.Reason)
+			continue
+		}
+		found = true
+		fmt.Printf("%s: %s %s, %s match, %s model\n", name, containerMPI.ID, containerMPI.Version, c.Rule, containerInfo.Model)
+	}
+	if !found {
+		infoLog.Printf("No installed container is compatible with %s %s with the %s policy\n", hostMPI.ID, hostMPI.Version, sysCfg.MPICompatPolicy)
+	}
+	return nil
+}
+
+// getContainer gathers all the details required to run a container installed by sympi,
+// based on its image and the options of the run spec
+func getContainer(spec *launcher.ContainerSpec, sysCfg *sys.Config) (container.Config, implem.Info, error) {
+	// Get the full path to the image
+	imgPath, err := getImagePath(spec.Name)
+	if err != nil {
+		return container.Config{}, implem.Info{}, err
+	}
+
+	// Inspect the image and extract the metadata
+	if sysCfg.SingularityBin == "" {
+		log.Fatalf("singularity bin not defined")
+	}
+
+	infoLog.Printf("Analyzing %s to figure out the correct configuration for execution...\n", imgPath)
+	containerInfo, containerMPI, err := container.GetMetadata(imgPath, sysCfg)
+	if err != nil {
+		return containerInfo, containerMPI, fmt.Errorf("failed to extract container's metadata: %w", err)
+	}
+
+	// Images built by other tools may not specify their application
+	if containerInfo.AppExe == "" && spec.AppExe == "" {
+		containerInfo.AppExe, err = container.DiscoverAppExe(&containerInfo, sysCfg)
+		if err != nil {
+			return containerInfo, containerMPI, fmt.Errorf("unable to find the application to start: %w", err)
+		}
+		infoLog.Printf("Starting %s, found in the runscript of the image\n", containerInfo.AppExe)
+	}
+
+	containerInfo.Binds = spec.Binds
+	containerInfo.Env = spec.Env
+	containerInfo.GPU = sysCfg.GPU
+	if containerInfo.GPU == "" {
+		containerInfo.GPU = container.DetectGPU()
+	}
+
+	if spec.WorkDir != "" {
+		err = container.CheckDir(&containerInfo, spec.WorkDir, sysCfg)
+		if err != nil {
+			return containerInfo, containerMPI, fmt.Errorf("invalid working directory: %w", err)
+		}
+	}
+
+	return containerInfo, containerMPI, nil
+}
+
+// getImagePath returns the path to the image of a container. name is either the name of an
+// installed container or the path to an image, e.g., ~/images/helloworld.sif, which is then
+// used directly without being installed.
+func getImagePath(name string) (string, error) {
+	if fi, err := os.Stat(name); err == nil && !fi.IsDir() {
+		return filepath.Abs(name)
+	}
+	if strings.ContainsRune(name, filepath.Separator) || filepath.Ext(name) == ".sif" {
+		return "", fmt.Errorf("%s does not exist", name)
+	}
+
+	imgPath := filepath.Join(sys.GetSympiDir(), sys.ContainerInstallDirPrefix+name, name+".sif")
+	if !util.FileExists(imgPath) {
+		return "", fmt.Errorf("%s does not exist", imgPath)
+	}
+	return imgPath, nil
+}
+
+// checkGlibc makes sure that a MPI from the host can be bind-mounted in the container, i.e.,
+// that the host glibc is not more recent than the container's
+func checkGlibc(c *container.Config, sysCfg *sys.Config) error {
+	hostVersion, err := checker.GetHostGlibcVersion(sysCfg)
+	if err != nil {
+		log.Printf("[WARN] unable to check glibc compatibility: %s", err)
+		return nil
+	}
+	containerVersion, err := container.GetGlibcVersion(c, sysCfg)
+	if err != nil {
+		log.Printf("[WARN] unable to check glibc compatibility: %s", err)
+		return nil
+	}
+
+	res, err := checker.CompareGlibcVersions(hostVersion, containerVersion)
+	if err != nil {
+		log.Printf("[WARN] unable to check glibc compatibility: %s", err)
+		return nil
+	}
+	if res > 0 {
+		fmt.Fprintf(os.Stderr, "The host uses glibc %s while %s uses glibc %s: the MPI from the host cannot be bind-mounted in the container, please use a container in hybrid mode instead, or -skip-glibc-check if the host MPI is known to work with it\n", hostVersion, c.Path, containerVersion)
+		return fmt.Errorf("glibc %s on the host, %s in %s: %w", hostVersion, containerVersion, c.Path, sympierr.ErrGlibcMismatch)
+	}
+
+	return nil
+}
+
+// checkCompositionGlibc checks the glibc of all the bind-mode containers of a run, i.e., of the
+// primary container and of the auxiliary ones, unless the check is disabled with -skip-glibc-check
+func checkCompositionGlibc(containers []*container.Config, sysCfg *sys.Config) error {
+	for _, c := range containers {
+		if c.Model != container.BindModel {
+			continue
+		}
+		if sysCfg.SkipGlibcCheck {
+			log.Printf("[WARN] glibc compatibility of %s not checked", c.Path)
+			continue
+		}
+		err := checkGlibc(c, sysCfg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupHostMPI selects the host MPI to use with a container, installing the MPI of the container
+// when no compatible MPI is installed, loads it and returns its build environment; the auxiliary
+// containers started with it, if any, are checked as well. The selected host MPI is returned even
+// if it cannot be set up.
+func setupHostMPI(ctx context.Context, spec *launcher.ContainerSpec, containerInfo *container.Config, containerMPI implem.Info, sysCfg *sys.Config, aux ...*container.Config) (hostMPI implem.Info, hostBuildEnv buildenv.Info, err error) {
+	// The MPI may be installed and is loaded in the environment file, the lock is released
+	// before the container is started
+	release, err := lockState(true)
+	if err != nil {
+		return hostMPI, hostBuildEnv, err
+	}
+	defer release()
+
+	if spec.HostMPI != "" {
+		// The host MPI was selected by the user, it must be installed
+		hostMPI.ID, hostMPI.Version = getMPIDetails(spec.HostMPI)
+		infoLog.Printf("Using %s %s on the host\n", hostMPI.ID, hostMPI.Version)
+	} else {
+		infoLog.Println("Looking for available compatible version...")
+		hostMPI, err = findCompatibleMPI(containerMPI, sysCfg)
+		if err != nil && sysCfg.NoAutoInstall {
+			return implem.Info{}, hostBuildEnv, fmt.Errorf("%s %s, or a compatible version, must be installed on the host, e.g., with sympi -install %s:%s: %w", containerMPI.ID, containerMPI.Version, containerMPI.ID, containerMPI.Version, err)
+		}
+		if err != nil {
+			infoLog.Printf("No compatible MPI found on the host, installing %s %s, the MPI of the container\n", containerMPI.ID, containerMPI.Version)
+			err := installMPIonHost(ctx, containerMPI.ID+"-"+containerMPI.Version, sysCfg)
+			if err != nil {
+				return implem.Info{}, hostBuildEnv, fmt.Errorf("failed to install %s %s: %w", containerMPI.ID, containerMPI.Version, err)
 			}
+			hostMPI.ID = containerMPI.ID
+			hostMPI.Version = containerMPI.Version
+		} else {
+			infoLog.Printf("%s %s was found on the host as a compatible version\n", hostMPI.ID, hostMPI.Version)
+		}
+	}
+
+	infoLog.Printf("Container is in %s mode\n", containerInfo.Model)
+	switch containerInfo.Model {
+	case container.BindModel:
+		infoLog.Printf("Binding/mounting %s %s on host -> %s\n", hostMPI.ID, hostMPI.Version, containerInfo.MPIDir)
+	case container.UnknownModel:
+		// Images not created by our tools do not specify a model, MPI must then be in the container
+		log.Printf("[WARN] %s does not specify a MPI model, assuming the %s model", containerInfo.Path, container.HybridModel)
+	}
+	err = checkCompositionGlibc(append([]*container.Config{containerInfo}, aux...), sysCfg)
+	if err != nil {
+		return hostMPI, hostBuildEnv, err
+	}
+
+	err = loadMPI(hostMPI.ID+":"+hostMPI.Version, sysCfg.PathOrder)
+	if err != nil {
+		return hostMPI, hostBuildEnv, fmt.Errorf("failed to load MPI %s %s on host: %w", hostMPI.ID, hostMPI.Version, err)
+	}
+
+	err = buildenv.CreateDefaultHostEnvCfg(&hostBuildEnv, &hostMPI, sysCfg)
+	if err != nil {
+		return hostMPI, hostBuildEnv, fmt.Errorf("failed to set host build environment: %w", err)
+	}
+	// The MPI may be installed system-wide
+	hostBuildEnv.InstallDir, err = getHostMPIInstallDir(hostMPI.ID + ":" + hostMPI.Version)
+	if err != nil {
+		return hostMPI, hostBuildEnv, err
+	}
+	return hostMPI, hostBuildEnv, nil
+}
+
+// checkBoundMPI checks before running a bind-mode container that the dependencies of the host
+// MPI can be found in the container. Missing libraries available on the host can be bound in
+// the container, which is offered to the user unless it is requested with -bind-missing-libs.
+func checkBoundMPI(ctx context.Context, hostMPI *implem.Info, hostBuildEnv *buildenv.Info, containerInfo *container.Config, sysCfg *sys.Config) error {
+	res, err := mpi.ProbeBoundMPI(ctx, hostMPI, hostBuildEnv, containerInfo, sysCfg)
+	if err != nil {
+		// Not being able to probe, e.g., without ldd in the image, does not mean the run fails
+		log.Printf("[WARN] failed to probe %s %s in %s: %s", hostMPI.ID, hostMPI.Version, containerInfo.Path, err)
+		return nil
+	}
+	if len(res.Missing) == 0 {
+		return nil
+	}
+
+	var unresolved []string
+	for _, lib := range res.Missing {
+		if _, ok := res.HostPaths[lib]; !ok {
+			unresolved = append(unresolved, lib)
+		}
+	}
+	if len(unresolved) > 0 {
+		return fmt.Errorf("%s %s depends on %s, which cannot be found in %s nor on the host; install them in the image", hostMPI.ID, hostMPI.Version, strings.Join(unresolved, ", "), containerInfo.Path)
+	}
+
+	binds := mpi.GetHostLibBinds(res.HostPaths)
+	fmt.Fprintf(os.Stderr, "[WARN] %s %s depends on %s, which cannot be found in %s\n", hostMPI.ID, hostMPI.Version, strings.Join(res.Missing, ", "), containerInfo.Path)
+	if !sysCfg.BindMissingLibs {
+		if !isInteractive() {
+			return fmt.Errorf("libraries of the host MPI are missing in %s, use -bind-missing-libs to bind them from the host", containerInfo.Path)
+		}
+		ok, err := prompt.New(os.Stdin, os.Stdout).Confirm(fmt.Sprintf("Bind %s from the host in the container?", strings.Join(binds, ", ")), true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("libraries of the host MPI are missing in %s: %s", containerInfo.Path, strings.Join(res.Missing, ", "))
+		}
+	}
+	infoLog.Printf("Binding %s from the host\n", strings.Join(binds, ", "))
+	containerInfo.Binds = append(containerInfo.Binds, binds...)
+	return nil
+}
+
+// runContainer runs a container. The spec specifies the user's options for the execution of
+// the container, e.g., the working directory; the other details are gathered from the image.
+// The auxiliary containers, if any, are started within the same job and must use the same
+// MPI implementation than the primary container. The details of the run, e.g., the host MPI
+// that was selected, are returned even if the run fails, they are then only partially set.
+func runContainer(ctx context.Context, spec *launcher.ContainerSpec, aux []launcher.ContainerSpec, sysCfg *sys.Config) (execRes syexec.Result, run results.RunResult, err error) {
+	// When running containers with sympi, we are always in the context of persistent installs
+	sysCfg.Persistent = sys.GetSympiDir()
+	run.Container = spec.Name
+	run.WorkDir = spec.WorkDir
+
+	containerInfo, containerMPI, err := getContainer(spec, sysCfg)
+	if err != nil {
+		return execRes, run, err
+	}
+	run.ContainerMPI = getRunMPI(containerMPI)
+	run.Model = containerInfo.Model.String()
+	infoLog.Printf("Container based on %s %s\n", containerMPI.ID, containerMPI.Version)
+	run.Affinity = mpi.GetAffinityDesc(sysCfg)
+	if run.Affinity != "" {
+		infoLog.Printf("Affinity: %s\n", run.Affinity)
+	}
+	run.Transport = strings.Join(network.GetProviderEnv(sysCfg), " ")
+
+	var comp launcher.Composition
+	comp.NP = spec.NP
+	comp.NTasksPerNode = spec.NTasksPerNode
+	for i := range aux {
+		auxInfo, auxMPI, err := getContainer(&aux[i], sysCfg)
+		if err != nil {
+			return execRes, run, fmt.Errorf("unable to get details about auxiliary container %s: %w", aux[i].Name, err)
+		}
+		if auxMPI.ID != containerMPI.ID {
+			return execRes, run, fmt.Errorf("auxiliary container %s is based on %s while the primary container is based on %s: %w", aux[i].Name, auxMPI.ID, containerMPI.ID, sympierr.ErrIncompatibleMPI)
+		}
+		var s job.Segment
+		s.App.NP = aux[i].NP
+		s.App.Name = aux[i].Name
+		s.App.BinPath = auxInfo.AppExe
+		if aux[i].AppExe != "" {
+			s.App.BinPath = aux[i].AppExe
+		}
+		s.App.WorkDir = aux[i].WorkDir
+		s.Container = &auxInfo
+		comp.Segments = append(comp.Segments, s)
+	}
+	comp.HetComponents = launcher.GetHetComponents(append([]launcher.ContainerSpec{*spec}, aux...))
+	comp.Array = spec.Array
+
+	var auxContainers []*container.Config
+	for _, s := range comp.Segments {
+		auxContainers = append(auxContainers, s.Container)
+	}
+	hostMPI, hostBuildEnv, err := setupHostMPI(ctx, spec, &containerInfo, containerMPI, sysCfg, auxContainers...)
+	run.HostMPI = getRunMPI(hostMPI)
+	if err != nil {
+		return execRes, run, err
+	}
+	err = checkBoundMPI(ctx, &hostMPI, &hostBuildEnv, &containerInfo, sysCfg)
+	if err != nil {
+		return execRes, run, err
+	}
+	var hostMPICfg mpi.Config
+	var containerMPICfg mpi.Config
+	var appInfo app.Info
+
+	hostMPICfg.Implem = hostMPI
+	hostMPICfg.Buildenv = hostBuildEnv
+
+	containerMPICfg.Implem = containerMPI
+	containerMPICfg.Container = containerInfo
+	appInfo.Name = spec.Name
+	appInfo.BinPath = containerInfo.AppExe
+	if spec.AppExe != "" {
+		appInfo.BinPath = spec.AppExe
+	}
+	appInfo.WorkDir = spec.WorkDir
+
+	// Launch the container
+	jobmgr, err := jm.Select(sysCfg)
+	if err != nil {
+		return execRes, run, fmt.Errorf("failed to load a job manager: %w", err)
+	}
+	start := time.Now()
+	expRes, execRes := launcher.RunComposition(ctx, &appInfo, &hostMPICfg, &hostBuildEnv, &containerMPICfg, &comp, &jobmgr, sysCfg)
+	run.WallTime = time.Since(start)
+	run.NP = expRes.NP
+	run.NNodes = expRes.NNodes
+	run.ExitCode = execRes.ExitCode
+	run.Usage = expRes.Usage
+	run.RunDir = expRes.RunDir
+	run.Tasks = expRes.Tasks
+	if run.RunDir != "" {
+		infoLog.Printf("Files of the run saved in %s\n", run.RunDir)
+	}
+	if !expRes.Pass {
+		diags := diagnostics.Analyze(execRes.Stdout, execRes.Stderr)
+		if len(diags) > 0 {
+			fmt.Fprintf(os.Stderr, "The execution failed, possible cause(s):\n")
+			for _, d := range diags {
+				fmt.Fprintf(os.Stderr, "\t- %s\n\t  -> %s\n", d.Explanation, d.Suggestion)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Execution failed!\n\tStdout: %s\n\tStderr: %s\n", execRes.Stdout, execRes.Stderr)
+		if execRes.Err == nil {
+			return execRes, run, fmt.Errorf("the execution of the container failed")
+		}
+		return execRes, run, fmt.Errorf("failed to run the container: %w", execRes.Err)
+	}
+
+	gpuMode := containerInfo.GPU
+	if gpuMode == "" {
+		gpuMode = "none"
+	}
+	infoLog.Printf("Container runtime: %s\n", sysCfg.ContainerRuntime)
+	infoLog.Printf("GPU support: %s\n", gpuMode)
+	if run.Transport != "" {
+		infoLog.Printf("Transport provider: %s\n", run.Transport)
+	}
+	if expRes.Usage.Elapsed != "" {
+		infoLog.Printf("Resource usage: CPU time %s, max RSS %s, elapsed %s\n", expRes.Usage.CPUTime, expRes.Usage.MaxRSS, expRes.Usage.Elapsed)
+	}
+	infoLog.Printf("Execution successful!\n\tStdout: %s\n\tStderr: %s\n", execRes.Stdout, execRes.Stderr)
+
+	if sysCfg.VerifyGPUs > 0 {
+		verifyGPUs(ctx, &appInfo, &hostMPICfg, &hostBuildEnv, &containerMPICfg, &comp, &jobmgr, expRes.NP, sysCfg)
+	}
+
+	return execRes, run, nil
+}
+
+// runScales runs a container at several scales, one run after the other with the same settings
+// except the number of ranks, e.g., for a strong-scaling study. Each scale is recorded as its own
+// result and a table comparing the scales is displayed once all of them ran; a failed scale does
+// not prevent running the next ones. With jobArray, all the scales are submitted at once as a
+// Slurm job array instead.
+func runScales(ctx context.Context, spec *launcher.ContainerSpec, scales []int, jobArray bool, sysCfg *sys.Config) error {
+	if jobArray {
+		return runScalesArray(ctx, spec, scales, sysCfg)
+	}
+
+	var runs []results.RunResult
+	var failed []string
+	for _, scale := range scales {
+		scaleSpec := *spec
+		scaleSpec.NP = int64(scale)
+		infoLog.Printf("Running %s with %d rank(s)\n", spec.Name, scale)
+		_, runRes, err := runContainer(ctx, &scaleSpec, nil, sysCfg)
+		runRes.Scale = scale
+		recordRun(runRes, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] the run of %s with %d rank(s) failed: %s\n", spec.Name, scale, err)
+			failed = append(failed, strconv.Itoa(scale))
+		}
+		runRes.Pass = err == nil
+		runs = append(runs, runRes)
+	}
+
+	err := results.WriteScalingTable(os.Stdout, runs)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("the runs with %s rank(s) failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runScalesArray runs a container at several scales with a single Slurm job array, each task of
+// the array running one scale. Slurm only reports whether all the tasks succeeded, so the result
+// of the array is the result of each scale; the wall time of each scale is its elapsed time in the
+// Slurm accounting, unknown when the accounting is not available.
+func runScalesArray(ctx context.Context, spec *launcher.ContainerSpec, scales []int, sysCfg *sys.Config) error {
+	arraySpec := *spec
+	arraySpec.Array = &job.Array{Param: job.ArrayNP}
+	for _, scale := range scales {
+		arraySpec.Array.Values = append(arraySpec.Array.Values, strconv.Itoa(scale))
+	}
+	infoLog.Printf("Running %s with %s rank(s) as a job array\n", spec.Name, strings.Join(arraySpec.Array.Values, ", "))
+	_, arrayRes, runErr := runContainer(ctx, &arraySpec, nil, sysCfg)
+
+	var runs []results.RunResult
+	for i, scale := range scales {
+		run := arrayRes
+		run.Tasks = nil
+		run.Scale = scale
+		run.NP = scale
+		run.WallTime = 0
+		run.Usage = results.Usage{}
+		if i < len(arrayRes.Tasks) {
+			run.Usage = arrayRes.Tasks[i]
+			if elapsed, err := results.ParseElapsed(run.Usage.Elapsed); err == nil {
+				run.WallTime = elapsed
+			}
+		}
+		recordRun(run, runErr)
+		run.Pass = runErr == nil
+		runs = append(runs, run)
+	}
+
+	err := results.WriteScalingTable(os.Stdout, runs)
+	if err != nil {
+		return err
+	}
+	return runErr
+}
+
+// verifyGPUs lists the GPUs seen by each rank with a new job requesting the same resources and
+// using the same container as a run, and warns when a rank does not see the number of GPUs
+// requested. With Slurm, the job is submitted separately and may not get the nodes of the run.
+func verifyGPUs(ctx context.Context, appInfo *app.Info, hostMPICfg *mpi.Config, hostBuildEnv *buildenv.Info, containerMPICfg *mpi.Config, comp *launcher.Composition, jobmgr *jm.JM, np int, sysCfg *sys.Config) {
+	checkCmd, err := container.GetGPUCheckCmd(containerMPICfg.Container.GPU)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] cannot verify the GPUs of %s: %s\n", containerMPICfg.Container.Path, err)
+		return
+	}
+
+	checkApp := *appInfo
+	checkApp.BinPath = checkCmd[0]
+	checkApp.Args = checkCmd[1:]
+	// Only the ranks of the primary container are checked
+	checkComp := launcher.Composition{NP: comp.NP, NTasksPerNode: comp.NTasksPerNode}
+	if len(comp.HetComponents) > 0 {
+		checkComp.HetComponents = comp.HetComponents[:1]
+	}
+	checkCfg := *sysCfg
+	checkCfg.LabelOutput = true
+	// The check is not a run of the experiment, its files are not kept
+	checkCfg.RunLayout = sys.RunLayoutFlat
+
+	infoLog.Printf("Verifying the GPUs seen by each rank with %s\n", strings.Join(checkCmd, " "))
+	expRes, execRes := launcher.RunComposition(ctx, &checkApp, hostMPICfg, hostBuildEnv, containerMPICfg, &checkComp, jobmgr, &checkCfg)
+	if !expRes.Pass {
+		fmt.Fprintf(os.Stderr, "[WARN] cannot verify the GPUs: %s failed: %s\n", strings.Join(checkCmd, " "), execRes.Err)
+		return
+	}
+
+	counts := container.CountGPUsPerRank(execRes.Stdout)
+	var ranks []int
+	for r := range counts {
+		ranks = append(ranks, r)
+	}
+	sort.Ints(ranks)
+	for _, r := range ranks {
+		infoLog.Printf("\tRank %d: %d GPU(s)\n", r, counts[r])
+	}
+	for _, w := range container.CheckGPUCounts(counts, np, sysCfg.VerifyGPUs) {
+		fmt.Fprintf(os.Stderr, "[WARN] %s\n", w)
+	}
+}
+
+// shellContainer starts an interactive shell in a container, set up like for running its
+// application: the host MPI is selected, bind-mounted and the environment of the container is set
+func shellContainer(ctx context.Context, spec *launcher.ContainerSpec, sysCfg *sys.Config) error {
+	// As with runContainer, we are in the context of persistent installs
+	sysCfg.Persistent = sys.GetSympiDir()
+
+	containerInfo, containerMPI, err := getContainer(spec, sysCfg)
+	if err != nil {
+		return err
+	}
+	infoLog.Printf("Container based on %s %s\n", containerMPI.ID, containerMPI.Version)
+	hostMPI, hostBuildEnv, err := setupHostMPI(ctx, spec, &containerInfo, containerMPI, sysCfg)
+	if err != nil {
+		return err
+	}
+
+	appInfo := app.Info{Name: spec.Name, WorkDir: spec.WorkDir}
+	args, containerEnv := mpi.GetShellCmd(&hostMPI, &hostBuildEnv, &appInfo, &containerInfo, sysCfg)
+	syEnv, err := sysCfg.GetSingularityEnv()
+	if err != nil {
+		return fmt.Errorf("failed to set the environment of Singularity: %w", err)
+	}
+
+	log.Printf("* Executing %s", strings.Join(args, " "))
+	// The shell handles interruptions itself, e.g., Ctrl-C, so it is not bound to the context
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(append(os.Environ(), syEnv...), containerEnv...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// remoteRunFlags are the flags of -run forwarded to the remote sympi with -remote
+var remoteRunFlags = map[string]bool{
+	"pwd": true, "jm": true, "np": true, "nodes": true, "partition": true, "bind": true, "profile": true,
+	"scales": true, "job-array": true, "nv": true, "rocm": true, "ucx-tls": true, "ofi-provider": true,
+	"mpirun-args": true, "map-by": true, "rank-by": true, "bind-to": true, "export-env": true,
+	"keep-mpi-env": true, "cleanenv": true, "containall": true, "bind-missing-libs": true,
+	"skip-glibc-check": true, "verify-gpu": true, "no-auto-install": true, "run-layout": true,
+	"singularity-cachedir": true, "singularity-tmpdir": true,
+}
+
+// remoteLocalFlags are the flags only affecting the local sympi with -remote, e.g., its verbosity
+var remoteLocalFlags = map[string]bool{"run": true, "remote": true, "v": true, "d": true, "q": true}
+
+// getRemoteRunArgs returns the flags of the run set on the command line to forward to the remote
+// sympi, e.g., -np=4. The other flags would be silently ignored, they are rejected.
+func getRemoteRunArgs(fs *flag.FlagSet) ([]string, error) {
+	var args []string
+	var unsupported []string
+	fs.Visit(func(f *flag.Flag) {
+		switch {
+		case remoteRunFlags[f.Name]:
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		case !remoteLocalFlags[f.Name]:
+			unsupported = append(unsupported, "-"+f.Name)
+		}
+	})
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("%s cannot be used with -remote", strings.Join(unsupported, ", "))
+	}
+	return args, nil
+}
+
+// runRemote runs an installed container or an image on a remote host, where the image is
+// installed under the name of its file
+func runRemote(ctx context.Context, target string, name string, opts remote.Options, sysCfg *sys.Config) error {
+	imgPath, err := getImagePath(name)
+	if err != nil {
+		return err
+	}
+	return remote.Run(ctx, target, strings.TrimSuffix(filepath.Base(imgPath), ".sif"), imgPath, opts, sysCfg)
+}
+
+// getRunMPI returns the description of a MPI used in the results of the runs, e.g., openmpi:4.0.2
+func getRunMPI(mpi implem.Info) string {
+	if mpi.ID == "" || mpi.Version == "" {
+		return ""
+	}
+	return mpi.ID + ":" + mpi.Version
+}
+
+// runMetadataFile is the name of the file with the metadata of a run in its directory
+const runMetadataFile = "run.json"
+
+// recordRun saves the result of the run of a container in the results of the runs
+func recordRun(r results.RunResult, runErr error) {
+	// Concurrent runs update the same file
+	release, err := lockState(true)
+	if err != nil {
+		log.Printf("[WARN] failed to save the result of the run of %s: %s", r.Container, err)
+		return
+	}
+	defer release()
+
+	path := filepath.Join(sys.GetSympiDir(), results.RunsFile)
+	runs, err := results.LoadRuns(path)
+	if err != nil {
+		log.Printf("[WARN] failed to load the results of the runs: %s", err)
+		return
+	}
+
+	r.Pass = runErr == nil
+	if runErr != nil {
+		r.Note = runErr.Error()
+	}
+	err = results.SaveRuns(path, results.UpdateRun(runs, r))
+	if err != nil {
+		log.Printf("[WARN] failed to save the result of the run of %s: %s", r.Container, err)
+	}
+
+	// With the per-run layout, the metadata of the run completes its files
+	if r.RunDir != "" {
+		err = saveRunMetadata(r)
+		if err != nil {
+			log.Printf("[WARN] failed to save the metadata of the run of %s: %s", r.Container, err)
+		}
+	}
+}
+
+// saveRunMetadata writes the result of a run in its directory, in the same format than the
+// JSON export of the results
+func saveRunMetadata(r results.RunResult) error {
+	f, err := os.Create(filepath.Join(r.RunDir, runMetadataFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return results.WriteJSON(f, []results.RunResult{r})
+}
+
+// exportResults writes the results of the runs in JSON or CSV
+func exportResults(w io.Writer, jsonFormat bool, csvFormat bool) error {
+	if jsonFormat == csvFormat {
+		return fmt.Errorf("please select the format of the export with either -json or -csv")
+	}
+
+	runs, err := results.LoadRuns(filepath.Join(sys.GetSympiDir(), results.RunsFile))
+	if err != nil {
+		return fmt.Errorf("failed to load the results of the runs: %w", err)
+	}
+	if jsonFormat {
+		return results.WriteJSON(w, runs)
+	}
+	return results.WriteCSV(w, runs)
+}
+
+// errWizardCancelled is the error returned when the user does not confirm the run in the wizard
+var errWizardCancelled = errors.New("run cancelled")
+
+// runWizard interactively selects a container, the host MPI and the number of ranks, and runs
+// the container once the user confirms. The details of the run are returned as for runContainer.
+func runWizard(ctx context.Context, p *prompt.Prompter, sysCfg *sys.Config) (results.RunResult, error) {
+	var run results.RunResult
+
+	entries, err := ioutil.ReadDir(sys.GetSympiDir())
+	if err != nil {
+		return run, fmt.Errorf("failed to read %s: %w", sys.GetSympiDir(), err)
+	}
+	containers, err := getContainerInstalls(entries)
+	if err != nil {
+		return run, fmt.Errorf("unable to get the list of containers: %w", err)
+	}
+	if len(containers) == 0 {
+		return run, fmt.Errorf("no container installed, please create one with sycontainerize first")
+	}
+	idx, err := p.Choose("Which container do you want to run?", containers, -1)
+	if err != nil {
+		return run, err
+	}
+	var spec launcher.ContainerSpec
+	spec.Name = containers[idx]
+	run.Container = spec.Name
+
+	_, containerMPI, err := getContainer(&spec, sysCfg)
+	if err != nil {
+		return run, err
+	}
+	res, err := matchHostMPI(containerMPI, sysCfg)
+	if err != nil {
+		return run, err
+	}
+
+	// The compatible MPIs installed on the host, the selected one being the default, and the
+	// installation of the MPI of the container when it is not installed yet
+	var options, hostMPIs []string
+	def := -1
+	containerMPIID := containerMPI.ID + ":" + containerMPI.Version
+	installed := false
+	for _, c := range res.Candidates {
+		if c.Rule == "" {
+			continue
+		}
+		id := c.MPI.ID + ":" + c.MPI.Version
+		if c.MPI.ID == res.Selected.ID && c.MPI.Version == res.Selected.Version {
+			def = len(options)
+		}
+		installed = installed || id == containerMPIID
+		options = append(options, fmt.Sprintf("%s (%s)", id, c.Rule))
+		hostMPIs = append(hostMPIs, id)
+	}
+	if !installed {
+		if def == -1 {
+			def = len(options)
+		}
+		options = append(options, "install "+containerMPIID+" on the host")
+		hostMPIs = append(hostMPIs, containerMPIID)
+	}
+	fmt.Printf("%s is based on %s\n", spec.Name, containerMPIID)
+	idx, err = p.Choose("Which MPI of the host do you want to use?", options, def)
+	if err != nil {
+		return run, err
+	}
+	spec.HostMPI = hostMPIs[idx]
+
+	spec.NP, err = p.Int("How many ranks do you want to start?", 2)
+	if err != nil {
+		return run, err
+	}
+
+	ok, err := p.Confirm(fmt.Sprintf("Run %s with %d rank(s) and %s from the host?", spec.Name, spec.NP, spec.HostMPI), true)
+	if err != nil {
+		return run, err
+	}
+	if !ok {
+		return run, errWizardCancelled
+	}
+
+	if !installed && spec.HostMPI == containerMPIID {
+		// Like with -install, concurrent installs of the same version must not share the install directory
+		var release func()
+		release, err = lockState(true)
+		if err != nil {
+			return run, err
+		}
+		err = installMPIonHost(ctx, containerMPIID, sysCfg)
+		release()
+		if err != nil {
+			return run, fmt.Errorf("failed to install %s: %w", containerMPIID, err)
+		}
+	}
+	_, run, err = runContainer(ctx, &spec, nil, sysCfg)
+	return run, err
+}
+
+// rerunFailed executes again the containers whose last run failed and updates their results
+func rerunFailed(ctx context.Context, sysCfg *sys.Config) error {
+	path := filepath.Join(sys.GetSympiDir(), results.RunsFile)
+	runs, err := results.LoadRuns(path)
+	if err != nil {
+		return fmt.Errorf("failed to load the results of the runs: %w", err)
+	}
+
+	failed := results.GetFailedRuns(runs)
+	if len(failed) == 0 {
+		infoLog.Println("No failed run")
+		return nil
+	}
+
+	nFailed := 0
+	for _, f := range failed {
+		infoLog.Printf("Running %s again (previous run with %s failed: %s)\n", f.Container, f.HostMPI, f.Note)
+		// The run is started again with the same host MPI and settings; without host MPI, e.g., when
+		// no compatible MPI was found, it is selected again
+		var spec launcher.ContainerSpec
+		spec.Name = f.Container
+		spec.HostMPI = f.HostMPI
+		spec.NP = int64(f.NP)
+		spec.WorkDir = f.WorkDir
+		// The failed scale of a scaling study is run again with the same number of ranks
+		if f.Scale > 0 {
+			spec.NP = int64(f.Scale)
+		}
+		_, run, err := runContainer(ctx, &spec, nil, sysCfg)
+		run.Scale = f.Scale
+		recordRun(run, err)
+		if err != nil {
+			nFailed++
+			fmt.Printf("%s: FAIL\n", f.Container)
+		} else {
+			fmt.Printf("%s: PASS\n", f.Container)
+		}
+	}
+	if nFailed > 0 {
+		return fmt.Errorf("%d run(s) out of %d still failing", nFailed, len(failed))
+	}
+	return nil
+}
+
+// getValidatedHostMPI returns the host MPI a container was last successfully run with or, if the
+// container was never successfully run, the compatible host MPI that would be selected to run it
+func getValidatedHostMPI(name string, containerMPI implem.Info, sysCfg *sys.Config) (string, error) {
+	runs, err := results.LoadRuns(filepath.Join(sys.GetSympiDir(), results.RunsFile))
+	if err != nil {
+		log.Printf("[WARN] failed to load the results of the runs: %s", err)
+	}
+	for _, r := range runs {
+		if r.Container == name && r.Pass && r.HostMPI != "" {
+			return r.HostMPI, nil
+		}
+	}
+
+	hostMPI, err := findCompatibleMPI(containerMPI, sysCfg)
+	if err != nil {
+		return "", err
+	}
+	return hostMPI.ID + ":" + hostMPI.Version, nil
+}
+
+// exportContainer creates a tarball with an installed container and the host MPI it was validated
+// against so both can be imported on another system
+func exportContainer(ctx context.Context, name string, output string, sysCfg *sys.Config) error {
+	containerDir := filepath.Join(sys.GetSympiDir(), sys.ContainerInstallDirPrefix+name)
+	imgPath := filepath.Join(containerDir, name+".sif")
+	if !util.FileExists(imgPath) {
+		return fmt.Errorf("%s does not exist", imgPath)
+	}
+	containerInfo, containerMPI, err := container.GetMetadata(imgPath, sysCfg)
+	if err != nil {
+		return fmt.Errorf("failed to extract container's metadata: %w", err)
+	}
+
+	hostMPI, err := getValidatedHostMPI(name, containerMPI, sysCfg)
+	if err != nil {
+		return err
+	}
+	hostMPIDir, err := getHostMPIInstallDir(hostMPI)
+	if err != nil {
+		return err
+	}
+
+	m := bundle.Manifest{
+		Container:    name,
+		ContainerMPI: containerMPI.ID + ":" + containerMPI.Version,
+		Model:        containerInfo.Model.String(),
+		HostMPI:      hostMPI,
+	}
+	infoLog.Printf("Exporting %s with %s from %s...\n", name, hostMPI, hostMPIDir)
+	return bundle.Export(ctx, containerDir, hostMPIDir, &m, output, sysCfg)
+}
+
+// importBundle installs the container and host MPI from a tarball created with -export
+func importBundle(ctx context.Context, archive string, sysCfg *sys.Config) error {
+	m, err := bundle.Import(ctx, archive, sys.GetSympiDir(), sysCfg)
+	if err != nil {
+		return err
+	}
+
+	if m.HostMPIReused {
+		infoLog.Printf("Imported container %s (%s, %s model), using the installed host MPI %s\n", m.Container, m.ContainerMPI, m.Model, m.HostMPI)
+		return nil
+	}
+	hostMPIDir := filepath.Join(sys.GetSympiDir(), m.HostMPIDir)
+	infoLog.Printf("Imported container %s (%s, %s model) and host MPI %s\n", m.Container, m.ContainerMPI, m.Model, m.HostMPI)
+	if m.HostMPIPrefix != "" && m.HostMPIPrefix != hostMPIDir {
+		infoLog.Printf("%s was installed in %s on the original system and is now in %s, MPI implementations that are not relocatable may not work as expected\n", m.HostMPI, m.HostMPIPrefix, hostMPIDir)
+	}
+	return nil
+}
+
+// getSourceEntry returns the lockfile entry of a MPI or Singularity installed on the host based on
+// the configuration listing the available versions; the checksum is the one of the source in the cache
+func getSourceEntry(entryType string, id string, kvs []kv.KV) freeze.Entry {
+	e := freeze.Entry{Type: entryType, ID: id}
+	tokens := strings.Split(id, ":")
+	if len(tokens) != 2 {
+		return e
+	}
+
+	var info implem.Info
+	info.SetURLs(kv.GetValue(kvs, tokens[1]))
+	e.URL = info.URL
+	if e.URL == "" {
+		fmt.Fprintf(os.Stderr, "[WARN] the source of %s is unknown\n", id)
+		return e
+	}
+	cachedPath, err := buildenv.GetCachedPath(e.URL)
+	if err != nil || !util.FileExists(cachedPath) {
+		fmt.Fprintf(os.Stderr, "[WARN] the source of %s is not in the cache, no checksum recorded\n", id)
+		return e
+	}
+	e.Checksum, err = util.SHA256File(cachedPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] failed to compute the checksum of %s: %s\n", cachedPath, err)
+	}
+	return e
+}
+
+// getInstalledSoftware returns a description of the Singularity, MPI and containers installed by sympi
+func getInstalledSoftware(sympiDir string) (string, error) {
+	dirEntries, err := ioutil.ReadDir(sympiDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", sympiDir, err)
+	}
+
+	var lines []string
+	singularities, err := getSingularityInstalls(dirEntries)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the list of singularity installs on the host: %w", err)
+	}
+	for _, v := range singularities {
+		lines = append(lines, "singularity:"+v)
+	}
+	mpis, err := getAllHostMPIInstalls()
+	if err != nil {
+		return "", fmt.Errorf("unable to get the install of MPIs installed on the host: %w", err)
+	}
+	for _, m := range mpis {
+		entry := m.ID + " " + m.Dir
+		if m.Target != "" {
+			entry = entry + " -> " + m.Target
+		}
+		lines = append(lines, entry)
+	}
+	containers, err := getContainerInstalls(dirEntries)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the list of containers: %w", err)
+	}
+	for _, c := range containers {
+		lines = append(lines, "container:"+c)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// writeBugReport writes to a single file the details of the environment that are useful to
+// investigate a bug. Details that cannot be gathered are reported as such in the file.
+func writeBugReport(path string, sysCfg *sys.Config) error {
+	var sections []bugreport.Section
+	addSection := func(title string, content string, err error) {
+		if err != nil {
+			content = "not available: " + err.Error()
+		}
+		sections = append(sections, bugreport.Section{Title: title, Content: content})
+	}
+
+	addSection("sympi version", sys.Version, nil)
+
+	if sysCfg.SingularityBin == "" {
+		addSection("Singularity version", "", sympierr.ErrSingularityNotInstalled)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*time.Second)
+		stdout, stderr, _, err := sysCfg.GetRunner().Run(ctx, sysCfg.SingularityBin, "--version")
+		cancel()
+		if err != nil {
+			err = fmt.Errorf("%w - stderr: %s", err, stderr)
+		}
+		addSection("Singularity version", sysCfg.SingularityBin+": "+stdout, err)
+	}
+
+	jobmgrID := sysCfg.JobManager
+	if jobmgrID == "" {
+		jobmgrID = jm.Detect().ID
+	}
+	addSection("Job manager", jobmgrID, nil)
+
+	addSection("Configuration", bugreport.FormatConfig(sysCfg), nil)
+
+	installed, err := getInstalledSoftware(sys.GetSympiDir())
+	addSection("Installed software", installed, err)
+
+	envContent := ""
+	envFile, err := getEnvFile()
+	if err == nil {
+		var content []byte
+		content, err = ioutil.ReadFile(envFile)
+		envContent = envFile + ":\n" + string(content)
+	}
+	addSection("Environment file", envContent, err)
+
+	logTail := ""
+	logFile, err := bugreport.LatestFile("singularity-*.log")
+	if err == nil {
+		logTail, err = bugreport.Tail(logFile, bugreport.DefaultLogLines)
+		logTail = logFile + ":\n" + bugreport.Redact(logTail)
+	}
+	addSection("Latest log", logTail, err)
+
+	var report strings.Builder
+	err = bugreport.Write(&report, sections)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, []byte(report.String()), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// validateConfig checks the configuration files of the etc directory and displays the issues. URLs
+// are checked with the servers unless sympi is offline.
+func validateConfig(sysCfg *sys.Config) error {
+	var client *http.Client
+	if !sysCfg.Offline {
+		client = &http.Client{Timeout: sys.CmdTimeout * time.Second}
+	}
+
+	files, issues, err := configcheck.CheckDir(context.Background(), sysCfg.EtcDir, client)
+	if err != nil {
+		return err
+	}
+
+	nErrors := 0
+	for _, i := range issues {
+		fmt.Println(i)
+		if i.Severity == configcheck.SeverityError {
+			nErrors++
+		}
+	}
+	fmt.Printf("%d configuration file(s) checked: %d error(s), %d warning(s)\n", len(files), nErrors, len(issues)-nErrors)
+	if nErrors > 0 {
+		return fmt.Errorf("%d invalid entries", nErrors)
+	}
+	return nil
+}
+
+// freezeEnv returns the lockfile entries describing all the MPI, Singularity and containers installed by sympi
+func freezeEnv(ctx context.Context, sysCfg *sys.Config) ([]freeze.Entry, error) {
+	var entries []freeze.Entry
+
+	sympiDir := sys.GetSympiDir()
+	dirEntries, err := ioutil.ReadDir(sympiDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sympiDir, err)
+	}
+
+	singularities, err := getSingularityInstalls(dirEntries)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the list of singularity installs on the host: %w", err)
+	}
+	if len(singularities) > 0 {
+		kvs, err := sy.LoadSingularityReleaseConf(sysCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load data about Singularity releases: %w", err)
+		}
+		for _, v := range singularities {
+			entries = append(entries, getSourceEntry(freeze.SingularityEntry, implem.SY+":"+v, kvs))
+		}
+	}
+
+	mpis, err := getHostMPIInstalls(dirEntries)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the list of MPI installs on the host: %w", err)
+	}
+	for _, id := range mpis {
+		mpiID, _ := getMPIDetails(id)
+		kvs, err := mpi.LoadMPIConfig(ctx, mpiID, sysCfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the configuration of %s: %w", mpiID, err)
+		}
+		entries = append(entries, getSourceEntry(freeze.MPIEntry, id, kvs))
+	}
+
+	containers, err := getContainerInstalls(dirEntries)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the list of containers: %w", err)
+	}
+	for _, name := range containers {
+		e := freeze.Entry{Type: freeze.ContainerEntry, ID: name}
+		imgPath := filepath.Join(sympiDir, sys.ContainerInstallDirPrefix+name, name+".sif")
+		e.Checksum, err = util.SHA256File(imgPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] failed to compute the checksum of %s: %s\n", imgPath, err)
 		}
+		entries = append(entries, e)
 	}
 
-	if ver != "" {
-		mpi.Version = ver
-		return mpi, nil
-	}
+	return entries, nil
+}
 
-	return mpi, fmt.Errorf("no compatible version available")
+func checkChecksum(path string, expected string) error {
+	sum, err := util.SHA256File(path)
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		return fmt.Errorf("checksum of %s is %s instead of %s", path, sum, expected)
+	}
+	return nil
 }
 
-func runContainer(containerDesc string, sysCfg *sys.Config) error {
-	// When running containers with sympi, we are always in the context of persistent installs
-	sysCfg.Persistent = sys.GetSympiDir()
+// applyEntry installs the MPI or Singularity described by an entry of a lockfile if it is not
+// already installed, from the exact same source; containers cannot be installed, they are only checked
+func applyEntry(ctx context.Context, e freeze.Entry, sysCfg *sys.Config) error {
+	sympiDir := sys.GetSympiDir()
 
-	// Get the full path to the image
-	containerInstallDir := filepath.Join(sys.GetSympiDir(), sys.ContainerInstallDirPrefix+containerDesc)
-	imgPath := filepath.Join(containerInstallDir, containerDesc+".sif")
-	if !util.FileExists(imgPath) {
-		return fmt.Errorf("%s does not exist", imgPath)
+	if e.Type == freeze.ContainerEntry {
+		imgPath := filepath.Join(sympiDir, sys.ContainerInstallDirPrefix+e.ID, e.ID+".sif")
+		if !util.FileExists(imgPath) {
+			return fmt.Errorf("%s is not installed, containers must be installed manually", e.ID)
+		}
+		if e.Checksum != "" {
+			return checkChecksum(imgPath, e.Checksum)
+		}
+		return nil
 	}
 
-	// Inspect the image and extract the metadata
-	if sysCfg.SingularityBin == "" {
-		log.Fatalf("singularity bin not defined")
+	id, version := getMPIDetails(e.ID)
+	if version == "" {
+		return fmt.Errorf("invalid ID: %s", e.ID)
 	}
-
-	fmt.Printf("Analyzing %s to figure out the correct configuration for execution...\n", imgPath)
-	containerInfo, containerMPI, err := container.GetMetadata(imgPath, sysCfg)
-	if err != nil {
-		return fmt.Errorf("failed to extract container's metadata: %s", err)
+	var installDir string
+	var kvs []kv.KV
+	var err error
+	if e.Type == freeze.SingularityEntry {
+		installDir = filepath.Join(sympiDir, sys.SingularityInstallDirPrefix+version)
+		kvs, err = sy.LoadSingularityReleaseConf(sysCfg)
+	} else {
+		installDir = filepath.Join(sympiDir, sys.MPIInstallDirPrefix+id+"-"+version)
+		kvs, err = mpi.LoadMPIConfig(ctx, id, sysCfg)
 	}
-	fmt.Printf("Container based on %s %s\n", containerMPI.ID, containerMPI.Version)
-	fmt.Println("Looking for available compatible version...")
-	hostMPI, err := findCompatibleMPI(containerMPI)
 	if err != nil {
-		fmt.Printf("No compatible MPI found, installing the appropriate version...")
-		err := installMPIonHost(containerMPI.ID+"-"+containerMPI.Version, sysCfg)
+		return err
+	}
+	if (e.Type == freeze.SingularityEntry && util.PathExists(installDir)) || (e.Type != freeze.SingularityEntry && provenance.IsComplete(installDir)) {
+		infoLog.Printf("%s is already installed\n", e.ID)
+		return nil
+	}
+
+	// The installation must use the source recorded in the lockfile
+	var info implem.Info
+	info.SetURLs(kv.GetValue(kvs, version))
+	if e.URL != "" && info.URL != e.URL {
+		return fmt.Errorf("the source of %s is %q in the configuration instead of %s", e.ID, info.URL, e.URL)
+	}
+	if e.Checksum != "" {
+		p := buildenv.SoftwarePackage{Name: e.ID, URL: info.URL, Mirrors: info.Mirrors}
+		cachedPath, err := buildenv.CachePackage(ctx, &p, sysCfg)
 		if err != nil {
-			return fmt.Errorf("failed to install %s %s", containerMPI.ID, containerMPI.Version)
+			return fmt.Errorf("failed to download %s: %w", e.ID, err)
+		}
+		err = checkChecksum(cachedPath, e.Checksum)
+		if err != nil {
+			// We do not want to use that file for any other install
+			os.Remove(cachedPath)
+			return err
 		}
-		hostMPI.ID = containerMPI.ID
-		hostMPI.Version = containerMPI.Version
 	} else {
-		fmt.Printf("%s %s was found on the host as a compatible version\n", hostMPI.ID, hostMPI.Version)
+		fmt.Fprintf(os.Stderr, "[WARN] no checksum for %s, the source cannot be checked\n", e.ID)
 	}
 
-	fmt.Printf("Container is in %s mode\n", containerInfo.Model)
-	if containerInfo.Model == container.BindModel {
-		fmt.Printf("Binding/mounting %s %s on host -> %s\n", hostMPI.ID, hostMPI.Version, containerInfo.MPIDir)
+	infoLog.Printf("Installing %s...\n", e.ID)
+	return installSoftware(ctx, e.ID, sysCfg)
+}
+
+// applyLockfile installs everything described in a lockfile created with -freeze
+func applyLockfile(ctx context.Context, path string, sysCfg *sys.Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
 	}
+	defer f.Close()
 
-	err = loadMPI(hostMPI.ID + ":" + hostMPI.Version)
+	entries, err := freeze.Read(f)
 	if err != nil {
-		return fmt.Errorf("failed to load MPI %s %s on host: %s", hostMPI.ID, hostMPI.Version, err)
+		return fmt.Errorf("failed to read %s: %w", path, err)
 	}
 
-	var hostBuildEnv buildenv.Info
-	err = buildenv.CreateDefaultHostEnvCfg(&hostBuildEnv, &hostMPI, sysCfg)
-	var hostMPICfg mpi.Config
-	var containerMPICfg mpi.Config
-	var appInfo app.Info
+	nFailed := 0
+	for _, e := range entries {
+		err := applyEntry(ctx, e, sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot apply %s %s: %s\n", e.Type, e.ID, err)
+			nFailed++
+		}
+	}
+	if nFailed > 0 {
+		return fmt.Errorf("%d entries out of %d failed", nFailed, len(entries))
+	}
+	return nil
+}
 
-	hostMPICfg.Implem = hostMPI
-	hostMPICfg.Buildenv = hostBuildEnv
+// printRunResult displays the result of a run as a single line that is easy to parse,
+// e.g., "RESULT: PASS" or "RESULT: FAIL reason=\"...\""
+func printRunResult(err error) {
+	if err == nil {
+		fmt.Println("RESULT: PASS")
+		return
+	}
+	fmt.Printf("RESULT: FAIL reason=%s\n", strconv.Quote(err.Error()))
+}
 
-	containerMPICfg.Implem = containerMPI
-	containerMPICfg.Container = containerInfo
-	appInfo.Name = containerDesc
-	appInfo.BinPath = containerInfo.AppExe
+// runOSU runs the OSU point-to-point benchmarks available in a set of containers and displays
+// a report comparing the results of the different containers, e.g., in bind and hybrid mode
+func runOSU(ctx context.Context, containers []string, sysCfg *sys.Config) error {
+	var report []osu.ContainerResults
+	for _, name := range containers {
+		spec := launcher.ContainerSpec{Name: name}
+		c, _, err := getContainer(&spec, sysCfg)
+		if err != nil {
+			return err
+		}
 
-	// Launch the container
-	jobmgr := jm.Detect()
-	expRes, execRes := launcher.Run(&appInfo, &hostMPICfg, &hostBuildEnv, &containerMPICfg, &jobmgr, sysCfg)
-	if !expRes.Pass {
-		return fmt.Errorf("failed to run the container: %s (stdout: %s; stderr: %s)", execRes.Err, execRes.Stderr, execRes.Stdout)
+		res := osu.ContainerResults{Name: name, Model: c.Model.String(), Results: make(map[string]osu.Result)}
+		for _, benchmark := range osu.Benchmarks {
+			binPath, err := container.FindBinary(&c, benchmark, sysCfg)
+			if err != nil {
+				infoLog.Printf("%s is not available in %s, skipping\n", benchmark, name)
+				continue
+			}
+
+			infoLog.Printf("Running %s in %s...\n", benchmark, name)
+			spec.NP = osu.NP
+			spec.AppExe = binPath
+			execRes, _, err := runContainer(ctx, &spec, nil, sysCfg)
+			if err != nil {
+				return fmt.Errorf("failed to run %s in %s: %w", benchmark, name, err)
+			}
+			r, err := osu.ParseOutput(benchmark, execRes.Stdout)
+			if err != nil {
+				return fmt.Errorf("failed to parse the output of %s: %w", benchmark, err)
+			}
+			res.Results[benchmark] = r
+		}
+		report = append(report, res)
 	}
 
-	fmt.Printf("Execution successful!\n\tStdout: %s\n\tStderr: %s\n", execRes.Stderr, execRes.Stdout)
+	fmt.Printf("\nOSU Micro-Benchmarks report (%d ranks)\n\n", osu.NP)
+	osu.PrintReport(os.Stdout, report)
 
 	return nil
 }
 
-func installSingularity(id string, sysCfg *sys.Config) error {
+func installSingularity(ctx context.Context, id string, sysCfg *sys.Config) error {
+	err := sys.CheckSympiDirWritable()
+	if err != nil {
+		return err
+	}
+
 	kvs, err := sy.LoadSingularityReleaseConf(sysCfg)
 	if err != nil {
-		return fmt.Errorf("failed to load data about Singularity releases: %s", err)
+		return fmt.Errorf("failed to load data about Singularity releases: %w", err)
 	}
 
 	var sy implem.Info
@@ -592,11 +2543,27 @@ func installSingularity(id string, sysCfg *sys.Config) error {
 	}
 
 	sy.Version = tokens[1]
-	sy.URL = kv.GetValue(kvs, sy.Version)
+	sy.SetURLs(kv.GetValue(kvs, sy.Version))
+	if sy.URL == "" {
+		return fmt.Errorf("Singularity %s is unknown: %w", sy.Version, sympierr.ErrVersionNotFound)
+	}
+
+	// Singularity and Apptainer are Go software, building them from source requires a recent
+	// enough version of Go. Apptainer is installed like Singularity, e.g., in the same directory.
+	runtime := sybuilder.DetectRuntime(sy.URL)
+	if runtime == sys.ApptainerRuntime {
+		log.Printf("* %s is a version of Apptainer", sy.URL)
+	}
+	if !sybuilder.IsBinaryArtifact(sy.URL) {
+		err = checker.CheckGoToolchain(runtime, sy.Version, sysCfg)
+		if err != nil {
+			return fmt.Errorf("cannot build Singularity %s: %w", sy.Version, err)
+		}
+	}
 
 	b, err := builder.Load(&sy)
 	if err != nil {
-		return fmt.Errorf("failed to load a builder: %s", err)
+		return fmt.Errorf("failed to load a builder: %w", err)
 	}
 	b.PrivInstall = true
 
@@ -612,49 +2579,72 @@ func installSingularity(id string, sysCfg *sys.Config) error {
 	buildEnv.BuildDir = filepath.Join(sys.GetSympiDir(), sys.SingularityBuildDirPrefix+sy.Version, "src", "github.com", "sylabs")
 	err = util.DirInit(buildEnv.ScratchDir)
 	if err != nil {
-		return fmt.Errorf("failed to initialize %s: %s", buildEnv.ScratchDir, err)
+		return fmt.Errorf("failed to initialize %s: %w", buildEnv.ScratchDir, err)
 	}
 	defer os.RemoveAll(buildEnv.ScratchDir)
 	err = util.DirInit(buildEnv.BuildDir)
 	if err != nil {
-		return fmt.Errorf("failed to initializat %s: %s", buildEnv.BuildDir, err)
+		return fmt.Errorf("failed to initializat %s: %w", buildEnv.BuildDir, err)
 	}
 	defer os.RemoveAll(buildEnv.BuildDir)
 
-	execRes := b.InstallOnHost(&sy, &buildEnv, sysCfg)
+	execRes := b.InstallOnHost(ctx, &sy, &buildEnv, sysCfg)
 	if execRes.Err != nil {
-		return fmt.Errorf("failed to install %s: %s", id, execRes.Err)
+		return fmt.Errorf("failed to install %s: %w", id, execRes.Err)
 	}
 
 	return nil
 }
 
-func listAvail(sysCfg *sys.Config) error {
+// installSoftware installs a version of Singularity or MPI on the host, e.g., singularity:3.8.0 or openmpi:4.0.2
+func installSoftware(ctx context.Context, id string, sysCfg *sys.Config) error {
+	if strings.HasPrefix(id, implem.SY) {
+		return installSingularity(ctx, id, sysCfg)
+	}
+	return installMPIonHost(ctx, id, sysCfg)
+}
+
+func listAvail(ctx context.Context, sysCfg *sys.Config) error {
+	entries, err := ioutil.ReadDir(sys.GetSympiDir())
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", sys.GetSympiDir(), err)
+	}
+	singularities, err := getSingularityInstalls(entries)
+	if err != nil {
+		return fmt.Errorf("unable to get the list of singularity installs on the host: %w", err)
+	}
+	installed := make(map[string]bool)
+	for _, v := range singularities {
+		installed[v] = true
+	}
+
 	fmt.Println("The following versions of Singularity can be installed:")
 	cfgFile := filepath.Join(sysCfg.EtcDir, "singularity.conf")
-	kvs, err := kv.LoadKeyValueConfig(cfgFile)
+	kvs, err := kv.LoadKeyValueConfigWithDropIns(cfgFile)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration from %s: %s", cfgFile, err)
+		return fmt.Errorf("failed to load configuration from %s: %w", cfgFile, err)
 	}
 	for _, e := range kvs {
-		fmt.Printf("\tsingularity:%s\n", e.Key)
+		if installed[e.Key] {
+			fmt.Printf("\tsingularity:%s (installed)\n", e.Key)
+		} else {
+			fmt.Printf("\tsingularity:%s\n", e.Key)
+		}
 	}
 
 	fmt.Println("The following versions of Open MPI can be installed:")
-	cfgFile = filepath.Join(sysCfg.EtcDir, "openmpi.conf")
-	kvs, err = kv.LoadKeyValueConfig(cfgFile)
+	kvs, err = mpi.LoadMPIConfig(ctx, implem.OMPI, sysCfg)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration from %s: %s", cfgFile, err)
+		return fmt.Errorf("failed to load the configuration of %s: %w", implem.OMPI, err)
 	}
 	for _, e := range kvs {
 		fmt.Printf("\topenmpi:%s\n", e.Key)
 	}
 
 	fmt.Println("The following versions of MPICH can be installed:")
-	cfgFile = filepath.Join(sysCfg.EtcDir, "mpich.conf")
-	kvs, err = kv.LoadKeyValueConfig(cfgFile)
+	kvs, err = mpi.LoadMPIConfig(ctx, implem.MPICH, sysCfg)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration from %s: %s", cfgFile, err)
+		return fmt.Errorf("failed to load the configuration of %s: %w", implem.MPICH, err)
 	}
 	for _, e := range kvs {
 		fmt.Printf("\tmpich:%s\n", e.Key)
@@ -663,19 +2653,124 @@ func listAvail(sysCfg *sys.Config) error {
 	return nil
 }
 
+// pruneScratch applies the scratch management policy of the configuration, i.e., removes the
+// old scratch and build artifacts and caps the size of the cache. It is best-effort: failures
+// are only logged, and nothing is pruned while another sympi may use the artifacts, i.e., when
+// the lock cannot be taken right away or the sympi directory is not writable.
+func pruneScratch(sysCfg *sys.Config) {
+	if sys.CheckSympiDirWritable() != nil {
+		return
+	}
+	release, err := lockState(false)
+	if err != nil {
+		log.Printf("* Scratch directories and cache not pruned: %s", err)
+		return
+	}
+	defer release()
+
+	removed, err := scratch.Prune(sysCfg)
+	for _, path := range removed {
+		log.Printf("* Pruned %s", path)
+	}
+	if err != nil {
+		log.Printf("[WARN] failed to prune the scratch directories and the cache: %s", err)
+	}
+}
+
 func main() {
 	verbose := flag.Bool("v", false, "Enable verbose mode")
+	verboseBuild := flag.Bool("verbose-build", false, "Display the output of configure/make on the console while building software")
 	debug := flag.Bool("d", false, "Enable debug mode")
-	list := flag.Bool("list", false, "List all MPI on the host and all MPI containers")
+	loaded := flag.Bool("loaded", false, "Only display the currently loaded MPI and Singularity on a single line, e.g., for shell prompts; with -list, only list the loaded MPI and Singularity")
+	list := flag.Bool("list", false, "List all MPI on the host and all MPI containers, with the MPI of the containers whose image was already inspected (all of them with -v)")
+	listImpl := flag.String("impl", "", "Only list the installs of a MPI implementation when using -list, e.g., openmpi; with -containers, only list the containers based on the implementation")
+	listContainers := flag.Bool("containers", false, "Only list the containers when using -list")
 	load := flag.String("load", "", "The version of MPI/Singularity installed on the host to load")
+	runLayout := flag.String("run-layout", "", "Layout of the files of the runs: "+sys.RunLayoutFlat+" (default) or "+sys.RunLayoutPerRun+" to save the script, output and metadata of each run in its own directory of "+filepath.Join(sys.GetSympiDir(), launcher.RunsDir)+"; overwrites "+sy.RunLayoutKey+" from the sympi configuration file")
+	pathOrder := flag.String("path-order", "", "Whether -load adds the directories of MPI/Singularity before or after the ones already in PATH and LD_LIBRARY_PATH: "+sys.PathOrderPrepend+" (default) or "+sys.PathOrderAppend+"; overwrites "+sy.PathOrderKey+" from the sympi configuration file")
+	namespace := flag.String("namespace", "", "Load or unload a MPI in a namespace, alongside the other MPIs, e.g., sympi -load openmpi:4.0.2 -namespace tools")
 	unload := flag.String("unload", "", "Unload current version of MPI/Singularity that is used, e.g., sympi -unload [mpi|singularity]")
-	install := flag.String("install", "", "MPI implementation to install, e.g., openmpi:4.0.2")
+	install := flag.String("install", "", "MPI implementation(s) or Singularity version(s) to install, comma-separated, e.g., openmpi:4.0.2,singularity:3.8.0; a variant of a MPI, e.g., built with another compiler, can be installed next to it with a tag, e.g., openmpi:4.1.4+gcc11")
 	uninstall := flag.String("uninstall", "", "MPI implementation to uninstall, e.g., openmpi:4.0.2")
-	run := flag.String("run", "", "Run a container")
+	shell := flag.String("shell", "", "Start an interactive shell in an installed container or an image, with the host MPI bound as when running it, e.g., sympi -shell mycontainer")
+	run := flag.String("run", "", "Run an installed container or an image, e.g., sympi -run ~/images/helloworld.sif")
 	avail := flag.Bool("avail", false, "List all available versions of MPI implementations and Singularity that can be installed on the host")
+	jobmgrID := flag.String("jm", "", "Job manager to use instead of the one that is detected: slurm, mpirun or none (mpirun and none directly use mpirun)")
+	redetect := flag.Bool("redetect", false, "Detect again the job manager to use instead of using the one saved in the configuration file")
+	osuContainers := flag.String("osu", "", "Run the OSU latency and bandwidth benchmarks in one or more containers (comma-separated) and compare the results")
+	runSpec := flag.String("run-spec", "", "Run a set of containers sharing the same allocation, as described in a YAML run spec file")
+	profile := flag.String("profile", "", "Run profile of the sympi configuration file ("+sy.ProfileKeyPrefix+"<name>.<setting> entries) applied when using -run, e.g., sympi -run mycontainer -profile small")
+	np := flag.Int64("np", 0, "Number of ranks when using -run; overwrites the setting of the profile")
+	jobArray := flag.Bool("job-array", false, "With -scales and Slurm, submit all the scales at once as a job array instead of one job per scale")
+	scales := flag.String("scales", "", "Comma-separated list of numbers of ranks to run the container with, one run after the other, when using -run, e.g., sympi -run mycontainer -scales 1,2,4,8; replaces -np")
+	nodes := flag.Int64("nodes", 0, "Number of nodes when using -run; overwrites the setting of the profile")
+	partition := flag.String("partition", "", "Partition of the nodes when using -run; overwrites the setting of the profile")
+	binds := flag.String("bind", "", "Comma-separated list of additional directories to bind-mount in the container when using -run, e.g., /data:/data or /ref:/ref:ro; added to the ones of the profile")
+	workDir := flag.String("pwd", "", "Directory in the container from where the application is started when using -run")
+	nv := flag.Bool("nv", false, "Enable NVIDIA GPU support in the container when using -run (detected by default)")
+	rocm := flag.Bool("rocm", false, "Enable AMD GPU support in the container when using -run (detected by default)")
+	rerun := flag.Bool("rerun-failed", false, "Run again, with the same host MPI, number of ranks and working directory, the containers whose last run failed, as recorded in "+filepath.Join(sys.GetSympiDir(), results.RunsFile))
+	quiet := flag.Bool("q", false, "Quiet mode, only display errors and results")
+	compatible := flag.String("compatible", "", "List the installed containers that can be run with a host MPI according to the compatibility policy, e.g., sympi -compatible openmpi:4.1.4")
+	explain := flag.String("explain-match", "", "Explain which host MPI is selected to run a container and why")
+	saveEnvFile := flag.String("save-env", "", "Write a script setting up the environment with the loaded MPI and Singularity, to be sourced by other shells or batch scripts")
+	newSession := flag.Bool("new-session", false, "Create a fresh SyMPI session file for the current shell and print the commands to use it, e.g., eval $(sympi -new-session)")
+	repair := flag.Bool("repair", false, "Recreate the environment file of the current SyMPI session from the current PATH and LD_LIBRARY_PATH")
+	scratch := flag.String("scratch", "", "Base directory for the scratch directories used while installing MPI, takes precedence over the "+sy.ScratchDirKeyPrefix+"<mpi> entries of the sympi configuration file")
+	ucxTLS := flag.String("ucx-tls", "", "UCX transports to use when running containers (UCX_TLS), e.g., rc,sm,self; overwrites "+sy.UCXTLSKey+" from the sympi configuration file")
+	mpirunArgs := flag.String("mpirun-args", "", "Additional mpirun arguments when running containers, e.g., \"--mca btl self,vader\"; overwrites the same options set by <mpi>"+sy.MpirunArgsKeySuffix+" in the sympi configuration file")
+	ofiProvider := flag.String("ofi-provider", "", "libfabric provider to use when running containers (FI_PROVIDER), e.g., verbs; overwrites "+sy.OFIProviderKey+" from the sympi configuration file")
+	export := flag.String("export", "", "Export an installed container and the host MPI it was validated against in a tarball, e.g., sympi -export mycontainer out.tar.gz")
+	importArchive := flag.String("import", "", "Import a container and its host MPI from a tarball created with -export")
+	freezeEnvFlag := flag.Bool("freeze", false, "Display a lockfile describing all the installed MPI, Singularity and containers, e.g., sympi -freeze > sympi.lock")
+	apply := flag.String("apply", "", "Install the MPI and Singularity described in a lockfile created with -freeze")
+	exportEnv := flag.String("export-env", "", "Comma-separated list of host environment variables to forward to the job scripts, e.g., OMP_NUM_THREADS,LM_LICENSE_FILE; overwrites "+sy.ExportEnvKey+" from the sympi configuration file")
+	keepMPIEnv := flag.Bool("keep-mpi-env", false, "Keep the MPI configuration of the host (OMPI_*, PMI_*, etc.) in the environment of containers in hybrid mode when using -run")
+	cleanEnv := flag.Bool("cleanenv", false, "Execute containers with a clean environment (singularity exec --cleanenv) when using -run")
+	containAll := flag.Bool("containall", false, "Execute containers fully isolated from the host (singularity exec --containall) when using -run")
+	register := flag.String("register", "", "Register a MPI installed outside of sympi so it can be used like the MPI installed by sympi, e.g., sympi -register openmpi:4.1.4 /opt/openmpi-4.1.4")
+	validateConfigFlag := flag.Bool("validate-config", false, "Check the configuration files (*.conf) of sympi: format, duplicate keys, versions and URLs, including whether URLs are reachable unless -offline is used")
+	bugReport := flag.String("bugreport", "", "Write the details of the environment useful to report a bug (versions, configuration, installed software, log) to a file, e.g., sympi -bugreport report.txt")
+	etcDir := flag.String("etc", "", "Directory with the configuration files (*.conf), e.g., for testing or packaging; overwrites the "+sys.SYMPI_ETC_ENV+" environment variable")
+	resultsFlag := flag.Bool("results", false, "Export the results of the runs recorded in "+filepath.Join(sys.GetSympiDir(), results.RunsFile)+" on stdout, in the format selected with -json or -csv")
+	jsonFlag := flag.Bool("json", false, "Export the results in JSON when using -results")
+	csvFlag := flag.Bool("csv", false, "Export the results in CSV when using -results")
+	wizard := flag.Bool("wizard", false, "Interactively select a container, the host MPI and the number of ranks, and run the container")
+	remoteHost := flag.String("remote", "", "Run the container on a remote host where sympi is installed, e.g., the login node of a cluster, when using -run: the image is copied over SSH and the job is submitted with the job manager of the remote host, e.g., sympi -run mycontainer -remote user@login")
+	syCacheDir := flag.String("singularity-cachedir", "", "Cache directory of Singularity (SINGULARITY_CACHEDIR), e.g., on a large filesystem; overwrites "+sy.SingularityCacheDirKey+" from the sympi configuration file, derived from -scratch by default")
+	syTmpDir := flag.String("singularity-tmpdir", "", "Temporary directory of Singularity (SINGULARITY_TMPDIR); overwrites "+sy.SingularityTmpDirKey+" from the sympi configuration file, derived from -scratch by default")
+	verifyInstall := flag.Bool("verify", false, "Compile and run a 2-rank MPI hello world against the MPI installed with -install to check that it works; the result is recorded in its provenance (see -info)")
+	verifyRollback := flag.Bool("verify-rollback", false, "Uninstall the MPI installed with -install -verify when it fails the smoke test")
+	debugBuild := flag.Bool("debug-build", false, "Build MPI with debug symbols and without optimizations when using -install; the build is installed as the <version>"+implem.VariantSeparator+implem.DebugVariant+" variant, e.g., openmpi:4.1.4"+implem.VariantSeparator+implem.DebugVariant+", next to the optimized build")
+	var assumeYes bool
+	flag.BoolVar(&assumeYes, "y", false, "Do not ask for a confirmation before destructive actions, e.g., -uninstall")
+	flag.BoolVar(&assumeYes, "assume-yes", false, "Same as -y")
+	bindMissingLibs := flag.Bool("bind-missing-libs", false, "When running a bind-mode container, bind from the host the libraries the host MPI depends on that are missing in the container, without asking")
+	skipGlibcCheck := flag.Bool("skip-glibc-check", false, "When running bind-mode containers, do not refuse to run them when the glibc of the host is more recent than theirs")
+	mapBy := flag.String("map-by", "", "How the ranks are mapped on the hardware, with the syntax of --map-by of Open MPI, e.g., socket or ppr:2:socket:PE=4; overwrites "+sy.MapByKey+" from the sympi configuration file")
+	rankBy := flag.String("rank-by", "", "How the ranks are numbered, with the syntax of --rank-by of Open MPI, e.g., core; overwrites "+sy.RankByKey+" from the sympi configuration file")
+	bindTo := flag.String("bind-to", "", "What the ranks are bound to, with the syntax of --bind-to of Open MPI, e.g., core or none; overwrites "+sy.BindToKey+" from the sympi configuration file")
+	verifyGPU := flag.Int("verify-gpu", 0, "Number of GPUs each rank must see; after running a container, GPUs seen by each rank are listed by a second job requesting the same resources and using the same container, a warning being displayed for each mismatch")
+	force := flag.Bool("force", false, "Uninstall a MPI even if installed containers have no other compatible MPI to run with")
+	forceReinstall := flag.Bool("force-reinstall", false, "Remove the existing installation of the MPI to install, after confirmation, and rebuild it from scratch")
+	noAutoInstall := flag.Bool("no-auto-install", false, "Fail when running a container and no compatible MPI is installed on the host instead of installing the MPI of the container")
+	info := flag.String("info", "", "Display how an installed MPI was built (source, configure arguments, compiler, date), e.g., sympi -info openmpi:4.1.4")
+	buildStats := flag.Bool("buildstats", false, "Display the durations of the builds of the installed MPI, per phase and on average per implementation")
+	diff := flag.String("diff", "", "Display the differences between two installed MPI (provenance, libraries and, for Open MPI, MCA parameters), e.g., sympi -diff openmpi:4.1.4 openmpi:4.1.2")
+	offline := flag.Bool("offline", false, "Do not access the network, sources to install must be in the cache ("+sys.GetCacheDir()+")")
 
 	flag.Parse()
 
+	if *quiet {
+		infoLog.SetOutput(ioutil.Discard)
+	}
+
+	// Fast path for shell prompts: no log file, no configuration
+	if *loaded && !*list {
+		displayLoaded()
+		return
+	}
+
 	// Initialize the log file. Log messages will both appear on stdout and the log file if the verbose option is used
 	logFile := util.OpenLogFile("sympi")
 	defer logFile.Close()
@@ -686,39 +2781,279 @@ func main() {
 		log.SetOutput(ioutil.Discard)
 	}
 
+	if *redetect {
+		jobmgr := jm.Redetect()
+		log.Printf("* Job manager %s detected and saved in the configuration file\n", jobmgr.ID)
+	}
+
+	// The directory is set in the environment so it is also used by the commands sympi starts
+	if *etcDir != "" {
+		os.Setenv(sys.SYMPI_ETC_ENV, *etcDir)
+	}
 	sysCfg := getDefaultSysConfig()
+	err := launcher.CheckEtcDir(sysCfg.EtcDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s, please set the directory with -etc or %s\n", err, sys.SYMPI_ETC_ENV)
+		os.Exit(1)
+	}
 	sysCfg.Verbose = *verbose
+	sysCfg.VerboseBuild = *verboseBuild
 	sysCfg.Debug = *debug
+	sysCfg.Offline = *offline
+	sysCfg.DebugBuild = *debugBuild
+	sysCfg.NoAutoInstall = *noAutoInstall
+	sysCfg.ForceReinstall = *forceReinstall
+	sysCfg.VerifyInstall = *verifyInstall || *verifyRollback
+	sysCfg.RollbackUnverified = *verifyRollback
+	sysCfg.VerifyGPUs = *verifyGPU
+	sysCfg.BindMissingLibs = *bindMissingLibs
+	sysCfg.SkipGlibcCheck = *skipGlibcCheck
+	sysCfg.ScratchBaseDir = *scratch
+	sysCfg.KeepMPIEnv = *keepMPIEnv
+	sysCfg.CleanEnv = *cleanEnv
+	sysCfg.ContainAll = *containAll
+	if *nv && *rocm {
+		log.Fatalf("-nv and -rocm are mutually exclusive")
+	}
+	if *nv {
+		sysCfg.GPU = container.NvidiaGPU
+	}
+	if *rocm {
+		sysCfg.GPU = container.AMDGPU
+	}
+	if *ucxTLS != "" {
+		sysCfg.UCXTLS = *ucxTLS
+	}
+	if *ofiProvider != "" {
+		sysCfg.OFIProvider = *ofiProvider
+	}
+	sysCfg.ExtraMpirunArgs = strings.Fields(*mpirunArgs)
+	if *mapBy != "" {
+		sysCfg.MapBy = *mapBy
+	}
+	if *rankBy != "" {
+		sysCfg.RankBy = *rankBy
+	}
+	if *bindTo != "" {
+		sysCfg.BindTo = *bindTo
+	}
+	err = mpi.CheckAffinity(&sysCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid affinity: %s\n", err)
+		os.Exit(1)
+	}
+	if *runLayout != "" {
+		err := sys.CheckRunLayout(*runLayout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -run-layout: %s\n", err)
+			os.Exit(1)
+		}
+		sysCfg.RunLayout = *runLayout
+	}
+	if *pathOrder != "" {
+		err := sys.CheckPathOrder(*pathOrder)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -path-order: %s\n", err)
+			os.Exit(1)
+		}
+		sysCfg.PathOrder = *pathOrder
+	}
+	if *exportEnv != "" {
+		sysCfg.ExportEnv = launcher.ParseVarNames(*exportEnv)
+	}
+	if *syCacheDir != "" {
+		sysCfg.SingularityCacheDir = *syCacheDir
+	}
+	if *syTmpDir != "" {
+		sysCfg.SingularityTmpDir = *syTmpDir
+	}
+	for _, t := range network.CheckUCXTLS(sysCfg.UCXTLS) {
+		fmt.Fprintf(os.Stderr, "[WARN] unknown UCX transport: %s\n", t)
+	}
+	for _, p := range network.CheckOFIProvider(sysCfg.OFIProvider) {
+		fmt.Fprintf(os.Stderr, "[WARN] unknown libfabric provider: %s\n", p)
+	}
+	if *jobmgrID != "" {
+		_, err := jm.FromID(*jobmgrID)
+		if err != nil {
+			log.Fatalf("invalid job manager: %s", err)
+		}
+		sysCfg.JobManager = *jobmgrID
+	}
 	// Save the options passed in through the command flags
 	if sysCfg.Debug {
 		sysCfg.Verbose = true
-		err := checker.CheckSystemConfig()
+		err := checker.CheckSystemConfig(&sysCfg)
 		if err != nil && err != sympierr.ErrSingularityNotInstalled {
 			log.Fatalf("the system is not correctly setup: %s", err)
 		}
 	}
 
+	if *repair {
+		err := repairEnvFile()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to repair the SyMPI environment: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("SyMPI environment successfully repaired")
+	}
+
+	if *validateConfigFlag {
+		err := validateConfig(&sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The report is especially useful when sympi is not correctly set up, so it does not require an initialized environment
+	if *bugReport != "" {
+		err := writeBugReport(*bugReport, &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write the bug report: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Bug report written to %s, please attach it to your issue\n", *bugReport)
+		return
+	}
+
+	// The environment is exported for shells and jobs outside of the session
+	if *saveEnvFile != "" {
+		err := saveEnv(*saveEnvFile, &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot save the environment: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Environment saved to %s, source it to use the loaded software\n", *saveEnvFile)
+		return
+	}
+
+	if *newSession {
+		err := startNewSession()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot start a new SyMPI session: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	envFile, err := getEnvFile()
-	if err != nil || !util.FileExists(envFile) {
-		fmt.Println("SyMPI is not initialize, please run the 'sympi_init' command first")
+	if err == nil {
+		err = session.Check(session.DefaultProcDir, envFile)
+	}
+	if errors.Is(err, session.ErrStaleSession) {
+		fmt.Fprintf(os.Stderr, "[WARN] %s, the environment of another shell may be modified; run 'sympi_init' again or 'eval $(sympi -new-session)' to start a new session in this shell\n", err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s, please run the 'sympi_init' command first\n", sympierr.ErrNotInitialized)
 		os.Exit(1)
 	}
 
+	pruneScratch(&sysCfg)
+
 	sympiDir := sys.GetSympiDir()
 
+	// Long operations such as installs and runs are cancelled when the command is interrupted,
+	// which kills the associated child processes. The default behavior is then restored so
+	// interrupting the command again terminates it right away, e.g., if the cleanup is stuck.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		log.Println("* Interrupted, cancelling current operation...")
+		cancel()
+	}()
+
 	if *list {
-		displayInstalled(sympiDir)
+		filter := listFilter{Impl: *listImpl, Containers: *listContainers, Loaded: *loaded}
+		err := displayInstalled(sympiDir, filter, &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot list the installed software: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *info != "" {
+		err := displayProvenance(*info)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot display the details of %s: %s\n", *info, err)
+			os.Exit(1)
+		}
+	}
+
+	if *buildStats {
+		err := displayBuildStats()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot display the build times: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *diff != "" {
+		if flag.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "-diff requires the MPI to compare with, e.g., sympi -diff %s openmpi:4.1.2\n", *diff)
+			os.Exit(1)
+		}
+		err := diffMPI(ctx, *diff, flag.Arg(0), &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot compare %s and %s: %s\n", *diff, flag.Arg(0), err)
+			os.Exit(1)
+		}
+	}
+
+	if *compatible != "" {
+		err := listCompatibleContainers(*compatible, &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot list the containers compatible with %s: %s\n", *compatible, err)
+			os.Exit(1)
+		}
+	}
+
+	if *explain != "" {
+		err := explainMatch(*explain, &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot explain the selection of the host MPI for %s: %s\n", *explain, err)
+			os.Exit(1)
+		}
+	}
+
+	// Operations modifying the state of sympi (installs, environment) cannot be executed
+	// concurrently; the installs first check that the sympi directory can be modified at all
+	if *install != "" || *uninstall != "" || *importArchive != "" || *apply != "" || *register != "" {
+		err := sys.CheckSympiDirWritable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	}
+	// Runs and shells only take the lock to set up the host MPI and to record their results, not
+	// while the jobs run
+	if *load != "" || *unload != "" || *install != "" || *uninstall != "" || *importArchive != "" || *apply != "" || *register != "" {
+		release, err := lockState(true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		defer release()
 	}
 
 	if *load != "" {
 		re := regexp.MustCompile(`^singularity:`)
 		if re.Match([]byte(*load)) {
-			err := loadSingularity(*load)
+			err := loadSingularity(*load, sysCfg.PathOrder)
 			if err != nil {
 				log.Fatalf("impossible to load Singularity: %s", err)
 			}
+		} else if *namespace != "" {
+			err := loadNamespacedMPI(*load, *namespace, sysCfg.PathOrder)
+			if err != nil {
+				log.Fatalf("impossible to load MPI in namespace %s: %s", *namespace, err)
+			}
 		} else {
-			err := loadMPI(*load)
+			err := loadMPI(*load, sysCfg.PathOrder)
 			if err != nil {
 				log.Fatalf("impossible to load MPI: %s", err)
 			}
@@ -728,6 +3063,13 @@ func main() {
 	if *unload != "" {
 		switch *unload {
 		case "mpi":
+			if *namespace != "" {
+				err := unloadNamespacedMPI(*namespace)
+				if err != nil {
+					log.Fatalf("impossible to unload MPI from namespace %s: %s", *namespace, err)
+				}
+				break
+			}
 			err := unloadMPI()
 			if err != nil {
 				log.Fatalf("impossible to unload MPI: %s", err)
@@ -742,39 +3084,254 @@ func main() {
 		}
 	}
 
+	if *install != "" && sysCfg.ForceReinstall {
+		err := confirmAction("remove the existing installations of "+*install+" and rebuild them", assumeYes)
+		if errors.Is(err, errNotConfirmed) {
+			fmt.Printf("%s not reinstalled\n", *install)
+			*install = ""
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot reinstall %s: %s\n", *install, err)
+			os.Exit(1)
+		}
+	}
+
 	if *install != "" {
-		re := regexp.MustCompile("^singularity")
+		// Each version is built in its own directories and the sympi lock prevents concurrent
+		// installs, so versions are simply installed one after the other
+		failed := false
+		for _, id := range strings.Split(*install, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			err := installSoftware(ctx, id, &sysCfg)
+			if errors.Is(err, sympierr.ErrAlreadyInstalled) {
+				fmt.Printf("%s is already installed, use -force-reinstall to rebuild it\n", id)
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot install %s: %s\n", id, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s successfully installed\n", id)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	}
+
+	if *register != "" {
+		if flag.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "-register requires the installation directory of MPI, e.g., sympi -register %s /opt/mpi\n", *register)
+			os.Exit(1)
+		}
+		err := registerMPI(*register, flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot register %s: %s\n", *register, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s successfully registered\n", *register)
+	}
+
+	if *uninstall != "" {
+		err := confirmAction("uninstall "+*uninstall, assumeYes)
+		if errors.Is(err, errNotConfirmed) {
+			fmt.Printf("%s not uninstalled\n", *uninstall)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot uninstall %s: %s\n", *uninstall, err)
+			os.Exit(1)
+		} else {
+			err = uninstallMPIfromHost(*uninstall, *force, &sysCfg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot uninstall %s: %s\n", *uninstall, err)
+				os.Exit(1)
+			}
+		}
+	}
 
-		if re.Match([]byte(*install)) {
-			err := installSingularity(*install, &sysCfg)
+	if *run != "" && *remoteHost != "" {
+		args, err := getRemoteRunArgs(flag.CommandLine)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot run %s on %s: %s\n", *run, *remoteHost, err)
+			os.Exit(1)
+		}
+		err = runRemote(ctx, *remoteHost, *run, remote.Options{Args: args}, &sysCfg)
+		printRunResult(err)
+		if err != nil {
+			log.Printf("impossible to run container %s on %s: %s", *run, *remoteHost, err)
+			os.Exit(1)
+		}
+	} else if *run != "" {
+		var spec launcher.ContainerSpec
+		spec.Name = *run
+		if *profile != "" {
+			err := launcher.ApplyProfile(&spec, *profile, &sysCfg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot apply profile %s: %s\n", *profile, err)
+				os.Exit(1)
+			}
+		}
+		// The command line takes precedence over the profile
+		if *workDir != "" {
+			spec.WorkDir = *workDir
+		}
+		if *np > 0 {
+			spec.NP = *np
+		}
+		if *nodes > 0 {
+			spec.Nodes = *nodes
+		}
+		if *partition != "" {
+			spec.Partition = *partition
+		}
+		if *binds != "" {
+			for _, b := range strings.Split(*binds, ",") {
+				err := container.CheckBind(b)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "invalid -bind: %s\n", err)
+					os.Exit(1)
+				}
+				spec.Binds = append(spec.Binds, b)
+			}
+		}
+		if *jobArray && *scales == "" {
+			fmt.Fprintf(os.Stderr, "invalid -job-array: the scales to submit must be given with -scales\n")
+			os.Exit(1)
+		}
+		if *scales != "" {
+			if *np > 0 {
+				fmt.Fprintf(os.Stderr, "invalid -scales: the number of ranks cannot be set with -np as well\n")
+				os.Exit(1)
+			}
+			scaleList, err := results.ParseScales(*scales)
 			if err != nil {
-				log.Fatalf("failed to install Singularity %s: %s", *install, err)
+				fmt.Fprintf(os.Stderr, "invalid -scales: %s\n", err)
+				os.Exit(1)
+			}
+			err = runScales(ctx, &spec, scaleList, *jobArray, &sysCfg)
+			printRunResult(err)
+			if err != nil {
+				log.Printf("impossible to run container %s at all scales: %s", *run, err)
+				os.Exit(1)
 			}
 		} else {
-			err := installMPIonHost(*install, &sysCfg)
+			_, runRes, err := runContainer(ctx, &spec, nil, &sysCfg)
+			recordRun(runRes, err)
+			printRunResult(err)
 			if err != nil {
-				log.Fatalf("failed to install MPI %s: %s", *install, err)
+				log.Printf("impossible to run container %s: %s", *run, err)
+				os.Exit(1)
 			}
 		}
 	}
 
-	if *uninstall != "" {
-		err := uninstallMPIfromHost(*uninstall, &sysCfg)
+	if *shell != "" {
+		spec := launcher.ContainerSpec{Name: *shell, WorkDir: *workDir}
+		err := shellContainer(ctx, &spec, &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot start a shell in %s: %s\n", *shell, err)
+			os.Exit(1)
+		}
+	}
+
+	if *wizard {
+		runRes, err := runWizard(ctx, prompt.New(os.Stdin, os.Stdout), &sysCfg)
+		if errors.Is(err, errWizardCancelled) {
+			fmt.Println("Run cancelled")
+			return
+		}
+		if runRes.HostMPI != "" {
+			// Only runs that were actually attempted are recorded
+			recordRun(runRes, err)
+		}
+		printRunResult(err)
+		if err != nil {
+			log.Printf("impossible to run the container: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	if *runSpec != "" {
+		spec, err := launcher.LoadRunSpec(*runSpec)
+		if err != nil {
+			log.Fatalf("impossible to load the run spec: %s", err)
+		}
+		_, _, err = runContainer(ctx, &spec.Containers[0], spec.Containers[1:], &sysCfg)
+		printRunResult(err)
+		if err != nil {
+			log.Printf("impossible to run the containers from %s: %s", *runSpec, err)
+			os.Exit(1)
+		}
+	}
+
+	if *rerun {
+		err := rerunFailed(ctx, &sysCfg)
+		printRunResult(err)
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+
+	if *osuContainers != "" {
+		err := runOSU(ctx, strings.Split(*osuContainers, ","), &sysCfg)
+		if err != nil {
+			log.Fatalf("impossible to run the OSU benchmarks: %s", err)
+		}
+	}
+
+	if *export != "" {
+		if flag.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "-export requires the path to the tarball to create, e.g., sympi -export %s out.tar.gz\n", *export)
+			os.Exit(1)
+		}
+		err := exportContainer(ctx, *export, flag.Arg(0), &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot export %s: %s\n", *export, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s successfully exported to %s\n", *export, flag.Arg(0))
+	}
+
+	if *importArchive != "" {
+		err := importBundle(ctx, *importArchive, &sysCfg)
 		if err != nil {
-			log.Fatalf("impossible to uninstall %s: %s", *install, err)
+			fmt.Fprintf(os.Stderr, "Cannot import %s: %s\n", *importArchive, err)
+			os.Exit(1)
 		}
+		fmt.Printf("%s successfully imported\n", *importArchive)
 	}
 
-	if *run != "" {
-		err := runContainer(*run, &sysCfg)
+	if *freezeEnvFlag {
+		entries, err := freezeEnv(ctx, &sysCfg)
+		if err == nil {
+			err = freeze.Write(os.Stdout, entries)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot describe the installed environment: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *resultsFlag {
+		err := exportResults(os.Stdout, *jsonFlag, *csvFlag)
 		if err != nil {
-			log.Fatalf("impossible to run container %s: %s", *run, err)
+			fmt.Fprintf(os.Stderr, "Cannot export the results of the runs: %s\n", err)
+			os.Exit(1)
 		}
+	}
 
+	if *apply != "" {
+		err := applyLockfile(ctx, *apply, &sysCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot apply %s: %s\n", *apply, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s successfully applied\n", *apply)
 	}
 
 	if *avail {
-		err := listAvail(&sysCfg)
+		err := listAvail(ctx, &sysCfg)
 		if err != nil {
 			log.Fatalf("impossible to list available software that can be installed")
 		}
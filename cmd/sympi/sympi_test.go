@@ -0,0 +1,425 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mpi"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+// setupSympiDir creates a sympi directory with MPI installations, e.g., openmpi-4.0.2, and
+// containers, and makes it the sympi directory of the tests; the system-wide directory does not
+// exist. The returned function restores the environment.
+func setupSympiDir(t *testing.T, installs []string, containers []string) (string, func()) {
+	dir, err := ioutil.TempDir("", "sympi-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	for _, i := range installs {
+		binDir := filepath.Join(dir, sys.MPIInstallDirPrefix+i, "bin")
+		err := os.MkdirAll(binDir, 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(binDir, "mpirun"), nil, 0755)
+		}
+		if err != nil {
+			t.Fatalf("failed to create the installation of %s: %s", i, err)
+		}
+	}
+	for _, c := range containers {
+		imgPath := filepath.Join(dir, sys.ContainerInstallDirPrefix+c, c+".sif")
+		err := os.MkdirAll(filepath.Dir(imgPath), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(imgPath, []byte(c), 0644)
+		}
+		if err != nil {
+			t.Fatalf("failed to create the image of %s: %s", c, err)
+		}
+	}
+
+	installDir, hasInstallDir := os.LookupEnv(sys.SYMPI_INSTALL_DIR_ENV)
+	systemDir, hasSystemDir := os.LookupEnv(sys.SYMPI_SYSTEM_DIR_ENV)
+	os.Setenv(sys.SYMPI_INSTALL_DIR_ENV, dir)
+	os.Setenv(sys.SYMPI_SYSTEM_DIR_ENV, filepath.Join(dir, "system"))
+	return dir, func() {
+		restoreEnv(sys.SYMPI_INSTALL_DIR_ENV, installDir, hasInstallDir)
+		restoreEnv(sys.SYMPI_SYSTEM_DIR_ENV, systemDir, hasSystemDir)
+		os.RemoveAll(dir)
+	}
+}
+
+func restoreEnv(name string, value string, set bool) {
+	if set {
+		os.Setenv(name, value)
+	} else {
+		os.Unsetenv(name)
+	}
+}
+
+// newInspectConfig returns a configuration whose Singularity reports that the images use a MPI
+func newInspectConfig(containerMPI implem.Info) *sys.Config {
+	inspect := "MPI_Implementation: " + containerMPI.ID + "\nMPI_Version: " + containerMPI.Version + "\nModel: bind\n"
+	return &sys.Config{
+		SingularityBin:  "singularity",
+		MPICompatPolicy: mpi.PolicyMinor,
+		Runner:          &mock.Runner{Results: map[string]mock.Result{"singularity": {Stdout: inspect}}},
+	}
+}
+
+func TestCheckMPIDependents(t *testing.T) {
+	ompi402 := implem.Info{ID: implem.OMPI, Version: "4.0.2"}
+
+	tests := []struct {
+		name             string
+		installs         []string
+		containers       []string
+		force            bool
+		expectedError    bool
+		expectedWarnings []string
+	}{
+		{
+			name:       "no container",
+			installs:   []string{"openmpi-4.0.2"},
+			containers: nil,
+		},
+		{
+			name:             "no fallback",
+			installs:         []string{"openmpi-4.0.2", "mpich-3.3"},
+			containers:       []string{"helloworld"},
+			expectedError:    true,
+			expectedWarnings: []string{"helloworld (openmpi 4.0.2) runs with openmpi:4.0.2, no other installed MPI is compatible with it"},
+		},
+		{
+			name:             "no fallback forced",
+			installs:         []string{"openmpi-4.0.2"},
+			containers:       []string{"helloworld"},
+			force:            true,
+			expectedWarnings: []string{"no other installed MPI is compatible with it"},
+		},
+		{
+			name:             "fallback",
+			installs:         []string{"openmpi-4.0.2", "openmpi-4.0.3"},
+			containers:       []string{"helloworld", "netpipe"},
+			expectedWarnings: []string{"helloworld (openmpi 4.0.2) runs with openmpi:4.0.2, it will run with openmpi 4.0.3 instead", "netpipe (openmpi 4.0.2)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cleanup := setupSympiDir(t, tt.installs, tt.containers)
+			defer cleanup()
+
+			var w bytes.Buffer
+			err := checkMPIDependents(&w, ompi402, tt.force, newInspectConfig(ompi402))
+			if tt.expectedError && err == nil {
+				t.Fatalf("checkMPIDependents() succeeded, warnings: %s", w.String())
+			}
+			if !tt.expectedError && err != nil {
+				t.Fatalf("checkMPIDependents() failed: %s", err)
+			}
+			for _, warning := range tt.expectedWarnings {
+				if !strings.Contains(w.String(), warning) {
+					t.Fatalf("%q not in the warnings %q", warning, w.String())
+				}
+			}
+			if len(tt.expectedWarnings) == 0 && w.Len() > 0 {
+				t.Fatalf("unexpected warnings: %s", w.String())
+			}
+		})
+	}
+}
+
+func TestGetMPIDependents(t *testing.T) {
+	dir, cleanup := setupSympiDir(t, []string{"openmpi-4.0.2", "openmpi-4.1.4"}, []string{"helloworld"})
+	defer cleanup()
+
+	// The containers running with another host MPI do not depend on the uninstalled one
+	sysCfg := newInspectConfig(implem.Info{ID: implem.OMPI, Version: "4.0.2"})
+	dependents, err := getMPIDependents(implem.Info{ID: implem.OMPI, Version: "4.1.4"}, sysCfg)
+	if err != nil {
+		t.Fatalf("getMPIDependents() failed: %s", err)
+	}
+	if len(dependents) != 0 {
+		t.Fatalf("unexpected dependents %v", dependents)
+	}
+
+	dependents, err = getMPIDependents(implem.Info{ID: implem.OMPI, Version: "4.0.2"}, sysCfg)
+	if err != nil {
+		t.Fatalf("getMPIDependents() failed: %s", err)
+	}
+	if len(dependents) != 1 || dependents[0].name != "helloworld" || dependents[0].fallback.ID != "" {
+		t.Fatalf("invalid dependents %v of the installations in %s", dependents, dir)
+	}
+}
+
+func TestRemoveMPIInstall(t *testing.T) {
+	dir, cleanup := setupSympiDir(t, []string{"openmpi-4.0.2"}, nil)
+	defer cleanup()
+	targetDir := filepath.Join(dir, sys.MPIInstallDirPrefix+"openmpi-4.0.2")
+	linkDir := filepath.Join(dir, sys.MPIInstallDirPrefix+"openmpi-4.0.2+alias")
+	err := linkMPIInstall(linkDir, targetDir)
+	if err != nil {
+		t.Fatalf("linkMPIInstall() failed: %s", err)
+	}
+
+	// An installation other versions link to is not removed, through an uninstall either
+	err = removeMPIInstall(targetDir)
+	if err == nil || !strings.Contains(err.Error(), "openmpi:4.0.2+alias") {
+		t.Fatalf("removeMPIInstall() did not refuse to remove %s: %v", targetDir, err)
+	}
+	err = uninstallMPIfromHost("openmpi:4.0.2", false, newInspectConfig(implem.Info{ID: implem.OMPI, Version: "4.0.2"}))
+	if err == nil || !strings.Contains(err.Error(), "openmpi:4.0.2+alias") {
+		t.Fatalf("uninstallMPIfromHost() did not refuse to remove %s: %v", targetDir, err)
+	}
+	if _, err := os.Stat(targetDir); err != nil {
+		t.Fatalf("%s was removed", targetDir)
+	}
+
+	// Removing a link leaves the installation it points to untouched
+	err = removeMPIInstall(linkDir)
+	if err != nil {
+		t.Fatalf("removeMPIInstall() failed: %s", err)
+	}
+	if _, err := os.Lstat(linkDir); !os.IsNotExist(err) {
+		t.Fatalf("%s was not removed", linkDir)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "bin", "mpirun")); err != nil {
+		t.Fatalf("%s was modified", targetDir)
+	}
+
+	// Without links, the installation is removed
+	err = removeMPIInstall(targetDir)
+	if err != nil {
+		t.Fatalf("removeMPIInstall() failed: %s", err)
+	}
+	if _, err := os.Lstat(targetDir); !os.IsNotExist(err) {
+		t.Fatalf("%s was not removed", targetDir)
+	}
+}
+
+func TestLinkMPIInstall(t *testing.T) {
+	dir, cleanup := setupSympiDir(t, []string{"openmpi-4.0.2", "openmpi-4.0.3"}, nil)
+	defer cleanup()
+	targetDir := filepath.Join(dir, sys.MPIInstallDirPrefix+"openmpi-4.0.2")
+
+	err := linkMPIInstall(filepath.Join(dir, sys.MPIInstallDirPrefix+"openmpi-4.0.3"), targetDir)
+	if !errors.Is(err, sympierr.ErrFileExists) {
+		t.Fatalf("linkMPIInstall() replaced an existing installation: %v", err)
+	}
+
+	// Links point to the actual installation, even when created from another link
+	linkDir := filepath.Join(dir, sys.MPIInstallDirPrefix+"openmpi-4.0.2+a")
+	err = linkMPIInstall(linkDir, targetDir)
+	if err != nil {
+		t.Fatalf("linkMPIInstall() failed: %s", err)
+	}
+	otherLinkDir := filepath.Join(dir, sys.MPIInstallDirPrefix+"openmpi-4.0.2+b")
+	err = linkMPIInstall(otherLinkDir, linkDir)
+	if err != nil {
+		t.Fatalf("linkMPIInstall() failed: %s", err)
+	}
+	expected, _ := filepath.EvalSymlinks(targetDir)
+	if target, err := os.Readlink(otherLinkDir); err != nil || target != expected {
+		t.Fatalf("%s points to %s instead of %s", otherLinkDir, target, expected)
+	}
+	links, err := getMPIInstallLinks(targetDir)
+	if err != nil {
+		t.Fatalf("getMPIInstallLinks() failed: %s", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("got links %v to %s", links, targetDir)
+	}
+}
+
+func TestFindDuplicateMPIInstall(t *testing.T) {
+	dir, cleanup := setupSympiDir(t, []string{"openmpi-4.0.2", "openmpi-4.0.2+gcc11"}, nil)
+	defer cleanup()
+
+	kvs := []kv.KV{
+		{Key: "4.0.2", Value: "https://download.open-mpi.org/release/open-mpi/v4.0/openmpi-4.0.2.tar.bz2"},
+		{Key: "4.0", Value: "https://download.open-mpi.org/release/open-mpi/v4.0/openmpi-4.0.2.tar.bz2"},
+		{Key: "4.0.2+gcc11", Value: "https://download.open-mpi.org/release/open-mpi/v4.0/openmpi-4.0.3.tar.bz2"},
+		{Key: "4.0.3", Value: "https://download.open-mpi.org/release/open-mpi/v4.0/openmpi-4.0.3.tar.bz2"},
+	}
+
+	tests := []struct {
+		name        string
+		version     string
+		expectedDir string
+	}{
+		{name: "same source", version: "4.0", expectedDir: filepath.Join(dir, sys.MPIInstallDirPrefix+"openmpi-4.0.2")},
+		{name: "same version", version: "4.0.2"},
+		{name: "only a variant with the same source", version: "4.0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpiCfg := implem.Info{ID: implem.OMPI, Version: tt.version}
+			mpiCfg.SetURLs(kv.GetValue(kvs, tt.version))
+			installDir := findDuplicateMPIInstall(&mpiCfg, kvs)
+			if installDir != tt.expectedDir {
+				t.Fatalf("got %q instead of %q", installDir, tt.expectedDir)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		run           func(t *testing.T, dir string) error
+		expectedError error
+	}{
+		{
+			name: "MPI not installed",
+			run: func(t *testing.T, dir string) error {
+				return loadMPI("openmpi:4.0.9", sys.PathOrderPrepend)
+			},
+			expectedError: sympierr.ErrMPINotInstalled,
+		},
+		{
+			name: "not initialized",
+			run: func(t *testing.T, dir string) error {
+				if file, err := getEnvFile(); err == nil && util.FileExists(file) {
+					t.Skipf("the tests run in a session initialized with sympi_init (%s)", file)
+				}
+				return loadMPI("openmpi:4.0.2", sys.PathOrderPrepend)
+			},
+			expectedError: sympierr.ErrNotInitialized,
+		},
+		{
+			name: "version not found",
+			run: func(t *testing.T, dir string) error {
+				sysCfg := sys.Config{EtcDir: dir}
+				err := ioutil.WriteFile(filepath.Join(dir, "openmpi.conf"), []byte("4.0.2=https://download.open-mpi.org/release/open-mpi/v4.0/openmpi-4.0.2.tar.bz2\n"), 0644)
+				if err != nil {
+					return err
+				}
+				return installMPIonHost(context.Background(), "openmpi:9.9.9", &sysCfg)
+			},
+			expectedError: sympierr.ErrVersionNotFound,
+		},
+		{
+			name: "incompatible MPI",
+			run: func(t *testing.T, dir string) error {
+				sysCfg := sys.Config{MPICompatPolicy: mpi.PolicyMinor}
+				_, err := findCompatibleMPI(implem.Info{ID: implem.MPICH, Version: "3.3"}, &sysCfg)
+				return err
+			},
+			expectedError: sympierr.ErrIncompatibleMPI,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, cleanup := setupSympiDir(t, []string{"openmpi-4.0.2"}, nil)
+			defer cleanup()
+
+			err := tt.run(t, dir)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("got error %v instead of %q", err, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestGetRemoteRunArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+		fail     bool
+	}{
+		{name: "no option", args: []string{"-run", "helloworld", "-remote", "login"}},
+		{
+			name:     "options",
+			args:     []string{"-run", "helloworld", "-remote", "login", "-v", "-np", "4", "-pwd", "/opt/my app", "-cleanenv"},
+			expected: []string{"-cleanenv=true", "-np=4", "-pwd=/opt/my app"},
+		},
+		{name: "unsupported option", args: []string{"-run", "helloworld", "-remote", "login", "-run-spec", "spec.yaml"}, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("sympi", flag.ContinueOnError)
+			fs.String("run", "", "")
+			fs.String("remote", "", "")
+			fs.Bool("v", false, "")
+			fs.Int64("np", 0, "")
+			fs.String("pwd", "", "")
+			fs.Bool("cleanenv", false, "")
+			fs.String("run-spec", "", "")
+			err := fs.Parse(tt.args)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %s", tt.args, err)
+			}
+
+			args, err := getRemoteRunArgs(fs)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("getRemoteRunArgs() succeeded with %q", tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getRemoteRunArgs() failed: %s", err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Fatalf("forwarded %q instead of %q", args, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckCompositionGlibc(t *testing.T) {
+	hybrid := container.Config{Path: "/tmp/primary.sif", Model: container.HybridModel}
+	aux := container.Config{Path: "/tmp/aux.sif", Model: container.BindModel}
+
+	tests := []struct {
+		name          string
+		containers    []*container.Config
+		skip          bool
+		expectedErr   error
+		expectedCalls int
+	}{
+		{name: "hybrid", containers: []*container.Config{&hybrid}},
+		{name: "auxiliary bind container", containers: []*container.Config{&hybrid, &aux}, expectedErr: sympierr.ErrGlibcMismatch, expectedCalls: 2},
+		{name: "skipped", containers: []*container.Config{&hybrid, &aux}, skip: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mock.Runner{Results: map[string]mock.Result{
+				"getconf":     {Stdout: "glibc 2.35\n"},
+				"singularity": {Stdout: "glibc 2.28\n"},
+			}}
+			sysCfg := sys.Config{SingularityBin: "singularity", SkipGlibcCheck: tt.skip, Runner: &r}
+			err := checkCompositionGlibc(tt.containers, &sysCfg)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("checkCompositionGlibc() returned %v instead of %v", err, tt.expectedErr)
+			}
+			if len(r.Calls()) != tt.expectedCalls {
+				t.Fatalf("got calls %v instead of %d", r.Calls(), tt.expectedCalls)
+			}
+		})
+	}
+}
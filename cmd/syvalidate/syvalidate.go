@@ -264,6 +264,7 @@ func main() {
 	configFile := flag.String("configfile", sysCfg.EtcDir+"/openmpi.conf", "Path to the configuration file specifying which versions of a given implementation of MPI to test")
 	outputFile := flag.String("outputFile", "", "Full path to the output file")
 	verbose := flag.Bool("v", false, "Enable verbose mode")
+	verboseBuild := flag.Bool("verbose-build", false, "Display the output of configure/make on the console while building software")
 	netpipe := flag.Bool("netpipe", false, "Run NetPipe as test")
 	imb := flag.Bool("imb", false, "Run IMB as test")
 	debug := flag.Bool("d", false, "Enable debug mode")
@@ -278,6 +279,7 @@ func main() {
 	sysCfg.IMB = *imb
 	sysCfg.Nrun = *nRun
 	sysCfg.Verbose = *verbose
+	sysCfg.VerboseBuild = *verboseBuild
 	sysCfg.Debug = *debug
 	if *persistent {
 		sysCfg.Persistent = sys.GetSympiDir()
@@ -309,7 +311,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to figure out the type of experiment: %s", err)
 	}
-	sysCfg.ScratchDir = buildenv.GetDefaultScratchDir(mpiImplem)
+	sysCfg.ScratchDir = buildenv.GetDefaultScratchDir(mpiImplem, &sysCfg)
 	// If the scratch dir exists, we delete it to start fresh
 	err = util.DirInit(sysCfg.ScratchDir)
 	if err != nil {
@@ -325,7 +327,7 @@ func main() {
 			log.Fatalf("failed to initialize directory %s: %s", sysCfg.ScratchDir, err)
 		}
 
-		err = checker.CheckSystemConfig()
+		err = checker.CheckSystemConfig(&sysCfg)
 		if err != nil {
 			log.Fatalf("the system is not correctly setup: %s", err)
 		}
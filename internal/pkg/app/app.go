@@ -21,4 +21,13 @@ type Info struct {
 
 	// InstallCmd is the command to use to install the application
 	InstallCmd string
+
+	// Args are the arguments to pass to the application's binary (optional)
+	Args []string
+
+	// NP is the number of ranks of the application when it is part of a MPMD command (optional)
+	NP int64
+
+	// WorkDir is the directory in the container from where the application is started (optional)
+	WorkDir string
 }
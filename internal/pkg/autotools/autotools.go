@@ -6,12 +6,12 @@
 package autotools
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"log"
-	"os/exec"
 	"path/filepath"
 
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
 )
 
@@ -25,10 +25,19 @@ type Config struct {
 
 	// ExtraConfigureArgs is a set of string that are passed to configure
 	ExtraConfigureArgs []string
+
+	// LiveOutput specifies whether the output of configure is displayed on the console while it runs
+	LiveOutput bool
+
+	// Env is the environment of configure, e.g., to set CFLAGS; the environment of sympi if nil
+	Env []string
+
+	// Runner is the runner used to execute configure; an ExecRunner if nil
+	Runner sys.Runner
 }
 
 // Configure handles the classic configure commands
-func Configure(cfg *Config) error {
+func Configure(ctx context.Context, cfg *Config) error {
 	configurePath := filepath.Join(cfg.Source, "configure")
 	if !util.FileExists(configurePath) {
 		fmt.Printf("-> %s does not exist, skipping the configuration step\n", configurePath)
@@ -45,17 +54,14 @@ func Configure(cfg *Config) error {
 	}
 
 	log.Printf("-> Running 'configure': %s %s\n", configurePath, cmdArgs)
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command(configurePath)
-	if len(cmdArgs) > 0 {
-		cmd = exec.Command(configurePath, cmdArgs...)
+	var r sys.Runner = sys.ExecRunner{}
+	if cfg.Runner != nil {
+		r = cfg.Runner
 	}
-	cmd.Dir = cfg.Source
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	err := cmd.Run()
+	r = sys.WithExecOptions(r, cfg.Source, cfg.Env, cfg.LiveOutput)
+	stdout, stderr, _, err := r.Run(ctx, configurePath, cmdArgs...)
 	if err != nil {
-		return fmt.Errorf("command failed: %s - stdout: %s - stderr: %s", err, stdout.String(), stderr.String())
+		return fmt.Errorf("command failed: %w - stdout: %s - stderr: %s", err, stdout, stderr)
 	}
 
 	return nil
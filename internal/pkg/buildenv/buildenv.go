@@ -11,7 +11,6 @@
 package buildenv
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -37,6 +36,9 @@ type SoftwarePackage struct {
 	// URL is the source of the software
 	URL string
 
+	// Mirrors is the list of alternate sources of the software, tried in order when URL fails
+	Mirrors []string
+
 	// InstallCmd is the command used to install the software
 	InstallCmd string
 
@@ -62,10 +64,19 @@ type Info struct {
 
 	// Env is the environment to use with the build environment
 	Env []string
+
+	// LiveOutput specifies whether the output of the build commands is displayed on the console while they run
+	LiveOutput bool
+
+	// Runner is the runner used to execute the build commands; an ExecRunner if nil
+	Runner sys.Runner
 }
 
+// DebugBuildFlags are the compiler flags used to build MPI with debug symbols and without optimizations
+var DebugBuildFlags = []string{"CFLAGS=-g -O0", "CXXFLAGS=-g -O0", "FFLAGS=-g -O0", "FCFLAGS=-g -O0"}
+
 // Unpack extracts the source code from a package/tarball/zip file.
-func (env *Info) Unpack() error {
+func (env *Info) Unpack(ctx context.Context) error {
 	log.Println("- Unpacking software...")
 
 	// Sanity checks
@@ -86,7 +97,7 @@ func (env *Info) Unpack() error {
 	// (and it is a fair assumption for our current context)
 	tarPath, err := exec.LookPath("tar")
 	if err != nil {
-		return fmt.Errorf("tar is not available: %s", err)
+		return fmt.Errorf("tar is not available: %w", err)
 	}
 
 	tarArg := util.GetTarArgs(format)
@@ -96,26 +107,22 @@ func (env *Info) Unpack() error {
 
 	// Untar the package
 	log.Printf("-> Executing from %s: %s %s %s \n", env.BuildDir, tarPath, tarArg, env.SrcPath)
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command(tarPath, tarArg, env.SrcPath)
-	cmd.Dir = env.BuildDir
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	err = cmd.Run()
+	r := sys.WithExecOptions(env.getRunner(), env.BuildDir, nil, false)
+	stdout, stderr, _, err := r.Run(ctx, tarPath, tarArg, env.SrcPath)
 	if err != nil {
-		return fmt.Errorf("command failed: %s - stdout: %s - stderr: %s", err, stdout.String(), stderr.String())
+		return fmt.Errorf("command failed: %w - stdout: %s - stderr: %s", err, stdout, stderr)
 	}
 
 	// We do not need the package anymore, delete it
 	err = os.Remove(env.SrcPath)
 	if err != nil {
-		return fmt.Errorf("failed to delete %s: %s", env.SrcPath, err)
+		return fmt.Errorf("failed to delete %s: %w", env.SrcPath, err)
 	}
 
 	// We save the directory created while untaring the tarball
 	entries, err := ioutil.ReadDir(env.BuildDir)
 	if err != nil {
-		return fmt.Errorf("failed to read directory %s: %s", env.BuildDir, err)
+		return fmt.Errorf("failed to read directory %s: %w", env.BuildDir, err)
 	}
 	if len(entries) != 1 {
 		return fmt.Errorf("inconsistent temporary %s directory, %d files instead of 1", env.BuildDir, len(entries))
@@ -126,41 +133,32 @@ func (env *Info) Unpack() error {
 }
 
 // RunMake executes the appropriate command to build the software
-func (env *Info) RunMake(priv bool, args []string, stage string) error {
+func (env *Info) RunMake(ctx context.Context, priv bool, args []string, stage string) error {
 	// Some sanity checks
 	if env.SrcDir == "" {
 		return fmt.Errorf("invalid parameter(s)")
 	}
 
-	var stdout, stderr bytes.Buffer
-
 	if stage != "" {
 		args = append(args, stage)
 	}
 
 	args = append([]string{"-j4"}, args...)
 	logMsg := "make " + strings.Join(args, " ")
-	var makeCmd *exec.Cmd
-	if !priv {
-		makeCmd = exec.Command("make", args...)
-	} else {
+	makeBin := "make"
+	if priv {
 		sudoBin, err := exec.LookPath("sudo")
 		if err != nil {
-			return fmt.Errorf("failed to find the sudo binary: %s", err)
+			return fmt.Errorf("failed to find the sudo binary: %w", err)
 		}
 		args = append([]string{"make"}, args...)
-		makeCmd = exec.Command(sudoBin, args...)
+		makeBin = sudoBin
 	}
 	log.Printf("* Executing (from %s): %s", env.SrcDir, logMsg)
-	if len(env.Env) > 0 {
-		makeCmd.Env = env.Env
-	}
-	makeCmd.Dir = env.SrcDir
-	makeCmd.Stderr = &stderr
-	makeCmd.Stdout = &stdout
-	err := makeCmd.Run()
+	r := sys.WithExecOptions(env.getRunner(), env.SrcDir, env.Env, env.LiveOutput)
+	stdout, stderr, _, err := r.Run(ctx, makeBin, args...)
 	if err != nil {
-		return fmt.Errorf("command failed: %s - stdout: %s - stderr: %s", err, stdout.String(), stderr.String())
+		return fmt.Errorf("command failed: %w - stdout: %s - stderr: %s", err, stdout, stderr)
 	}
 
 	return nil
@@ -181,7 +179,7 @@ func (env *Info) copyTarball(p *SoftwarePackage) error {
 	// The begining of the URL starts with 'file://' which we do not want
 	err := util.CopyFile(p.URL[7:], targetTarballPath)
 	if err != nil {
-		return fmt.Errorf("cannot copy file %s to %s: %s", p.URL, targetTarballPath, err)
+		return fmt.Errorf("cannot copy file %s to %s: %w", p.URL, targetTarballPath, err)
 	}
 
 	env.SrcPath = filepath.Join(env.BuildDir, p.tarball)
@@ -190,7 +188,7 @@ func (env *Info) copyTarball(p *SoftwarePackage) error {
 }
 
 // Get is the function to get a given source code
-func (env *Info) Get(p *SoftwarePackage) error {
+func (env *Info) Get(ctx context.Context, p *SoftwarePackage, sysCfg *sys.Config) error {
 	log.Printf("- Getting %s from %s...\n", p.Name, p.URL)
 
 	// Sanity checks
@@ -208,12 +206,12 @@ func (env *Info) Get(p *SoftwarePackage) error {
 	case util.FileURL:
 		err := env.copyTarball(p)
 		if err != nil {
-			return fmt.Errorf("impossible to copy the tarball: %s", err)
+			return fmt.Errorf("impossible to copy the tarball: %w", err)
 		}
 	case util.HttpURL:
-		err := env.download(p)
+		err := env.download(ctx, p, sysCfg)
 		if err != nil {
-			return fmt.Errorf("impossible to download %s: %s", p.Name, err)
+			return fmt.Errorf("impossible to download %s: %w", p.Name, err)
 		}
 	default:
 		return fmt.Errorf("impossible to detect URL type: %s", p.URL)
@@ -222,47 +220,6 @@ func (env *Info) Get(p *SoftwarePackage) error {
 	return nil
 }
 
-func (env *Info) download(p *SoftwarePackage) error {
-	// Sanity checks
-	if p.URL == "" || env.BuildDir == "" {
-		return fmt.Errorf("invalid parameter(s)")
-	}
-
-	log.Printf("- Downloading %s from %s...", p.Name, p.URL)
-
-	// todo: do not assume wget
-	binPath, err := exec.LookPath("wget")
-	if err != nil {
-		return fmt.Errorf("cannot find wget: %s", err)
-	}
-
-	log.Printf("* Executing from %s: %s %s", env.BuildDir, binPath, p.URL)
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command(binPath, p.URL)
-	cmd.Dir = env.BuildDir
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("command failed: %s - stdout: %s - stderr: %s", err, stdout.String(), stderr.String())
-	}
-
-	// todo: we currently assume that we have one and only one file in the
-	// directory This is not a fair assumption, especially while debugging
-	// when we do not wipe out the temporary directories
-	files, err := ioutil.ReadDir(env.BuildDir)
-	if err != nil {
-		return fmt.Errorf("failed to read directory %s: %s", env.BuildDir, err)
-	}
-	if len(files) != 1 {
-		return fmt.Errorf("inconsistent temporary %s directory, %d files instead of 1", env.BuildDir, len(files))
-	}
-	p.tarball = files[0].Name()
-	env.SrcPath = filepath.Join(env.BuildDir, files[0].Name())
-
-	return nil
-}
-
 // IsInstalled checks whether a specific software package is already installed in a specific build environment
 func (env *Info) IsInstalled(p *SoftwarePackage) bool {
 	switch util.DetectURLType(p.URL) {
@@ -317,8 +274,8 @@ func (env *Info) lookPath(bin string) string {
 }
 
 // Install is a generic function to install a software
-func (env *Info) Install(p *SoftwarePackage) error {
-	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*time.Second)
+func (env *Info) Install(ctx context.Context, p *SoftwarePackage) error {
+	ctx, cancel := context.WithTimeout(ctx, sys.CmdTimeout*time.Second)
 	defer cancel()
 
 	cmdElts := strings.Split(p.InstallCmd, " ")
@@ -326,20 +283,23 @@ func (env *Info) Install(p *SoftwarePackage) error {
 
 	log.Printf("Executing from %s: %s %s.", env.SrcDir, binPath, strings.Join(cmdElts[1:], " "))
 	log.Printf("Environment: %s\n", strings.Join(env.Env, "\n"))
-	cmd := exec.CommandContext(ctx, binPath, cmdElts[1:]...)
-	cmd.Dir = env.SrcDir
-	cmd.Env = env.Env
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	r := sys.WithExecOptions(env.getRunner(), env.SrcDir, env.Env, env.LiveOutput)
+	stdout, stderr, _, err := r.Run(ctx, binPath, cmdElts[1:]...)
 	if err != nil {
-		return fmt.Errorf("failed to install %s: %s; stdout: %s; stderr: %s", p.Name, err, stdout.String(), stderr.String())
+		return fmt.Errorf("failed to install %s: %w; stdout: %s; stderr: %s", p.Name, err, stdout, stderr)
 	}
 
 	return nil
 }
 
+// getRunner returns the runner to use to execute the build commands
+func (env *Info) getRunner() sys.Runner {
+	if env.Runner == nil {
+		return sys.ExecRunner{}
+	}
+	return env.Runner
+}
+
 // CreateDefaultHostEnvCfg returns the default configuration to install/manage MPI on the host
 func CreateDefaultHostEnvCfg(env *Info, mpi *implem.Info, sysCfg *sys.Config) error {
 	/* SET THE BUILD DIRECTORY */
@@ -349,7 +309,7 @@ func CreateDefaultHostEnvCfg(env *Info, mpi *implem.Info, sysCfg *sys.Config) er
 	// We always initialize the build directory for MPI on the host
 	err := util.DirInit(env.BuildDir)
 	if err != nil {
-		return fmt.Errorf("failed to initialize directory %s: %s", env.BuildDir, err)
+		return fmt.Errorf("failed to initialize directory %s: %w", env.BuildDir, err)
 	}
 
 	/* SET THE INSTALL DIRECTORY */
@@ -359,27 +319,44 @@ func CreateDefaultHostEnvCfg(env *Info, mpi *implem.Info, sysCfg *sys.Config) er
 		env.InstallDir = filepath.Join(sysCfg.ScratchDir, sys.MPIInstallDirPrefix+mpi.ID+"-"+mpi.Version)
 		err := util.DirInit(env.InstallDir)
 		if err != nil {
-			return fmt.Errorf("failed to initialize directory %s: %s", env.InstallDir, err)
+			return fmt.Errorf("failed to initialize directory %s: %w", env.InstallDir, err)
 		}
 	} else {
 		env.InstallDir = persistent.GetPersistentHostMPIInstallDir(mpi, sysCfg)
 	}
 
+	/* SET THE COMPILER FLAGS */
+
+	if sysCfg.DebugBuild {
+		env.Env = append(os.Environ(), DebugBuildFlags...)
+	}
+
 	/* SET THE SCRATCH DIRECTORY */
 
 	env.ScratchDir = filepath.Join(sysCfg.ScratchDir, "scratch_"+mpi.ID+"_"+mpi.Version)
 	// We always initialize the scratch directory for MPI on the host
 	err = util.DirInit(env.ScratchDir)
 	if err != nil {
-		return fmt.Errorf("failed to initialize directory %s: %s", env.ScratchDir, err)
+		return fmt.Errorf("failed to initialize directory %s: %w", env.ScratchDir, err)
 	}
 
 	return nil
 }
 
-// GetDefaultScratchDir returns the default directory to use as scratch directory
-func GetDefaultScratchDir(mpi *implem.Info) string {
-	return filepath.Join(sys.GetSympiDir(), "scratch-"+mpi.ID)
+// GetDefaultScratchDir returns the default directory to use as scratch directory.
+// The base directory is, by order of precedence, sysCfg.ScratchBaseDir, the
+// base directory configured for the MPI implementation and the sympi directory.
+func GetDefaultScratchDir(mpi *implem.Info, sysCfg *sys.Config) string {
+	baseDir := sys.GetSympiDir()
+	if sysCfg != nil {
+		if dir, ok := sysCfg.ScratchDirs[mpi.ID]; ok && dir != "" {
+			baseDir = dir
+		}
+		if sysCfg.ScratchBaseDir != "" {
+			baseDir = sysCfg.ScratchBaseDir
+		}
+	}
+	return filepath.Join(baseDir, "scratch-"+mpi.ID)
 }
 
 // Init ensures that the buildenv is correctly initialized
@@ -387,19 +364,19 @@ func (e *Info) Init(sysCfg *sys.Config) error {
 	if !util.PathExists(e.ScratchDir) {
 		err := os.MkdirAll(e.ScratchDir, 0755)
 		if err != nil {
-			return fmt.Errorf("failed to create scratch directory %s: %s", e.ScratchDir, err)
+			return fmt.Errorf("failed to create scratch directory %s: %w", e.ScratchDir, err)
 		}
 	}
 	if !util.PathExists(e.BuildDir) {
 		err := os.MkdirAll(e.BuildDir, 0755)
 		if err != nil {
-			return fmt.Errorf("failed to create build directory %s: %s", e.BuildDir, err)
+			return fmt.Errorf("failed to create build directory %s: %w", e.BuildDir, err)
 		}
 	}
 	if !util.PathExists(e.InstallDir) {
 		err := os.MkdirAll(e.InstallDir, 0755)
 		if err != nil {
-			return fmt.Errorf("failed to create build directory %s: %s", e.InstallDir, err)
+			return fmt.Errorf("failed to create build directory %s: %w", e.InstallDir, err)
 		}
 	}
 	return nil
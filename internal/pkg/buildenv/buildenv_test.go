@@ -0,0 +1,91 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package buildenv
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestGetDefaultScratchDir(t *testing.T) {
+	dirs := map[string]string{implem.OMPI: "/fast1"}
+	tests := []struct {
+		name     string
+		mpiID    string
+		sysCfg   *sys.Config
+		expected string
+	}{
+		{
+			name:     "no configuration",
+			mpiID:    implem.OMPI,
+			sysCfg:   nil,
+			expected: filepath.Join(sys.GetSympiDir(), "scratch-"+implem.OMPI),
+		},
+		{
+			name:     "implementation configured",
+			mpiID:    implem.OMPI,
+			sysCfg:   &sys.Config{ScratchDirs: dirs},
+			expected: filepath.Join("/fast1", "scratch-"+implem.OMPI),
+		},
+		{
+			name:     "other implementation",
+			mpiID:    implem.MPICH,
+			sysCfg:   &sys.Config{ScratchDirs: dirs},
+			expected: filepath.Join(sys.GetSympiDir(), "scratch-"+implem.MPICH),
+		},
+		{
+			name:     "base directory takes precedence",
+			mpiID:    implem.OMPI,
+			sysCfg:   &sys.Config{ScratchDirs: dirs, ScratchBaseDir: "/tmp/scratch"},
+			expected: filepath.Join("/tmp/scratch", "scratch-"+implem.OMPI),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpi := implem.Info{ID: tt.mpiID}
+			dir := GetDefaultScratchDir(&mpi, tt.sysCfg)
+			if dir != tt.expected {
+				t.Fatalf("GetDefaultScratchDir() returned %s instead of %s", dir, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildCommands(t *testing.T) {
+	r := &mock.Runner{}
+	env := Info{
+		SrcDir: "/tmp/src",
+		Runner: r,
+	}
+
+	err := env.RunMake(context.Background(), false, nil, "install")
+	if err != nil {
+		t.Fatalf("RunMake() failed: %s", err)
+	}
+	err = env.Install(context.Background(), &SoftwarePackage{Name: "test", InstallCmd: "make install-all"})
+	if err != nil {
+		t.Fatalf("Install() failed: %s", err)
+	}
+
+	expected := []string{"make -j4 install", "make install-all"}
+	if !reflect.DeepEqual(r.Calls(), expected) {
+		t.Fatalf("commands are %v instead of %v", r.Calls(), expected)
+	}
+
+	// Failures of the commands are reported
+	r.Results = map[string]mock.Result{"make": {Stderr: "no rule to make target", ExitCode: 2}}
+	err = env.RunMake(context.Background(), false, nil, "")
+	if err == nil {
+		t.Fatalf("RunMake() succeeded while make failed")
+	}
+}
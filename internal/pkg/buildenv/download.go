@@ -0,0 +1,274 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package buildenv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+const (
+	// downloadAttempts is the maximum number of times we try to download a file when facing transient errors
+	downloadAttempts = 3
+
+	// downloadRetryDelay is the delay between two download attempts, multiplied by the number of the attempt
+	downloadRetryDelay = 5 * time.Second
+)
+
+// httpStatusError is the error returned when a server replied with an unexpected HTTP status
+type httpStatusError struct {
+	code int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status: %d %s", e.code, http.StatusText(e.code))
+}
+
+// isTransient checks whether an error while downloading a file is worth retrying
+func isTransient(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusTooManyRequests ||
+			statusErr.code == http.StatusRequestedRangeNotSatisfiable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// getHTTPClient returns the client used to download files. The proxy is set from the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func getHTTPClient(sysCfg *sys.Config) *http.Client {
+	timeout := sysCfg.DownloadTimeout
+	if timeout == 0 {
+		timeout = sys.DefaultDownloadTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+// fetch downloads a file to dst. If dst already exists, e.g., from a previous
+// interrupted attempt, we ask the server for the missing bytes only; if the server does
+// not support range requests, the file is downloaded from scratch.
+func fetch(ctx context.Context, client *http.Client, u string, dst string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", u, err)
+	}
+
+	var offset int64
+	if fi, err := os.Stat(dst); err == nil && fi.Size() > 0 {
+		offset = fi.Size()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		log.Printf("* Resuming download of %s at byte %d", u, offset)
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is not consistent with the remote file, start over
+		os.Remove(dst)
+		return &httpStatusError{code: resp.StatusCode}
+	default:
+		return &httpStatusError{code: resp.StatusCode}
+	}
+
+	f, err := os.OpenFile(dst, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dst, err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", u, err)
+	}
+
+	return nil
+}
+
+func getTarballName(u string) (string, error) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %s: %w", u, err)
+	}
+	name := path.Base(parsedURL.Path)
+	if name == "." || name == "/" {
+		return "", fmt.Errorf("unable to get the file name from %s", u)
+	}
+	return name, nil
+}
+
+// downloadFrom downloads a file from a given URL, retrying and resuming the download
+// when facing transient errors
+func downloadFrom(ctx context.Context, client *http.Client, u string, targetPath string) error {
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		err = fetch(ctx, client, u, targetPath)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil || !isTransient(err) || attempt == downloadAttempts {
+			break
+		}
+
+		log.Printf("[WARN] failed to download %s (attempt %d/%d): %s, retrying...", u, attempt, downloadAttempts, err)
+		select {
+		case <-ctx.Done():
+			os.Remove(targetPath)
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * downloadRetryDelay):
+		}
+	}
+
+	// We never leave a partial file behind
+	os.Remove(targetPath)
+	return err
+}
+
+// addToCache saves a copy of a downloaded file in the cache. Failing to do so is not fatal,
+// we will simply download the file again next time.
+func addToCache(downloadedPath string, cachedPath string) {
+	err := os.MkdirAll(filepath.Dir(cachedPath), 0755)
+	if err != nil {
+		log.Printf("[WARN] failed to create cache directory: %s", err)
+		return
+	}
+	err = util.CopyFile(downloadedPath, cachedPath)
+	if err != nil {
+		log.Printf("[WARN] failed to add %s to the cache: %s", downloadedPath, err)
+		os.Remove(cachedPath)
+	}
+}
+
+func (env *Info) download(ctx context.Context, p *SoftwarePackage, sysCfg *sys.Config) error {
+	// Sanity checks
+	if p.URL == "" || env.BuildDir == "" {
+		return fmt.Errorf("invalid parameter(s)")
+	}
+
+	tarball, err := getTarballName(p.URL)
+	if err != nil {
+		return err
+	}
+	targetPath := filepath.Join(env.BuildDir, tarball)
+
+	urls := append([]string{p.URL}, p.Mirrors...)
+	cachedPath, err := GetCachedPath(p.URL)
+	if err != nil {
+		return err
+	}
+	if util.FileExists(cachedPath) {
+		log.Printf("- Using %s from the cache (%s)", p.Name, cachedPath)
+		err := util.CopyFile(cachedPath, targetPath)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", cachedPath, targetPath, err)
+		}
+		p.tarball = tarball
+		env.SrcPath = targetPath
+		return nil
+	}
+	if sysCfg.Offline {
+		return fmt.Errorf("offline mode, %s is missing; download it from %s and copy it to %s: %w", tarball, strings.Join(urls, " or "), cachedPath, sympierr.ErrNotInCache)
+	}
+
+	client := getHTTPClient(sysCfg)
+	for _, u := range urls {
+		log.Printf("- Downloading %s from %s...", p.Name, u)
+		err = downloadFrom(ctx, client, u, targetPath)
+		if err == nil {
+			p.tarball = tarball
+			env.SrcPath = targetPath
+			addToCache(targetPath, cachedPath)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Printf("[WARN] failed to download %s from %s: %s", p.Name, u, err)
+	}
+
+	return fmt.Errorf("failed to download %s from all %d source(s): %w", p.Name, len(urls), err)
+}
+
+// GetCachedPath returns the path of the copy in the cache of the file available at a URL. The
+// name of the copy is prefixed with a hash of the URL since different sources can provide files
+// with the same name, e.g., the release and a fork of a MPI.
+func GetCachedPath(u string) (string, error) {
+	tarball, err := getTarballName(u)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(sys.GetCacheDir(), hex.EncodeToString(sum[:8])+"_"+tarball), nil
+}
+
+// CachePackage makes sure that the source of a software package is in the cache, downloading
+// it if necessary, and returns the path to the copy in the cache
+func CachePackage(ctx context.Context, p *SoftwarePackage, sysCfg *sys.Config) (string, error) {
+	cachedPath, err := GetCachedPath(p.URL)
+	if err != nil {
+		return "", err
+	}
+	if util.FileExists(cachedPath) {
+		return cachedPath, nil
+	}
+
+	var env Info
+	env.BuildDir, err = ioutil.TempDir("", "sympi-download-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(env.BuildDir)
+
+	err = env.download(ctx, p, sysCfg)
+	if err != nil {
+		return "", err
+	}
+	if !util.FileExists(cachedPath) {
+		return "", fmt.Errorf("failed to add %s to the cache", p.Name)
+	}
+	return cachedPath, nil
+}
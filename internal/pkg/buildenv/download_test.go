@@ -0,0 +1,166 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package buildenv
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestDownload(t *testing.T) {
+	content := "fake tarball"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		// ServeContent supports range requests, which lets us test resumed downloads
+		http.ServeContent(w, r, "test.tar.gz", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	tempDir, err := ioutil.TempDir("", "buildenv-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Make sure we do not use the cache of the user
+	sympiDir := os.Getenv(sys.SYMPI_INSTALL_DIR_ENV)
+	os.Setenv(sys.SYMPI_INSTALL_DIR_ENV, filepath.Join(tempDir, "sympi"))
+	defer os.Setenv(sys.SYMPI_INSTALL_DIR_ENV, sympiDir)
+
+	tests := []struct {
+		name        string
+		url         string
+		mirrors     []string
+		partial     string
+		offline     bool
+		cachedURL   string
+		expectedErr bool
+	}{
+		{
+			name:        "valid",
+			url:         srv.URL + "/test.tar.gz",
+			expectedErr: false,
+		},
+		{
+			name:        "not found",
+			url:         srv.URL + "/missing.tar.gz",
+			expectedErr: true,
+		},
+		{
+			name:        "mirror",
+			url:         srv.URL + "/broken/test.tar.gz",
+			mirrors:     []string{srv.URL + "/test.tar.gz"},
+			expectedErr: false,
+		},
+		{
+			name:        "resume",
+			url:         srv.URL + "/test.tar.gz",
+			partial:     content[:4],
+			expectedErr: false,
+		},
+		{
+			name:        "offline",
+			url:         srv.URL + "/test.tar.gz",
+			offline:     true,
+			expectedErr: true,
+		},
+		{
+			name:        "offline from cache",
+			url:         "http://invalid.example.com/test.tar.gz",
+			offline:     true,
+			cachedURL:   "http://invalid.example.com/test.tar.gz",
+			expectedErr: false,
+		},
+		{
+			name:        "offline with another source in cache",
+			url:         "http://invalid.example.com/test.tar.gz",
+			offline:     true,
+			cachedURL:   "http://fork.example.com/test.tar.gz",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.RemoveAll(sys.GetCacheDir())
+			if tt.cachedURL != "" {
+				os.MkdirAll(sys.GetCacheDir(), 0755)
+				cachedPath, err := GetCachedPath(tt.cachedURL)
+				if err == nil {
+					err = ioutil.WriteFile(cachedPath, []byte(content), 0644)
+				}
+				if err != nil {
+					t.Fatalf("failed to populate the cache: %s", err)
+				}
+			}
+			sysCfg := sys.Config{Offline: tt.offline}
+			env := Info{BuildDir: tempDir}
+			p := SoftwarePackage{Name: "test", URL: tt.url, Mirrors: tt.mirrors}
+			if tt.partial != "" {
+				err := ioutil.WriteFile(filepath.Join(tempDir, "test.tar.gz"), []byte(tt.partial), 0644)
+				if err != nil {
+					t.Fatalf("failed to create partial file: %s", err)
+				}
+			}
+			err := env.download(context.Background(), &p, &sysCfg)
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatalf("download of %s succeeded while expected to fail", tt.url)
+				}
+				if _, err := os.Stat(filepath.Join(tempDir, "missing.tar.gz")); err == nil {
+					t.Fatalf("partial file left behind")
+				}
+				if tt.offline && !errors.Is(err, sympierr.ErrNotInCache) {
+					t.Fatalf("unexpected error in offline mode: %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("download of %s failed: %s", tt.url, err)
+			}
+			b, err := ioutil.ReadFile(env.SrcPath)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", env.SrcPath, err)
+			}
+			if string(b) != content {
+				t.Fatalf("unexpected content: %s", string(b))
+			}
+		})
+	}
+}
+
+func TestGetCachedPath(t *testing.T) {
+	release, err := GetCachedPath("https://download.open-mpi.org/release/open-mpi/v4.0/openmpi-4.0.2.tar.bz2")
+	if err != nil {
+		t.Fatalf("GetCachedPath() failed: %s", err)
+	}
+	fork, err := GetCachedPath("https://example.com/fork/openmpi-4.0.2.tar.bz2")
+	if err != nil {
+		t.Fatalf("GetCachedPath() failed: %s", err)
+	}
+	if release == fork {
+		t.Fatalf("files from different sources share the same copy %s in the cache", release)
+	}
+	for _, p := range []string{release, fork} {
+		if filepath.Dir(p) != sys.GetCacheDir() || !strings.HasSuffix(p, "_openmpi-4.0.2.tar.bz2") {
+			t.Fatalf("invalid path %s in the cache", p)
+		}
+	}
+}
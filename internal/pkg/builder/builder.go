@@ -10,11 +10,13 @@
 package builder
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/app"
 	"github.com/sylabs/singularity-mpi/internal/pkg/autotools"
@@ -23,10 +25,12 @@ import (
 	"github.com/sylabs/singularity-mpi/internal/pkg/deffile"
 	"github.com/sylabs/singularity-mpi/internal/pkg/impi"
 	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/modulefile"
 	"github.com/sylabs/singularity-mpi/internal/pkg/mpi"
 	"github.com/sylabs/singularity-mpi/internal/pkg/mpich"
 	"github.com/sylabs/singularity-mpi/internal/pkg/openmpi"
 	"github.com/sylabs/singularity-mpi/internal/pkg/persistent"
+	"github.com/sylabs/singularity-mpi/internal/pkg/provenance"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sy"
 	"github.com/sylabs/singularity-mpi/internal/pkg/syexec"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
@@ -41,11 +45,15 @@ const (
 type GetConfigureExtraArgsFn func(*sys.Config) []string
 
 // ConfigureFn is the function prototype to configuration a specific software
-type ConfigureFn func(*buildenv.Info, *sys.Config, []string) error
+type ConfigureFn func(context.Context, *buildenv.Info, *sys.Config, []string) error
 
 // GetDeffileTemplateTagsFn is a "function pointer" to get the tags used in the definition file template for a given implementation of MPI
 type GetDeffileTemplateTagsFn func() deffile.TemplateTags
 
+// ProgressFn is a "function pointer" to call when the installation of a software moves to a new
+// phase, e.g., download, configure or make, to let the user know what is going on during long builds
+type ProgressFn func(msg string)
+
 // Builder gathers all the data specific to a software builder
 type Builder struct {
 	// PrivInstall specifies whether install needs to be executed with sudo
@@ -59,16 +67,30 @@ type Builder struct {
 
 	// GetDeffileTemplateTags is the function to call to get all template tags
 	GetDeffileTemplateTags GetDeffileTemplateTagsFn
+
+	// Progress is the function to call to report the phases of an installation (optional)
+	Progress ProgressFn
+}
+
+// reportProgress reports a new phase of an installation, when progress reporting is enabled
+func (b *Builder) reportProgress(format string, a ...interface{}) {
+	if b.Progress != nil {
+		b.Progress(fmt.Sprintf(format, a...))
+	}
 }
 
 // GenericConfigure is a generic function to configure a software, basically a wrapper around autotool's configure
-func GenericConfigure(env *buildenv.Info, sysCfg *sys.Config, extraArgs []string) error {
+func GenericConfigure(ctx context.Context, env *buildenv.Info, sysCfg *sys.Config, extraArgs []string) error {
 	var ac autotools.Config
 	ac.Install = env.InstallDir
 	ac.Source = env.SrcDir
-	err := autotools.Configure(&ac)
+	ac.ExtraConfigureArgs = extraArgs
+	ac.LiveOutput = env.LiveOutput
+	ac.Env = env.Env
+	ac.Runner = sysCfg.Runner
+	err := autotools.Configure(ctx, &ac)
 	if err != nil {
-		return fmt.Errorf("failed to configure MPI: %s", err)
+		return fmt.Errorf("failed to configure MPI: %w", err)
 	}
 
 	return nil
@@ -90,10 +112,11 @@ func findMakefile(env *buildenv.Info) ([]string, error) {
 	return nil, fmt.Errorf("unable to locate the Makefile")
 }
 
-func (b *Builder) compile(pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) syexec.Result {
+func (b *Builder) compile(ctx context.Context, pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) syexec.Result {
 	var res syexec.Result
 
 	log.Printf("- Compiling %s...\n", pkg.ID)
+	b.reportProgress("Compiling %s %s...", pkg.ID, pkg.Version)
 	if env.SrcDir == "" {
 		res.Err = fmt.Errorf("invalid parameter(s)")
 		return res
@@ -107,17 +130,17 @@ func (b *Builder) compile(pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Conf
 			if res.Err != nil {
 				return res
 			}
-			return impi.RunScript(env, sysCfg, "install")
+			return impi.RunScript(ctx, env, sysCfg, "install")
 		}
 		res.Err = fmt.Errorf("failed to figure out how to compile %s", pkg.ID)
 		return res
 	}
 
-	res.Err = env.RunMake(false, makeExtraArgs, "")
+	res.Err = env.RunMake(ctx, false, makeExtraArgs, "")
 	return res
 }
 
-func (b *Builder) install(pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) syexec.Result {
+func (b *Builder) install(ctx context.Context, pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) syexec.Result {
 	var res syexec.Result
 
 	if pkg.ID == implem.IMPI {
@@ -126,6 +149,7 @@ func (b *Builder) install(pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Conf
 	}
 
 	log.Printf("- Installing %s in %s...", pkg.ID, env.InstallDir)
+	b.reportProgress("Installing %s %s in %s...", pkg.ID, pkg.Version, env.InstallDir)
 	if env.InstallDir == "" || env.BuildDir == "" {
 		res.Err = fmt.Errorf("invalid parameter(s)")
 		return res
@@ -133,15 +157,101 @@ func (b *Builder) install(pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Conf
 
 	makeExtraArgs, err := findMakefile(env)
 	if err != nil {
-		res.Err = fmt.Errorf("unable to find Makefile: %s", err)
+		res.Err = fmt.Errorf("unable to find Makefile: %w", err)
 		return res
 	}
-	res.Err = env.RunMake(b.PrivInstall, makeExtraArgs, "install")
+	res.Err = env.RunMake(ctx, b.PrivInstall, makeExtraArgs, "install")
 	return res
 }
 
-// InstallHostMPI installs a specific version of MPI on the host
-func (b *Builder) InstallOnHost(pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) syexec.Result {
+// Environment variables giving the details of the installation to the hooks
+const (
+	// HookInstallDirEnv is the environment variable with the installation directory, which is also the argument of the hook
+	HookInstallDirEnv = "SYMPI_HOOK_INSTALL_DIR"
+
+	// HookPackageEnv is the environment variable with the software being installed, e.g., openmpi:4.0.2
+	HookPackageEnv = "SYMPI_HOOK_PACKAGE"
+
+	// HookStageEnv is the environment variable with the stage of the installation, i.e., pre_install or post_install
+	HookStageEnv = "SYMPI_HOOK_STAGE"
+
+	// preInstallStage is the stage of the hook executed before configuring the software
+	preInstallStage = "pre_install"
+
+	// postInstallStage is the stage of the hook executed after installing the software
+	postInstallStage = "post_install"
+)
+
+// runHook executes the command of a hook with the installation directory as argument. The output of
+// the command is saved in the log. An error is returned if the command fails, unless the hook is
+// best-effort.
+func runHook(ctx context.Context, stage string, hook sys.Hook, pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) error {
+	if hook.Cmd == "" {
+		return nil
+	}
+
+	log.Printf("- Running %s hook for %s: %s", stage, pkg.ID, hook.Cmd)
+	hookEnv := append(os.Environ(), HookInstallDirEnv+"="+env.InstallDir, HookPackageEnv+"="+pkg.ID+":"+pkg.Version, HookStageEnv+"="+stage)
+	r := sys.WithExecOptions(sysCfg.GetRunner(), env.BuildDir, hookEnv, env.LiveOutput)
+	// The hook gets the installation directory as "$1"
+	stdout, stderr, _, err := r.Run(ctx, "sh", "-c", hook.Cmd+` "$@"`, stage, env.InstallDir)
+	log.Printf("-> %s hook stdout: %s", stage, stdout)
+	log.Printf("-> %s hook stderr: %s", stage, stderr)
+	if err != nil {
+		if hook.BestEffort {
+			log.Printf("[WARN] %s hook failed, ignored since best-effort: %s", stage, err)
+			return nil
+		}
+		return fmt.Errorf("%s hook %q failed: %w - stderr: %s", stage, hook.Cmd, err, stderr)
+	}
+	return nil
+}
+
+// compilerFlagVars are the environment variables setting compiler flags recorded in the provenance of the builds
+var compilerFlagVars = []string{"CFLAGS", "CXXFLAGS", "FFLAGS", "FCFLAGS", "LDFLAGS"}
+
+// getBuildEnv returns the environment of the build commands
+func getBuildEnv(env *buildenv.Info) []string {
+	if env.Env == nil {
+		return os.Environ()
+	}
+	return env.Env
+}
+
+// getCompilerFlags returns the compiler flags set in the environment of a build, e.g., CFLAGS=-g -O0
+func getCompilerFlags(env *buildenv.Info) []string {
+	var flags []string
+	for _, e := range getBuildEnv(env) {
+		for _, v := range compilerFlagVars {
+			if strings.HasPrefix(e, v+"=") {
+				flags = append(flags, e)
+			}
+		}
+	}
+	return flags
+}
+
+// getCompiler identifies the C compiler of a build, CC or cc: the first line displayed by
+// <compiler> --version. An empty string is returned if the compiler cannot be identified.
+func getCompiler(ctx context.Context, env *buildenv.Info, sysCfg *sys.Config) string {
+	cc := "cc"
+	for _, e := range getBuildEnv(env) {
+		if strings.HasPrefix(e, "CC=") && e != "CC=" {
+			cc = strings.TrimPrefix(e, "CC=")
+		}
+	}
+
+	stdout, _, _, err := sysCfg.GetRunner().Run(ctx, cc, "--version")
+	if err != nil {
+		log.Printf("[WARN] unable to identify the compiler %s: %s", cc, err)
+		return ""
+	}
+	return strings.TrimSpace(strings.Split(stdout, "\n")[0])
+}
+
+// InstallOnHost installs a specific software package on the host. Cancelling the context
+// stops the installation and kills the associated child processes.
+func (b *Builder) InstallOnHost(ctx context.Context, pkg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) syexec.Result {
 	var res syexec.Result
 
 	// Sanity checks
@@ -157,43 +267,119 @@ func (b *Builder) InstallOnHost(pkg *implem.Info, env *buildenv.Info, sysCfg *sy
 	}
 
 	log.Printf("* %s does not exists, installing from scratch\n", env.InstallDir)
+	env.LiveOutput = sysCfg.VerboseBuild
+	env.Runner = sysCfg.Runner
+	if pkg.ID == implem.SY && sy.IsBinaryArtifact(pkg.URL) {
+		// Prebuilt versions of Singularity do not need to be configured/compiled
+		res.Err = sy.InstallRelease(ctx, pkg.ID+"-"+pkg.Version, pkg.URL, pkg.Mirrors, env, sysCfg)
+		if res.Err != nil {
+			res.Err = fmt.Errorf("failed to install %s from %s: %w", pkg.ID, pkg.URL, res.Err)
+		}
+		return res
+	}
+
+	// The durations of the phases are recorded in the provenance to benchmark the builds
+	buildStart := time.Now()
+	phaseStart := buildStart
+	phaseSeconds := make(map[string]float64)
+	endPhase := func(phase string) {
+		phaseSeconds[phase] = time.Since(phaseStart).Seconds()
+		phaseStart = time.Now()
+	}
+
 	var s buildenv.SoftwarePackage
 	s.URL = pkg.URL
+	s.Mirrors = pkg.Mirrors
 	s.Name = pkg.ID + "-" + pkg.Version
-	res.Err = env.Get(&s)
+	b.reportProgress("Downloading %s %s from %s...", pkg.ID, pkg.Version, pkg.URL)
+	res.Err = env.Get(ctx, &s, sysCfg)
+	if res.Err != nil {
+		res.Err = fmt.Errorf("failed to download MPI from %s: %w", pkg.URL, res.Err)
+		return res
+	}
+	endPhase(provenance.PhaseDownload)
+
+	b.reportProgress("Unpacking %s %s...", pkg.ID, pkg.Version)
+	res.Err = env.Unpack(ctx)
 	if res.Err != nil {
-		res.Err = fmt.Errorf("failed to download MPI from %s: %s", pkg.URL, res.Err)
+		res.Err = fmt.Errorf("failed to unpack MPI: %w", res.Err)
 		return res
 	}
+	endPhase(provenance.PhaseUnpack)
 
-	res.Err = env.Unpack()
+	res.Err = runHook(ctx, preInstallStage, sysCfg.PreInstallHook, pkg, env, sysCfg)
 	if res.Err != nil {
-		res.Err = fmt.Errorf("failed to unpack MPI: %s", res.Err)
 		return res
 	}
+	// The hooks are not part of the build
+	phaseStart = time.Now()
 
 	// Right now, we assume we do not have to install autotools, which is a bad assumption
 	var extraArgs []string
 	if b.GetConfigureExtraArgs != nil {
 		extraArgs = b.GetConfigureExtraArgs(sysCfg)
 	}
-	res.Err = b.Configure(env, sysCfg, extraArgs)
+	b.reportProgress("Configuring %s %s...", pkg.ID, pkg.Version)
+	res.Err = b.Configure(ctx, env, sysCfg, extraArgs)
 	if res.Err != nil {
-		res.Err = fmt.Errorf("failed to configure %s: %s", pkg.ID, res.Err)
+		res.Err = fmt.Errorf("failed to configure %s: %w", pkg.ID, res.Err)
 		return res
 	}
+	endPhase(provenance.PhaseConfigure)
 
-	res = b.compile(pkg, env, sysCfg)
+	res = b.compile(ctx, pkg, env, sysCfg)
 	if res.Err != nil {
 		res.Stderr = fmt.Sprintf("failed to compile %s: %s", pkg.ID, res.Err)
 		return res
 	}
+	endPhase(provenance.PhaseCompile)
 
-	res = b.install(pkg, env, sysCfg)
+	res = b.install(ctx, pkg, env, sysCfg)
 	if res.Err != nil {
 		res.Stderr = fmt.Sprintf("failed to install MPI: %s", res.Err)
 		return res
 	}
+	endPhase(provenance.PhaseInstall)
+
+	prov := provenance.Provenance{
+		ID:            pkg.ID,
+		Version:       pkg.Version,
+		SourceURL:     pkg.URL,
+		ConfigureArgs: extraArgs,
+		CompilerFlags: getCompilerFlags(env),
+		Compiler:      getCompiler(ctx, env, sysCfg),
+		BuildDate:     time.Now().UTC(),
+		ToolVersion:   sys.Version,
+		BuildType:     provenance.ReleaseBuild,
+		BuildSeconds:  time.Since(buildStart).Seconds(),
+		PhaseSeconds:  phaseSeconds,
+	}
+	if sysCfg.DebugBuild && pkg.ID != implem.SY {
+		prov.BuildType = provenance.DebugBuild
+	}
+	res.Err = provenance.Write(env.InstallDir, &prov)
+	if res.Err != nil {
+		res.Err = fmt.Errorf("unable to record the provenance of %s: %w", pkg.ID, res.Err)
+		res.Stderr = res.Err.Error()
+		return res
+	}
+
+	if sysCfg.ModulefilesDir != "" {
+		data := modulefile.Data{Name: pkg.ID, Version: pkg.Version, InstallDir: env.InstallDir}
+		path, err := modulefile.Write(sysCfg.ModulefilesDir, sysCfg.ModulefileFormat, &data)
+		if err != nil {
+			res.Err = fmt.Errorf("unable to create the modulefile of %s: %w", pkg.ID, err)
+			res.Stderr = res.Err.Error()
+			return res
+		}
+		log.Printf("* Modulefile %s created\n", path)
+	}
+
+	res.Err = runHook(ctx, postInstallStage, sysCfg.PostInstallHook, pkg, env, sysCfg)
+	if res.Err != nil {
+		res.Stderr = res.Err.Error()
+		return res
+	}
 
 	return res
 }
@@ -206,7 +392,7 @@ func (b *Builder) UninstallHost(mpiCfg *implem.Info, env *buildenv.Info, sysCfg
 		log.Println("Uninstalling MPI on host...")
 
 		if mpiCfg.ID == implem.IMPI {
-			return impi.RunScript(env, sysCfg, "uninstall")
+			return impi.RunScript(context.Background(), env, sysCfg, "uninstall")
 		} else {
 			mpiDir := filepath.Join(sys.GetSympiDir(), env.InstallDir)
 			if util.PathExists(mpiDir) {
@@ -217,6 +403,9 @@ func (b *Builder) UninstallHost(mpiCfg *implem.Info, env *buildenv.Info, sysCfg
 				}
 			}
 		}
+		if sysCfg.ModulefilesDir != "" {
+			res.Err = modulefile.Remove(sysCfg.ModulefilesDir, sysCfg.ModulefileFormat, mpiCfg.ID, mpiCfg.Version)
+		}
 	} else {
 		log.Printf("Persistent installs mode, not uninstalling MPI from host")
 	}
@@ -236,6 +425,7 @@ func Load(pkg *implem.Info) (Builder, error) {
 		//		builder.GetMpirunExtraArgs = openmpi.GetMpirunExtraArgs // deprecated
 		builder.GetDeffileTemplateTags = openmpi.GetDeffileTemplateTags
 	case implem.MPICH:
+		builder.GetConfigureExtraArgs = mpich.MPICHGetConfigureExtraArgs
 		builder.GetDeffileTemplateTags = mpich.GetDeffileTemplateTags
 	case implem.IMPI:
 		builder.GetDeffileTemplateTags = impi.GetDeffileTemplateTags
@@ -256,7 +446,7 @@ func (b *Builder) createDefFileFromTemplate(defFileName string, mpiCfg *implem.I
 	// Copy the definition file template to the temporary directory
 	err := util.CopyFile(templateDefFile, container.DefFile)
 	if err != nil {
-		return f, fmt.Errorf("failed to copy %s to %s: %s", templateDefFile, container.DefFile, err)
+		return f, fmt.Errorf("failed to copy %s to %s: %w", templateDefFile, container.DefFile, err)
 	}
 
 	// Copy the test file
@@ -265,7 +455,7 @@ func (b *Builder) createDefFileFromTemplate(defFileName string, mpiCfg *implem.I
 	destTestFile := filepath.Join(env.BuildDir, "mpitest.c")
 	err = util.CopyFile(testFile, destTestFile)
 	if err != nil {
-		return f, fmt.Errorf("failed to copy %s to %s: %s", testFile, destTestFile, err)
+		return f, fmt.Errorf("failed to copy %s to %s: %w", testFile, destTestFile, err)
 	}
 
 	// Update the definition file for the specific version of MPI we are testing
@@ -275,7 +465,7 @@ func (b *Builder) createDefFileFromTemplate(defFileName string, mpiCfg *implem.I
 	f.Tags = b.GetDeffileTemplateTags()
 	err = deffile.UpdateDeffileTemplate(f, sysCfg)
 	if err != nil {
-		return f, fmt.Errorf("unable to generate definition file from template: %s", err)
+		return f, fmt.Errorf("unable to generate definition file from template: %w", err)
 	}
 
 	return f, nil
@@ -305,7 +495,7 @@ func (b *Builder) GenerateDeffile(appInfo *app.Info, mpiCfg *implem.Info, env *b
 		}
 		f, err = b.createDefFileFromTemplate(defFileName, mpiCfg, env, container, sysCfg)
 		if err != nil {
-			return fmt.Errorf("failed to create definition file from template: %s", err)
+			return fmt.Errorf("failed to create definition file from template: %w", err)
 		}
 	} else {
 		defFileName = "ubuntu_" + mpiCfg.ID + "_" + appInfo.Name + ".def"
@@ -322,7 +512,7 @@ func (b *Builder) GenerateDeffile(appInfo *app.Info, mpiCfg *implem.Info, env *b
 
 		err = deffile.CreateHybridDefFile(appInfo, &f, sysCfg)
 		if err != nil {
-			return fmt.Errorf("failed to create definition file: %s", err)
+			return fmt.Errorf("failed to create definition file: %w", err)
 		}
 	}
 
@@ -341,7 +531,7 @@ func (b *Builder) GenerateDeffile(appInfo *app.Info, mpiCfg *implem.Info, env *b
 
 // CompileAppOnHost compiles and installs a given application on the host, as well
 // as the required MPI implementation when necessary
-func (b *Builder) CompileAppOnHost(appInfo *app.Info, mpiCfg *mpi.Config, buildEnv *buildenv.Info, sysCfg *sys.Config) error {
+func (b *Builder) CompileAppOnHost(ctx context.Context, appInfo *app.Info, mpiCfg *mpi.Config, buildEnv *buildenv.Info, sysCfg *sys.Config) error {
 	var s buildenv.SoftwarePackage
 	s.URL = appInfo.Source
 	s.Name = appInfo.Name
@@ -364,13 +554,13 @@ func (b *Builder) CompileAppOnHost(appInfo *app.Info, mpiCfg *mpi.Config, buildE
 	if !util.PathExists(buildEnv.BuildDir) {
 		err := util.DirInit(buildEnv.BuildDir)
 		if err != nil {
-			return fmt.Errorf("failed to initialize %s: %s", buildEnv.BuildDir, err)
+			return fmt.Errorf("failed to initialize %s: %w", buildEnv.BuildDir, err)
 		}
 	}
 
-	res := b.InstallOnHost(&mpiCfg.Implem, buildEnv, sysCfg)
+	res := b.InstallOnHost(ctx, &mpiCfg.Implem, buildEnv, sysCfg)
 	if res.Err != nil {
-		return fmt.Errorf("failed to install MPI on host: %s", res.Err)
+		return fmt.Errorf("failed to install MPI on host: %w", res.Err)
 	}
 
 	mpiCfg.Buildenv.InstallDir = buildEnv.InstallDir
@@ -381,13 +571,13 @@ func (b *Builder) CompileAppOnHost(appInfo *app.Info, mpiCfg *mpi.Config, buildE
 	if !util.PathExists(buildEnv.BuildDir) {
 		err := util.DirInit(buildEnv.BuildDir)
 		if err != nil {
-			return fmt.Errorf("failed to initialize directory %s: %s", buildEnv.BuildDir, err)
+			return fmt.Errorf("failed to initialize directory %s: %w", buildEnv.BuildDir, err)
 		}
 	}
 	if !util.PathExists(buildEnv.InstallDir) {
 		err := util.DirInit(buildEnv.InstallDir)
 		if err != nil {
-			return fmt.Errorf("failed to initialize directory %s: %s", buildEnv.InstallDir, err)
+			return fmt.Errorf("failed to initialize directory %s: %w", buildEnv.InstallDir, err)
 		}
 	}
 
@@ -395,15 +585,15 @@ func (b *Builder) CompileAppOnHost(appInfo *app.Info, mpiCfg *mpi.Config, buildE
 	log.Printf("Install the application in %s\n", buildEnv.InstallDir)
 
 	// Download the app
-	err := buildEnv.Get(&s)
+	err := buildEnv.Get(ctx, &s, sysCfg)
 	if err != nil {
-		return fmt.Errorf("unable to get the application from %s: %s", s.URL, err)
+		return fmt.Errorf("unable to get the application from %s: %w", s.URL, err)
 	}
 
 	// Unpacking the app
-	err = buildEnv.Unpack()
+	err = buildEnv.Unpack(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to unpack the application %s: %s", buildEnv.SrcPath, err)
+		return fmt.Errorf("unable to unpack the application %s: %w", buildEnv.SrcPath, err)
 	}
 
 	// Install the app
@@ -414,9 +604,9 @@ func (b *Builder) CompileAppOnHost(appInfo *app.Info, mpiCfg *mpi.Config, buildE
 	buildEnv.Env = []string{"LD_LIBRARY_PATH=" + mpiLdPath}
 	buildEnv.Env = append([]string{"PATH=" + mpiPath}, buildEnv.Env...)
 	log.Printf("* env:\n\t%s", strings.Join(buildEnv.Env, "\n\t"))
-	err = buildEnv.Install(&s)
+	err = buildEnv.Install(ctx, &s)
 	if err != nil {
-		return fmt.Errorf("unable to install package: %s", err)
+		return fmt.Errorf("unable to install package: %w", err)
 	}
 
 	// todo: we do not have a good way to know if an app is actually install in InstallDir or
@@ -0,0 +1,128 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package builder
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestRunHook(t *testing.T) {
+	tests := []struct {
+		name        string
+		hook        sys.Hook
+		result      mock.Result
+		expectedCmd string
+		expectedErr bool
+	}{
+		{
+			name: "no hook",
+		},
+		{
+			name:        "success",
+			hook:        sys.Hook{Cmd: "/site/fix-rpath.sh"},
+			expectedCmd: `sh -c /site/fix-rpath.sh "$@" post_install /opt/sympi/mpi_install_openmpi-4.0.2`,
+		},
+		{
+			name:        "failure",
+			hook:        sys.Hook{Cmd: "/site/fix-rpath.sh"},
+			result:      mock.Result{Stderr: "permission denied", ExitCode: 1},
+			expectedCmd: `sh -c /site/fix-rpath.sh "$@" post_install /opt/sympi/mpi_install_openmpi-4.0.2`,
+			expectedErr: true,
+		},
+		{
+			name:        "best-effort failure",
+			hook:        sys.Hook{Cmd: "/site/gen-module.sh", BestEffort: true},
+			result:      mock.Result{ExitCode: 1},
+			expectedCmd: `sh -c /site/gen-module.sh "$@" post_install /opt/sympi/mpi_install_openmpi-4.0.2`,
+		},
+	}
+
+	pkg := implem.Info{ID: implem.OMPI, Version: "4.0.2"}
+	env := buildenv.Info{InstallDir: "/opt/sympi/mpi_install_openmpi-4.0.2"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mock.Runner{Results: map[string]mock.Result{"sh": tt.result}}
+			sysCfg := sys.Config{Runner: r}
+			err := runHook(context.Background(), postInstallStage, tt.hook, &pkg, &env, &sysCfg)
+			if tt.expectedErr && err == nil {
+				t.Fatalf("runHook() succeeded while the hook failed")
+			}
+			if !tt.expectedErr && err != nil {
+				t.Fatalf("runHook() failed: %s", err)
+			}
+
+			calls := r.Calls()
+			if tt.expectedCmd == "" {
+				if len(calls) != 0 {
+					t.Fatalf("unexpected commands: %v", calls)
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0] != tt.expectedCmd {
+				t.Fatalf("invalid commands %v, %q expected", calls, tt.expectedCmd)
+			}
+		})
+	}
+}
+
+func TestGetCompiler(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          []string
+		result       mock.Result
+		expected     string
+		expectedCmd  string
+		expectedFlag []string
+	}{
+		{
+			name:         "default compiler",
+			env:          []string{"PATH=/usr/bin", "CFLAGS=-g -O0"},
+			result:       mock.Result{Stdout: "cc (GCC) 11.3.0\nCopyright (C) 2021 Free Software Foundation, Inc.\n"},
+			expected:     "cc (GCC) 11.3.0",
+			expectedCmd:  "cc --version",
+			expectedFlag: []string{"CFLAGS=-g -O0"},
+		},
+		{
+			name:        "CC",
+			env:         []string{"CC=/opt/llvm/bin/clang"},
+			result:      mock.Result{Stdout: "clang version 14.0.0\n"},
+			expected:    "clang version 14.0.0",
+			expectedCmd: "/opt/llvm/bin/clang --version",
+		},
+		{
+			name:        "missing compiler",
+			env:         []string{"CC=icc"},
+			result:      mock.Result{ExitCode: 127},
+			expected:    "",
+			expectedCmd: "icc --version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mock.Runner{Results: map[string]mock.Result{"cc": tt.result, "clang": tt.result, "icc": tt.result}}
+			sysCfg := sys.Config{Runner: r}
+			env := buildenv.Info{Env: tt.env}
+			compiler := getCompiler(context.Background(), &env, &sysCfg)
+			if compiler != tt.expected {
+				t.Fatalf("compiler is %q instead of %q", compiler, tt.expected)
+			}
+			if calls := r.Calls(); len(calls) != 1 || calls[0] != tt.expectedCmd {
+				t.Fatalf("invalid commands %v, %q expected", calls, tt.expectedCmd)
+			}
+			if flags := getCompilerFlags(&env); !reflect.DeepEqual(flags, tt.expectedFlag) {
+				t.Fatalf("compiler flags are %v instead of %v", flags, tt.expectedFlag)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+const (
+	// ManifestFile is the name of the file describing the content of a bundle
+	ManifestFile = "sympi-manifest.conf"
+
+	containerKey     = "container"
+	containerDirKey  = "container_dir"
+	containerMPIKey  = "container_mpi"
+	modelKey         = "model"
+	hostMPIKey       = "host_mpi"
+	hostMPIDirKey    = "host_mpi_dir"
+	hostMPIPrefixKey = "host_mpi_prefix"
+)
+
+// Manifest describes the content of a bundle, i.e., a container and the host MPI it was validated against
+type Manifest struct {
+	// Container is the name of the container
+	Container string
+
+	// ContainerDir is the name of the directory of the container in the bundle
+	ContainerDir string
+
+	// ContainerMPI is the MPI in the container, e.g., openmpi:4.0.2
+	ContainerMPI string
+
+	// Model is the MPI model of the container
+	Model string
+
+	// HostMPI is the host MPI, e.g., openmpi:4.0.2
+	HostMPI string
+
+	// HostMPIDir is the name of the directory of the host MPI in the bundle
+	HostMPIDir string
+
+	// HostMPIPrefix is the directory where the host MPI was installed on the system where the bundle was created
+	HostMPIPrefix string
+
+	// HostMPIReused specifies whether the host MPI was already installed when importing the bundle,
+	// in which case the installation is used as is; set by Import, not saved in the manifest
+	HostMPIReused bool
+}
+
+func (m *Manifest) toKVs() []kv.KV {
+	return []kv.KV{
+		{Key: containerKey, Value: m.Container},
+		{Key: containerDirKey, Value: m.ContainerDir},
+		{Key: containerMPIKey, Value: m.ContainerMPI},
+		{Key: modelKey, Value: m.Model},
+		{Key: hostMPIKey, Value: m.HostMPI},
+		{Key: hostMPIDirKey, Value: m.HostMPIDir},
+		{Key: hostMPIPrefixKey, Value: m.HostMPIPrefix},
+	}
+}
+
+// isValidEntry checks that the name of a directory from a manifest does not refer to another directory
+func isValidEntry(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsRune(name, filepath.Separator)
+}
+
+func loadManifest(path string) (Manifest, error) {
+	var m Manifest
+
+	kvs, err := kv.LoadKeyValueConfig(path)
+	if err != nil {
+		return m, err
+	}
+	m.Container = kv.GetValue(kvs, containerKey)
+	m.ContainerDir = kv.GetValue(kvs, containerDirKey)
+	m.ContainerMPI = kv.GetValue(kvs, containerMPIKey)
+	m.Model = kv.GetValue(kvs, modelKey)
+	m.HostMPI = kv.GetValue(kvs, hostMPIKey)
+	m.HostMPIDir = kv.GetValue(kvs, hostMPIDirKey)
+	m.HostMPIPrefix = kv.GetValue(kvs, hostMPIPrefixKey)
+
+	if m.Container == "" || m.HostMPI == "" {
+		return m, fmt.Errorf("incomplete manifest %s", path)
+	}
+	if !isValidEntry(m.ContainerDir) || !isValidEntry(m.HostMPIDir) {
+		return m, fmt.Errorf("invalid directory in manifest %s", path)
+	}
+
+	return m, nil
+}
+
+func runTar(ctx context.Context, sysCfg *sys.Config, args ...string) error {
+	tarPath, err := exec.LookPath("tar")
+	if err != nil {
+		return fmt.Errorf("tar is not available: %w", err)
+	}
+
+	stdout, stderr, _, err := sysCfg.GetRunner().Run(ctx, tarPath, args...)
+	if err != nil {
+		return fmt.Errorf("command failed: %w - stdout: %s - stderr: %s", err, stdout, stderr)
+	}
+	return nil
+}
+
+// Export creates a compressed tarball with the directory of a container, the directory of the host
+// MPI it is used with and a manifest describing them. The names of the directories are set in the manifest.
+func Export(ctx context.Context, containerDir string, hostMPIDir string, m *Manifest, output string, sysCfg *sys.Config) error {
+	if !util.PathExists(containerDir) || !util.PathExists(hostMPIDir) {
+		return fmt.Errorf("invalid parameter(s)")
+	}
+	if util.PathExists(output) {
+		return fmt.Errorf("%s: %w", output, sympierr.ErrFileExists)
+	}
+
+	// Registered and linked MPIs are links to the actual installation, which is the prefix the MPI
+	// was configured with
+	prefix, err := filepath.EvalSymlinks(hostMPIDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", hostMPIDir, err)
+	}
+	m.ContainerDir = filepath.Base(containerDir)
+	m.HostMPIDir = filepath.Base(hostMPIDir)
+	m.HostMPIPrefix = prefix
+
+	tempDir, err := ioutil.TempDir("", "sympi-export-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manifest := strings.Join(kv.ToStringSlice(m.toKVs()), "\n") + "\n"
+	err = ioutil.WriteFile(filepath.Join(tempDir, ManifestFile), []byte(manifest), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create the manifest: %w", err)
+	}
+
+	// The links are followed so the bundle has the files they point to, which may not exist on
+	// the system where it is imported
+	err = runTar(ctx, sysCfg, "-czhf", output,
+		"-C", filepath.Dir(containerDir), m.ContainerDir,
+		"-C", filepath.Dir(hostMPIDir), m.HostMPIDir,
+		"-C", tempDir, ManifestFile)
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("failed to create %s: %w", output, err)
+	}
+
+	return nil
+}
+
+// isMPIInstall checks whether a directory is the installation of a MPI, i.e., has bin/mpirun or bin/mpiexec
+func isMPIInstall(dir string) bool {
+	return util.FileExists(filepath.Join(dir, "bin", "mpirun")) || util.FileExists(filepath.Join(dir, "bin", "mpiexec"))
+}
+
+// Import unpacks a tarball created by Export in a directory. The container is not imported if it
+// already exists in the directory. The host MPI already installed in the directory, e.g., by the
+// import of another container validated against it, is reused instead of being imported again.
+func Import(ctx context.Context, archive string, destDir string, sysCfg *sys.Config) (Manifest, error) {
+	var m Manifest
+
+	if !util.FileExists(archive) {
+		return m, fmt.Errorf("%s does not exist", archive)
+	}
+
+	// We unpack in the destination directory so the directories can then be simply moved
+	tempDir, err := ioutil.TempDir(destDir, ".import-")
+	if err != nil {
+		return m, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = runTar(ctx, sysCfg, "-xzf", archive, "-C", tempDir)
+	if err != nil {
+		return m, fmt.Errorf("failed to unpack %s: %w", archive, err)
+	}
+
+	m, err = loadManifest(filepath.Join(tempDir, ManifestFile))
+	if err != nil {
+		return m, fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	for _, entry := range []string{m.ContainerDir, m.HostMPIDir} {
+		if !util.PathExists(filepath.Join(tempDir, entry)) {
+			return m, fmt.Errorf("%s is missing from %s", entry, archive)
+		}
+	}
+	if util.PathExists(filepath.Join(destDir, m.ContainerDir)) {
+		return m, fmt.Errorf("%s: %w", filepath.Join(destDir, m.ContainerDir), sympierr.ErrFileExists)
+	}
+	// The name of the directory identifies the implementation and version of the MPI
+	hostMPIDir := filepath.Join(destDir, m.HostMPIDir)
+	if util.PathExists(hostMPIDir) {
+		if !isMPIInstall(hostMPIDir) {
+			return m, fmt.Errorf("%s is not a MPI installation: %w", hostMPIDir, sympierr.ErrFileExists)
+		}
+		m.HostMPIReused = true
+	}
+
+	entries := []string{m.ContainerDir}
+	if !m.HostMPIReused {
+		entries = append(entries, m.HostMPIDir)
+	}
+	for _, entry := range entries {
+		err = os.Rename(filepath.Join(tempDir, entry), filepath.Join(destDir, entry))
+		if err != nil {
+			return m, fmt.Errorf("failed to import %s: %w", entry, err)
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bundle
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+func TestExportImport(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	// The host MPI is registered, i.e., a link to its actual installation
+	containerDir := filepath.Join(srcDir, "mpi_container_test")
+	prefix := filepath.Join(srcDir, "openmpi")
+	mpiDir := filepath.Join(srcDir, "mpi_install_openmpi-4.0.2")
+	for _, f := range []string{filepath.Join(containerDir, "test.sif"), filepath.Join(prefix, "bin", "mpirun")} {
+		err = os.MkdirAll(filepath.Dir(f), 0755)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", filepath.Dir(f), err)
+		}
+		err = ioutil.WriteFile(f, []byte("test"), 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", f, err)
+		}
+	}
+	err = os.Symlink(prefix, mpiDir)
+	if err != nil {
+		t.Fatalf("failed to register the host MPI: %s", err)
+	}
+
+	output := filepath.Join(srcDir, "bundle.tar.gz")
+	m := Manifest{Container: "test", ContainerMPI: "openmpi:4.0.2", Model: "bind", HostMPI: "openmpi:4.0.2"}
+	err = Export(context.Background(), containerDir, mpiDir, &m, output, nil)
+	if err != nil {
+		t.Fatalf("Export() failed: %s", err)
+	}
+
+	destDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(destDir)
+
+	imported, err := Import(context.Background(), output, destDir, nil)
+	if err != nil {
+		t.Fatalf("Import() failed: %s", err)
+	}
+	if imported != m {
+		t.Fatalf("imported manifest is %+v instead of %+v", imported, m)
+	}
+	if m.HostMPIPrefix != prefix {
+		t.Fatalf("the prefix of the host MPI is %s instead of %s", m.HostMPIPrefix, prefix)
+	}
+	info, err := os.Lstat(filepath.Join(destDir, m.HostMPIDir))
+	if err != nil || !info.IsDir() {
+		t.Fatalf("the installation of the host MPI was not imported: %v", err)
+	}
+	for _, f := range []string{"mpi_container_test/test.sif", "mpi_install_openmpi-4.0.2/bin/mpirun"} {
+		_, err = os.Stat(filepath.Join(destDir, f))
+		if err != nil {
+			t.Fatalf("%s was not imported: %s", f, err)
+		}
+	}
+
+	// Importing again must not overwrite the existing container
+	_, err = Import(context.Background(), output, destDir, nil)
+	if !errors.Is(err, sympierr.ErrFileExists) {
+		t.Fatalf("Import() returned %v instead of %v", err, sympierr.ErrFileExists)
+	}
+
+	// The installed host MPI is reused
+	err = os.RemoveAll(filepath.Join(destDir, m.ContainerDir))
+	if err != nil {
+		t.Fatalf("failed to remove the imported container: %s", err)
+	}
+	imported, err = Import(context.Background(), output, destDir, nil)
+	if err != nil {
+		t.Fatalf("Import() failed with the host MPI already installed: %s", err)
+	}
+	if !imported.HostMPIReused {
+		t.Fatalf("the installed host MPI was not reused")
+	}
+	if !util.FileExists(filepath.Join(destDir, m.ContainerDir, "test.sif")) {
+		t.Fatalf("the container was not imported")
+	}
+}
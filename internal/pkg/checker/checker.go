@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 )
 
 const (
@@ -51,9 +52,9 @@ func CheckDefFile(path string) error {
 }
 
 // checkSingularityInstall makes sure that Singularity is correctly installed and works properly
-func checkSingularityInstall() error {
+func checkSingularityInstall(sysCfg *sys.Config) error {
 
-	binPath, err := exec.LookPath("singularity")
+	binPath, _, err := sys.LookupSingularity()
 	if err != nil {
 		log.Printf("* Checking for Singularity\tfail")
 		return sympierr.ErrSingularityNotInstalled
@@ -69,9 +70,8 @@ func checkSingularityInstall() error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout*time.Minute)
 	defer cancel()
-	singularityCmd := exec.CommandContext(ctx, binPath, "build", "alpine.sif", "library://sylabsed/examples/alpine")
-	singularityCmd.Dir = dir
-	err = singularityCmd.Run()
+	r := sys.WithExecOptions(sysCfg.GetRunner(), dir, nil, false)
+	_, _, _, err = r.Run(ctx, binPath, "build", "alpine.sif", "library://sylabsed/examples/alpine")
 	if err != nil {
 		log.Printf("* Checking for Singularity\tfail")
 		return fmt.Errorf("failed to build test image: %s", err)
@@ -97,8 +97,8 @@ func checkPrereqBinaries() error {
 }
 
 // CheckSystemConfig checks the system configuration to ensure that the tool can run correctly
-func CheckSystemConfig() error {
-	err := checkSingularityInstall()
+func CheckSystemConfig(sysCfg *sys.Config) error {
+	err := checkSingularityInstall(sysCfg)
 	if err != nil && err != sympierr.ErrSingularityNotInstalled {
 		return err
 	}
@@ -112,7 +112,7 @@ func CheckSystemConfig() error {
 }
 
 // CheckBuildPrivilege checks if we can build an image for a definition file on the system
-func CheckBuildPrivilege() error {
+func CheckBuildPrivilege(sysCfg *sys.Config) error {
 	binPath, err := exec.LookPath("sudo")
 	if err != nil {
 		return fmt.Errorf("failed to find sudo: %s", err)
@@ -139,9 +139,8 @@ func CheckBuildPrivilege() error {
 	log.Printf("* Trying to create image with: sudo singularity build %s %s\n", testImg, dummyDefFile)
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute) // We try only for one minute
 	defer cancel()
-	singularityCmd := exec.CommandContext(ctx, binPath, "singularity", "build", testImg, dummyDefFile)
-	singularityCmd.Dir = dir
-	err = singularityCmd.Run()
+	r := sys.WithExecOptions(sysCfg.GetRunner(), dir, nil, false)
+	_, _, _, err = r.Run(ctx, binPath, "singularity", "build", testImg, dummyDefFile)
 	if err != nil {
 		return fmt.Errorf("failed to build test image: %s", err)
 	}
@@ -0,0 +1,66 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package checker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// ParseGlibcVersion parses the output of 'getconf GNU_LIBC_VERSION', e.g., "glibc 2.31",
+// and returns the version of glibc
+func ParseGlibcVersion(output string) (string, error) {
+	tokens := strings.Fields(strings.TrimSpace(output))
+	if len(tokens) != 2 || tokens[0] != "glibc" {
+		return "", fmt.Errorf("unexpected glibc version format: %s", output)
+	}
+	return tokens[1], nil
+}
+
+// GetHostGlibcVersion returns the version of glibc on the host
+func GetHostGlibcVersion(sysCfg *sys.Config) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout*time.Second)
+	defer cancel()
+
+	stdout, stderr, _, err := sysCfg.GetRunner().Run(ctx, "getconf", "GNU_LIBC_VERSION")
+	if err != nil {
+		return "", fmt.Errorf("failed to get glibc version - stderr: %s: %w", stderr, err)
+	}
+
+	return ParseGlibcVersion(stdout)
+}
+
+// CompareGlibcVersions compares two glibc versions and returns a negative number if v1 is
+// older than v2, 0 if they are identical and a positive number if v1 is newer than v2
+func CompareGlibcVersions(v1 string, v2 string) (int, error) {
+	t1 := strings.Split(v1, ".")
+	t2 := strings.Split(v2, ".")
+	for i := 0; i < len(t1) || i < len(t2); i++ {
+		n1, n2 := 0, 0
+		var err error
+		if i < len(t1) {
+			n1, err = strconv.Atoi(t1[i])
+			if err != nil {
+				return 0, fmt.Errorf("invalid version %s: %w", v1, err)
+			}
+		}
+		if i < len(t2) {
+			n2, err = strconv.Atoi(t2[i])
+			if err != nil {
+				return 0, fmt.Errorf("invalid version %s: %w", v2, err)
+			}
+		}
+		if n1 != n2 {
+			return n1 - n2, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package checker
+
+import (
+	"testing"
+)
+
+func TestCompareGlibcVersions(t *testing.T) {
+	tests := []struct {
+		v1       string
+		v2       string
+		expected int
+	}{
+		{v1: "2.31", v2: "2.31", expected: 0},
+		{v1: "2.31", v2: "2.27", expected: 1},
+		{v1: "2.9", v2: "2.27", expected: -1},
+		{v1: "2.27.1", v2: "2.27", expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.v1+"-"+tt.v2, func(t *testing.T) {
+			res, err := CompareGlibcVersions(tt.v1, tt.v2)
+			if err != nil {
+				t.Fatalf("comparison failed: %s", err)
+			}
+			if (res > 0 && tt.expected <= 0) || (res < 0 && tt.expected >= 0) || (res == 0 && tt.expected != 0) {
+				t.Fatalf("comparing %s and %s returned %d", tt.v1, tt.v2, res)
+			}
+		})
+	}
+}
+
+func TestParseGlibcVersion(t *testing.T) {
+	v, err := ParseGlibcVersion("glibc 2.31\n")
+	if err != nil || v != "2.31" {
+		t.Fatalf("unexpected result: %s (%v)", v, err)
+	}
+	_, err = ParseGlibcVersion("musl")
+	if err == nil {
+		t.Fatalf("invalid format was accepted")
+	}
+}
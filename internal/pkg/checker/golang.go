@@ -0,0 +1,111 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package checker
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// goRequirement associates a Singularity/Apptainer release series to the minimum version of Go required to build it
+type goRequirement struct {
+	singularity string
+	minGo       string
+}
+
+// goRequirements is the list of known Go requirements for each runtime, sorted by version
+var goRequirements = map[string][]goRequirement{
+	sys.SingularityRuntime: {
+		{singularity: "3.0", minGo: "1.10"},
+		{singularity: "3.1", minGo: "1.11"},
+		{singularity: "3.4", minGo: "1.12"},
+		{singularity: "3.5", minGo: "1.13"},
+		{singularity: "3.9", minGo: "1.16"},
+		{singularity: "3.10", minGo: "1.17"},
+		{singularity: "3.11", minGo: "1.19"},
+	},
+	sys.ApptainerRuntime: {
+		{singularity: "1.0", minGo: "1.16"},
+		{singularity: "1.1", minGo: "1.17"},
+		{singularity: "1.2", minGo: "1.20"},
+		{singularity: "1.3", minGo: "1.21"},
+	},
+}
+
+var goVersionRegexp = regexp.MustCompile(`go version go([0-9]+(\.[0-9]+)*)`)
+
+// ParseGoVersion parses the output of 'go version', e.g., "go version go1.13.8 linux/amd64",
+// and returns the version of Go
+func ParseGoVersion(output string) (string, error) {
+	m := goVersionRegexp.FindStringSubmatch(output)
+	if m == nil {
+		return "", fmt.Errorf("unexpected Go version format: %s", strings.TrimSpace(output))
+	}
+	return m[1], nil
+}
+
+// GetMinGoVersion returns the minimum version of Go required to build a version of Singularity
+// or Apptainer
+func GetMinGoVersion(runtime string, syVersion string) (string, error) {
+	requirements, ok := goRequirements[runtime]
+	if !ok {
+		return "", fmt.Errorf("unknown runtime: %s", runtime)
+	}
+
+	tokens := strings.Split(syVersion, ".")
+	if len(tokens) < 2 {
+		return "", fmt.Errorf("invalid Singularity version: %s", syVersion)
+	}
+	series := tokens[0] + "." + tokens[1]
+
+	minGo := requirements[0].minGo
+	for _, r := range requirements {
+		if implem.CompareVersions(series, r.singularity) < 0 {
+			break
+		}
+		minGo = r.minGo
+	}
+	return minGo, nil
+}
+
+// CheckGoToolchain makes sure that Go is installed and recent enough to build a given version of
+// Singularity or Apptainer
+func CheckGoToolchain(runtime string, syVersion string, sysCfg *sys.Config) error {
+	minGo, err := GetMinGoVersion(runtime, syVersion)
+	if err != nil {
+		return err
+	}
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return fmt.Errorf("go is not installed, %s %s requires Go >= %s: %w", runtime, syVersion, minGo, sympierr.ErrMissingPrerequisite)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout*time.Second)
+	defer cancel()
+	stdout, stderr, _, err := sysCfg.GetRunner().Run(ctx, goBin, "version")
+	if err != nil {
+		return fmt.Errorf("failed to get Go version - stderr: %s: %w", stderr, err)
+	}
+
+	goVersion, err := ParseGoVersion(stdout)
+	if err != nil {
+		return err
+	}
+	if implem.CompareVersions(goVersion, minGo) < 0 {
+		return fmt.Errorf("Go %s is installed but %s %s requires Go >= %s: %w", goVersion, runtime, syVersion, minGo, sympierr.ErrMissingPrerequisite)
+	}
+
+	return nil
+}
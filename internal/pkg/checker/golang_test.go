@@ -0,0 +1,53 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package checker
+
+import (
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestGetMinGoVersion(t *testing.T) {
+	tests := []struct {
+		runtime       string
+		syVersion     string
+		expectedMinGo string
+	}{
+		{runtime: sys.SingularityRuntime, syVersion: "3.0.3", expectedMinGo: "1.10"},
+		{runtime: sys.SingularityRuntime, syVersion: "3.3.0", expectedMinGo: "1.11"},
+		{runtime: sys.SingularityRuntime, syVersion: "3.5.2", expectedMinGo: "1.13"},
+		{runtime: sys.SingularityRuntime, syVersion: "3.8.0", expectedMinGo: "1.13"},
+		{runtime: sys.SingularityRuntime, syVersion: "3.10.4", expectedMinGo: "1.17"},
+		{runtime: sys.SingularityRuntime, syVersion: "4.0.0", expectedMinGo: "1.19"},
+		{runtime: sys.SingularityRuntime, syVersion: "3.11.0-rc.1", expectedMinGo: "1.19"},
+		{runtime: sys.ApptainerRuntime, syVersion: "1.1.9", expectedMinGo: "1.17"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.runtime+"-"+tt.syVersion, func(t *testing.T) {
+			minGo, err := GetMinGoVersion(tt.runtime, tt.syVersion)
+			if err != nil {
+				t.Fatalf("failed to get minimum Go version: %s", err)
+			}
+			if minGo != tt.expectedMinGo {
+				t.Fatalf("%s %s requires Go %s instead of %s", tt.runtime, tt.syVersion, minGo, tt.expectedMinGo)
+			}
+		})
+	}
+}
+
+func TestParseGoVersion(t *testing.T) {
+	v, err := ParseGoVersion("go version go1.13.8 linux/amd64\n")
+	if err != nil || v != "1.13.8" {
+		t.Fatalf("unexpected result: %s (%v)", v, err)
+	}
+
+	_, err = ParseGoVersion("command not found")
+	if err == nil {
+		t.Fatalf("invalid output successfully parsed")
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package configcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+)
+
+// Severity levels of the issues
+const (
+	// SeverityError is the severity of an issue preventing the use of an entry
+	SeverityError = "ERROR"
+
+	// SeverityWarning is the severity of an issue that may be transient, e.g., a server being down
+	SeverityWarning = "WARN"
+)
+
+// nonSourceFiles are the configuration files in the etc directory that do not associate versions to URLs
+var nonSourceFiles = map[string]bool{
+	"ofi.conf": true,
+}
+
+// supportedSchemes are the schemes of the URLs that can be used in the configuration files
+var supportedSchemes = map[string]bool{
+	"http":    true,
+	"https":   true,
+	"file":    true,
+	"git":     true,
+	"library": true,
+	"docker":  true,
+}
+
+// versionRegexp matches the versions used as keys, e.g., 4.0.1 or 2019.4.243
+var versionRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*([.\-_+]?[0-9A-Za-z]+)*$`)
+
+// Issue is a problem found in a configuration file
+type Issue struct {
+	// File is the path to the configuration file
+	File string
+
+	// Key is the key of the invalid entry; empty if the issue is about the whole file
+	Key string
+
+	// Severity is the severity of the issue, SeverityError or SeverityWarning
+	Severity string
+
+	// Msg describes the issue
+	Msg string
+}
+
+func (i Issue) String() string {
+	if i.Key == "" {
+		return fmt.Sprintf("[%s] %s: %s", i.Severity, i.File, i.Msg)
+	}
+	return fmt.Sprintf("[%s] %s: %s: %s", i.Severity, i.File, i.Key, i.Msg)
+}
+
+// CheckURL makes sure that a URL from a configuration file is valid and uses a supported scheme
+func CheckURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %w", u, err)
+	}
+	if parsed.Scheme == "" {
+		return fmt.Errorf("invalid URL %s: missing scheme", u)
+	}
+	if !supportedSchemes[parsed.Scheme] {
+		return fmt.Errorf("invalid URL %s: unsupported scheme %s", u, parsed.Scheme)
+	}
+	if parsed.Scheme == "file" {
+		if parsed.Path == "" {
+			return fmt.Errorf("invalid URL %s: missing path", u)
+		}
+	} else if parsed.Host == "" {
+		return fmt.Errorf("invalid URL %s: missing host", u)
+	}
+	return nil
+}
+
+// CheckReachable checks that the target of a URL exists: a HEAD request is sent to HTTP servers
+// and files must exist. Other URLs, e.g., library://, are not checked.
+func CheckReachable(ctx context.Context, client *http.Client, u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+
+	switch parsed.Scheme {
+	case "file":
+		_, err := os.Stat(parsed.Path)
+		if err != nil {
+			return fmt.Errorf("%s is not reachable: %w", u, err)
+		}
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+		if err != nil {
+			return fmt.Errorf("invalid request for %s: %w", u, err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("%s is not reachable: %w", u, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("%s is not reachable: HTTP status %d %s", u, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+	}
+	return nil
+}
+
+// CheckFile checks the entries of a configuration file: the file must be readable by the parser of
+// the configuration files, keys must be unique and, for files associating versions to URLs, keys
+// must be versions and values comma-separated lists of valid URLs. When client is not nil, the
+// URLs are also checked with CheckReachable, failures being reported as warnings.
+func CheckFile(ctx context.Context, path string, client *http.Client) []Issue {
+	kvs, err := kv.LoadKeyValueConfig(path)
+	if err != nil {
+		return []Issue{{File: path, Severity: SeverityError, Msg: err.Error()}}
+	}
+
+	var issues []Issue
+	seen := make(map[string]bool)
+	for _, entry := range kvs {
+		if seen[entry.Key] {
+			issues = append(issues, Issue{File: path, Key: entry.Key, Severity: SeverityError, Msg: "duplicate key"})
+		}
+		seen[entry.Key] = true
+
+		if nonSourceFiles[filepath.Base(path)] {
+			continue
+		}
+		if !versionRegexp.MatchString(entry.Key) {
+			issues = append(issues, Issue{File: path, Key: entry.Key, Severity: SeverityError, Msg: "malformed version"})
+		}
+		urls := 0
+		for _, u := range strings.Split(entry.Value, ",") {
+			u = strings.TrimSpace(u)
+			if u == "" {
+				continue
+			}
+			urls++
+			err := CheckURL(u)
+			if err != nil {
+				issues = append(issues, Issue{File: path, Key: entry.Key, Severity: SeverityError, Msg: err.Error()})
+				continue
+			}
+			if client != nil {
+				err := CheckReachable(ctx, client, u)
+				if err != nil {
+					issues = append(issues, Issue{File: path, Key: entry.Key, Severity: SeverityWarning, Msg: err.Error()})
+				}
+			}
+		}
+		if urls == 0 {
+			issues = append(issues, Issue{File: path, Key: entry.Key, Severity: SeverityError, Msg: "no URL"})
+		}
+	}
+
+	return issues
+}
+
+// CheckDir checks all the configuration files of a directory and of its drop-in directory (see
+// CheckFile). It returns the files that were checked and the issues that were found; drop-in
+// files that are not named after a configuration file of the directory are reported since they
+// are ignored.
+func CheckDir(ctx context.Context, dir string, client *http.Client) ([]string, []Issue, error) {
+	var files []string
+	var issues []Issue
+	configFiles := 0
+	for i, d := range []string{dir, filepath.Join(dir, kv.DropInDir)} {
+		matches, err := filepath.Glob(filepath.Join(d, "*.conf"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to get the configuration files from %s: %w", d, err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+		if i == 0 {
+			configFiles = len(matches)
+		}
+	}
+
+	for _, f := range files[configFiles:] {
+		if !isDropIn(f, files[:configFiles]) {
+			issues = append(issues, Issue{File: f, Severity: SeverityError, Msg: "ignored, drop-in files must be named <name>.conf or <name>_*.conf to be merged with " + filepath.Join(dir, "<name>.conf")})
+		}
+	}
+	for _, f := range files {
+		issues = append(issues, CheckFile(ctx, f, client)...)
+	}
+	return files, issues, nil
+}
+
+// isDropIn checks whether a drop-in file is merged with one of the configuration files
+func isDropIn(dropIn string, configFiles []string) bool {
+	for _, f := range configFiles {
+		if kv.IsDropInOf(dropIn, f) {
+			return true
+		}
+	}
+	return false
+}
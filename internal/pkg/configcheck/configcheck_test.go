@@ -0,0 +1,175 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package configcheck
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url         string
+		expectedErr bool
+	}{
+		{url: "https://www.mpich.org/static/downloads/3.3/mpich-3.3.tar.gz"},
+		{url: "file:///shared/IntelMPI/l_mpi_2019.4.243.tar"},
+		{url: "https://github.com/sylabs/singularity.git"},
+		{url: "library://vallee/mpi/ubuntu-disco-openmpi-4.0.1:20190925"},
+		{url: "www.mpich.org/mpich-3.3.tar.gz", expectedErr: true},
+		{url: "ftp://ftp.example.org/mpich-3.3.tar.gz", expectedErr: true},
+		{url: "https:///mpich-3.3.tar.gz", expectedErr: true},
+		{url: "file://", expectedErr: true},
+		{url: "http://[::1", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckURL(tt.url)
+			if tt.expectedErr && err == nil {
+				t.Fatalf("invalid URL accepted")
+			}
+			if !tt.expectedErr && err != nil {
+				t.Fatalf("valid URL rejected: %s", err)
+			}
+		})
+	}
+}
+
+func TestCheckFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("unexpected %s request", r.Method)
+		}
+		if r.URL.Path != "/openmpi-4.0.1.tar.bz2" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "configcheck")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		online   bool
+		expected []string
+	}{
+		{
+			name:    "valid",
+			file:    "openmpi.conf",
+			content: "# Open MPI\n4.0.1=" + srv.URL + "/openmpi-4.0.1.tar.bz2, https://mirror.example.org/openmpi-4.0.1.tar.bz2\n",
+		},
+		{
+			name:     "invalid entries",
+			file:     "mpich.conf",
+			content:  "3.3=https://www.mpich.org/mpich-3.3.tar.gz\n3.3=https://www.mpich.org/mpich-3.3.tar.gz\nlatest=https://www.mpich.org/mpich.tar.gz\n3.2=www.mpich.org/mpich-3.2.tar.gz\n3.1=\n",
+			expected: []string{"[ERROR] 3.3: duplicate key", "[ERROR] latest: malformed version", "[ERROR] 3.2: invalid URL", "[ERROR] 3.1: no URL"},
+		},
+		{
+			name:     "unreachable",
+			file:     "singularity.conf",
+			content:  "3.5.0=" + srv.URL + "/singularity-3.5.0.tar.gz\n",
+			online:   true,
+			expected: []string{"[WARN] 3.5.0: " + srv.URL + "/singularity-3.5.0.tar.gz is not reachable: HTTP status 404"},
+		},
+		{
+			name:     "not a source file",
+			file:     "ofi.conf",
+			content:  "interface=<your network interface>\nprovider=sockets\nprovider=verbs\n",
+			expected: []string{"[ERROR] provider: duplicate key"},
+		},
+		{
+			name:     "invalid format",
+			file:     "intelmpi.conf",
+			content:  "2019.4.243\n",
+			expected: []string{"[ERROR] invalid entry format"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			err := ioutil.WriteFile(path, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("failed to create %s: %s", path, err)
+			}
+			var client *http.Client
+			if tt.online {
+				client = srv.Client()
+			}
+
+			issues := CheckFile(context.Background(), path, client)
+			if len(issues) != len(tt.expected) {
+				t.Fatalf("got %d issue(s) instead of %d: %v", len(issues), len(tt.expected), issues)
+			}
+			for i, issue := range issues {
+				msg := strings.Replace(issue.String(), " "+path+":", "", 1)
+				if !strings.HasPrefix(msg, tt.expected[i]) {
+					t.Fatalf("issue %q does not match %q", msg, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDir(t *testing.T) {
+	// The configuration files distributed with sympi must be valid
+	files, issues, err := CheckDir(context.Background(), filepath.Join("..", "..", "..", "etc"), nil)
+	if err != nil {
+		t.Fatalf("CheckDir() failed: %s", err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no configuration file found")
+	}
+	if len(issues) > 0 {
+		t.Fatalf("invalid configuration files: %v", issues)
+	}
+}
+
+func TestCheckDirDropIns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configcheck")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.MkdirAll(filepath.Join(dir, kv.DropInDir), 0755)
+	if err != nil {
+		t.Fatalf("failed to create drop-in directory: %s", err)
+	}
+
+	content := []byte("4.0.1=https://download.open-mpi.org/release/open-mpi/v4.0/openmpi-4.0.1.tar.bz2\n")
+	for _, f := range []string{"openmpi.conf", filepath.Join(kv.DropInDir, "openmpi.conf"), filepath.Join(kv.DropInDir, "openmpi_site.conf"), filepath.Join(kv.DropInDir, "openmpi-site.conf")} {
+		err := ioutil.WriteFile(filepath.Join(dir, f), content, 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", f, err)
+		}
+	}
+
+	files, issues, err := CheckDir(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatalf("CheckDir() failed: %s", err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("got %d file(s) instead of 4: %v", len(files), files)
+	}
+	if len(issues) != 1 || issues[0].File != filepath.Join(dir, kv.DropInDir, "openmpi-site.conf") || issues[0].Severity != SeverityError {
+		t.Fatalf("ignored drop-in file not reported: %v", issues)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// AppExeLabel is the label of an image giving the path to the MPI application in the
+// container. It has precedence over the App_exe label set by sympi, e.g., for images with
+// several entrypoints built by other tools.
+const AppExeLabel = "sympi.appexe"
+
+// getRunscriptCandidates returns the absolute paths used in a runscript, in order, which are
+// the executables the runscript may start
+func getRunscriptCandidates(runscript string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(runscript, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, token := range strings.Fields(line) {
+			token = strings.Trim(token, `"';`)
+			if !strings.HasPrefix(token, "/") || strings.ContainsAny(token, "$*") || seen[token] {
+				continue
+			}
+			seen[token] = true
+			candidates = append(candidates, token)
+		}
+	}
+	return candidates
+}
+
+// isMPILinked checks, based on the output of ldd, whether a binary is linked against MPI
+func isMPILinked(lddOutput string) bool {
+	for _, line := range strings.Split(lddOutput, "\n") {
+		if strings.Contains(strings.TrimSpace(line), "libmpi") {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscoverAppExe finds the MPI application of an image that does not specify it with a label:
+// among the executables of the runscript, the application is the one linked against MPI. An
+// error listing the candidates is returned when none or several of them are linked against MPI.
+func DiscoverAppExe(c *Config, sysCfg *sys.Config) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*time.Minute)
+	defer cancel()
+
+	r := sysCfg.GetRunner()
+	runscript, stderr, err := runSingularity(ctx, r, sysCfg, "inspect", "--runscript", c.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the runscript of %s: %s: %w", c.Path, strings.TrimSpace(stderr), err)
+	}
+	candidates := getRunscriptCandidates(runscript)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("the runscript of %s does not start any executable, set the %s label of the image", c.Path, AppExeLabel)
+	}
+
+	var mpiBinaries []string
+	for _, candidate := range candidates {
+		stdout, _, err := runSingularity(ctx, r, sysCfg, "exec", c.Path, "ldd", candidate)
+		if err != nil {
+			// Not a dynamic executable, e.g., a script or a directory
+			log.Printf("* %s is not a dynamic executable: %s", candidate, err)
+			continue
+		}
+		if isMPILinked(stdout) {
+			mpiBinaries = append(mpiBinaries, candidate)
+		}
+	}
+
+	switch len(mpiBinaries) {
+	case 0:
+		return "", fmt.Errorf("none of the executables of the runscript of %s is linked against MPI (%s), set the %s label of the image", c.Path, strings.Join(candidates, ", "), AppExeLabel)
+	case 1:
+		return mpiBinaries[0], nil
+	default:
+		return "", fmt.Errorf("several executables of the runscript of %s are linked against MPI (%s), set the %s label of the image", c.Path, strings.Join(mpiBinaries, ", "), AppExeLabel)
+	}
+}
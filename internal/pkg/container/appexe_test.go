@@ -0,0 +1,108 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestAppExeLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		inspect  string
+		expected string
+	}{
+		{name: "App_exe", inspect: "App_exe: /opt/helloworld\n", expected: "/opt/helloworld"},
+		{name: "label", inspect: "App_exe: /opt/entrypoint\nsympi.appexe: /opt/solver/bin/solver\n", expected: "/opt/solver/bin/solver"},
+		{name: "none", inspect: "Application: helloworld\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, err := parseInspectOutput(tt.inspect)
+			if err != nil {
+				t.Fatalf("parsing failed: %s", err)
+			}
+			if c.AppExe != tt.expected {
+				t.Fatalf("application is %q instead of %q", c.AppExe, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetRunscriptCandidates(t *testing.T) {
+	tests := []struct {
+		name      string
+		runscript string
+		expected  []string
+	}{
+		{name: "exec", runscript: "#!/bin/sh\nexec /opt/helloworld \"$@\"\n", expected: []string{"/opt/helloworld"}},
+		{
+			name:      "entrypoints",
+			runscript: "#!/bin/bash\n# Select the entrypoint\ncase \"$1\" in\n  pre) /opt/bin/preprocess;;\n  *) cd /data && '/opt/bin/solver' \"$@\";;\nesac\n/opt/bin/preprocess --check\n",
+			expected:  []string{"/opt/bin/preprocess", "/data", "/opt/bin/solver"},
+		},
+		{name: "variables", runscript: "exec $APP /opt/$NAME /opt/*\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := getRunscriptCandidates(tt.runscript)
+			if !reflect.DeepEqual(candidates, tt.expected) {
+				t.Fatalf("candidates are %q instead of %q", candidates, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsMPILinked(t *testing.T) {
+	tests := []struct {
+		name     string
+		ldd      string
+		expected bool
+	}{
+		{name: "openmpi", ldd: "\tlinux-vdso.so.1 (0x00007ffd)\n\tlibmpi.so.40 => /opt/mpi/lib/libmpi.so.40 (0x00007f2a)\n", expected: true},
+		{name: "mpich", ldd: "\tlibmpich.so.12 => /usr/lib/libmpich.so.12 (0x00007f2a)\n", expected: true},
+		{name: "not linked", ldd: "\tlibc.so.6 => /lib/x86_64-linux-gnu/libc.so.6 (0x00007f2a)\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if linked := isMPILinked(tt.ldd); linked != tt.expected {
+				t.Fatalf("linked against MPI: %t instead of %t", linked, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDiscoverAppExe(t *testing.T) {
+	// The mock gives the same output for the runscript and ldd
+	tests := []struct {
+		name   string
+		output string
+		errMsg string
+	}{
+		{name: "no executable", output: "#!/bin/sh\necho hello\n", errMsg: "does not start any executable"},
+		{name: "not linked", output: "#!/bin/sh\nexec /opt/helloworld\n", errMsg: "none of the executables"},
+		{name: "ambiguous", output: "exec /opt/helloworld\n\tlibmpi.so.40 => /opt/mpi/lib/libmpi.so.40\n", errMsg: "/opt/helloworld, /opt/mpi/lib/libmpi.so.40"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mock.Runner{Results: map[string]mock.Result{"singularity": {Stdout: tt.output}}}
+			sysCfg := sys.Config{SingularityBin: "singularity", Runner: r}
+			_, err := DiscoverAppExe(&Config{Path: "/images/test.sif"}, &sysCfg)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("discovery gave error %v instead of an error with %q", err, tt.errMsg)
+			}
+		})
+	}
+}
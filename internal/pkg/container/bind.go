@@ -0,0 +1,40 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Modes of the bind-mounted directories
+const (
+	// BindReadOnly is the mode of the directories bind-mounted read-only
+	BindReadOnly = "ro"
+
+	// BindReadWrite is the mode of the directories bind-mounted read-write, the default
+	BindReadWrite = "rw"
+)
+
+// CheckBind checks that a bind follows the syntax of the --bind option of Singularity, i.e.,
+// src[:dst[:mode]] with an absolute destination and ro or rw as mode. Valid binds are given to
+// Singularity unchanged.
+func CheckBind(bind string) error {
+	tokens := strings.Split(bind, ":")
+	if len(tokens) > 3 {
+		return fmt.Errorf("invalid bind %s, it should be src[:dst[:ro|rw]]", bind)
+	}
+	if tokens[0] == "" {
+		return fmt.Errorf("invalid bind %s, the source is empty", bind)
+	}
+	if len(tokens) > 1 && !strings.HasPrefix(tokens[1], "/") {
+		return fmt.Errorf("invalid bind %s, the destination %q must be an absolute path", bind, tokens[1])
+	}
+	if len(tokens) == 3 && tokens[2] != BindReadOnly && tokens[2] != BindReadWrite {
+		return fmt.Errorf("invalid bind %s, the mode %q should be %s or %s", bind, tokens[2], BindReadOnly, BindReadWrite)
+	}
+	return nil
+}
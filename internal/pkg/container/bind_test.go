@@ -0,0 +1,40 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"testing"
+)
+
+func TestCheckBind(t *testing.T) {
+	tests := []struct {
+		bind          string
+		expectedError bool
+	}{
+		{bind: "/data"},
+		{bind: "/data:/data"},
+		{bind: "/data:/mnt/data:ro"},
+		{bind: "/scratch:/scratch:rw"},
+		{bind: "", expectedError: true},
+		{bind: ":/data", expectedError: true},
+		{bind: "/data:data", expectedError: true},
+		{bind: "/data:/data:RO", expectedError: true},
+		{bind: "/data:/data:noexec", expectedError: true},
+		{bind: "/data:/data:ro:rw", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bind, func(t *testing.T) {
+			err := CheckBind(tt.bind)
+			if tt.expectedError && err == nil {
+				t.Fatalf("invalid bind accepted")
+			}
+			if !tt.expectedError && err != nil {
+				t.Fatalf("CheckBind() failed: %s", err)
+			}
+		})
+	}
+}
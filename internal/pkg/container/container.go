@@ -6,19 +6,17 @@
 package container
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/checker"
 	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
 	"github.com/sylabs/singularity-mpi/internal/pkg/util/sy"
@@ -30,12 +28,6 @@ const (
 
 	// KeyIndex is the index of the key to use to sign images
 	KeyIndex = "SY_KEY_INDEX"
-
-	// HybridModel is the identifier used to identify the hybrid model
-	HybridModel = "hybrid"
-
-	// BindModel is the identifier used to identify the bind-mount model
-	BindModel = "bind"
 )
 
 // Config is a structure representing a container
@@ -62,7 +54,7 @@ type Config struct {
 	URL string
 
 	// Model specifies the model to follow for MPI inside the container
-	Model string
+	Model Model
 
 	// AppExe is the command to start the application in the container
 	AppExe string
@@ -72,6 +64,12 @@ type Config struct {
 
 	// Binds is the set of bind options to use while starting the container
 	Binds []string
+
+	// Env is the set of environment variables (KEY=VALUE) to set in the container before starting the application
+	Env []string
+
+	// GPU is the GPU support to enable while starting the container, i.e., NvidiaGPU or AMDGPU (optional)
+	GPU string
 }
 
 // CreateContainer creates a container based on a MPI configuration
@@ -83,11 +81,9 @@ func Create(container *Config, sysCfg *sys.Config) error {
 		return fmt.Errorf("build directory is undefined")
 	}
 
-	if sysCfg.SingularityBin == "" {
-		sysCfg.SingularityBin, err = exec.LookPath("singularity")
-		if err != nil {
-			return fmt.Errorf("singularity not available: %s", err)
-		}
+	err = sysCfg.SetSingularityBin()
+	if err != nil {
+		return fmt.Errorf("singularity not available: %w", err)
 	}
 
 	if container.Name == "" {
@@ -108,26 +104,22 @@ func Create(container *Config, sysCfg *sys.Config) error {
 	if sysCfg.Debug {
 		err = checker.CheckDefFile(container.DefFile)
 		if err != nil {
-			return fmt.Errorf("unable to check definition file: %s", err)
+			return fmt.Errorf("unable to check definition file: %w", err)
 		}
 	}
 
 	log.Printf("-> Using definition file %s", container.DefFile)
-	var stdout, stderr bytes.Buffer
-	var cmd *exec.Cmd
-	if sy.IsSudoCmd("build", sysCfg) {
-		log.Printf("-> Running %s %s %s %s %s\n", sysCfg.SudoBin, sysCfg.SingularityBin, "build", container.Path, container.DefFile)
-		cmd = exec.CommandContext(ctx, sysCfg.SudoBin, sysCfg.SingularityBin, "build", container.Path, container.DefFile)
-	} else {
-		log.Printf("-> Running %s %s %s %s\n", sysCfg.SingularityBin, "build", container.Path, container.DefFile)
-		cmd = exec.CommandContext(ctx, sysCfg.SingularityBin, "build", container.Path, container.DefFile)
-	}
-	cmd.Dir = container.BuildDir
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
+	err = sysCfg.CheckSingularityFreeSpace()
+	if err != nil {
+		return fmt.Errorf("cannot build %s: %w", container.Path, err)
+	}
+	r, err := getSingularityRunner(container.BuildDir, sysCfg)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runSingularity(ctx, r, sysCfg, "build", container.Path, container.DefFile)
 	if err != nil {
-		return fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %s", stdout.String(), stderr.String(), err)
+		return fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %w", stdout, stderr, err)
 	}
 
 	return nil
@@ -140,12 +132,9 @@ func PullContainerImage(cfg *Config, mpiImplm *implem.Info, sysCfg *sys.Config,
 		return fmt.Errorf("undefined image URL")
 	}
 
-	if sysCfg.SingularityBin == "" {
-		var err error
-		sysCfg.SingularityBin, err = exec.LookPath("singularity")
-		if err != nil {
-			return fmt.Errorf("failed to find Singularity binary: %s", err)
-		}
+	err := sysCfg.SetSingularityBin()
+	if err != nil {
+		return fmt.Errorf("failed to find Singularity binary: %w", err)
 	}
 
 	log.Println("* Pulling container with the following MPI configuration *")
@@ -154,9 +143,9 @@ func PullContainerImage(cfg *Config, mpiImplm *implem.Info, sysCfg *sys.Config,
 	log.Println("-> MPI version:", mpiImplm.Version)
 	log.Println("-> Image URL:", cfg.URL)
 
-	err := Pull(cfg, sysCfg)
+	err = Pull(cfg, sysCfg)
 	if err != nil {
-		return fmt.Errorf("failed to pull image: %s", err)
+		return fmt.Errorf("failed to pull image: %w", err)
 	}
 
 	return nil
@@ -164,8 +153,6 @@ func PullContainerImage(cfg *Config, mpiImplm *implem.Info, sysCfg *sys.Config,
 
 // Pull retieves an image from the registry
 func Pull(containerInfo *Config, sysCfg *sys.Config) error {
-	var stdout, stderr bytes.Buffer
-
 	log.Printf("* Singularity binary: %s\n", sysCfg.SingularityBin)
 	log.Printf("* Container path: %s\n", containerInfo.Path)
 	log.Printf("* Image URL: %s\n", containerInfo.URL)
@@ -181,16 +168,22 @@ func Pull(containerInfo *Config, sysCfg *sys.Config) error {
 		return nil
 	}
 
+	// Pulling an image converts it to SIF, which needs as much space as building it
+	err := sysCfg.CheckSingularityFreeSpace()
+	if err != nil {
+		return fmt.Errorf("cannot pull %s: %w", containerInfo.URL, err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*2*time.Minute)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, sysCfg.SingularityBin, "pull", containerInfo.Path, containerInfo.URL)
-	cmd.Dir = containerInfo.BuildDir
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	r, err := getSingularityRunner(containerInfo.BuildDir, sysCfg)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, _, err := r.Run(ctx, sysCfg.SingularityBin, "pull", containerInfo.Path, containerInfo.URL)
 	if err != nil {
-		return fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %s", stdout.String(), stderr.String(), err)
+		return fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %w", stdout, stderr, err)
 	}
 
 	return nil
@@ -198,8 +191,6 @@ func Pull(containerInfo *Config, sysCfg *sys.Config) error {
 
 // Sign signs a given image
 func Sign(container *Config, sysCfg *sys.Config) error {
-	var stdout, stderr bytes.Buffer
-
 	log.Printf("-> Signing container (%s)", container.Path)
 	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*2*time.Minute)
 	defer cancel()
@@ -209,32 +200,15 @@ func Sign(container *Config, sysCfg *sys.Config) error {
 		indexIdx = os.Getenv(KeyIndex)
 	}
 
-	var cmd *exec.Cmd
-	if sy.IsSudoCmd("sign", sysCfg) {
-		cmd = exec.CommandContext(ctx, sysCfg.SudoBin, sysCfg.SingularityBin, "sign", "--keyidx", indexIdx, container.Path)
-	} else {
-		cmd = exec.CommandContext(ctx, sysCfg.SingularityBin, "sign", "--keyidx", indexIdx, container.Path)
-	}
-
-	stdin, err := cmd.StdinPipe()
+	// The passphrase of the key is given to Singularity on stdin
+	r, err := getSingularityRunner(container.BuildDir, sysCfg)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
-	go func() {
-		defer stdin.Close()
-		passphrase := os.Getenv(KeyPassphrase)
-		_, err := io.WriteString(stdin, passphrase)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
-	cmd.Dir = container.BuildDir
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
+	r = sys.WithStdin(r, strings.NewReader(os.Getenv(KeyPassphrase)))
+	stdout, stderr, err := runSingularity(ctx, r, sysCfg, "sign", "--keyidx", indexIdx, container.Path)
 	if err != nil {
-		return fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %s", stdout.String(), stderr.String(), err)
+		return fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %w", stdout, stderr, err)
 	}
 
 	return nil
@@ -242,40 +216,67 @@ func Sign(container *Config, sysCfg *sys.Config) error {
 
 // Upload uploads an image to a registry
 func Upload(containerInfo *Config, sysCfg *sys.Config) error {
-	var stdout, stderr bytes.Buffer
-
 	log.Printf("-> Uploading container %s to %s", containerInfo.Path, sysCfg.Registry)
 	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*2*time.Minute)
 	defer cancel()
 
-	var cmd *exec.Cmd
-	if sy.IsSudoCmd("push", sysCfg) {
-		cmd = exec.CommandContext(ctx, sysCfg.SudoBin, sysCfg.SingularityBin, "push", containerInfo.Path, sysCfg.Registry)
-	} else {
-		cmd = exec.CommandContext(ctx, sysCfg.SingularityBin, "push", containerInfo.Path, sysCfg.Registry)
+	r, err := getSingularityRunner(containerInfo.BuildDir, sysCfg)
+	if err != nil {
+		return err
 	}
-	cmd.Dir = containerInfo.BuildDir
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	stdout, stderr, err := runSingularity(ctx, r, sysCfg, "push", containerInfo.Path, sysCfg.Registry)
 	if err != nil {
-		return fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %s", stdout.String(), stderr.String(), err)
+		return fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %w", stdout, stderr, err)
 	}
 
 	return nil
 }
 
+// getSingularityRunner returns a runner executing Singularity from a directory, with the
+// cache and temporary directories of the configuration
+func getSingularityRunner(dir string, sysCfg *sys.Config) (sys.Runner, error) {
+	var env []string
+	vars, err := sysCfg.GetSingularityEnv()
+	if err != nil {
+		return nil, err
+	}
+	if len(vars) > 0 {
+		env = append(os.Environ(), vars...)
+	}
+	return sys.WithExecOptions(sysCfg.GetRunner(), dir, env, false), nil
+}
+
+// runSingularity executes a Singularity command through a runner, with sudo if the
+// configuration requires it for that command
+func runSingularity(ctx context.Context, r sys.Runner, sysCfg *sys.Config, syCmd string, args ...string) (string, string, error) {
+	bin := sysCfg.SingularityBin
+	cmdArgs := append([]string{syCmd}, args...)
+	if sy.IsSudoCmd(syCmd, sysCfg) {
+		bin = sysCfg.SudoBin
+		cmdArgs = append([]string{sysCfg.SingularityBin}, cmdArgs...)
+	}
+
+	log.Printf("-> Running %s %s\n", bin, strings.Join(cmdArgs, " "))
+	stdout, stderr, _, err := r.Run(ctx, bin, cmdArgs...)
+	return stdout, stderr, err
+}
+
 // GetContainerDefaultName returns the default name for any container based on the configuration details
-func GetContainerDefaultName(distro string, mpiID string, mpiVersion string, appName string, model string) string {
-	return strings.Replace(distro, ":", "-", -1) + "-" + mpiID + "-" + mpiVersion + "-" + appName + "-" + model
+func GetContainerDefaultName(distro string, mpiID string, mpiVersion string, appName string, model Model) string {
+	return strings.Replace(distro, ":", "-", -1) + "-" + mpiID + "-" + mpiVersion + "-" + appName + "-" + model.String()
 }
 
-func parseInspectOutput(output string) (Config, implem.Info) {
+func parseInspectOutput(output string) (Config, implem.Info, error) {
 	var cfg Config
 	var mpiCfg implem.Info
+	var err error
 
+	var labelExe string
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), AppExeLabel+": ") {
+			labelExe = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), AppExeLabel+": "))
+		}
 		if strings.Contains(line, "MPI_Implementation: ") {
 			mpiCfg.ID = strings.Replace(line, "MPI_Implementation: ", "", -1)
 		}
@@ -283,7 +284,10 @@ func parseInspectOutput(output string) (Config, implem.Info) {
 			mpiCfg.Version = strings.Replace(line, "MPI_Version: ", "", -1)
 		}
 		if strings.Contains(line, "Model: ") {
-			cfg.Model = strings.Replace(line, "Model: ", "", -1)
+			cfg.Model, err = ParseModel(strings.Replace(line, "Model: ", "", -1))
+			if err != nil {
+				return cfg, mpiCfg, err
+			}
 		}
 		if strings.Contains(line, "Linux_version: ") {
 			cfg.Distro = strings.Replace(line, "Linux_version: ", "", -1)
@@ -295,35 +299,117 @@ func parseInspectOutput(output string) (Config, implem.Info) {
 			cfg.MPIDir = strings.Replace(line, "MPI_Directory: ", "", -1)
 		}
 	}
+	if labelExe != "" {
+		cfg.AppExe = labelExe
+	}
 
-	return cfg, mpiCfg
+	return cfg, mpiCfg, nil
 }
 
-// GetMetadata inspects the container's image and gathers all the available metadata
+// GetMetadata inspects the container's image and gathers all the available metadata.
+// The result of the inspection is cached next to the image and reused as long as the
+// image does not change.
 func GetMetadata(imgPath string, sysCfg *sys.Config) (Config, implem.Info, error) {
 	var metadata Config
 	var mpiCfg implem.Info
 
+	if output, ok := loadCachedInspect(imgPath); ok {
+		log.Printf("* Using cached metadata for %s\n", imgPath)
+		metadata, mpiCfg, err := parseInspectOutput(output)
+		if err != nil {
+			return metadata, mpiCfg, fmt.Errorf("invalid metadata for %s: %w", imgPath, err)
+		}
+		metadata.Path = imgPath
+		return metadata, mpiCfg, nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*2*time.Minute)
 	defer cancel()
 
-	var stdout, stderr bytes.Buffer
-	var cmd *exec.Cmd
-	if sy.IsSudoCmd("inspect", sysCfg) {
-		log.Printf("Executing %s %s inspect %s\n", sysCfg.SudoBin, sysCfg.SingularityBin, imgPath)
-		cmd = exec.CommandContext(ctx, sysCfg.SudoBin, sysCfg.SingularityBin, "inspect", imgPath)
-	} else {
-		log.Printf("Executing %s inspect %s\n", sysCfg.SingularityBin, imgPath)
-		cmd = exec.CommandContext(ctx, sysCfg.SingularityBin, "inspect", imgPath)
-	}
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	stdout, stderr, err := runSingularity(ctx, sysCfg.GetRunner(), sysCfg, "inspect", imgPath)
 	if err != nil {
-		return metadata, mpiCfg, fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %s", stdout.String(), stderr.String(), err)
+		return metadata, mpiCfg, fmt.Errorf("failed to execute command - stdout: %s; stderr: %s; err: %w", stdout, stderr, err)
 	}
 
-	metadata, mpiCfg = parseInspectOutput(stdout.String())
+	err = saveCachedInspect(imgPath, stdout)
+	if err != nil {
+		// Not fatal, we will simply inspect the image again next time
+		log.Printf("[WARN] failed to cache metadata of %s: %s", imgPath, err)
+	}
+
+	metadata, mpiCfg, err = parseInspectOutput(stdout)
+	if err != nil {
+		return metadata, mpiCfg, fmt.Errorf("invalid metadata for %s: %w", imgPath, err)
+	}
 	metadata.Path = imgPath
 	return metadata, mpiCfg, nil
 }
+
+// GetCachedMetadata returns the metadata of a container's image from its cache, without
+// inspecting the image. The boolean is false if the image was not inspected since it changed.
+func GetCachedMetadata(imgPath string) (Config, implem.Info, bool) {
+	output, ok := loadCachedInspect(imgPath)
+	if !ok {
+		return Config{}, implem.Info{}, false
+	}
+	metadata, mpiCfg, err := parseInspectOutput(output)
+	if err != nil {
+		return Config{}, implem.Info{}, false
+	}
+	metadata.Path = imgPath
+	return metadata, mpiCfg, true
+}
+
+// execInContainer executes a command in the container, with the bind-mounts of the container
+func execInContainer(c *Config, sysCfg *sys.Config, command ...string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*time.Minute)
+	defer cancel()
+
+	var args []string
+	if sysCfg.Nopriv {
+		args = append(args, "-u")
+	}
+	for _, b := range c.Binds {
+		args = append(args, "--bind", b)
+	}
+	args = append(args, c.Path)
+	args = append(args, command...)
+
+	return runSingularity(ctx, sysCfg.GetRunner(), sysCfg, "exec", args...)
+}
+
+// CheckDir checks that a directory exists in the container, including the directories
+// that are bind-mounted in the container
+func CheckDir(c *Config, dir string, sysCfg *sys.Config) error {
+	_, stderr, err := execInContainer(c, sysCfg, "test", "-d", dir)
+	if err != nil {
+		return fmt.Errorf("%s does not exist in %s - stderr: %s: %w", dir, c.Path, stderr, err)
+	}
+
+	return nil
+}
+
+// FindBinary looks for a binary in the container, first in the PATH then in the
+// entire file system, and returns its path
+func FindBinary(c *Config, name string, sysCfg *sys.Config) (string, error) {
+	script := "command -v " + name + " || find / -xdev -type f -name " + name + " 2>/dev/null | head -n 1"
+	stdout, stderr, err := execInContainer(c, sysCfg, "sh", "-c", script)
+	if err != nil {
+		return "", fmt.Errorf("failed to look for %s in %s - stderr: %s: %w", name, c.Path, stderr, err)
+	}
+	path := strings.TrimSpace(stdout)
+	if path == "" {
+		return "", fmt.Errorf("%s not found in %s: %w", name, c.Path, sympierr.ErrNotAvailable)
+	}
+
+	return path, nil
+}
+
+// GetGlibcVersion returns the version of glibc in the container
+func GetGlibcVersion(c *Config, sysCfg *sys.Config) (string, error) {
+	stdout, stderr, err := execInContainer(c, sysCfg, "getconf", "GNU_LIBC_VERSION")
+	if err != nil {
+		return "", fmt.Errorf("failed to get glibc version from %s - stderr: %s: %w", c.Path, stderr, err)
+	}
+	return checker.ParseGlibcVersion(stdout)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestGetMetadata(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "container-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	imgPath := filepath.Join(tempDir, "test.sif")
+	err = ioutil.WriteFile(imgPath, []byte("image"), 0644)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", imgPath, err)
+	}
+
+	inspect := "Application: helloworld\nApp_exe: /opt/helloworld\nLinux_version: ubuntu:disco\nMPI_Directory: /opt/mpi\nMPI_Implementation: openmpi\nMPI_Version: 4.0.2\nModel: bind\n"
+	r := &mock.Runner{Results: map[string]mock.Result{"singularity": {Stdout: inspect}}}
+	sysCfg := sys.Config{SingularityBin: "singularity", Runner: r}
+	if _, _, ok := GetCachedMetadata(imgPath); ok {
+		t.Fatalf("metadata found in the cache before inspecting the image")
+	}
+	c, mpi, err := GetMetadata(imgPath, &sysCfg)
+	if err != nil {
+		t.Fatalf("GetMetadata() failed: %s", err)
+	}
+	if mpi.ID != "openmpi" || mpi.Version != "4.0.2" {
+		t.Fatalf("invalid MPI: %+v", mpi)
+	}
+	if c.Model != BindModel || c.AppExe != "/opt/helloworld" || c.MPIDir != "/opt/mpi" || c.Distro != "ubuntu:disco" || c.Path != imgPath {
+		t.Fatalf("invalid metadata: %+v", c)
+	}
+
+	// The metadata is then cached, the image is not inspected again
+	_, _, err = GetMetadata(imgPath, &sysCfg)
+	if err != nil {
+		t.Fatalf("GetMetadata() failed: %s", err)
+	}
+	cached, cachedMPI, ok := GetCachedMetadata(imgPath)
+	if !ok || !reflect.DeepEqual(cached, c) || !reflect.DeepEqual(cachedMPI, mpi) {
+		t.Fatalf("invalid cached metadata: %+v, %+v", cached, cachedMPI)
+	}
+	expected := []string{"singularity inspect " + imgPath}
+	if !reflect.DeepEqual(r.Calls(), expected) {
+		t.Fatalf("singularity was called with %v instead of %v", r.Calls(), expected)
+	}
+}
+
+func TestSingularityCommands(t *testing.T) {
+	c := Config{
+		Path:     "/tmp/test.sif",
+		URL:      "library://sympi/test",
+		BuildDir: "/tmp",
+		Binds:    []string{"/opt/mpi"},
+	}
+
+	tests := []struct {
+		name     string
+		sudoCmds []string
+		run      func(*sys.Config) error
+		expected string
+	}{
+		{
+			name:     "pull",
+			run:      func(sysCfg *sys.Config) error { return Pull(&c, sysCfg) },
+			expected: "/usr/bin/singularity pull /tmp/test.sif library://sympi/test",
+		},
+		{
+			name:     "push",
+			run:      func(sysCfg *sys.Config) error { return Upload(&c, sysCfg) },
+			expected: "/usr/bin/singularity push /tmp/test.sif library://registry",
+		},
+		{
+			name:     "push with sudo",
+			sudoCmds: []string{"push"},
+			run:      func(sysCfg *sys.Config) error { return Upload(&c, sysCfg) },
+			expected: "/usr/bin/sudo /usr/bin/singularity push /tmp/test.sif library://registry",
+		},
+		{
+			name:     "exec",
+			run:      func(sysCfg *sys.Config) error { return CheckDir(&c, "/opt/mpi", sysCfg) },
+			expected: "/usr/bin/singularity exec --bind /opt/mpi /tmp/test.sif test -d /opt/mpi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mock.Runner{}
+			sysCfg := sys.Config{
+				SingularityBin: "/usr/bin/singularity",
+				SudoBin:        "/usr/bin/sudo",
+				SudoSyCmds:     tt.sudoCmds,
+				Registry:       "library://registry",
+				Runner:         r,
+			}
+			err := tt.run(&sysCfg)
+			if err != nil {
+				t.Fatalf("command failed: %s", err)
+			}
+			calls := r.Calls()
+			if len(calls) != 1 || calls[0] != tt.expected {
+				t.Fatalf("commands are %v instead of %s", calls, tt.expected)
+			}
+		})
+	}
+}
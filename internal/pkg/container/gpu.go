@@ -0,0 +1,152 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// NvidiaGPU is the GPU mode for NVIDIA GPUs, i.e., singularity's --nv option
+	NvidiaGPU = "nv"
+
+	// AMDGPU is the GPU mode for AMD GPUs, i.e., singularity's --rocm option
+	AMDGPU = "rocm"
+)
+
+// DetectGPU returns the GPU mode to use based on the GPU tools available on the host,
+// or an empty string if no GPU is detected
+func DetectGPU() string {
+	if _, err := exec.LookPath("nvidia-smi"); err == nil {
+		log.Println("* nvidia-smi found, enabling NVIDIA GPU support")
+		return NvidiaGPU
+	}
+	if _, err := exec.LookPath("rocminfo"); err == nil {
+		log.Println("* rocminfo found, enabling AMD GPU support")
+		return AMDGPU
+	}
+	return ""
+}
+
+// GetGPUArgs returns the singularity arguments required to enable GPU support in the container
+func GetGPUArgs(c *Config) []string {
+	switch c.GPU {
+	case NvidiaGPU, AMDGPU:
+		return []string{"--" + c.GPU}
+	}
+	return nil
+}
+
+// GetGPUCheckCmd returns the command listing the GPUs visible in a container for a GPU mode
+func GetGPUCheckCmd(mode string) ([]string, error) {
+	switch mode {
+	case NvidiaGPU:
+		return []string{"nvidia-smi", "-L"}, nil
+	case AMDGPU:
+		return []string{"rocm-smi", "--showid"}, nil
+	}
+	return nil, fmt.Errorf("GPU support is not enabled")
+}
+
+var (
+	// rankLabelREs match the labels prefixing the output of the ranks: mpirun --tag-output
+	// (Open MPI), mpirun -prepend-rank (Hydra) and srun --label
+	rankLabelREs = []*regexp.Regexp{
+		regexp.MustCompile(`^\[\d+,(\d+)\]<stdout>:\s?(.*)$`),
+		regexp.MustCompile(`^\[(\d+)\]\s?(.*)$`),
+		regexp.MustCompile(`^\s*(\d+):\s?(.*)$`),
+	}
+
+	// gpuLineREs match the lines of the output of nvidia-smi -L and rocm-smi --showid
+	// describing a GPU, the submatch being the index of the GPU
+	gpuLineREs = []*regexp.Regexp{
+		regexp.MustCompile(`^GPU (\d+):`),
+		regexp.MustCompile(`^GPU\[(\d+)\]`),
+	}
+)
+
+// parseRankLine returns the rank displaying a labeled line of output and the line without its
+// label; the rank is -1 if the line is not labeled
+func parseRankLine(line string) (int, string) {
+	for _, re := range rankLabelREs {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		rank, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		return rank, m[2]
+	}
+	return -1, line
+}
+
+// CountGPUsPerRank parses the labeled output of the GPU check command (see GetGPUCheckCmd) run
+// by all the ranks of a job and returns the number of GPUs each rank saw. Lines that are not
+// labeled with a rank are ignored.
+func CountGPUsPerRank(output string) map[int]int {
+	gpus := make(map[int]map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		rank, content := parseRankLine(strings.TrimRight(line, "\r"))
+		if rank < 0 {
+			continue
+		}
+		if gpus[rank] == nil {
+			gpus[rank] = make(map[string]bool)
+		}
+		for _, re := range gpuLineREs {
+			if m := re.FindStringSubmatch(content); m != nil {
+				gpus[rank][m[1]] = true
+				break
+			}
+		}
+	}
+
+	counts := make(map[int]int)
+	for rank, ids := range gpus {
+		counts[rank] = len(ids)
+	}
+	return counts
+}
+
+// CheckGPUCounts compares the number of GPUs each rank saw with the expected number of GPUs per
+// rank and returns a warning for each mismatch. When np is 0, only the ranks that displayed
+// something are checked.
+func CheckGPUCounts(counts map[int]int, np int, expected int) []string {
+	var ranks []int
+	if np > 0 {
+		for r := 0; r < np; r++ {
+			ranks = append(ranks, r)
+		}
+	} else {
+		for r := range counts {
+			ranks = append(ranks, r)
+		}
+		sort.Ints(ranks)
+	}
+	if len(ranks) == 0 {
+		return []string{"no rank reported its GPUs"}
+	}
+
+	var warnings []string
+	for _, r := range ranks {
+		n, ok := counts[r]
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("rank %d did not report its GPUs", r))
+		case n != expected:
+			warnings = append(warnings, fmt.Sprintf("rank %d saw %d GPU(s) while %d were requested", r, n, expected))
+		}
+	}
+	return warnings
+}
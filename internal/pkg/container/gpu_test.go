@@ -0,0 +1,79 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCountGPUsPerRank(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected map[int]int
+	}{
+		{
+			name:     "openmpi",
+			output:   "[1,0]<stdout>:GPU 0: Tesla V100 (UUID: GPU-a)\n[1,0]<stdout>:GPU 1: Tesla V100 (UUID: GPU-b)\n[1,1]<stdout>:GPU 0: Tesla V100 (UUID: GPU-c)\n",
+			expected: map[int]int{0: 2, 1: 1},
+		},
+		{
+			name:     "hydra",
+			output:   "[0] GPU 0: Tesla V100 (UUID: GPU-a)\n[1] GPU 0: Tesla V100 (UUID: GPU-b)\n",
+			expected: map[int]int{0: 1, 1: 1},
+		},
+		{
+			name:     "srun",
+			output:   "0: GPU 0: A100 (UUID: GPU-a)\r\n1: No devices were found\r\n",
+			expected: map[int]int{0: 1, 1: 0},
+		},
+		{
+			name:     "rocm",
+			output:   "0: GPU[0]\t\t: GPU ID: 0x738c\n0: GPU[0]\t\t: Device Name: MI100\n0: GPU[1]\t\t: GPU ID: 0x738c\n",
+			expected: map[int]int{0: 2},
+		},
+		{
+			name:     "unlabeled",
+			output:   "GPU 0: Tesla V100 (UUID: GPU-a)\n",
+			expected: map[int]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := CountGPUsPerRank(tt.output)
+			if !reflect.DeepEqual(counts, tt.expected) {
+				t.Fatalf("got %v instead of %v", counts, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckGPUCounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		counts   map[int]int
+		np       int
+		expected int
+		warnings int
+	}{
+		{name: "match", counts: map[int]int{0: 1, 1: 1}, np: 2, expected: 1, warnings: 0},
+		{name: "mismatch", counts: map[int]int{0: 1, 1: 0}, np: 2, expected: 1, warnings: 1},
+		{name: "missing rank", counts: map[int]int{0: 1}, np: 2, expected: 1, warnings: 1},
+		{name: "unknown np", counts: map[int]int{0: 2, 1: 2}, np: 0, expected: 2, warnings: 0},
+		{name: "no output", counts: map[int]int{}, np: 0, expected: 1, warnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := CheckGPUCounts(tt.counts, tt.np, tt.expected)
+			if len(warnings) != tt.warnings {
+				t.Fatalf("got %d warning(s) instead of %d: %v", len(warnings), tt.warnings, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// DefaultInspectWorkers is the default number of images that are inspected concurrently
+const DefaultInspectWorkers = 4
+
+// Metadata is the result of the inspection of a container image
+type Metadata struct {
+	// Container is the container's configuration extracted from the image
+	Container Config
+
+	// MPI is the MPI implementation available in the image
+	MPI implem.Info
+
+	// Err is the error that occurred while inspecting the image, if any
+	Err error
+}
+
+// GetImageName returns the name of an image, i.e., the name of the image file without the .sif extension
+func GetImageName(imgPath string) string {
+	return strings.TrimSuffix(filepath.Base(imgPath), ".sif")
+}
+
+// InspectImages inspects a set of images, running at most n inspections in parallel. The result
+// is a map where the key is the image name (see GetImageName); since the map is not ordered,
+// callers iterate over their list of images to display results in a deterministic order.
+func InspectImages(imgPaths []string, n int, sysCfg *sys.Config) map[string]Metadata {
+	if n <= 0 {
+		n = DefaultInspectWorkers
+	}
+
+	results := make(map[string]Metadata)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, n)
+	for _, imgPath := range imgPaths {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(imgPath string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			var md Metadata
+			md.Container, md.MPI, md.Err = GetMetadata(imgPath, sysCfg)
+
+			mutex.Lock()
+			results[GetImageName(imgPath)] = md
+			mutex.Unlock()
+		}(imgPath)
+	}
+	wg.Wait()
+
+	return results
+}
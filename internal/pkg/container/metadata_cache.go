@@ -0,0 +1,83 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// metadataCacheSuffix is the suffix added to the image path to get the path of its metadata cache
+const metadataCacheSuffix = ".metadata.json"
+
+// metadataCache is the content of the metadata cache of an image. The image's size and
+// modification time let us detect that the image changed and that the cache is stale.
+type metadataCache struct {
+	ImgSize    int64  `json:"img_size"`
+	ImgModTime int64  `json:"img_mtime"`
+	Inspect    string `json:"inspect"`
+}
+
+func getMetadataCachePath(imgPath string) string {
+	return imgPath + metadataCacheSuffix
+}
+
+// loadCachedInspect returns the output of singularity inspect for an image from its cache.
+// The boolean is false if the cache does not exist or is stale.
+func loadCachedInspect(imgPath string) (string, bool) {
+	fi, err := os.Stat(imgPath)
+	if err != nil {
+		return "", false
+	}
+
+	data, err := ioutil.ReadFile(getMetadataCachePath(imgPath))
+	if err != nil {
+		return "", false
+	}
+
+	var cache metadataCache
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		log.Printf("[WARN] invalid metadata cache for %s: %s", imgPath, err)
+		return "", false
+	}
+
+	if cache.ImgSize != fi.Size() || cache.ImgModTime != fi.ModTime().UnixNano() {
+		log.Printf("* Metadata cache for %s is stale", imgPath)
+		return "", false
+	}
+
+	return cache.Inspect, true
+}
+
+// saveCachedInspect saves the output of singularity inspect for an image in its cache
+func saveCachedInspect(imgPath string, inspect string) error {
+	fi, err := os.Stat(imgPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", imgPath, err)
+	}
+
+	cache := metadataCache{
+		ImgSize:    fi.Size(),
+		ImgModTime: fi.ModTime().UnixNano(),
+		Inspect:    inspect,
+	}
+	data, err := json.Marshal(&cache)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata cache: %w", err)
+	}
+
+	cachePath := getMetadataCachePath(imgPath)
+	err = ioutil.WriteFile(cachePath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", cachePath, err)
+	}
+
+	return nil
+}
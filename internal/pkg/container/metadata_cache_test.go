@@ -0,0 +1,50 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetadataCache(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "container-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	imgPath := filepath.Join(tempDir, "test.sif")
+	err = ioutil.WriteFile(imgPath, []byte("image"), 0644)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", imgPath, err)
+	}
+
+	if _, ok := loadCachedInspect(imgPath); ok {
+		t.Fatalf("cache found while it was never created")
+	}
+
+	inspect := "MPI_Implementation: openmpi\nMPI_Version: 4.0.1\n"
+	err = saveCachedInspect(imgPath, inspect)
+	if err != nil {
+		t.Fatalf("failed to save cache: %s", err)
+	}
+	output, ok := loadCachedInspect(imgPath)
+	if !ok || output != inspect {
+		t.Fatalf("unexpected cache content: %s", output)
+	}
+
+	// Modifying the image must invalidate the cache
+	err = ioutil.WriteFile(imgPath, []byte("updated image"), 0644)
+	if err != nil {
+		t.Fatalf("failed to update %s: %s", imgPath, err)
+	}
+	if _, ok := loadCachedInspect(imgPath); ok {
+		t.Fatalf("stale cache was used")
+	}
+}
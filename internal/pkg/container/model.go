@@ -0,0 +1,55 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Model is the model followed for MPI inside a container
+type Model int
+
+const (
+	// UnknownModel is the model of containers that do not specify one, e.g., images not created by our tools
+	UnknownModel Model = iota
+
+	// HybridModel is the model where MPI is installed in the container and used with the MPI of the host
+	HybridModel
+
+	// BindModel is the model where the MPI of the host is bind-mounted in the container
+	BindModel
+)
+
+// modelLabels associates each known model to the value of the Model label of the images
+var modelLabels = map[Model]string{
+	HybridModel: "hybrid",
+	BindModel:   "bind",
+}
+
+// String returns the value used to identify the model, e.g., in the image labels
+func (m Model) String() string {
+	label, ok := modelLabels[m]
+	if !ok {
+		return "unknown"
+	}
+	return label
+}
+
+// ParseModel returns the model matching the value of an image's Model label. An
+// empty label means that the image does not specify a model.
+func ParseModel(label string) (Model, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return UnknownModel, nil
+	}
+	for m, l := range modelLabels {
+		if l == label {
+			return m, nil
+		}
+	}
+	return UnknownModel, fmt.Errorf("unknown MPI model %q, supported models are %s and %s", label, HybridModel, BindModel)
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package container
+
+import (
+	"testing"
+)
+
+func TestParseModel(t *testing.T) {
+	tests := []struct {
+		label           string
+		expectedModel   Model
+		expectedSuccess bool
+	}{
+		{label: "bind", expectedModel: BindModel, expectedSuccess: true},
+		{label: "hybrid", expectedModel: HybridModel, expectedSuccess: true},
+		{label: "", expectedModel: UnknownModel, expectedSuccess: true},
+		{label: "bindmount", expectedModel: UnknownModel, expectedSuccess: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			m, err := ParseModel(tt.label)
+			if tt.expectedSuccess && err != nil {
+				t.Fatalf("failed to parse %s: %s", tt.label, err)
+			}
+			if !tt.expectedSuccess && err == nil {
+				t.Fatalf("%s successfully parsed", tt.label)
+			}
+			if m != tt.expectedModel {
+				t.Fatalf("%s parsed as %s instead of %s", tt.label, m, tt.expectedModel)
+			}
+			if tt.expectedSuccess && tt.label != "" && m.String() != tt.label {
+				t.Fatalf("%s is displayed as %s", tt.label, m)
+			}
+		})
+	}
+}
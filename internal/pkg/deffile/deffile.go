@@ -63,7 +63,10 @@ type DefFileData struct {
 	InternalEnv *buildenv.Info
 
 	// Model specifies the model to follow for MPI inside the container
-	Model string
+	Model container.Model
+
+	// AppExe is the path of the application's executable inside the container, recorded in the App_exe label. When empty, the path is derived from the application's information
+	AppExe string
 }
 
 func setMPIInstallDir(mpiImplm string, mpiVersion string) string {
@@ -110,7 +113,7 @@ func AddLabels(f *os.File, app *app.Info, deffile *DefFileData) error {
 		return err
 	}
 
-	_, err = f.WriteString("\tModel " + deffile.Model + "\n")
+	_, err = f.WriteString("\tModel " + deffile.Model.String() + "\n")
 	if err != nil {
 		return err
 	}
@@ -120,7 +123,13 @@ func AddLabels(f *os.File, app *app.Info, deffile *DefFileData) error {
 		return err
 	}
 
-	if deffile.Model == container.BindModel {
+	if deffile.AppExe != "" {
+		// The path was explicitly specified when building the container
+		_, err = f.WriteString("\tApp_exe " + deffile.AppExe + "\n")
+		if err != nil {
+			return err
+		}
+	} else if deffile.Model == container.BindModel {
 		// When dealing with the bind model, we explicitly copy the binary in /opt
 		_, err = f.WriteString("\tApp_exe /opt/" + app.BinName + "\n")
 		if err != nil {
@@ -567,7 +576,7 @@ func CreateBindDefFile(app *app.Info, data *DefFileData, sysCfg *sys.Config) err
 		return fmt.Errorf("failed to load a workable ldd module")
 	}
 	log.Printf("* Getting dependencies for %s\n", app.BinPath)
-	pkgs := lddMod.GetPackageDependenciesForFile(app.BinPath)
+	pkgs := lddMod.GetPackageDependenciesForFile(app.BinPath, sysCfg)
 
 	// Add some packages we always want in the image
 	// todo: find a way to do this in a clean and maintainable way
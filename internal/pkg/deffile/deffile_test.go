@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
@@ -17,6 +18,7 @@ import (
 	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/app"
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 )
 
@@ -94,3 +96,64 @@ func TestCreateDefFile(t *testing.T) {
 
 	fmt.Printf("Definition files are in %s", tempDir)
 }
+
+func TestAddLabelsAppExe(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    container.Model
+		appExe   string
+		expected string
+	}{
+		{
+			name:     "explicit path",
+			model:    container.HybridModel,
+			appExe:   "/opt/app/bin/app",
+			expected: "\tApp_exe /opt/app/bin/app\n",
+		},
+		{
+			name:     "bind model default",
+			model:    container.BindModel,
+			expected: "\tApp_exe /opt/app\n",
+		},
+		{
+			name:     "hybrid model default",
+			model:    container.HybridModel,
+			expected: "\tApp_exe /usr/bin/app\n",
+		},
+	}
+
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	a := app.Info{Name: "app", BinName: "app", BinPath: "/usr/bin/app"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := DefFileData{
+				MpiImplm:    &implem.Info{ID: implem.OMPI, Version: "4.0.0"},
+				InternalEnv: &buildenv.Info{},
+				Model:       tt.model,
+				AppExe:      tt.appExe,
+			}
+			path := filepath.Join(tempDir, "labels.def")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("failed to create %s: %s", path, err)
+			}
+			err = AddLabels(f, &a, &data)
+			f.Close()
+			if err != nil {
+				t.Fatalf("AddLabels() failed: %s", err)
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", path, err)
+			}
+			if !strings.Contains(string(content), tt.expected) {
+				t.Fatalf("label %q not found in:\n%s", tt.expected, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package diagnostics
+
+import (
+	"regexp"
+)
+
+// Diagnostic is the explanation of a known error found in the output of a failed run
+type Diagnostic struct {
+	// Explanation is a short and human-readable explanation of the error
+	Explanation string
+
+	// Suggestion is the suggested fix
+	Suggestion string
+}
+
+type rule struct {
+	re   *regexp.Regexp
+	diag Diagnostic
+}
+
+var rules = []rule{
+	{
+		re: regexp.MustCompile(`There are not enough slots available`),
+		diag: Diagnostic{
+			Explanation: "more ranks were requested than the number of slots (cores) available on the allocated nodes",
+			Suggestion:  "reduce the number of ranks, request more nodes or add --oversubscribe to the mpirun arguments",
+		},
+	},
+	{
+		re: regexp.MustCompile(`ORTE was unable to reliably start|ORTE daemon has unexpectedly failed`),
+		diag: Diagnostic{
+			Explanation: "Open MPI could not start its daemons on the remote nodes",
+			Suggestion:  "check that the host MPI is installed at the same path on all the nodes and that the nodes can reach each other (e.g., SSH, firewall)",
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)UCX\s+(ERROR|WARN)|ucp_|uct_|UCX_TLS|transport.*(not available|unavailable)`),
+		diag: Diagnostic{
+			Explanation: "UCX failed to initialize a network transport",
+			Suggestion:  "check the network setup of the host (e.g., Infiniband drivers) or restrict the transports with UCX_TLS (e.g., UCX_TLS=tcp,self,sm)",
+		},
+	},
+	{
+		re: regexp.MustCompile(`undefined symbol|symbol lookup error|version .GLIBC_[0-9.]+. not found|version .* not defined in file`),
+		diag: Diagnostic{
+			Explanation: "the MPI libraries used in the container are not ABI compatible with the application",
+			Suggestion:  "host and container MPI ABI differ; use a host MPI of the same implementation and version family than the container",
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)error while loading shared libraries`),
+		diag: Diagnostic{
+			Explanation: "a library required by the application cannot be found in the container",
+			Suggestion:  "check that the host MPI is correctly bind-mounted in the container (bind model) or that LD_LIBRARY_PATH is correctly set",
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)PMI.*(failed|error)|PMIx.*(failed|error)`),
+		diag: Diagnostic{
+			Explanation: "the process manager interface (PMI/PMIx) failed to wire up the ranks",
+			Suggestion:  "make sure the host and container MPI use the same PMI flavor, or launch with mpirun instead of the job manager's launcher",
+		},
+	},
+	{
+		re: regexp.MustCompile(`(?i)FATAL:.*(could not open image|image format not recognized)`),
+		diag: Diagnostic{
+			Explanation: "Singularity cannot open the container image",
+			Suggestion:  "check that the image exists on all the nodes and was built with a compatible version of Singularity",
+		},
+	},
+}
+
+// Analyze looks for known errors in the output of a failed run and returns the associated
+// diagnostics, in the order of the rules, without duplicates
+func Analyze(outputs ...string) []Diagnostic {
+	var diags []Diagnostic
+	for _, r := range rules {
+		for _, output := range outputs {
+			if r.re.MatchString(output) {
+				diags = append(diags, r.diag)
+				break
+			}
+		}
+	}
+	return diags
+}
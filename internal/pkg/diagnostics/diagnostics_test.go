@@ -0,0 +1,50 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package diagnostics
+
+import (
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name     string
+		stdout   string
+		stderr   string
+		expected int
+	}{
+		{
+			name:     "no error",
+			stdout:   "Hello world from rank 0\n",
+			expected: 0,
+		},
+		{
+			name:     "slots",
+			stderr:   "There are not enough slots available in the system to satisfy the 4\nslots that were requested by the application:",
+			expected: 1,
+		},
+		{
+			name:     "abi",
+			stderr:   "/opt/mpitest: symbol lookup error: /opt/mpi/lib/libmpi.so.40: undefined symbol: ompi_foo",
+			expected: 1,
+		},
+		{
+			name:     "multiple",
+			stdout:   "ORTE was unable to reliably start one or more daemons.",
+			stderr:   "There are not enough slots available",
+			expected: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := Analyze(tt.stdout, tt.stderr)
+			if len(diags) != tt.expected {
+				t.Fatalf("got %d diagnostic(s) instead of %d: %v", len(diags), tt.expected, diags)
+			}
+		})
+	}
+}
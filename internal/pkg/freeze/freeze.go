@@ -0,0 +1,124 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package freeze
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// MPIEntry is the type of the entries describing a MPI installed on the host
+	MPIEntry = "mpi"
+
+	// SingularityEntry is the type of the entries describing a version of Singularity installed on the host
+	SingularityEntry = "singularity"
+
+	// ContainerEntry is the type of the entries describing an installed container
+	ContainerEntry = "container"
+
+	// checksumPrefix is the prefix of the checksums in a lockfile
+	checksumPrefix = "sha256:"
+
+	// noValue is used in a lockfile when a field of an entry is not set
+	noValue = "-"
+)
+
+// Entry describes an element of an installed environment
+type Entry struct {
+	// Type is the type of the element: mpi, singularity or container
+	Type string
+
+	// ID identifies the element, e.g., openmpi:4.0.2, singularity:3.5.0 or the name of a container
+	ID string
+
+	// URL is the source of the element (empty if unknown)
+	URL string
+
+	// Checksum is the SHA-256 checksum of the source of a MPI or Singularity and of the image of a container (empty if unknown)
+	Checksum string
+}
+
+var typeOrder = map[string]int{
+	SingularityEntry: 0,
+	MPIEntry:         1,
+	ContainerEntry:   2,
+}
+
+func fieldValue(val string) string {
+	if val == "" {
+		return noValue
+	}
+	return val
+}
+
+// Write saves a set of entries in a lockfile, one entry per line. The entries are sorted so the
+// lockfiles of two environments can be easily compared.
+func Write(w io.Writer, entries []Entry) error {
+	sorted := append([]Entry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Type != sorted[j].Type {
+			return typeOrder[sorted[i].Type] < typeOrder[sorted[j].Type]
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	_, err := fmt.Fprintln(w, "# Generated by 'sympi -freeze', install with 'sympi -apply <file>'")
+	if err != nil {
+		return err
+	}
+	for _, e := range sorted {
+		checksum := noValue
+		if e.Checksum != "" {
+			checksum = checksumPrefix + e.Checksum
+		}
+		_, err = fmt.Fprintf(w, "%s %s %s %s\n", e.Type, e.ID, fieldValue(e.URL), checksum)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read loads the entries of a lockfile
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid entry format: %s", line)
+		}
+		if _, ok := typeOrder[fields[0]]; !ok {
+			return nil, fmt.Errorf("invalid entry type: %s", fields[0])
+		}
+		e := Entry{Type: fields[0], ID: fields[1]}
+		if fields[2] != noValue {
+			e.URL = fields[2]
+		}
+		if fields[3] != noValue {
+			if !strings.HasPrefix(fields[3], checksumPrefix) {
+				return nil, fmt.Errorf("invalid checksum: %s", fields[3])
+			}
+			e.Checksum = strings.TrimPrefix(fields[3], checksumPrefix)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package freeze
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	entries := []Entry{
+		{Type: ContainerEntry, ID: "helloworld", Checksum: "abcd"},
+		{Type: MPIEntry, ID: "openmpi:4.0.2", URL: "https://example.org/openmpi-4.0.2.tar.bz2", Checksum: "1234"},
+		{Type: MPIEntry, ID: "mpich:3.3", URL: "https://example.org/mpich-3.3.tar.gz"},
+		{Type: SingularityEntry, ID: "singularity:3.5.0", URL: "https://example.org/singularity-3.5.0.tar.gz", Checksum: "5678"},
+	}
+	expected := `# Generated by 'sympi -freeze', install with 'sympi -apply <file>'
+singularity singularity:3.5.0 https://example.org/singularity-3.5.0.tar.gz sha256:5678
+mpi mpich:3.3 https://example.org/mpich-3.3.tar.gz -
+mpi openmpi:4.0.2 https://example.org/openmpi-4.0.2.tar.bz2 sha256:1234
+container helloworld - sha256:abcd
+`
+
+	var buf bytes.Buffer
+	err := Write(&buf, entries)
+	if err != nil {
+		t.Fatalf("Write() failed: %s", err)
+	}
+	if buf.String() != expected {
+		t.Fatalf("got:\n%s\ninstead of:\n%s", buf.String(), expected)
+	}
+
+	read, err := Read(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("Read() failed: %s", err)
+	}
+	if !reflect.DeepEqual(read, []Entry{entries[3], entries[2], entries[1], entries[0]}) {
+		t.Fatalf("Read() returned %v", read)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "missing field", content: "mpi openmpi:4.0.2 -\n"},
+		{name: "unknown type", content: "compiler gcc:9 - -\n"},
+		{name: "invalid checksum", content: "mpi openmpi:4.0.2 - md5:1234\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.content))
+			if err == nil {
+				t.Fatalf("Read() succeeded with %q", tt.content)
+			}
+		})
+	}
+}
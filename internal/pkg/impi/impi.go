@@ -6,11 +6,10 @@
 package impi
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
@@ -95,27 +94,27 @@ func updateIntelMPIDefFile(impiCfg *Config, env *buildenv.Info, sysCfg *sys.Conf
 	destUninstallConfFile := filepath.Join(env.BuildDir, intelUninstallConfFile)
 	err := util.CopyFile(srcInstallConfFile, destInstallConfFile)
 	if err != nil {
-		return fmt.Errorf("enable to copy %s to %s: %s", srcInstallConfFile, destInstallConfFile, err)
+		return fmt.Errorf("enable to copy %s to %s: %w", srcInstallConfFile, destInstallConfFile, err)
 	}
 	err = util.CopyFile(srcUninstallConfFile, destUninstallConfFile)
 	if err != nil {
-		return fmt.Errorf("enable to copy %s to %s: %s", srcUninstallConfFile, destUninstallConfFile, err)
+		return fmt.Errorf("enable to copy %s to %s: %w", srcUninstallConfFile, destUninstallConfFile, err)
 	}
 
 	err = updateTemplate(destInstallConfFile, containerIMPIInstallDir)
 	if err != nil {
-		return fmt.Errorf("unable to update IMPI template %s: %s", destInstallConfFile, err)
+		return fmt.Errorf("unable to update IMPI template %s: %w", destInstallConfFile, err)
 	}
 
 	err = updateTemplate(destUninstallConfFile, containerIMPIInstallDir)
 	if err != nil {
-		return fmt.Errorf("unable to update IMPI template %s: %s", destUninstallConfFile, err)
+		return fmt.Errorf("unable to update IMPI template %s: %w", destUninstallConfFile, err)
 	}
 
 	// Then we have to put together a valid def file
 	data, err := ioutil.ReadFile(impiCfg.DefFile)
 	if err != nil {
-		return fmt.Errorf("failed to read %s: %s", impiCfg.DefFile, err)
+		return fmt.Errorf("failed to read %s: %w", impiCfg.DefFile, err)
 	}
 
 	content := string(data)
@@ -128,7 +127,7 @@ func updateIntelMPIDefFile(impiCfg *Config, env *buildenv.Info, sysCfg *sys.Conf
 
 	err = ioutil.WriteFile(impiCfg.DefFile, []byte(content), 0)
 	if err != nil {
-		return fmt.Errorf("failed to write file %s: %s", impiCfg.DefFile, err)
+		return fmt.Errorf("failed to write file %s: %w", impiCfg.DefFile, err)
 	}
 
 	return nil
@@ -137,13 +136,13 @@ func updateIntelMPIDefFile(impiCfg *Config, env *buildenv.Info, sysCfg *sys.Conf
 func updateTemplate(filepath string, destMPIInstall string) error {
 	data, err := ioutil.ReadFile(filepath)
 	if err != nil {
-		return fmt.Errorf("failed to read %s: %s", filepath, err)
+		return fmt.Errorf("failed to read %s: %w", filepath, err)
 	}
 	content := string(data)
 	content = strings.Replace(content, "MPIINSTALLDIR", destMPIInstall, -1)
 	err = ioutil.WriteFile(filepath, []byte(content), 0)
 	if err != nil {
-		return fmt.Errorf("failed to write file %s: %s", filepath, err)
+		return fmt.Errorf("failed to write file %s: %w", filepath, err)
 	}
 	return nil
 }
@@ -160,12 +159,12 @@ func updateTemplates(env *buildenv.Info, sysCfg *sys.Config) error {
 
 	err := updateTemplate(intelSilentInstallConfig, env.BuildDir)
 	if err != nil {
-		return fmt.Errorf("failed to update template %s: %s", intelSilentInstallConfig, err)
+		return fmt.Errorf("failed to update template %s: %w", intelSilentInstallConfig, err)
 	}
 
 	err = updateTemplate(intelSilentUninstallConfig, env.BuildDir)
 	if err != nil {
-		return fmt.Errorf("failed to update template %s: %s", intelSilentUninstallConfig, err)
+		return fmt.Errorf("failed to update template %s: %w", intelSilentUninstallConfig, err)
 	}
 
 	return nil
@@ -179,27 +178,27 @@ func SetupInstallScript(env *buildenv.Info, sysCfg *sys.Config) error {
 	log.Printf("Copying %s to %s\n", intelSilentInstallTemplate, intelSilentInstallConfig)
 	err := util.CopyFile(intelSilentInstallTemplate, intelSilentInstallConfig)
 	if err != nil {
-		return fmt.Errorf("failed to copy %s to %s: %s", intelSilentInstallTemplate, intelSilentInstallConfig, err)
+		return fmt.Errorf("failed to copy %s to %s: %w", intelSilentInstallTemplate, intelSilentInstallConfig, err)
 	}
 
 	intelSilentUninstallTemplate := filepath.Join(sysCfg.TemplateDir, "intel", intelUninstallConfFileTemplate)
 	intelSilentUninstallConfig := filepath.Join(env.SrcDir, intelUninstallConfFile)
 	err = util.CopyFile(intelSilentUninstallTemplate, intelSilentUninstallConfig)
 	if err != nil {
-		return fmt.Errorf("failed to copy %s to %s: %s", intelSilentUninstallTemplate, intelSilentUninstallConfig, err)
+		return fmt.Errorf("failed to copy %s to %s: %w", intelSilentUninstallTemplate, intelSilentUninstallConfig, err)
 	}
 
 	// Update the templates
 	err = updateTemplates(env, sysCfg)
 	if err != nil {
-		return fmt.Errorf("unable to update Intel templates: %s", err)
+		return fmt.Errorf("unable to update Intel templates: %w", err)
 	}
 
 	return nil
 }
 
 // RunScript executes a install/uninstall script
-func RunScript(env *buildenv.Info, sysCfg *sys.Config, phase string) syexec.Result {
+func RunScript(ctx context.Context, env *buildenv.Info, sysCfg *sys.Config, phase string) syexec.Result {
 	var configFile string
 	var res syexec.Result
 
@@ -216,14 +215,8 @@ func RunScript(env *buildenv.Info, sysCfg *sys.Config, phase string) syexec.Resu
 	}
 
 	// Run the install or uninstall script
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("./install.sh", "--silent", configFile)
-	cmd.Dir = env.SrcDir
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	res.Err = cmd.Run()
-	res.Stderr = stderr.String()
-	res.Stdout = stdout.String()
+	r := sys.WithExecOptions(sysCfg.GetRunner(), env.SrcDir, nil, env.LiveOutput)
+	res.Stdout, res.Stderr, _, res.Err = r.Run(ctx, "./install.sh", "--silent", configFile)
 
 	return res
 }
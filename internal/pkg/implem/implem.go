@@ -5,6 +5,13 @@
 
 package implem
 
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
 const (
 	// OMPI is the identifier for Open MPI
 	OMPI = "openmpi"
@@ -19,6 +26,88 @@ const (
 	SY = "singularity"
 )
 
+// VariantSeparator separates the version of a MPI from the tag of a variant, e.g., a build
+// with a different compiler installed as openmpi:4.1.4+gcc11 next to openmpi:4.1.4
+const VariantSeparator = "+"
+
+// variantRegexp matches the valid tags of variants, which are part of directory names
+var variantRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// NormalizeVersion returns the canonical form of a version with an optional variant; the
+// variant can also be separated with a '/', e.g., 4.1.4/debug is the same as 4.1.4+debug
+func NormalizeVersion(version string) string {
+	return strings.Replace(version, "/", VariantSeparator, 1)
+}
+
+// SplitVariant returns the version and the tag of the variant of a version with an optional
+// variant, e.g., 4.1.4 and gcc11 for 4.1.4+gcc11; the variant is empty for the default build
+func SplitVariant(version string) (string, string) {
+	tokens := strings.SplitN(NormalizeVersion(version), VariantSeparator, 2)
+	if len(tokens) == 1 {
+		return tokens[0], ""
+	}
+	return tokens[0], tokens[1]
+}
+
+// DebugVariant is the tag of the variants built with debug symbols and without optimizations, e.g.,
+// openmpi:4.1.4+debug; a debug build of another variant is tagged with both, e.g., openmpi:4.1.4+gcc11-debug
+const DebugVariant = "debug"
+
+// GetDebugVersion returns the version of the debug build of a version with an optional variant,
+// e.g., 4.1.4+debug for 4.1.4 and 4.1.4+gcc11-debug for 4.1.4+gcc11
+func GetDebugVersion(version string) string {
+	v, variant := SplitVariant(version)
+	if variant == "" {
+		return v + VariantSeparator + DebugVariant
+	}
+	return v + VariantSeparator + variant + "-" + DebugVariant
+}
+
+// IsDebugVersion checks whether a version with an optional variant is a debug build
+func IsDebugVersion(version string) bool {
+	_, variant := SplitVariant(version)
+	return variant == DebugVariant || strings.HasSuffix(variant, "-"+DebugVariant)
+}
+
+// CheckVariant makes sure that the tag of a variant is valid; an empty tag is the default build
+func CheckVariant(variant string) error {
+	if variant != "" && !variantRegexp.MatchString(variant) {
+		return fmt.Errorf("invalid variant %q, only letters, digits, '.', '_' and '-' are supported", variant)
+	}
+	return nil
+}
+
+// CompareVersions compares two versions and returns a negative number if v1 is older than v2,
+// 0 if they are identical and a positive number if v1 is newer than v2. Non-numeric suffixes,
+// e.g., release candidates, are ignored.
+func CompareVersions(v1 string, v2 string) int {
+	t1 := strings.Split(v1, ".")
+	t2 := strings.Split(v2, ".")
+	for i := 0; i < len(t1) || i < len(t2); i++ {
+		n1, n2 := 0, 0
+		if i < len(t1) {
+			n1 = leadingNumber(t1[i])
+		}
+		if i < len(t2) {
+			n2 = leadingNumber(t2[i])
+		}
+		if n1 != n2 {
+			return n1 - n2
+		}
+	}
+	return 0
+}
+
+// leadingNumber returns the number a token of a version starts with, 0 if none
+func leadingNumber(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
+
 // Info gathers all data about a specific MPI implementation
 type Info struct {
 	// ID is the string idenfifying the MPI implementation
@@ -30,6 +119,28 @@ type Info struct {
 	// URL is the URL to use to get the MPI implementation
 	URL string
 
+	// Mirrors is the list of alternate URLs to try when URL cannot be downloaded
+	Mirrors []string
+
 	// Tarball is the name of the tarball of the MPI implementation
 	Tarball string
 }
+
+// SetURLs sets the URL and mirrors of the implementation from a comma-separated
+// list of URLs, as found in the configuration files. The first URL is the
+// preferred one.
+func (i *Info) SetURLs(val string) {
+	i.URL = ""
+	i.Mirrors = nil
+	for _, u := range strings.Split(val, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if i.URL == "" {
+			i.URL = u
+		} else {
+			i.Mirrors = append(i.Mirrors, u)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package implem
+
+import (
+	"testing"
+)
+
+func TestSplitVariant(t *testing.T) {
+	tests := []struct {
+		version         string
+		expectedVersion string
+		expectedVariant string
+		expectedValid   bool
+	}{
+		{version: "4.1.4", expectedVersion: "4.1.4", expectedValid: true},
+		{version: "4.1.4+gcc11", expectedVersion: "4.1.4", expectedVariant: "gcc11", expectedValid: true},
+		{version: "4.1.4/debug", expectedVersion: "4.1.4", expectedVariant: "debug", expectedValid: true},
+		{version: "4.1.4+gcc-11.2", expectedVersion: "4.1.4", expectedVariant: "gcc-11.2", expectedValid: true},
+		{version: "4.1.4+gcc/11", expectedVersion: "4.1.4", expectedVariant: "gcc+11", expectedValid: false},
+		{version: "4.1.4+", expectedVersion: "4.1.4", expectedValid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			version, variant := SplitVariant(tt.version)
+			if version != tt.expectedVersion || variant != tt.expectedVariant {
+				t.Fatalf("%s split into %s and %s instead of %s and %s", tt.version, version, variant, tt.expectedVersion, tt.expectedVariant)
+			}
+			err := CheckVariant(variant)
+			if tt.expectedValid && err != nil {
+				t.Fatalf("variant of %s is invalid: %s", tt.version, err)
+			}
+			if !tt.expectedValid && err == nil {
+				t.Fatalf("variant of %s is valid", tt.version)
+			}
+		})
+	}
+}
+
+func TestGetDebugVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{version: "4.1.4", expected: "4.1.4+debug"},
+		{version: "4.1.4+gcc11", expected: "4.1.4+gcc11-debug"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			debugVersion := GetDebugVersion(tt.version)
+			if debugVersion != tt.expected {
+				t.Fatalf("debug build of %s is %s instead of %s", tt.version, debugVersion, tt.expected)
+			}
+			if IsDebugVersion(tt.version) || !IsDebugVersion(debugVersion) {
+				t.Fatalf("debug build of %s not detected", tt.version)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		v1       string
+		v2       string
+		expected int
+	}{
+		{v1: "1.10", v2: "1.9", expected: 1},
+		{v1: "3.11", v2: "3.11.0", expected: 0},
+		{v1: "4.0.0rc1", v2: "4.0.1", expected: -1},
+		{v1: "1.21", v2: "1.21.3", expected: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.v1+"-"+tt.v2, func(t *testing.T) {
+			res := CompareVersions(tt.v1, tt.v2)
+			if (res < 0 && tt.expected >= 0) || (res == 0 && tt.expected != 0) || (res > 0 && tt.expected <= 0) {
+				t.Fatalf("comparing %s and %s returned %d instead of %d", tt.v1, tt.v2, res, tt.expected)
+			}
+		})
+	}
+}
@@ -14,10 +14,12 @@ import (
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
 	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
 	"github.com/sylabs/singularity-mpi/internal/pkg/syexec"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+	"github.com/sylabs/singularity-mpi/internal/pkg/util/sy"
 )
 
 const (
@@ -26,6 +28,15 @@ const (
 
 	// Slurm is the value set to JM.ID when Slurm shall be used to submit a job
 	SlurmID = "slurm"
+
+	// MpirunAlias is an alias that can be used to explicitly request the native job manager
+	MpirunAlias = "mpirun"
+
+	// NoneAlias is an alias that can be used to explicitly request not to use any job manager, i.e., the native one
+	NoneAlias = "none"
+
+	// JMKey is the key used in the tool's configuration file to store the job manager that was detected
+	JMKey = "job_manager"
 )
 
 // Loader checks whether a giv job manager is applicable or not
@@ -63,8 +74,84 @@ type JM struct {
 }
 
 // Detect figures out which job manager must be used on the system and return a
-// structure that gather all the data necessary to interact with it
+// structure that gather all the data necessary to interact with it. The result
+// of a previous detection saved in the tool's configuration file is used when
+// available, in which case no probing of the system is done.
 func Detect() JM {
+	kvs, err := sy.LoadMPIConfigFile()
+	if err == nil {
+		id := kv.GetValue(kvs, JMKey)
+		if id != "" {
+			comp, err := FromID(id)
+			if err == nil {
+				log.Printf("* Using job manager %s from configuration file\n", id)
+				return comp
+			}
+			log.Printf("[WARN] invalid job manager in configuration file: %s", err)
+		}
+	}
+
+	return Redetect()
+}
+
+// Redetect probes the system to figure out which job manager must be used,
+// regardless of what is saved in the tool's configuration file, and saves the
+// result in the configuration file for later use.
+func Redetect() JM {
+	comp := probe()
+	err := save(&comp)
+	if err != nil {
+		log.Printf("[WARN] unable to save the job manager configuration: %s", err)
+	}
+	return comp
+}
+
+// FromID returns the job manager component associated to an ID without probing the system.
+// "mpirun" and "none" are accepted as aliases for the native job manager.
+func FromID(id string) (JM, error) {
+	var jm JM
+
+	switch id {
+	case NativeID, MpirunAlias, NoneAlias:
+		return newNative(), nil
+	case SlurmID:
+		return newSlurm(), nil
+	}
+
+	return jm, fmt.Errorf("unknown job manager: %s", id)
+}
+
+// Select returns the job manager to use based on the system configuration: the
+// job manager explicitly requested by the user if any, otherwise the detected one
+func Select(sysCfg *sys.Config) (JM, error) {
+	if sysCfg.JobManager == "" {
+		return Detect(), nil
+	}
+
+	jm, err := FromID(sysCfg.JobManager)
+	if err != nil {
+		return jm, fmt.Errorf("unable to select job manager: %w", err)
+	}
+	log.Printf("* Using job manager %s as requested\n", jm.ID)
+
+	return jm, nil
+}
+
+func save(jm *JM) error {
+	configFile := sy.GetPathToSyMPIConfigFile()
+	err := sy.ConfigFileUpdateEntry(configFile, JMKey, jm.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update entry %s in %s: %w", JMKey, configFile, err)
+	}
+
+	if jm.Set != nil {
+		return jm.Set()
+	}
+
+	return nil
+}
+
+func probe() JM {
 	// Default job manager
 	loaded, comp := NativeDetect()
 	if !loaded {
@@ -87,14 +174,25 @@ func Load(jm *JM) error {
 
 // TempFile creates a temporary file that is used to store a batch script
 func TempFile(j *job.Job, env *buildenv.Info, sysCfg *sys.Config) error {
-	filePrefix := "sbash-" + j.Container.Name
+	filePrefix := "sbash"
+	if j.Container != nil {
+		filePrefix += "-" + j.Container.Name
+	}
 	path := ""
+	if sysCfg.RunDir != "" {
+		// The script is part of the files of the run and kept with them
+		path = filepath.Join(sysCfg.RunDir, filePrefix+".sh")
+		j.BatchScript = path
+		j.CleanUp = func(...interface{}) error { return nil }
+		return nil
+	}
 	if sysCfg.Persistent == "" {
 		f, err := ioutil.TempFile("", filePrefix+"-")
 		if err != nil {
-			return fmt.Errorf("failed to create temporary file: %s", err)
+			return fmt.Errorf("failed to create temporary file: %w", err)
 		}
 		path = f.Name()
+		j.BatchScript = path
 		f.Close()
 	} else {
 		fileName := filePrefix + ".sh"
@@ -103,7 +201,7 @@ func TempFile(j *job.Job, env *buildenv.Info, sysCfg *sys.Config) error {
 		if util.PathExists(path) {
 			return sympierr.ErrFileExists
 		}
-		if j.Container.InstallDir == "" {
+		if j.Container != nil && j.Container.InstallDir == "" {
 			j.Container.InstallDir = env.InstallDir
 		}
 	}
@@ -111,10 +209,19 @@ func TempFile(j *job.Job, env *buildenv.Info, sysCfg *sys.Config) error {
 	j.CleanUp = func(...interface{}) error {
 		err := os.RemoveAll(path)
 		if err != nil {
-			return fmt.Errorf("unable to delete %s: %s", path, err)
+			return fmt.Errorf("unable to delete %s: %w", path, err)
 		}
 		return nil
 	}
 
 	return nil
 }
+
+// getTotalNP returns the total number of ranks of a job, including its segments
+func getTotalNP(j *job.Job) int64 {
+	np := j.NP
+	for _, s := range j.Segments {
+		np += s.App.NP
+	}
+	return np
+}
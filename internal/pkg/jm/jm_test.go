@@ -48,3 +48,36 @@ func TestTempFile(t *testing.T) {
 		t.Fatalf("temporary file %s still exists even after cleanup", j.BatchScript)
 	}
 }
+
+func TestFromID(t *testing.T) {
+	tests := []struct {
+		id         string
+		expectedID string
+		expectErr  bool
+	}{
+		{id: SlurmID, expectedID: SlurmID},
+		{id: NativeID, expectedID: NativeID},
+		{id: MpirunAlias, expectedID: NativeID},
+		{id: NoneAlias, expectedID: NativeID},
+		{id: "pbs", expectErr: true},
+		{id: "unknown", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			jm, err := FromID(tt.id)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("selecting %s succeeded but was expected to fail", tt.id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to select %s: %s", tt.id, err)
+			}
+			if jm.ID != tt.expectedID {
+				t.Fatalf("selecting %s returned %s instead of %s", tt.id, jm.ID, tt.expectedID)
+			}
+		})
+	}
+}
@@ -7,17 +7,22 @@ package jm
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"text/template"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
 	"github.com/sylabs/singularity-mpi/internal/pkg/impi"
 	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
 	"github.com/sylabs/singularity-mpi/internal/pkg/job"
 	"github.com/sylabs/singularity-mpi/internal/pkg/mpi"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mpich"
 	"github.com/sylabs/singularity-mpi/internal/pkg/syexec"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 )
 
@@ -63,6 +68,36 @@ func NativeGetError(j *job.Job, sysCfg *sys.Config) string {
 	return j.ErrBuffer.String()
 }
 
+// generateNativeScript creates the script starting a job from the template of the user
+func generateNativeScript(j *job.Job, env *buildenv.Info, sysCfg *sys.Config, tmpl *template.Template, mpirunCmd string) error {
+	err := TempFile(j, env, sysCfg)
+	if err != nil {
+		if err == sympierr.ErrFileExists {
+			log.Printf("* Script %s already esists, skipping\n", j.BatchScript)
+			return nil
+		}
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+
+	data := NativeScriptData{
+		Job:       j,
+		MPIDir:    env.InstallDir,
+		PMIEnv:    getPMIEnv(sysCfg.PMIEnv),
+		MpirunCmd: mpirunCmd,
+	}
+	var script strings.Builder
+	err = tmpl.Execute(&script, data)
+	if err != nil {
+		return fmt.Errorf("unable to generate the job script: %w", err)
+	}
+
+	err = ioutil.WriteFile(j.BatchScript, []byte(script.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write to file %s: %w", j.BatchScript, err)
+	}
+	return nil
+}
+
 // NativeSubmit is the function to call to submit a job through the native job manager
 func NativeSubmit(j *job.Job, env *buildenv.Info, sysCfg *sys.Config) (syexec.SyCmd, error) {
 	var sycmd syexec.SyCmd
@@ -71,26 +106,56 @@ func NativeSubmit(j *job.Job, env *buildenv.Info, sysCfg *sys.Config) (syexec.Sy
 		return sycmd, fmt.Errorf("application binary is undefined")
 	}
 
-	sycmd.BinPath = mpi.GetPathToMpirun(j.HostCfg, env)
-	if j.NP > 0 {
+	if j.HostCfg.ID == implem.MPICH && sysCfg.MPICHPMI == mpich.PMIx {
+		return sycmd, fmt.Errorf("MPICH built with %s has no process manager, jobs must be started with Slurm", mpich.PMIx)
+	}
+	if len(j.HetComponents) > 0 {
+		log.Printf("[WARN] heterogeneous jobs require Slurm, all the applications share the same nodes")
+	}
+	if j.Array != nil {
+		return sycmd, fmt.Errorf("job arrays require Slurm")
+	}
+
+	launcher, err := mpi.GetPathToLauncher(j.HostCfg, env)
+	if err != nil {
+		return sycmd, err
+	}
+	sycmd.BinPath = launcher
+	// With MPMD, the number of ranks is specified for each application
+	primary := j.App
+	if len(j.Segments) > 0 {
+		primary.NP = j.NP
+	} else if j.NP > 0 {
 		sycmd.CmdArgs = append(sycmd.CmdArgs, "-np")
 		sycmd.CmdArgs = append(sycmd.CmdArgs, strconv.FormatInt(j.NP, 10))
 	}
 
-	mpirunArgs, err := mpi.GetMpirunArgs(j.HostCfg, env, &j.App, j.Container, sysCfg)
+	mpirunArgs, err := mpi.GetMpirunArgs(j.HostCfg, env, &primary, j.Container, sysCfg, j.Segments...)
 	if err != nil {
-		return sycmd, fmt.Errorf("unable to get mpirun arguments: %s", err)
+		return sycmd, fmt.Errorf("unable to get mpirun arguments: %w", err)
 	}
 	sycmd.CmdArgs = append(sycmd.CmdArgs, mpirunArgs...)
 
+	// With a template of job script, the script is executed instead of mpirun
+	if tmpl, ok := sysCfg.JobTemplates[NativeID]; ok {
+		err := generateNativeScript(j, env, sysCfg, tmpl, sycmd.BinPath+" "+strings.Join(sycmd.CmdArgs, " "))
+		if err != nil {
+			return sycmd, fmt.Errorf("unable to generate job script: %w", err)
+		}
+		sycmd.BinPath = "bash"
+		sycmd.CmdArgs = []string{j.BatchScript}
+	}
+
 	newPath := getEnvPath(j.HostCfg, env)
 	newLDPath := getEnvLDPath(j.HostCfg, env)
 	log.Printf("-> PATH=%s", newPath)
 	log.Printf("-> LD_LIBRARY_PATH=%s\n", newLDPath)
 	log.Printf("Using %s as PATH\n", newPath)
 	log.Printf("Using %s as LD_LIBRARY_PATH\n", newLDPath)
-	sycmd.Env = append([]string{"LD_LIBRARY_PATH=" + newLDPath}, os.Environ()...)
-	sycmd.Env = append([]string{"PATH=" + newPath}, os.Environ()...)
+	// The last definition of a variable prevails so the paths of the MPI and the PMI/PMIx tuning
+	// override the host environment
+	sycmd.Env = append(os.Environ(), "PATH="+newPath, "LD_LIBRARY_PATH="+newLDPath)
+	sycmd.Env = append(sycmd.Env, sysCfg.PMIEnv...)
 
 	j.GetOutput = NativeGetOutput
 	j.GetError = NativeGetError
@@ -102,13 +167,17 @@ func NativeSubmit(j *job.Job, env *buildenv.Info, sysCfg *sys.Config) (syexec.Sy
 // The native component is the default job manager. If application, the function returns a structure with all the
 // "function pointers" to correctly use the native job manager.
 func NativeDetect() (bool, JM) {
+	// This is the default job manager, i.e., mpirun so we do not check anything, just return this component.
+	// If the component is selected and mpirun not correctly installed, the framework will pick it up later.
+	return true, newNative()
+}
+
+func newNative() JM {
 	var jm JM
 	jm.ID = NativeID
 	jm.Get = NativeGetConfig
 	jm.Set = NativeSetConfig
 	jm.Submit = NativeSubmit
 
-	// This is the default job manager, i.e., mpirun so we do not check anything, just return this component.
-	// If the component is selected and mpirun not correctly installed, the framework will pick it up later.
-	return true, jm
+	return jm
 }
@@ -6,18 +6,27 @@
 package jm
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/sylabs/singularity-mpi/internal/pkg/app"
 	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
 	"github.com/sylabs/singularity-mpi/internal/pkg/job"
 	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
 	"github.com/sylabs/singularity-mpi/internal/pkg/mpi"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mpich"
+	"github.com/sylabs/singularity-mpi/internal/pkg/results"
 	"github.com/sylabs/singularity-mpi/internal/pkg/slurm"
 	"github.com/sylabs/singularity-mpi/internal/pkg/syexec"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
@@ -29,43 +38,149 @@ import (
 // if so return a JM structure with all the "function pointers" to interact with Slurm through our generic
 // API.
 func SlurmDetect() (bool, JM) {
-	var jm JM
-
 	_, err := exec.LookPath("sbatch")
 	if err != nil {
 		log.Println("* Slurm not detected")
+		var jm JM
 		return false, jm
 	}
 
+	return true, newSlurm()
+}
+
+func newSlurm() JM {
+	var jm JM
 	jm.ID = SlurmID
 	jm.Set = SlurmSetConfig
 	jm.Get = SlurmGetConfig
 	jm.Submit = SlurmSubmit
 	jm.Load = SlurmLoad
 
-	return true, jm
+	return jm
+}
+
+// readJobFile reads a file written by Slurm for a job, e.g., its output. With a job array, each
+// task writes its own file, the path having %a for the index of the task: the files of the tasks
+// are concatenated, each one after a line identifying the task.
+func readJobFile(j *job.Job, path string) string {
+	if j.Array == nil {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+		return string(content)
+	}
+
+	var sb strings.Builder
+	for i, v := range j.Array.Values {
+		content, err := ioutil.ReadFile(strings.Replace(path, "%a", strconv.Itoa(i), -1))
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "==> task %d (%s=%s) <==\n%s", i, j.Array.Param, v, content)
+	}
+	return sb.String()
 }
 
 // SlurmGetOutput reads the content of the Slurm output file that is associated to a job
 func SlurmGetOutput(j *job.Job, sysCfg *sys.Config) string {
-	outputFile := getJobOutputFilePath(j, sysCfg)
-	output, err := ioutil.ReadFile(outputFile)
+	return readJobFile(j, getJobOutputFilePath(j, sysCfg))
+}
+
+// SlurmGetError reads the content of the Slurm error file that is associated to a job
+func SlurmGetError(j *job.Job, sysCfg *sys.Config) string {
+	return readJobFile(j, getJobErrorFilePath(j, sysCfg))
+}
+
+// sacctFormat is the list of fields we get from sacct
+const sacctFormat = "JobID,TotalCPU,MaxRSS,Elapsed"
+
+var jobIDRegexp = regexp.MustCompile(`Submitted batch job ([0-9]+)`)
+
+// parseMemSize converts a size reported by sacct, e.g., 1234K, to bytes
+func parseMemSize(size string) float64 {
+	if size == "" {
+		return 0
+	}
+	multiplier := 1.0
+	switch size[len(size)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	case 'T':
+		multiplier = 1 << 40
+	}
+	if multiplier != 1.0 {
+		size = size[:len(size)-1]
+	}
+	n, err := strconv.ParseFloat(size, 64)
 	if err != nil {
-		return ""
+		return 0
 	}
+	return n * multiplier
+}
 
-	return string(output)
+// parseSacctOutput parses the output of 'sacct --parsable2 --noheader' with the fields from
+// sacctFormat. The CPU time and elapsed time are the ones of the job, the maximum RSS is the
+// maximum over all the job steps. The job may be a task of a job array, e.g., 1234_0.
+func parseSacctOutput(jobID string, output string) results.Usage {
+	var usage results.Usage
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) != 4 || (fields[0] != jobID && !strings.HasPrefix(fields[0], jobID+".")) {
+			continue
+		}
+		if fields[0] == jobID {
+			usage.CPUTime = fields[1]
+			usage.Elapsed = fields[3]
+		}
+		if parseMemSize(fields[2]) > parseMemSize(usage.MaxRSS) {
+			usage.MaxRSS = fields[2]
+		}
+	}
+	return usage
 }
 
-// SlurmGetError reads the content of the Slurm error file that is associated to a job
-func SlurmGetError(j *job.Job, sysCfg *sys.Config) string {
-	errorFile := getJobErrorFilePath(j, sysCfg)
-	errorTxt, err := ioutil.ReadFile(errorFile)
+// SlurmGetUsage gets from the Slurm accounting the resources used by a job
+func SlurmGetUsage(j *job.Job, submitOutput string, sysCfg *sys.Config) (results.Usage, string) {
+	m := jobIDRegexp.FindStringSubmatch(submitOutput)
+	if m == nil {
+		return results.Usage{}, "job ID not found in the sbatch output"
+	}
+	j.ID = m[1]
+
+	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*time.Second)
+	defer cancel()
+	stdout, stderr, _, err := sysCfg.GetRunner().Run(ctx, "sacct", "-j", j.ID, "--format="+sacctFormat, "--parsable2", "--noheader")
 	if err != nil {
-		return ""
+		// Typically when accounting is disabled on the system
+		log.Printf("[INFO] sacct failed: %s - stderr: %s", err, stderr)
+		return results.Usage{}, "Slurm accounting not available"
 	}
 
-	return string(errorTxt)
+	// The tasks of a job array are separate jobs in the accounting, e.g., 1234_0
+	if j.Array != nil {
+		j.TaskUsages = nil
+		found := false
+		for i := range j.Array.Values {
+			taskUsage := parseSacctOutput(j.ID+"_"+strconv.Itoa(i), stdout)
+			found = found || taskUsage.Elapsed != ""
+			j.TaskUsages = append(j.TaskUsages, taskUsage)
+		}
+		if !found {
+			return results.Usage{}, "tasks of job array " + j.ID + " not found in the Slurm accounting"
+		}
+		return results.Usage{}, ""
+	}
+
+	usage := parseSacctOutput(j.ID, stdout)
+	if usage.Elapsed == "" {
+		return usage, "job " + j.ID + " not found in the Slurm accounting"
+	}
+	return usage, ""
 }
 
 // SlurmGetConfig is the Slurm function to get the configuration of the job manager
@@ -79,7 +194,7 @@ func SlurmSetConfig() error {
 
 	err := sy.ConfigFileUpdateEntry(configFile, slurm.EnabledKey, "true")
 	if err != nil {
-		return fmt.Errorf("failed to update entry %s in %s: %s", slurm.EnabledKey, configFile, err)
+		return fmt.Errorf("failed to update entry %s in %s: %w", slurm.EnabledKey, configFile, err)
 	}
 	return nil
 }
@@ -89,12 +204,12 @@ func SlurmLoad(jm *JM, sysCfg *sys.Config) error {
 	log.Println("* Slurm detected, updating the configuration file")
 	kvs, err := kv.LoadKeyValueConfig(sysCfg.SyConfigFile)
 	if err != nil {
-		return fmt.Errorf("unable to load configuration from %s: %s", sysCfg.SyConfigFile, err)
+		return fmt.Errorf("unable to load configuration from %s: %w", sysCfg.SyConfigFile, err)
 	}
 	if kv.GetValue(kvs, slurm.EnabledKey) == "" {
 		err := SlurmSetConfig()
 		if err != nil {
-			return fmt.Errorf("unable to add Slurm entry in configuration file: %s", err)
+			return fmt.Errorf("unable to add Slurm entry in configuration file: %w", err)
 		}
 	}
 
@@ -102,13 +217,20 @@ func SlurmLoad(jm *JM, sysCfg *sys.Config) error {
 }
 
 func getJobOutFilenamePrefix(j *job.Job) string {
-	return "host-" + j.HostCfg.ID + "-" + j.HostCfg.Version + "_container-" + j.Container.Name
+	prefix := "host-" + j.HostCfg.ID + "-" + j.HostCfg.Version + "_container-" + j.Container.Name
+	if j.Array != nil {
+		// Slurm replaces %a by the index of the task
+		prefix += "_%a"
+	}
+	return prefix
 }
 
 func getJobOutputFilePath(j *job.Job, sysCfg *sys.Config) string {
 	errorFilename := getJobOutFilenamePrefix(j) + ".out"
 	path := filepath.Join(sysCfg.ScratchDir, errorFilename)
-	if sysCfg.Persistent != "" {
+	if sysCfg.RunDir != "" {
+		path = filepath.Join(sysCfg.RunDir, errorFilename)
+	} else if sysCfg.Persistent != "" {
 		path = filepath.Join(j.Container.InstallDir, errorFilename)
 	}
 	return path
@@ -117,33 +239,326 @@ func getJobOutputFilePath(j *job.Job, sysCfg *sys.Config) string {
 func getJobErrorFilePath(j *job.Job, sysCfg *sys.Config) string {
 	outputFilename := getJobOutFilenamePrefix(j) + ".err"
 	path := filepath.Join(sysCfg.ScratchDir, outputFilename)
-	if sysCfg.Persistent != "" {
+	if sysCfg.RunDir != "" {
+		path = filepath.Join(sysCfg.RunDir, outputFilename)
+	} else if sysCfg.Persistent != "" {
 		path = filepath.Join(j.Container.InstallDir, outputFilename)
 	}
 	return path
 }
 
-func generateJobScript(j *job.Job, env *buildenv.Info, sysCfg *sys.Config, kvs []kv.KV) error {
+// getJobScratchDir returns the job-local scratch directory the batch script moves to, if enabled.
+// The directory is resolved when the job starts because it usually only exists within the allocation.
+func getJobScratchDir(kvs []kv.KV) string {
+	if kv.GetValue(kvs, slurm.JobScratchKey) != "true" {
+		return ""
+	}
+
+	dir := kv.GetValue(kvs, slurm.JobScratchDirKey)
+	if dir == "" {
+		dir = slurm.DefaultJobScratchDir
+	}
+	return dir
+}
+
+// loadScriptTemplate loads the template of the batch scripts: the template file specified in the
+// configuration if any, the built-in template otherwise
+func loadScriptTemplate(kvs []kv.KV, sysCfg *sys.Config) (*template.Template, error) {
+	if tmpl, ok := sysCfg.JobTemplates[SlurmID]; ok {
+		return tmpl, nil
+	}
+
+	// The template was not validated when the configuration was loaded
+	path := kv.GetValue(kvs, slurm.TemplateKey)
+	if path == "" {
+		return template.New("slurm").Parse(slurm.DefaultScriptTemplate)
+	}
+
+	return LoadTemplate(path)
+}
+
+// getExportedEnv returns the shell assignments forwarding host environment variables to a job. The
+// values are resolved when the job is submitted; variables that are not set are skipped rather than
+// exported empty.
+func getExportedEnv(names []string) []string {
+	var assignments []string
+	for _, name := range names {
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			log.Printf("[WARN] %s is not set, it is not exported to the job", name)
+			continue
+		}
+		// The value is quoted so it is not interpreted by the shell running the script
+		assignments = append(assignments, name+"="+shellQuote(val))
+	}
+	return assignments
+}
+
+// getPMIEnv returns the shell assignments of the variables tuning PMI/PMIx, e.g., PMIX_MCA_gds=hash
+func getPMIEnv(vars []string) []string {
+	var assignments []string
+	for _, v := range vars {
+		tokens := strings.SplitN(v, "=", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		assignments = append(assignments, tokens[0]+"="+shellQuote(tokens[1]))
+	}
+	return assignments
+}
+
+// shellQuote quotes a value so it is not interpreted by the shell running a batch script
+func shellQuote(val string) string {
+	return "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+}
+
+// getArrayData sets the fields of the script of a job array and returns the arguments starting
+// the application in a task, i.e., the arguments of the application and, with job.ArrayNP, the
+// number of ranks of the task to pass to the launcher; the allocation of all the tasks is the one
+// of the task with the most ranks. MPMD and heterogeneous jobs cannot be job arrays.
+func getArrayData(j *job.Job, data *slurm.ScriptData) (app.Info, string, error) {
+	a := j.Array
+	primary := j.App
+	err := a.Check()
+	if err != nil {
+		return primary, "", err
+	}
+	if len(j.Segments) > 0 || len(j.HetComponents) > 0 {
+		return primary, "", fmt.Errorf("MPMD and heterogeneous jobs cannot be job arrays")
+	}
+
+	data.Array = "0-" + strconv.Itoa(len(a.Values)-1)
+	for _, v := range a.Values {
+		data.ArrayValues = append(data.ArrayValues, shellQuote(v))
+	}
+	valueRef := `"$` + job.ArrayValueVar + `"`
+	if a.Param == job.ArrayArg {
+		primary.Args = append(append([]string{}, primary.Args...), valueRef)
+		return primary, "", nil
+	}
+	data.NTasks = a.GetMaxNP()
+	return primary, valueRef, nil
+}
+
+// getHetGroups returns the components of a heterogeneous job and the srun command starting each
+// application in its own component. mpirun cannot start ranks across the components of a job, so
+// the ranks are started by Slurm; the partition of the job is used when a component does not
+// specify its own.
+func getHetGroups(j *job.Job, env *buildenv.Info, partition string, srunCmd string, sysCfg *sys.Config) ([]slurm.HetGroup, string, error) {
+	if len(j.HetComponents) != len(j.Segments)+1 {
+		return nil, "", fmt.Errorf("%d components for %d applications", len(j.HetComponents), len(j.Segments)+1)
+	}
+
+	apps := []job.Segment{{App: j.App, Container: j.Container}}
+	apps[0].App.NP = j.NP
+	apps = append(apps, j.Segments...)
+
+	var groups []slurm.HetGroup
+	var srunArgs []string
+	for i, c := range j.HetComponents {
+		s := &apps[i]
+		if s.Container == nil {
+			return nil, "", fmt.Errorf("container of %s is undefined", s.App.Name)
+		}
+		if s.App.BinPath == "" {
+			return nil, "", fmt.Errorf("binary of %s is undefined", s.App.Name)
+		}
+
+		g := slurm.HetGroup{
+			Partition:     c.Partition,
+			Constraint:    c.Constraint,
+			NTasksPerNode: c.NTasksPerNode,
+		}
+		var err error
+		g.Nodes, g.NTasks, err = job.GetAllocation(c.NNodes, s.App.NP, c.NTasksPerNode)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid allocation of %s: %w", s.App.Name, err)
+		}
+		if g.Partition == "" {
+			g.Partition = partition
+		}
+		groups = append(groups, g)
+
+		if i > 0 {
+			srunArgs = append(srunArgs, ":")
+		}
+		srunArgs = append(srunArgs, "--het-group="+strconv.Itoa(i))
+		if g.NTasks > 0 {
+			srunArgs = append(srunArgs, "-n", strconv.FormatInt(g.NTasks, 10))
+		}
+		srunArgs = append(srunArgs, mpi.GetContainerCmd(j.HostCfg, env, &s.App, s.Container, sysCfg)...)
+	}
+
+	return groups, srunCmd + " " + strings.Join(srunArgs, " "), nil
+}
+
+// getSrunCmd returns the srun command starting ranks directly with Slurm. The MPI plugin is the one
+// of the configuration or of the environment (SLURM_MPI_TYPE), otherwise the one matching the PMI of
+// MPICH. A mismatch between the plugin and the PMI of MPICH prevents the ranks from initializing so
+// it is reported.
+func getSrunCmd(j *job.Job, kvs []kv.KV, sysCfg *sys.Config) (string, error) {
+	mpiType := kv.GetValue(kvs, slurm.MPIKey)
+	if mpiType == "" {
+		mpiType = os.Getenv("SLURM_MPI_TYPE")
+	}
+	if j.HostCfg.ID == implem.MPICH && sysCfg.MPICHPMI != "" {
+		expected := mpich.GetSlurmMPIType(sysCfg.MPICHPMI)
+		if mpiType == "" {
+			mpiType = expected
+		} else if mpiType != expected {
+			log.Printf("[WARN] MPICH is built with %s but Slurm uses --mpi=%s, --mpi=%s is expected", sysCfg.MPICHPMI, mpiType, expected)
+		}
+	}
+
+	cmd := "srun"
+	if mpiType != "" {
+		cmd += " --mpi=" + mpiType
+	}
+	if sysCfg.LabelOutput {
+		cmd += " --label"
+	}
+	affinityArgs, err := mpi.GetSrunAffinityArgs(sysCfg)
+	if err != nil {
+		return "", fmt.Errorf("invalid affinity: %w", err)
+	}
+	if len(affinityArgs) > 0 {
+		cmd += " " + strings.Join(affinityArgs, " ")
+	}
+	return cmd, nil
+}
+
+// BuildSlurmScript returns the text of the batch script to start a job with Slurm. The script is
+// generated from a template with the details of the job (number of nodes and ranks) and the Slurm
+// configuration (partition, account, time limit, job-local scratch, exported variables). The host MPI used to start the
+// job is installed in env.InstallDir. When the job specifies components, the script describes a
+// heterogeneous job with one component per application.
+func BuildSlurmScript(j *job.Job, env *buildenv.Info, kvs []kv.KV, sysCfg *sys.Config) (string, error) {
 	// Sanity checks
 	if j == nil {
-		return fmt.Errorf("undefined job")
+		return "", fmt.Errorf("undefined job")
 	}
 
-	// Some sanity checks
 	if j.HostCfg == nil {
-		return fmt.Errorf("undefined host configuration")
+		return "", fmt.Errorf("undefined host configuration")
 	}
 
 	if env.InstallDir == "" {
-		return fmt.Errorf("undefined host installation directory")
+		return "", fmt.Errorf("undefined host installation directory")
 	}
 
 	if sysCfg.ScratchDir == "" {
-		return fmt.Errorf("undefined scratch directory")
+		return "", fmt.Errorf("undefined scratch directory")
 	}
 
 	if j.App.BinPath == "" {
-		return fmt.Errorf("application binary is undefined")
+		return "", fmt.Errorf("application binary is undefined")
+	}
+
+	data := slurm.ScriptData{
+		Job:           j,
+		Partition:     kv.GetValue(kvs, slurm.PartitionKey),
+		Account:       kv.GetValue(kvs, slurm.AccountKey),
+		Time:          kv.GetValue(kvs, slurm.TimeKey),
+		ErrorFile:     getJobErrorFilePath(j, sysCfg),
+		OutputFile:    getJobOutputFilePath(j, sysCfg),
+		MPIDir:        env.InstallDir,
+		ExportEnv:     getExportedEnv(sysCfg.ExportEnv),
+		PMIEnv:        getPMIEnv(sysCfg.PMIEnv),
+		JobScratchDir: getJobScratchDir(kvs),
+	}
+
+	// With a job array, the number of ranks or an argument of the application is set in the
+	// launch command by each task
+	primaryApp := j.App
+	var taskNP string
+	var err error
+	if j.Array != nil {
+		primaryApp, taskNP, err = getArrayData(j, &data)
+		if err != nil {
+			return "", fmt.Errorf("invalid job array: %w", err)
+		}
+	}
+
+	// srun only implements the affinity when it starts the ranks, mpirun does otherwise
+	if len(j.HetComponents) > 0 {
+		var srunCmd string
+		srunCmd, err = getSrunCmd(j, kvs, sysCfg)
+		if err != nil {
+			return "", err
+		}
+		data.HetGroups, data.MpirunCmd, err = getHetGroups(j, env, data.Partition, srunCmd, sysCfg)
+		if err != nil {
+			return "", fmt.Errorf("invalid heterogeneous job: %w", err)
+		}
+	} else if j.HostCfg.ID == implem.MPICH && sysCfg.MPICHPMI == mpich.PMIx {
+		// MPICH is built without process manager, the ranks can only be started by Slurm
+		if len(j.Segments) > 0 {
+			return "", fmt.Errorf("MPMD jobs require mpirun, which is not available with MPICH built with %s", mpich.PMIx)
+		}
+		srunCmd, err := getSrunCmd(j, kvs, sysCfg)
+		if err != nil {
+			return "", err
+		}
+		srunArgs := []string{srunCmd}
+		if taskNP != "" {
+			srunArgs = append(srunArgs, "-n", taskNP)
+		} else if j.NP > 0 && j.Array == nil {
+			srunArgs = append(srunArgs, "-n", strconv.FormatInt(j.NP, 10))
+			data.NTasks = j.NP
+		}
+		srunArgs = append(srunArgs, mpi.GetContainerCmd(j.HostCfg, env, &primaryApp, j.Container, sysCfg)...)
+		data.MpirunCmd = strings.Join(srunArgs, " ")
+	} else {
+		// With MPMD, the number of ranks of each application must be explicit
+		primary := primaryApp
+		if len(j.Segments) > 0 {
+			primary.NP = j.NP
+		}
+		mpirunArgs, err := mpi.GetMpirunArgs(j.HostCfg, env, &primary, j.Container, sysCfg, j.Segments...)
+		if err != nil {
+			return "", fmt.Errorf("unable to get mpirun arguments: %w", err)
+		}
+		if taskNP != "" {
+			mpirunArgs = append([]string{mpi.GetNPFlag(j.HostCfg), taskNP}, mpirunArgs...)
+		}
+		launcher, err := mpi.GetPathToLauncher(j.HostCfg, env)
+		if err != nil {
+			return "", err
+		}
+		data.MpirunCmd = launcher + " " + strings.Join(mpirunArgs, " ")
+		if j.NP > 0 && taskNP == "" {
+			data.NTasks = getTotalNP(j)
+		}
+	}
+	if len(j.HetComponents) == 0 {
+		data.NTasksPerNode = j.NTasksPerNode
+		data.Nodes, data.NTasks, err = job.GetAllocation(j.NNodes, data.NTasks, j.NTasksPerNode)
+		if err != nil {
+			return "", fmt.Errorf("invalid allocation: %w", err)
+		}
+	}
+
+	tmpl, err := loadScriptTemplate(kvs, sysCfg)
+	if err != nil {
+		return "", err
+	}
+	var script strings.Builder
+	err = tmpl.Execute(&script, data)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate the batch script: %w", err)
+	}
+	// A template ignoring the job array would run the job once without the parameter
+	if j.Array != nil && !strings.Contains(script.String(), "--array="+data.Array) {
+		return "", fmt.Errorf("the template of the batch scripts does not support job arrays, see {{.Array}} and {{.ArrayValues}}")
+	}
+
+	return script.String(), nil
+}
+
+func generateJobScript(j *job.Job, env *buildenv.Info, sysCfg *sys.Config, kvs []kv.KV) error {
+	// Sanity checks
+	if j == nil {
+		return fmt.Errorf("undefined job")
 	}
 
 	// Create the batch script
@@ -153,7 +568,7 @@ func generateJobScript(j *job.Job, env *buildenv.Info, sysCfg *sys.Config, kvs [
 			log.Printf("* Script %s already esists, skipping\n", j.BatchScript)
 			return nil
 		}
-		return fmt.Errorf("unable to create temporary file: %s", err)
+		return fmt.Errorf("unable to create temporary file: %w", err)
 	}
 
 	// TempFile is supposed to set the path to the batch script
@@ -161,38 +576,14 @@ func generateJobScript(j *job.Job, env *buildenv.Info, sysCfg *sys.Config, kvs [
 		return fmt.Errorf("Batch script path is undefined")
 	}
 
-	scriptText := "#!/bin/bash\n#\n"
-	partition := kv.GetValue(kvs, slurm.PartitionKey)
-	if partition != "" {
-		scriptText += slurm.ScriptCmdPrefix + " --partition=" + partition + "\n"
-	}
-
-	if j.NNodes > 0 {
-		scriptText += slurm.ScriptCmdPrefix + " --nodes=" + strconv.FormatInt(j.NNodes, 10) + "\n"
-	}
-
-	if j.NP > 0 {
-		scriptText += slurm.ScriptCmdPrefix + " --ntasks=" + strconv.FormatInt(j.NP, 10) + "\n"
-	}
-
-	scriptText += slurm.ScriptCmdPrefix + " --error=" + getJobErrorFilePath(j, sysCfg) + "\n"
-	scriptText += slurm.ScriptCmdPrefix + " --output=" + getJobOutputFilePath(j, sysCfg) + "\n"
-
-	// Set PATH and LD_LIBRARY_PATH
-	scriptText += "\nexport PATH=" + env.InstallDir + "/bin:$PATH\n"
-	scriptText += "export LD_LIBRARY_PATH=" + env.InstallDir + "/lib:$LD_LIBRARY_PATH\n\n"
-
-	// Add the mpirun command
-	mpirunPath := filepath.Join(env.InstallDir, "bin", "mpirun")
-	mpirunArgs, err := mpi.GetMpirunArgs(j.HostCfg, env, &j.App, j.Container, sysCfg)
+	scriptText, err := BuildSlurmScript(j, env, kvs, sysCfg)
 	if err != nil {
-		return fmt.Errorf("unable to get mpirun arguments: %s", err)
+		return err
 	}
-	scriptText += "\n" + mpirunPath + " " + strings.Join(mpirunArgs, " ") + "\n"
 
 	err = ioutil.WriteFile(j.BatchScript, []byte(scriptText), 0644)
 	if err != nil {
-		return fmt.Errorf("unable to write to file %s: %s", j.BatchScript, err)
+		return fmt.Errorf("unable to write to file %s: %w", j.BatchScript, err)
 	}
 
 	return nil
@@ -213,17 +604,18 @@ func SlurmSubmit(j *job.Job, hostBuildEnv *buildenv.Info, sysCfg *sys.Config) (s
 
 	kvs, err := sy.LoadMPIConfigFile()
 	if err != nil {
-		return sycmd, fmt.Errorf("unable to load configuration: %s", err)
+		return sycmd, fmt.Errorf("unable to load configuration: %w", err)
 	}
 
 	err = generateJobScript(j, hostBuildEnv, sysCfg, kvs)
 	if err != nil {
-		return sycmd, fmt.Errorf("unable to generate Slurm script: %s", err)
+		return sycmd, fmt.Errorf("unable to generate Slurm script: %w", err)
 	}
 	sycmd.CmdArgs = append(sycmd.CmdArgs, j.BatchScript)
 
 	j.GetOutput = SlurmGetOutput
 	j.GetError = SlurmGetError
+	j.GetUsage = SlurmGetUsage
 
 	return sycmd, nil
 }
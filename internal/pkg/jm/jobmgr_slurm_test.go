@@ -6,16 +6,53 @@
 package jm
 
 import (
+	"flag"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/sylabs/singularity-mpi/internal/pkg/app"
 	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
-
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
 	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mpich"
+	"github.com/sylabs/singularity-mpi/internal/pkg/results"
+	"github.com/sylabs/singularity-mpi/internal/pkg/slurm"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 )
 
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// goldenInstallDir is the installation directory of MPI in the golden files
+const goldenInstallDir = "/opt/sympi/mpi_install_openmpi-4.0.2"
+
+// newInstallDir creates a MPI installation directory with the given launcher in its bin
+// directory, none when the launcher is empty
+func newInstallDir(t *testing.T, launcher string) string {
+	dir, err := ioutil.TempDir("", "sympi-install-")
+	if err != nil {
+		t.Fatalf("failed to create a temporary directory: %s", err)
+	}
+	binDir := filepath.Join(dir, "bin")
+	err = os.MkdirAll(binDir, 0755)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", binDir, err)
+	}
+	if launcher != "" {
+		err = ioutil.WriteFile(filepath.Join(binDir, launcher), []byte("#!/bin/sh\n"), 0755)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", launcher, err)
+		}
+	}
+	return dir
+}
+
 func TestSlurmSubmit(t *testing.T) {
 	failed := false
 
@@ -61,7 +98,7 @@ func TestSlurmSubmit(t *testing.T) {
 				t.Logf("failed to read the batch script: %s", err)
 			}
 			t.Logf("Content of the batch script:\n")
-			t.Logf(string(b))
+			t.Logf("%s", string(b))
 		}
 		defer f.Close()
 	}
@@ -81,3 +118,390 @@ func TestSlurmSubmit(t *testing.T) {
 	t.Logf("Slurm batch script: %s\n", job.BatchScript)
 
 }
+
+func TestBuildSlurmScript(t *testing.T) {
+	newJob := func(nnodes int64, np int64) *job.Job {
+		return &job.Job{
+			NNodes:  nnodes,
+			NP:      np,
+			HostCfg: &implem.Info{ID: implem.OMPI, Version: "4.0.2"},
+			Container: &container.Config{
+				Name:  "helloworld",
+				Path:  "/containers/helloworld.sif",
+				Model: container.HybridModel,
+			},
+			App: app.Info{Name: "helloworld", BinPath: "/opt/helloworld"},
+		}
+	}
+	mpmdJob := newJob(2, 4)
+	mpmdJob.Segments = []job.Segment{
+		{
+			App:       app.Info{Name: "monitor", BinPath: "/opt/monitor", NP: 2},
+			Container: &container.Config{Name: "monitor", Path: "/containers/monitor.sif", Model: container.HybridModel},
+		},
+	}
+	ntasksJob := newJob(0, 6)
+	ntasksJob.NTasksPerNode = 4
+	nodesJob := newJob(2, 0)
+	nodesJob.NTasksPerNode = 4
+	mpichJob := newJob(2, 8)
+	mpichJob.HostCfg = &implem.Info{ID: implem.MPICH, Version: "3.3"}
+
+	hetJob := newJob(0, 16)
+	hetJob.Segments = []job.Segment{
+		{
+			App:       app.Info{Name: "atmosphere", BinPath: "/opt/atmosphere", NP: 2},
+			Container: &container.Config{Name: "atmosphere", Path: "/containers/atmosphere.sif", Model: container.HybridModel},
+		},
+	}
+	hetJob.HetComponents = []job.HetComponent{{NNodes: 4}, {NNodes: 1, Partition: "gpu", Constraint: "v100"}}
+
+	arrayNPJob := newJob(0, 8)
+	arrayNPJob.NTasksPerNode = 4
+	arrayNPJob.Array = &job.Array{Param: job.ArrayNP, Values: []string{"1", "2", "4", "8"}}
+	arrayArgJob := newJob(1, 2)
+	arrayArgJob.Array = &job.Array{Param: job.ArrayArg, Values: []string{"small", "it's large"}}
+	arrayMPICHJob := newJob(2, 0)
+	arrayMPICHJob.HostCfg = &implem.Info{ID: implem.MPICH, Version: "3.3"}
+	arrayMPICHJob.Array = &job.Array{Param: job.ArrayNP, Values: []string{"2", "4"}}
+
+	os.Setenv("SYMPI_TEST_THREADS", "4")
+	defer os.Unsetenv("SYMPI_TEST_THREADS")
+	os.Unsetenv("SLURM_MPI_TYPE")
+
+	tests := []struct {
+		name      string
+		job       *job.Job
+		kvs       []kv.KV
+		exportEnv []string
+		pmiEnv    []string
+		mpichPMI  string
+	}{
+		{name: "defaults", job: newJob(0, 0)},
+		{name: "partition", job: newJob(0, 0), kvs: []kv.KV{{Key: slurm.PartitionKey, Value: "debug"}}},
+		{name: "ntasks", job: ntasksJob},
+		{name: "nodes", job: nodesJob},
+		{name: "fewer_ntasks_than_nodes", job: newJob(4, 2)},
+		{name: "nodes_ntasks", job: newJob(2, 8)},
+		{name: "partition_nodes_ntasks", job: newJob(2, 8), kvs: []kv.KV{{Key: slurm.PartitionKey, Value: "batch"}}},
+		{name: "job_scratch", job: newJob(1, 2), kvs: []kv.KV{{Key: slurm.JobScratchKey, Value: "true"}}},
+		{name: "account_time", job: newJob(1, 2), kvs: []kv.KV{{Key: slurm.AccountKey, Value: "proj42"}, {Key: slurm.TimeKey, Value: "01:00:00"}}},
+		{name: "mpmd", job: mpmdJob},
+		{name: "export_env", job: newJob(1, 2), exportEnv: []string{"SYMPI_TEST_THREADS", "SYMPI_TEST_UNSET"}},
+		{name: "pmi_env", job: newJob(1, 2), pmiEnv: []string{"PMIX_MCA_gds=hash", "PMIX_MCA_psec=native", "PMI_DEBUG=1 2"}},
+		{name: "mpich_pmix", job: mpichJob, mpichPMI: mpich.PMIx},
+		{name: "hetjob", job: hetJob, kvs: []kv.KV{{Key: slurm.PartitionKey, Value: "batch"}, {Key: slurm.TimeKey, Value: "01:00:00"}}},
+		{name: "array_np", job: arrayNPJob},
+		{name: "array_arg", job: arrayArgJob},
+		{name: "array_mpich_pmix", job: arrayMPICHJob, mpichPMI: mpich.PMIx},
+	}
+
+	// The golden files refer to the installation directory of the MPI used to generate them
+	installDir := newInstallDir(t, "mpirun")
+	defer os.RemoveAll(installDir)
+	env := buildenv.Info{InstallDir: installDir}
+	sysCfg := sys.Config{ScratchDir: "/scratch"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := sysCfg
+			cfg.ExportEnv = tt.exportEnv
+			cfg.PMIEnv = tt.pmiEnv
+			cfg.MPICHPMI = tt.mpichPMI
+			script, err := BuildSlurmScript(tt.job, &env, tt.kvs, &cfg)
+			if err != nil {
+				t.Fatalf("BuildSlurmScript() failed: %s", err)
+			}
+			script = strings.Replace(script, installDir, goldenInstallDir, -1)
+
+			golden := filepath.Join("testdata", "slurm_"+tt.name+".golden")
+			if *update {
+				err := ioutil.WriteFile(golden, []byte(script), 0644)
+				if err != nil {
+					t.Fatalf("failed to update %s: %s", golden, err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", golden, err)
+			}
+			if script != string(expected) {
+				t.Fatalf("script differs from %s:\n%s", golden, script)
+			}
+		})
+	}
+
+	// A template file replaces the built-in template
+	tmplFile := filepath.Join("testdata", "slurm_custom.tmpl")
+	script, err := BuildSlurmScript(newJob(2, 8), &env, []kv.KV{{Key: slurm.TemplateKey, Value: tmplFile}}, &sysCfg)
+	if err != nil {
+		t.Fatalf("BuildSlurmScript() failed with %s: %s", tmplFile, err)
+	}
+	if !strings.HasPrefix(script, "#!/bin/bash\n#SBATCH --nodes=2 --ntasks=8\nmodule load license-server\n") || !strings.HasSuffix(script, "/opt/helloworld\n") {
+		t.Fatalf("invalid script from %s:\n%s", tmplFile, script)
+	}
+	_, err = BuildSlurmScript(newJob(2, 8), &env, []kv.KV{{Key: slurm.TemplateKey, Value: "/sympi/missing.tmpl"}}, &sysCfg)
+	if err == nil {
+		t.Fatalf("BuildSlurmScript() succeeded with a missing template")
+	}
+
+	// Invalid jobs are rejected
+	invalid := newJob(1, 1)
+	invalid.App.BinPath = ""
+	_, err = BuildSlurmScript(invalid, &env, nil, &sysCfg)
+	if err == nil {
+		t.Fatalf("BuildSlurmScript() succeeded with an undefined application binary")
+	}
+	_, err = BuildSlurmScript(newJob(0, 4), &env, nil, &sysCfg)
+	if err == nil {
+		t.Fatalf("BuildSlurmScript() succeeded with ranks but neither nodes nor ranks per node")
+	}
+	invalid = newJob(1, 8)
+	invalid.NTasksPerNode = 4
+	_, err = BuildSlurmScript(invalid, &env, nil, &sysCfg)
+	if err == nil {
+		t.Fatalf("BuildSlurmScript() succeeded with more ranks than the nodes can host")
+	}
+	invalid = newJob(1, 1)
+	invalid.HetComponents = []job.HetComponent{{NNodes: 1}, {NNodes: 1}}
+	_, err = BuildSlurmScript(invalid, &env, nil, &sysCfg)
+	if err == nil {
+		t.Fatalf("BuildSlurmScript() succeeded with more components than applications")
+	}
+	invalid = newJob(2, 4)
+	invalid.Segments = mpmdJob.Segments
+	invalid.Array = &job.Array{Param: job.ArrayArg, Values: []string{"small"}}
+	_, err = BuildSlurmScript(invalid, &env, nil, &sysCfg)
+	if err == nil {
+		t.Fatalf("BuildSlurmScript() succeeded with a MPMD job array")
+	}
+	invalid = newJob(2, 0)
+	invalid.Array = &job.Array{Param: job.ArrayNP, Values: []string{"many"}}
+	_, err = BuildSlurmScript(invalid, &env, nil, &sysCfg)
+	if err == nil {
+		t.Fatalf("BuildSlurmScript() succeeded with an invalid job array")
+	}
+	_, err = BuildSlurmScript(arrayNPJob, &env, []kv.KV{{Key: slurm.TemplateKey, Value: tmplFile}}, &sysCfg)
+	if err == nil {
+		t.Fatalf("BuildSlurmScript() succeeded with a job array and a template without job arrays")
+	}
+
+	// Installations only providing mpiexec use it, broken installations are rejected
+	mpiexecDir := newInstallDir(t, "mpiexec")
+	defer os.RemoveAll(mpiexecDir)
+	script, err = BuildSlurmScript(newJob(1, 2), &buildenv.Info{InstallDir: mpiexecDir}, nil, &sysCfg)
+	if err != nil {
+		t.Fatalf("BuildSlurmScript() failed with an installation only providing mpiexec: %s", err)
+	}
+	if !strings.Contains(script, filepath.Join(mpiexecDir, "bin", "mpiexec")+" ") {
+		t.Fatalf("mpiexec is not used by the script:\n%s", script)
+	}
+	brokenDir := newInstallDir(t, "")
+	defer os.RemoveAll(brokenDir)
+	_, err = BuildSlurmScript(newJob(1, 2), &buildenv.Info{InstallDir: brokenDir}, nil, &sysCfg)
+	if err == nil || !strings.Contains(err.Error(), brokenDir) {
+		t.Fatalf("BuildSlurmScript() did not report the broken installation in %s: %v", brokenDir, err)
+	}
+}
+
+func TestGetExportedEnv(t *testing.T) {
+	os.Setenv("SYMPI_TEST_LICENSE", "27000@license-server")
+	defer os.Unsetenv("SYMPI_TEST_LICENSE")
+	os.Setenv("SYMPI_TEST_QUOTE", "it's $HOME")
+	defer os.Unsetenv("SYMPI_TEST_QUOTE")
+	os.Setenv("SYMPI_TEST_EMPTY", "")
+	defer os.Unsetenv("SYMPI_TEST_EMPTY")
+
+	tests := []struct {
+		name     string
+		names    []string
+		expected []string
+	}{
+		{
+			name:     "none",
+			names:    nil,
+			expected: nil,
+		},
+		{
+			name:     "set",
+			names:    []string{"SYMPI_TEST_LICENSE", "SYMPI_TEST_EMPTY"},
+			expected: []string{"SYMPI_TEST_LICENSE='27000@license-server'", "SYMPI_TEST_EMPTY=''"},
+		},
+		{
+			name:     "quoted",
+			names:    []string{"SYMPI_TEST_QUOTE"},
+			expected: []string{`SYMPI_TEST_QUOTE='it'\''s $HOME'`},
+		},
+		{
+			name:     "unset",
+			names:    []string{"SYMPI_TEST_UNSET", "SYMPI_TEST_LICENSE"},
+			expected: []string{"SYMPI_TEST_LICENSE='27000@license-server'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assignments := getExportedEnv(tt.names)
+			if !reflect.DeepEqual(assignments, tt.expected) {
+				t.Fatalf("got %q instead of %q", assignments, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetSrunCmd(t *testing.T) {
+	ompiJob := &job.Job{HostCfg: &implem.Info{ID: implem.OMPI, Version: "4.0.2"}}
+	mpichJob := &job.Job{HostCfg: &implem.Info{ID: implem.MPICH, Version: "3.3"}}
+
+	tests := []struct {
+		name     string
+		job      *job.Job
+		kvs      []kv.KV
+		mpichPMI string
+		mapBy    string
+		bindTo   string
+		rankBy   string
+		expected string
+		fail     bool
+	}{
+		{name: "default", job: ompiJob, expected: "srun"},
+		{name: "configured", job: ompiJob, kvs: []kv.KV{{Key: slurm.MPIKey, Value: "pmix"}}, expected: "srun --mpi=pmix"},
+		{name: "mpich pmi", job: mpichJob, mpichPMI: mpich.PMI2, expected: "srun --mpi=pmi2"},
+		{name: "mpich mismatch", job: mpichJob, kvs: []kv.KV{{Key: slurm.MPIKey, Value: "pmix"}}, mpichPMI: mpich.PMI2, expected: "srun --mpi=pmix"},
+		{name: "affinity", job: ompiJob, mapBy: "node", bindTo: "core", expected: "srun --distribution=cyclic --cpu-bind=cores"},
+		{name: "processing elements", job: ompiJob, mapBy: "socket:PE=4", expected: "srun --distribution=block:cyclic --cpus-per-task=4"},
+		{name: "unsupported ranking", job: ompiJob, rankBy: "core", fail: true},
+	}
+
+	os.Unsetenv("SLURM_MPI_TYPE")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sysCfg := sys.Config{MPICHPMI: tt.mpichPMI, MapBy: tt.mapBy, BindTo: tt.bindTo, RankBy: tt.rankBy}
+			cmd, err := getSrunCmd(tt.job, tt.kvs, &sysCfg)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("getSrunCmd() succeeded with %s", cmd)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getSrunCmd() failed: %s", err)
+			}
+			if cmd != tt.expected {
+				t.Fatalf("srun command is %q instead of %q", cmd, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetJobScratchDir(t *testing.T) {
+	tests := []struct {
+		name        string
+		kvs         []kv.KV
+		expectedDir string
+	}{
+		{
+			name:        "disabled",
+			kvs:         nil,
+			expectedDir: "",
+		},
+		{
+			name:        "default",
+			kvs:         []kv.KV{{Key: slurm.JobScratchKey, Value: "true"}},
+			expectedDir: slurm.DefaultJobScratchDir,
+		},
+		{
+			name:        "custom",
+			kvs:         []kv.KV{{Key: slurm.JobScratchKey, Value: "true"}, {Key: slurm.JobScratchDirKey, Value: "/local/scratch"}},
+			expectedDir: "/local/scratch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := getJobScratchDir(tt.kvs)
+			if dir != tt.expectedDir {
+				t.Fatalf("job-local scratch directory is %q instead of %q", dir, tt.expectedDir)
+			}
+		})
+	}
+}
+
+func TestParseSacctOutput(t *testing.T) {
+	output := "1234|00:02.345||00:00:07\n1234.batch|00:01.000|1024K|00:00:07\n1234.0|00:01.345|2M|00:00:05\n"
+	usage := parseSacctOutput("1234", output)
+	if usage.CPUTime != "00:02.345" || usage.Elapsed != "00:00:07" || usage.MaxRSS != "2M" {
+		t.Fatalf("invalid usage: %+v", usage)
+	}
+
+	usage = parseSacctOutput("1234", "")
+	if usage.CPUTime != "" || usage.Elapsed != "" || usage.MaxRSS != "" {
+		t.Fatalf("usage from empty output: %+v", usage)
+	}
+}
+
+func TestSlurmGetUsage(t *testing.T) {
+	r := &mock.Runner{
+		Results: map[string]mock.Result{
+			"sacct": {Stdout: "1234|00:02.345||00:00:07\n1234.0|00:01.345|2M|00:00:05\n"},
+		},
+	}
+	sysCfg := sys.Config{Runner: r}
+
+	var j job.Job
+	usage, note := SlurmGetUsage(&j, "Submitted batch job 1234\n", &sysCfg)
+	if note != "" {
+		t.Fatalf("SlurmGetUsage() failed: %s", note)
+	}
+	if j.ID != "1234" || usage.CPUTime != "00:02.345" || usage.MaxRSS != "2M" || usage.Elapsed != "00:00:07" {
+		t.Fatalf("invalid usage for job %s: %+v", j.ID, usage)
+	}
+	calls := r.Calls()
+	if len(calls) != 1 || calls[0] != "sacct -j 1234 --format="+sacctFormat+" --parsable2 --noheader" {
+		t.Fatalf("invalid invocations of sacct: %v", calls)
+	}
+
+	// Each task of a job array has its own usage
+	r.Results["sacct"] = mock.Result{Stdout: "1234_0|00:01.000||00:00:04\n1234_0.0|00:00.900|1M|00:00:03\n1234_1|00:03.000||00:00:02\n1234_1.0|00:02.900|3M|00:00:01\n"}
+	arrayJob := job.Job{Array: &job.Array{Param: job.ArrayNP, Values: []string{"1", "2", "4"}}}
+	usage, note = SlurmGetUsage(&arrayJob, "Submitted batch job 1234\n", &sysCfg)
+	if note != "" {
+		t.Fatalf("SlurmGetUsage() failed with a job array: %s", note)
+	}
+	expectedTasks := []results.Usage{{CPUTime: "00:01.000", MaxRSS: "1M", Elapsed: "00:00:04"}, {CPUTime: "00:03.000", MaxRSS: "3M", Elapsed: "00:00:02"}, {}}
+	if !reflect.DeepEqual(arrayJob.TaskUsages, expectedTasks) {
+		t.Fatalf("invalid usage of the tasks: %+v", arrayJob.TaskUsages)
+	}
+
+	// Accounting not available
+	r.Results["sacct"] = mock.Result{Stderr: "Slurm accounting storage is disabled", ExitCode: 1}
+	_, note = SlurmGetUsage(&j, "Submitted batch job 1234\n", &sysCfg)
+	if note == "" {
+		t.Fatalf("SlurmGetUsage() succeeded while sacct failed")
+	}
+}
+
+func TestReadJobFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{"job.out": "single\n", "job_0.out": "one rank\n", "job_2.out": "four ranks\n"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", name, err)
+		}
+	}
+
+	output := readJobFile(&job.Job{}, filepath.Join(dir, "job.out"))
+	if output != "single\n" {
+		t.Fatalf("invalid output of the job: %q", output)
+	}
+
+	// The task 1 did not write its output
+	arrayJob := job.Job{Array: &job.Array{Param: job.ArrayNP, Values: []string{"1", "2", "4"}}}
+	output = readJobFile(&arrayJob, filepath.Join(dir, "job_%a.out"))
+	if output != "==> task 0 (np=1) <==\none rank\n==> task 2 (np=4) <==\nfour ranks\n" {
+		t.Fatalf("invalid output of the job array: %q", output)
+	}
+}
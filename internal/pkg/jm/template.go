@@ -0,0 +1,115 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package jm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+)
+
+// TemplateKeySuffix is the suffix of the keys of the tool's configuration file specifying the
+// template of the job scripts of a job manager, e.g., native_template or slurm_template
+const TemplateKeySuffix = "_template"
+
+// TemplateIDs are the identifiers of the job managers that generate their job scripts from a template
+var TemplateIDs = []string{NativeID, SlurmID}
+
+// NativeScriptData gathers the fields available to the template of a job script started by the
+// native job manager
+type NativeScriptData struct {
+	// Job is the job the script starts, e.g., {{.Job.NP}} is its number of ranks
+	Job *job.Job
+
+	// MPIDir is the directory where the host MPI used to start the job is installed
+	MPIDir string
+
+	// PMIEnv are the variables tuning PMI/PMIx set for the job, as shell assignments, e.g.,
+	// PMIX_MCA_gds='hash'; they are already in the environment of the script
+	PMIEnv []string
+
+	// MpirunCmd is the complete mpirun command starting the application
+	MpirunCmd string
+}
+
+// parseErrorRegexp matches the errors of text/template when parsing a template, e.g.,
+// 'template: job.tmpl:3: function "foo" not defined'
+var parseErrorRegexp = regexp.MustCompile(`^template: [^:]*:([0-9]+): (.*)$`)
+
+// startLineRegexp matches the errors reporting the line where an invalid action started, which is
+// more accurate than the line where the error is detected, e.g., 'unclosed action started at job.tmpl:3'
+var startLineRegexp = regexp.MustCompile(`started at [^:]*:([0-9]+)$`)
+
+// LoadTemplate loads and validates a template of job script. Parsing errors report the line and
+// column of the invalid action in the file.
+func LoadTemplate(path string) (*template.Template, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	name := filepath.Base(path)
+	text := string(data)
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		m := parseErrorRegexp.FindStringSubmatch(err.Error())
+		if m == nil {
+			return nil, fmt.Errorf("invalid template %s: %w", path, err)
+		}
+		line, _ := strconv.Atoi(m[1])
+		if start := startLineRegexp.FindStringSubmatch(m[2]); start != nil {
+			line, _ = strconv.Atoi(start[1])
+		}
+		col := getParseErrorColumn(name, text, line, m[2])
+		return nil, fmt.Errorf("invalid template %s:%d:%d: %s", path, line, col, m[2])
+	}
+	return tmpl, nil
+}
+
+// getParseErrorColumn figures out the column of the action causing a parsing error on a line,
+// which text/template does not report: the faulty action is the first one such that parsing the
+// template up to it fails with the same error.
+func getParseErrorColumn(name string, text string, line int, msg string) int {
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return 1
+	}
+	offset := 0
+	for _, l := range lines[:line-1] {
+		offset += len(l) + 1
+	}
+
+	lineText := lines[line-1]
+	col := 1
+	for idx := strings.Index(lineText, "{{"); idx >= 0; {
+		if col == 1 {
+			col = idx + 1
+		}
+		start := offset + idx
+		end := len(text)
+		closing := strings.Index(text[start:], "}}")
+		if closing >= 0 {
+			end = start + closing + 2
+		}
+		_, err := template.New(name).Parse(text[:end])
+		if err != nil && strings.HasSuffix(err.Error(), msg) {
+			return idx + 1
+		}
+
+		next := strings.Index(lineText[idx+2:], "{{")
+		if next < 0 {
+			break
+		}
+		idx += next + 2
+	}
+	return col
+}
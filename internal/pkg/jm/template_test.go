@@ -0,0 +1,119 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package jm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/app"
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestLoadTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		text     string
+		location string
+	}{
+		{name: "valid", text: "#!/bin/bash\n#SBATCH --ntasks={{.Job.NP}}\n{{.MpirunCmd}}\n"},
+		{name: "undefined function", text: "#!/bin/bash\n#SBATCH --nodes={{.Job.NNodes}} --ntasks={{ntasks .Job}}\n", location: ":2:42: "},
+		{name: "unclosed action", text: "#!/bin/bash\n{{.MpirunCmd}}\n\n{{.MpirunCmd\n", location: ":4:1: "},
+		{name: "unexpected end", text: "#!/bin/bash\n  {{end}}\n", location: ":2:3: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "job.tmpl")
+			err := ioutil.WriteFile(path, []byte(tt.text), 0644)
+			if err != nil {
+				t.Fatalf("failed to create %s: %s", path, err)
+			}
+
+			_, err = LoadTemplate(path)
+			if tt.location == "" {
+				if err != nil {
+					t.Fatalf("LoadTemplate() failed: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), path+tt.location) {
+				t.Fatalf("LoadTemplate() returned %v instead of an error at %s", err, tt.location)
+			}
+		})
+	}
+
+	_, err = LoadTemplate(filepath.Join(dir, "missing.tmpl"))
+	if err == nil {
+		t.Fatalf("LoadTemplate() succeeded with a missing file")
+	}
+}
+
+func TestUserTemplates(t *testing.T) {
+	newJob := func() *job.Job {
+		return &job.Job{
+			NP:        4,
+			NNodes:    1,
+			HostCfg:   &implem.Info{ID: implem.OMPI, Version: "4.0.2"},
+			Container: &container.Config{Name: "helloworld", Path: "/containers/helloworld.sif", Model: container.HybridModel},
+			App:       app.Info{Name: "helloworld", BinPath: "/opt/helloworld"},
+		}
+	}
+	tmpl := template.Must(template.New("job.tmpl").Parse("#!/bin/bash\nlicense-server start # {{.Job.App.Name}} with {{.Job.NP}} ranks\n{{.MpirunCmd}}\n"))
+	sysCfg := sys.Config{
+		ScratchDir: "/scratch",
+		JobTemplates: map[string]*template.Template{
+			NativeID: tmpl,
+			SlurmID:  tmpl,
+		},
+	}
+	installDir := newInstallDir(t, "mpirun")
+	defer os.RemoveAll(installDir)
+	env := buildenv.Info{InstallDir: installDir}
+	mpirun := filepath.Join(installDir, "bin", "mpirun")
+	expected := "#!/bin/bash\nlicense-server start # helloworld with 4 ranks\n"
+
+	// Slurm
+	script, err := BuildSlurmScript(newJob(), &env, nil, &sysCfg)
+	if err != nil {
+		t.Fatalf("BuildSlurmScript() failed: %s", err)
+	}
+	if script != expected+mpirun+" singularity exec /containers/helloworld.sif /opt/helloworld\n" {
+		t.Fatalf("invalid Slurm script:\n%s", script)
+	}
+
+	// Native job manager, the script is executed instead of mpirun
+	j := newJob()
+	sycmd, err := NativeSubmit(j, &env, &sysCfg)
+	if err != nil {
+		t.Fatalf("NativeSubmit() failed: %s", err)
+	}
+	defer j.CleanUp()
+	if sycmd.BinPath != "bash" || len(sycmd.CmdArgs) != 1 || sycmd.CmdArgs[0] != j.BatchScript {
+		t.Fatalf("invalid command: %s %s", sycmd.BinPath, strings.Join(sycmd.CmdArgs, " "))
+	}
+	data, err := ioutil.ReadFile(j.BatchScript)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", j.BatchScript, err)
+	}
+	if string(data) != expected+mpirun+" -np 4 singularity exec /containers/helloworld.sif /opt/helloworld\n" {
+		t.Fatalf("invalid native script:\n%s", data)
+	}
+}
@@ -7,10 +7,13 @@ package job
 
 import (
 	"bytes"
+	"fmt"
+	"strconv"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/app"
 	"github.com/sylabs/singularity-mpi/internal/pkg/container"
 	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/results"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 )
 
@@ -23,6 +26,96 @@ type GetOutputFn func(*Job, *sys.Config) string
 // GetErrorFn is a "function pointer" to call to gather stderr from an application after completion of a job
 type GetErrorFn func(*Job, *sys.Config) string
 
+// GetUsageFn is a "function pointer" to call to gather the resources used by a job after its completion,
+// based on the output of the submission command. When the usage is not available, the fields are empty
+// and the returned string explains why.
+type GetUsageFn func(*Job, string, *sys.Config) (results.Usage, string)
+
+// Segment is an additional containerized application started within the same job as the
+// main application, with its own ranks (MPMD)
+type Segment struct {
+	// App is the application to start in the container, including its number of ranks
+	App app.Info
+
+	// Container is the container in which the application is started
+	Container *container.Config
+}
+
+// HetComponent describes the allocation of one of the components of a heterogeneous job, each
+// application of the job being started on its own set of nodes
+type HetComponent struct {
+	// NNodes is the number of nodes of the component; the job manager's default if 0
+	NNodes int64
+
+	// NTasksPerNode is the number of ranks per node of the component (optional)
+	NTasksPerNode int64
+
+	// Partition is the partition of the nodes of the component (optional)
+	Partition string
+
+	// Constraint is the list of features the nodes of the component must have (optional)
+	Constraint string
+}
+
+const (
+	// ArrayNP is the parameter of a job array setting the number of ranks of each task
+	ArrayNP = "np"
+
+	// ArrayArg is the parameter of a job array setting an argument appended to the arguments of
+	// the application in each task, e.g., the size of the input
+	ArrayArg = "arg"
+
+	// ArrayValueVar is the variable of the batch scripts with the value of the parameter of the
+	// task of a job array
+	ArrayValueVar = "SYMPI_ARRAY_VALUE"
+)
+
+// Array describes a job array, i.e., a job submitted once to sweep over the values of a
+// parameter: each task of the array runs the job with the value selected by its index
+type Array struct {
+	// Param is the parameter of the job set by the tasks, ArrayNP or ArrayArg
+	Param string
+
+	// Values are the values of the parameter, the task with index i using Values[i]
+	Values []string
+}
+
+// Check checks that a job array is valid: a known parameter, at least one value and, for
+// ArrayNP, numbers of ranks
+func (a *Array) Check() error {
+	if len(a.Values) == 0 {
+		return fmt.Errorf("job array without values")
+	}
+	switch a.Param {
+	case ArrayArg:
+		return nil
+	case ArrayNP:
+		for _, v := range a.Values {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of ranks %q in the job array", v)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid parameter %q of the job array, it should be %s or %s", a.Param, ArrayNP, ArrayArg)
+}
+
+// GetMaxNP returns the largest number of ranks of the tasks of a job array over ArrayNP, the
+// allocation of all the tasks being the same; 0 for other job arrays
+func (a *Array) GetMaxNP() int64 {
+	var max int64
+	if a.Param != ArrayNP {
+		return max
+	}
+	for _, v := range a.Values {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > max {
+			max = n
+		}
+	}
+	return max
+}
+
 // Job represents a job
 type Job struct {
 	// NP is the number of ranks
@@ -31,6 +124,9 @@ type Job struct {
 	// NNodes is the number of nodes
 	NNodes int64
 
+	// NTasksPerNode is the number of ranks per node (optional)
+	NTasksPerNode int64
+
 	// CleanUp is the function to call once the job is completed to clean the system
 	CleanUp CleanUpFn
 
@@ -46,6 +142,22 @@ type Job struct {
 	// App is the path to the application's binary, i.e., the binary to start
 	App app.Info
 
+	// Segments are the auxiliary containers started with the application, sharing the same allocation (optional)
+	Segments []Segment
+
+	// HetComponents are the allocations of a heterogeneous job (optional): the first component is the
+	// allocation of the application, the next ones the allocations of the segments, in order. Only
+	// supported with Slurm, NNodes is then ignored.
+	HetComponents []HetComponent
+
+	// Array makes the job a job array (optional), only supported with Slurm. With ArrayNP, NP
+	// is ignored and each task uses its own number of ranks.
+	Array *Array
+
+	// TaskUsages are the resources used by each task of a job array, in the order of the values
+	// of the array, gathered with the usage of the job (optional)
+	TaskUsages []results.Usage
+
 	// OutBuffer is a buffer with the output of the job
 	OutBuffer bytes.Buffer
 
@@ -57,4 +169,48 @@ type Job struct {
 
 	// GetError is the function to call to gather stderr of the application based on the use of a given job manager
 	GetError GetErrorFn
+
+	// ID is the identifier of the job assigned by the job manager (optional)
+	ID string
+
+	// GetUsage is the function to call to gather the resources used by the job (optional)
+	GetUsage GetUsageFn
+}
+
+// GetAllocation returns the number of nodes and ranks to request from the job manager, 0 meaning
+// that the job manager's default applies. What is not specified is derived from the number of
+// ranks per node:
+//   - with the number of ranks, the number of nodes is the number of ranks divided by the number
+//     of ranks per node, rounded up;
+//   - with the number of nodes, the number of ranks is the number of nodes times the number of
+//     ranks per node.
+//
+// Without number of ranks per node, a number of ranks requires a number of nodes while a number
+// of nodes alone starts one rank per node. When there are fewer ranks than nodes, the number of
+// nodes is reduced to the number of ranks so no node is left idle. Inconsistent allocations are
+// rejected.
+func GetAllocation(nodes int64, ntasks int64, perNode int64) (int64, int64, error) {
+	if nodes < 0 || ntasks < 0 || perNode < 0 {
+		return 0, 0, fmt.Errorf("invalid allocation of %d nodes, %d ranks and %d ranks per node", nodes, ntasks, perNode)
+	}
+
+	if perNode > 0 {
+		switch {
+		case nodes == 0 && ntasks == 0:
+			return 0, 0, fmt.Errorf("%d ranks per node requires the number of nodes or ranks", perNode)
+		case nodes == 0:
+			nodes = (ntasks + perNode - 1) / perNode
+		case ntasks == 0:
+			ntasks = nodes * perNode
+		case ntasks > nodes*perNode:
+			return 0, 0, fmt.Errorf("%d ranks cannot be started on %d nodes with %d ranks per node", ntasks, nodes, perNode)
+		}
+	} else if ntasks > 0 && nodes == 0 {
+		return 0, 0, fmt.Errorf("%d ranks require the number of nodes or the number of ranks per node", ntasks)
+	}
+
+	if ntasks > 0 && ntasks < nodes {
+		nodes = ntasks
+	}
+	return nodes, ntasks, nil
 }
@@ -0,0 +1,85 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package job
+
+import (
+	"testing"
+)
+
+func TestGetAllocation(t *testing.T) {
+	tests := []struct {
+		name           string
+		nodes          int64
+		ntasks         int64
+		perNode        int64
+		expectedNodes  int64
+		expectedNTasks int64
+		fail           bool
+	}{
+		{name: "defaults"},
+		{name: "nodes and ranks", nodes: 2, ntasks: 8, expectedNodes: 2, expectedNTasks: 8},
+		{name: "nodes only", nodes: 2, expectedNodes: 2},
+		{name: "ranks only", ntasks: 8, fail: true},
+		{name: "nodes from ranks", ntasks: 6, perNode: 4, expectedNodes: 2, expectedNTasks: 6},
+		{name: "ranks from nodes", nodes: 2, perNode: 4, expectedNodes: 2, expectedNTasks: 8},
+		{name: "all specified", nodes: 2, ntasks: 6, perNode: 4, expectedNodes: 2, expectedNTasks: 6},
+		{name: "too many ranks", nodes: 1, ntasks: 8, perNode: 4, fail: true},
+		{name: "ranks per node only", perNode: 4, fail: true},
+		{name: "fewer ranks than nodes", nodes: 4, ntasks: 2, expectedNodes: 2, expectedNTasks: 2},
+		{name: "negative", nodes: -1, ntasks: 2, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, ntasks, err := GetAllocation(tt.nodes, tt.ntasks, tt.perNode)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("allocation of %d nodes, %d ranks and %d ranks per node succeeded", tt.nodes, tt.ntasks, tt.perNode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("allocation failed: %s", err)
+			}
+			if nodes != tt.expectedNodes || ntasks != tt.expectedNTasks {
+				t.Fatalf("got %d nodes and %d ranks instead of %d nodes and %d ranks", nodes, ntasks, tt.expectedNodes, tt.expectedNTasks)
+			}
+		})
+	}
+}
+
+func TestArray(t *testing.T) {
+	tests := []struct {
+		name          string
+		array         Array
+		expectedMaxNP int64
+		fail          bool
+	}{
+		{name: "ranks", array: Array{Param: ArrayNP, Values: []string{"1", "8", "4"}}, expectedMaxNP: 8},
+		{name: "arguments", array: Array{Param: ArrayArg, Values: []string{"small", "large"}}},
+		{name: "no value", array: Array{Param: ArrayNP}, fail: true},
+		{name: "invalid ranks", array: Array{Param: ArrayNP, Values: []string{"1", "0"}}, fail: true},
+		{name: "invalid parameter", array: Array{Param: "nodes", Values: []string{"1"}}, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.array.Check()
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("invalid job array %+v accepted", tt.array)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() failed: %s", err)
+			}
+			if tt.array.GetMaxNP() != tt.expectedMaxNP {
+				t.Fatalf("GetMaxNP() returned %d instead of %d", tt.array.GetMaxNP(), tt.expectedMaxNP)
+			}
+		})
+	}
+}
@@ -8,11 +8,18 @@ package kv
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 )
 
+// DropInDir is the name of the directory, next to the configuration files, where drop-in
+// configuration files are stored
+const DropInDir = "conf.d"
+
 // KV represents a key/value pair
 type KV struct {
 	// Key of the pair
@@ -34,9 +41,9 @@ func KeyExists(kvs []KV, key string) bool {
 
 // SetValue sets the value of a given key
 func SetValue(kvs []KV, key string, value string) error {
-	for _, kv := range kvs {
-		if kv.Key == key {
-			kv.Value = value
+	for i := range kvs {
+		if kvs[i].Key == key {
+			kvs[i].Value = value
 			return nil
 		}
 	}
@@ -63,9 +70,14 @@ func LoadKeyValueConfig(filepath string) ([]KV, error) {
 	}
 	defer f.Close()
 
+	return parseKeyValueConfig(f)
+}
+
+// parseKeyValueConfig parses the key/value pairs of a configuration
+func parseKeyValueConfig(r io.Reader) ([]KV, error) {
 	var data []KV
 
-	lineReader := bufio.NewScanner(f)
+	lineReader := bufio.NewScanner(r)
 	for lineReader.Scan() {
 		line := lineReader.Text()
 
@@ -95,6 +107,91 @@ func LoadKeyValueConfig(filepath string) ([]KV, error) {
 
 		data = append(data, newKV)
 	}
+	if err := lineReader.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// getDropInFiles returns the drop-in files of a configuration file in lexical order. For a
+// configuration file <dir>/<name>.conf, the drop-in files are <dir>/conf.d/<name>.conf and
+// <dir>/conf.d/<name>_*.conf.
+func getDropInFiles(path string) ([]string, error) {
+	dir := filepath.Join(filepath.Dir(path), DropInDir)
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	files, err := filepath.Glob(filepath.Join(dir, name+"_*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, name+".conf")); err == nil {
+		files = append(files, filepath.Join(dir, name+".conf"))
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// IsDropInOf checks whether a file of the drop-in directory is merged with a configuration file,
+// i.e., whether it is named after it (see getDropInFiles)
+func IsDropInOf(dropIn string, path string) bool {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	base := filepath.Base(dropIn)
+	return base == name+".conf" || (strings.HasPrefix(base, name+"_") && strings.HasSuffix(base, ".conf"))
+}
+
+// ConfigExists checks whether a configuration file or one of its drop-in files exists
+func ConfigExists(path string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	dropIns, err := getDropInFiles(path)
+	return err == nil && len(dropIns) > 0
+}
+
+// merge adds key/value pairs to an existing set, the new values overriding the existing ones
+func merge(kvs []KV, newKVs []KV) []KV {
+	for _, newKV := range newKVs {
+		if KeyExists(kvs, newKV.Key) {
+			SetValue(kvs, newKV.Key, newKV.Value)
+		} else {
+			kvs = append(kvs, newKV)
+		}
+	}
+	return kvs
+}
+
+// LoadKeyValueConfigWithDropIns loads all the key/value pairs from a configuration file and
+// its drop-in files (see getDropInFiles). The drop-in files are loaded in lexical order after
+// the configuration file, the values of the later files overriding the values of the earlier
+// ones. The configuration file itself is optional when drop-in files are available.
+func LoadKeyValueConfigWithDropIns(path string) ([]KV, error) {
+	dropIns, err := getDropInFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get drop-in files for %s: %w", path, err)
+	}
+
+	var data []KV
+	if _, err := os.Stat(path); err == nil || len(dropIns) == 0 {
+		data, err = LoadKeyValueConfig(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return loadDropIns(data, dropIns)
+}
+
+// loadDropIns merges the key/value pairs of drop-in files into an existing set
+func loadDropIns(data []KV, dropIns []string) ([]KV, error) {
+	for _, f := range dropIns {
+		kvs, err := LoadKeyValueConfig(f)
+		if err != nil {
+			return nil, err
+		}
+		data = merge(data, kvs)
+	}
 
 	return data, nil
 }
@@ -0,0 +1,93 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package kv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeyValueConfigWithDropIns(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "kv-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.MkdirAll(filepath.Join(tempDir, DropInDir), 0755)
+	if err != nil {
+		t.Fatalf("failed to create drop-in directory: %s", err)
+	}
+	files := map[string]string{
+		"openmpi.conf":                       "4.0.0=url1\n4.0.1=url2\n",
+		DropInDir + "/openmpi_10-site.conf":  "4.0.1=site\n4.0.2=url3\n",
+		DropInDir + "/openmpi_20-local.conf": "4.0.2=local\n",
+		// Must be ignored, it is a drop-in for another configuration file
+		DropInDir + "/openmpi-images_site.conf": "4.0.0=image\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", name, err)
+		}
+	}
+
+	kvs, err := LoadKeyValueConfigWithDropIns(filepath.Join(tempDir, "openmpi.conf"))
+	if err != nil {
+		t.Fatalf("failed to load configuration: %s", err)
+	}
+
+	expected := map[string]string{
+		"4.0.0": "url1",
+		"4.0.1": "site",
+		"4.0.2": "local",
+	}
+	if len(kvs) != len(expected) {
+		t.Fatalf("got %d entries instead of %d: %v", len(kvs), len(expected), kvs)
+	}
+	for key, val := range expected {
+		if GetValue(kvs, key) != val {
+			t.Fatalf("value of %s is %s instead of %s", key, GetValue(kvs, key), val)
+		}
+	}
+}
+
+func TestConfigExists(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "kv-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.MkdirAll(filepath.Join(tempDir, DropInDir), 0755)
+	if err != nil {
+		t.Fatalf("failed to create drop-in directory: %s", err)
+	}
+	for _, f := range []string{"openmpi.conf", filepath.Join(DropInDir, "mpich_site.conf")} {
+		err = ioutil.WriteFile(filepath.Join(tempDir, f), []byte("1.0=file:///tmp/src.tar.gz\n"), 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", f, err)
+		}
+	}
+
+	tests := []struct {
+		file     string
+		expected bool
+	}{
+		{file: "openmpi.conf", expected: true},
+		{file: "mpich.conf", expected: true},
+		{file: "singularity.conf", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if ConfigExists(filepath.Join(tempDir, tt.file)) != tt.expected {
+				t.Fatalf("ConfigExists() did not return %v", tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultRemoteTTL is the default time a configuration fetched from a remote source is used
+// before being fetched again
+const DefaultRemoteTTL = time.Hour
+
+// RemoteOptions specifies how a configuration is fetched from a remote source
+type RemoteOptions struct {
+	// CacheDir is the directory where the fetched configurations are cached
+	CacheDir string
+
+	// TTL is the time a cached configuration is used before being fetched again; DefaultRemoteTTL if 0
+	TTL time.Duration
+
+	// Offline specifies whether the network must not be accessed, the cached configuration being then used regardless of its age
+	Offline bool
+
+	// Client is the HTTP client used to fetch the configurations; http.DefaultClient if nil
+	Client *http.Client
+}
+
+// IsRemote checks whether the path to a configuration is a http(s) URL
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// getRemoteCachePath returns the path to the cached copy of a remote configuration
+func getRemoteCachePath(u string, cacheDir string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:8])+"_"+filepath.Base(u))
+}
+
+// fetchRemoteConfig downloads a configuration, which is only returned if it is valid
+func fetchRemoteConfig(ctx context.Context, u string, client *http.Client) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	_, err = parseKeyValueConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return content, nil
+}
+
+// LoadRemoteKeyValueConfig loads the key/value pairs of a configuration served over http(s).
+// The configuration is cached and fetched again once the cached copy is older than the TTL.
+// When the configuration cannot be fetched, e.g., offline, the cached copy is used regardless
+// of its age.
+func LoadRemoteKeyValueConfig(ctx context.Context, u string, opts RemoteOptions) ([]KV, error) {
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = DefaultRemoteTTL
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	cachePath := getRemoteCachePath(u, opts.CacheDir)
+	fi, statErr := os.Stat(cachePath)
+	if statErr == nil && time.Since(fi.ModTime()) < ttl {
+		return LoadKeyValueConfig(cachePath)
+	}
+
+	var fetchErr error
+	if opts.Offline {
+		fetchErr = fmt.Errorf("offline mode")
+	} else {
+		var content []byte
+		content, fetchErr = fetchRemoteConfig(ctx, u, client)
+		if fetchErr == nil {
+			err := os.MkdirAll(opts.CacheDir, 0755)
+			if err == nil {
+				err = ioutil.WriteFile(cachePath, content, 0644)
+			}
+			if err != nil {
+				log.Printf("[WARN] unable to cache %s in %s: %s", u, cachePath, err)
+			}
+			return parseKeyValueConfig(bytes.NewReader(content))
+		}
+	}
+
+	if statErr != nil {
+		return nil, fmt.Errorf("unable to fetch %s and no cached copy: %w", u, fetchErr)
+	}
+	log.Printf("[WARN] unable to fetch %s (%s), using the cached copy from %s", u, fetchErr, fi.ModTime().Format(time.RFC3339))
+	return LoadKeyValueConfig(cachePath)
+}
+
+// LoadRemoteKeyValueConfigWithDropIns loads the key/value pairs of a configuration served over
+// http(s) (see LoadRemoteKeyValueConfig) and merges the drop-in files of a local configuration
+// file, so local additions still apply to the remote configuration. The local configuration
+// file is used instead of the remote configuration when the latter is not available at all.
+func LoadRemoteKeyValueConfigWithDropIns(ctx context.Context, u string, localPath string, opts RemoteOptions) ([]KV, error) {
+	data, err := LoadRemoteKeyValueConfig(ctx, u, opts)
+	if err != nil {
+		if _, statErr := os.Stat(localPath); statErr != nil {
+			return nil, err
+		}
+		log.Printf("[WARN] %s, using %s", err, localPath)
+		data, err = LoadKeyValueConfig(localPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dropIns, err := getDropInFiles(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get drop-in files for %s: %w", localPath, err)
+	}
+	return loadDropIns(data, dropIns)
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package kv
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadRemoteKeyValueConfig(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "kv-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	content := "4.1.4=url1\n"
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/openmpi.conf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+	u := srv.URL + "/openmpi.conf"
+	opts := RemoteOptions{CacheDir: filepath.Join(tempDir, "cache")}
+	ctx := context.Background()
+
+	kvs, err := LoadRemoteKeyValueConfig(ctx, u, opts)
+	if err != nil || GetValue(kvs, "4.1.4") != "url1" || requests != 1 {
+		t.Fatalf("fetching %s gave %v after %d request(s): %v", u, kvs, requests, err)
+	}
+
+	// The cached copy is used until it is older than the TTL
+	content = "4.1.4=url2\n"
+	kvs, err = LoadRemoteKeyValueConfig(ctx, u, opts)
+	if err != nil || GetValue(kvs, "4.1.4") != "url1" || requests != 1 {
+		t.Fatalf("cached %s gave %v after %d request(s): %v", u, kvs, requests, err)
+	}
+	opts.TTL = time.Nanosecond
+	kvs, err = LoadRemoteKeyValueConfig(ctx, u, opts)
+	if err != nil || GetValue(kvs, "4.1.4") != "url2" || requests != 2 {
+		t.Fatalf("expired %s gave %v after %d request(s): %v", u, kvs, requests, err)
+	}
+
+	// Invalid configurations are not cached, the cached copy is used instead
+	content = "<html>maintenance</html>\n"
+	kvs, err = LoadRemoteKeyValueConfig(ctx, u, opts)
+	if err != nil || GetValue(kvs, "4.1.4") != "url2" {
+		t.Fatalf("invalid %s gave %v: %v", u, kvs, err)
+	}
+
+	// Offline, the cached copy is used regardless of its age
+	opts.Offline = true
+	kvs, err = LoadRemoteKeyValueConfig(ctx, u, opts)
+	if err != nil || GetValue(kvs, "4.1.4") != "url2" || requests != 3 {
+		t.Fatalf("offline %s gave %v after %d request(s): %v", u, kvs, requests, err)
+	}
+	_, err = LoadRemoteKeyValueConfig(ctx, srv.URL+"/mpich.conf", opts)
+	if err == nil {
+		t.Fatalf("offline configuration without cached copy was loaded")
+	}
+}
+
+func TestLoadRemoteKeyValueConfigWithDropIns(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "kv-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.MkdirAll(filepath.Join(tempDir, DropInDir), 0755)
+	if err != nil {
+		t.Fatalf("failed to create drop-in directory: %s", err)
+	}
+	files := map[string]string{
+		"openmpi.conf":                      "4.0.0=local\n",
+		DropInDir + "/openmpi_10-site.conf": "4.1.4=site\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", name, err)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openmpi.conf" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("4.1.2=remote\n4.1.4=remote\n"))
+	}))
+	defer srv.Close()
+	opts := RemoteOptions{CacheDir: filepath.Join(tempDir, "cache")}
+	localPath := filepath.Join(tempDir, "openmpi.conf")
+
+	tests := []struct {
+		name     string
+		url      string
+		expected map[string]string
+	}{
+		{name: "remote", url: srv.URL + "/openmpi.conf", expected: map[string]string{"4.1.2": "remote", "4.1.4": "site"}},
+		{name: "local fallback", url: srv.URL + "/unavailable.conf", expected: map[string]string{"4.0.0": "local", "4.1.4": "site"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs, err := LoadRemoteKeyValueConfigWithDropIns(context.Background(), tt.url, localPath, opts)
+			if err != nil {
+				t.Fatalf("failed to load configuration: %s", err)
+			}
+			if len(kvs) != len(tt.expected) {
+				t.Fatalf("got %d entries instead of %d: %v", len(kvs), len(tt.expected), kvs)
+			}
+			for key, val := range tt.expected {
+				if GetValue(kvs, key) != val {
+					t.Fatalf("value of %s is %s instead of %s", key, GetValue(kvs, key), val)
+				}
+			}
+		})
+	}
+}
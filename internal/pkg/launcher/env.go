@@ -0,0 +1,115 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+	"github.com/sylabs/singularity-mpi/internal/pkg/util/sy"
+)
+
+// mpiEnvPrefixes are the prefixes of the environment variables configuring MPI on the host, which
+// are removed from the environment of the job when the MPI of the container is used (hybrid model)
+var mpiEnvPrefixes = []string{"OMPI_", "OPAL_", "PMIX_", "PMI_", "HYDRA_", "MPICH_", "MPIR_CVAR_", "I_MPI_"}
+
+// isMPIEnv checks whether an environment variable, e.g., "OMPI_MCA_btl=self", configures MPI
+func isMPIEnv(v string) bool {
+	for _, prefix := range mpiEnvPrefixes {
+		if strings.HasPrefix(v, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterMPIEnv returns an environment without the variables configuring MPI on the host, except
+// the variables to keep, e.g., the PMI/PMIx tuning of the configuration (PMIX_MCA_gds=hash)
+func filterMPIEnv(env []string, keep ...string) []string {
+	var filtered []string
+	for _, v := range env {
+		if !isMPIEnv(v) || isKeptEnv(v, keep) {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+// isKeptEnv checks whether an environment variable, e.g., "PMIX_MCA_gds=hash", is one of the
+// variables to keep
+func isKeptEnv(v string, keep []string) bool {
+	for _, k := range keep {
+		if v == k {
+			return true
+		}
+	}
+	return false
+}
+
+// needsMPIEnvIsolation checks whether the MPI configuration of the host must be removed from the
+// environment of a job, i.e., when all its containers use their own MPI. In bind mode, the MPI
+// of the host is used in the container so its configuration is preserved.
+func needsMPIEnvIsolation(j *job.Job, sysCfg *sys.Config) bool {
+	if sysCfg.KeepMPIEnv || j.Container == nil {
+		return false
+	}
+	containers := []*container.Config{j.Container}
+	for _, s := range j.Segments {
+		if s.Container != nil {
+			containers = append(containers, s.Container)
+		}
+	}
+	for _, c := range containers {
+		if c.Model == container.BindModel {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseVarNames parses a comma-separated list of names of environment variables, e.g.,
+// "OMP_NUM_THREADS, LM_LICENSE_FILE"; empty entries are ignored
+func ParseVarNames(val string) []string {
+	var names []string
+	for _, name := range strings.Split(val, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// varNameRegexp matches the names of the environment variables a shell can export
+var varNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParsePMIEnv gets the variables tuning PMI/PMIx from the entries of the sympi configuration
+// file, as NAME=VALUE assignments in the order of the file, e.g.:
+//
+//	pmi_env.PMIX_MCA_gds = hash
+//	pmi_env.PMIX_MCA_psec = native
+//
+// They are exported by the batch scripts of the jobs, for clusters where the defaults of PMIx
+// do not match the MPI build.
+func ParsePMIEnv(kvs []kv.KV) ([]string, error) {
+	var env []string
+	for _, entry := range kvs {
+		if !strings.HasPrefix(entry.Key, sy.PMIEnvKeyPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(entry.Key, sy.PMIEnvKeyPrefix)
+		if !varNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("%s does not follow the %s<variable> format, %q is not a valid variable name", entry.Key, sy.PMIEnvKeyPrefix, name)
+		}
+		env = append(env, name+"="+entry.Value)
+	}
+	return env, nil
+}
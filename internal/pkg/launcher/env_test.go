@@ -0,0 +1,108 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestFilterMPIEnv(t *testing.T) {
+	env := []string{"PATH=/usr/bin", "OMPI_MCA_btl=self", "PMI_RANK=0", "UCX_TLS=rc", "I_MPI_ROOT=/opt/intel", "HOME=/home/user"}
+	expected := []string{"PATH=/usr/bin", "UCX_TLS=rc", "HOME=/home/user"}
+	filtered := filterMPIEnv(env)
+	if !reflect.DeepEqual(filtered, expected) {
+		t.Fatalf("got %v instead of %v", filtered, expected)
+	}
+}
+
+func TestNeedsMPIEnvIsolation(t *testing.T) {
+	hybrid := container.Config{Model: container.HybridModel}
+	bind := container.Config{Model: container.BindModel}
+	tests := []struct {
+		name     string
+		job      job.Job
+		keep     bool
+		expected bool
+	}{
+		{name: "hybrid", job: job.Job{Container: &hybrid}, expected: true},
+		{name: "bind", job: job.Job{Container: &bind}, expected: false},
+		{name: "hybrid kept", job: job.Job{Container: &hybrid}, keep: true, expected: false},
+		{name: "bind segment", job: job.Job{Container: &hybrid, Segments: []job.Segment{{Container: &bind}}}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sysCfg := sys.Config{KeepMPIEnv: tt.keep}
+			res := needsMPIEnvIsolation(&tt.job, &sysCfg)
+			if res != tt.expected {
+				t.Fatalf("needsMPIEnvIsolation() returned %t instead of %t", res, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseVarNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      string
+		expected []string
+	}{
+		{name: "empty", val: "", expected: nil},
+		{name: "list", val: "OMP_NUM_THREADS, LM_LICENSE_FILE,", expected: []string{"OMP_NUM_THREADS", "LM_LICENSE_FILE"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := ParseVarNames(tt.val)
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Fatalf("got %q instead of %q", names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParsePMIEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		kvs           []kv.KV
+		expected      []string
+		expectedError bool
+	}{
+		{name: "none", kvs: []kv.KV{{Key: "export_env", Value: "OMP_NUM_THREADS"}}, expected: nil},
+		{
+			name:     "variables",
+			kvs:      []kv.KV{{Key: "pmi_env.PMIX_MCA_gds", Value: "hash"}, {Key: "ucx_tls", Value: "rc"}, {Key: "pmi_env.PMIX_MCA_psec", Value: "native"}},
+			expected: []string{"PMIX_MCA_gds=hash", "PMIX_MCA_psec=native"},
+		},
+		{name: "empty value", kvs: []kv.KV{{Key: "pmi_env.PMIX_MCA_ptl_tcp_if_include", Value: ""}}, expected: []string{"PMIX_MCA_ptl_tcp_if_include="}},
+		{name: "no variable", kvs: []kv.KV{{Key: "pmi_env.", Value: "hash"}}, expectedError: true},
+		{name: "invalid variable", kvs: []kv.KV{{Key: "pmi_env.PMIX-MCA", Value: "hash"}}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := ParsePMIEnv(tt.kvs)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("ParsePMIEnv() succeeded with %q", env)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePMIEnv() failed: %s", err)
+			}
+			if !reflect.DeepEqual(env, tt.expected) {
+				t.Fatalf("got %q instead of %q", env, tt.expected)
+			}
+		})
+	}
+}
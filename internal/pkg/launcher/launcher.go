@@ -6,7 +6,6 @@
 package launcher
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"log"
@@ -16,6 +15,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/app"
@@ -24,9 +24,12 @@ import (
 	"github.com/sylabs/singularity-mpi/internal/pkg/jm"
 	"github.com/sylabs/singularity-mpi/internal/pkg/job"
 	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/modulefile"
 	"github.com/sylabs/singularity-mpi/internal/pkg/mpi"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mpich"
 	"github.com/sylabs/singularity-mpi/internal/pkg/network"
 	"github.com/sylabs/singularity-mpi/internal/pkg/results"
+	"github.com/sylabs/singularity-mpi/internal/pkg/scratch"
 	"github.com/sylabs/singularity-mpi/internal/pkg/slurm"
 	"github.com/sylabs/singularity-mpi/internal/pkg/syexec"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
@@ -41,23 +44,56 @@ type Info struct {
 }
 
 // PrepareLaunchCmd interacts with a job manager backend to figure out how to launch a job
-func prepareLaunchCmd(j *job.Job, jobmgr *jm.JM, hostEnv *buildenv.Info, sysCfg *sys.Config) (syexec.SyCmd, error) {
+func prepareLaunchCmd(ctx context.Context, j *job.Job, jobmgr *jm.JM, hostEnv *buildenv.Info, sysCfg *sys.Config) (syexec.SyCmd, error) {
 	var cmd syexec.SyCmd
 
 	launchCmd, err := jobmgr.Submit(j, hostEnv, sysCfg)
 	if err != nil {
-		return cmd, fmt.Errorf("failed to create a launcher object: %s", err)
+		return cmd, fmt.Errorf("failed to create a launcher object: %w", err)
 	}
 	log.Printf("* Command object for '%s %s' is ready", launchCmd.BinPath, strings.Join(launchCmd.CmdArgs, " "))
 
-	cmd.Ctx, cmd.CancelFn = context.WithTimeout(context.Background(), sys.CmdTimeout*time.Minute)
-	cmd.Cmd = exec.CommandContext(cmd.Ctx, launchCmd.BinPath, launchCmd.CmdArgs...)
-	cmd.Cmd.Stdout = &j.OutBuffer
-	cmd.Cmd.Stderr = &j.ErrBuffer
+	cmd.Ctx, cmd.CancelFn = context.WithTimeout(ctx, sys.CmdTimeout*time.Minute)
+	cmd.BinPath = launchCmd.BinPath
+	cmd.CmdArgs = launchCmd.CmdArgs
+	cmd.Env = launchCmd.Env
+	if needsMPIEnvIsolation(j, sysCfg) {
+		log.Println("* Removing the MPI configuration of the host from the environment of the job")
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = filterMPIEnv(cmd.Env, sysCfg.PMIEnv...)
+	}
 
 	return cmd, nil
 }
 
+// requiredConfigFiles are the configuration files that must be available in the etc directory
+var requiredConfigFiles = []string{implem.OMPI + ".conf", implem.MPICH + ".conf", implem.SY + ".conf"}
+
+// CheckEtcDir makes sure that a directory has the configuration files of the tool. A configuration
+// file can be replaced by its drop-in files.
+func CheckEtcDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("invalid configuration directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid configuration directory: %s is not a directory", dir)
+	}
+
+	var missing []string
+	for _, f := range requiredConfigFiles {
+		if !kv.ConfigExists(filepath.Join(dir, f)) {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("configuration file(s) %s missing from %s", strings.Join(missing, ", "), dir)
+	}
+	return nil
+}
+
 // Load gathers all the details to start running experiments or create containers for apps
 //
 // todo: should be in a different package (but where?)
@@ -69,44 +105,46 @@ func Load() (sys.Config, jm.JM, network.Info, error) {
 	/* Figure out the directory of this binary */
 	bin, err := os.Executable()
 	if err != nil {
-		return cfg, jobmgr, net, fmt.Errorf("cannot detect the directory of the binary")
+		return cfg, jobmgr, net, fmt.Errorf("cannot detect the directory of the binary: %w", err)
 	}
 	cfg.BinPath = filepath.Dir(bin)
-	cfg.EtcDir = filepath.Join(os.Getenv("GOPATH"), "src", "github.com", "sylabs", "singularity-mpi", "etc")
+	cfg.EtcDir = sys.GetEtcDir()
 	cfg.TemplateDir = filepath.Join(cfg.EtcDir, "templates")
 	cfg.OfiCfgFile = filepath.Join(cfg.EtcDir, "ofi.conf")
 	cfg.CurPath, err = os.Getwd()
 	if err != nil {
-		return cfg, jobmgr, net, fmt.Errorf("cannot detect current directory")
+		return cfg, jobmgr, net, fmt.Errorf("cannot detect current directory: %w", err)
 	}
 
 	cfg.SyConfigFile = sy.GetPathToSyMPIConfigFile()
 	if util.PathExists(cfg.SyConfigFile) {
 		kvs, err := kv.LoadKeyValueConfig(cfg.SyConfigFile)
 		if err != nil {
-			return cfg, jobmgr, net, fmt.Errorf("unable to load the tool's configuration: %s", err)
+			return cfg, jobmgr, net, fmt.Errorf("unable to load the tool's configuration: %w", err)
 		}
 		if kv.GetValue(kvs, slurm.EnabledKey) != "" {
 			cfg.SlurmEnabled, err = strconv.ParseBool(kv.GetValue(kvs, slurm.EnabledKey))
 			if err != nil {
-				return cfg, jobmgr, net, fmt.Errorf("failed to load the Slurm configuration: %s", err)
+				return cfg, jobmgr, net, fmt.Errorf("failed to load the Slurm configuration: %w", err)
 			}
 		}
 	} else {
 		log.Println("-> Creating configuration file...")
 		path, err := sy.CreateMPIConfigFile()
 		if err != nil {
-			return cfg, jobmgr, net, fmt.Errorf("failed to create configuration file: %s", err)
+			return cfg, jobmgr, net, fmt.Errorf("failed to create configuration file: %w", err)
 		}
 		log.Printf("... %s successfully created\n", path)
 	}
-	cfg.SingularityBin, err = exec.LookPath("singularity")
+	err = cfg.SetSingularityBin()
 	if err != nil {
-		log.Printf("[WARN] failed to find the Singularity binary")
+		log.Printf("[WARN] failed to find the Singularity binary: %s", err)
+	} else {
+		log.Printf("* Using %s (%s)", cfg.ContainerRuntime, cfg.SingularityBin)
 	}
 	cfg.SudoBin, err = exec.LookPath("sudo")
 	if err != nil {
-		return cfg, jobmgr, net, fmt.Errorf("sudo not available: %s", err)
+		return cfg, jobmgr, net, fmt.Errorf("sudo not available: %w", err)
 	}
 
 	// Parse and load the sympi configuration file
@@ -124,6 +162,150 @@ func Load() (sys.Config, jm.JM, network.Info, error) {
 	if val != "" {
 		cfg.SudoSyCmds = strings.Split(val, " ")
 	}
+	cfg.DownloadTimeout = sys.DefaultDownloadTimeout
+	val = kv.GetValue(sympiKVs, sy.DownloadTimeoutKey)
+	if val != "" {
+		cfg.DownloadTimeout, err = time.ParseDuration(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.DownloadTimeoutKey, err)
+		}
+	}
+	cfg.MPIConfigURL = kv.GetValue(sympiKVs, sy.MPIConfigURLKey)
+	if cfg.MPIConfigURL != "" && !kv.IsRemote(cfg.MPIConfigURL) {
+		return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %s is not a http(s) URL", sy.MPIConfigURLKey, cfg.MPIConfigURL)
+	}
+	cfg.MPIConfigTTL = kv.DefaultRemoteTTL
+	val = kv.GetValue(sympiKVs, sy.MPIConfigTTLKey)
+	if val != "" {
+		cfg.MPIConfigTTL, err = time.ParseDuration(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.MPIConfigTTLKey, err)
+		}
+	}
+	cfg.MPICompatPolicy = mpi.DefaultPolicy
+	val = kv.GetValue(sympiKVs, sy.MPICompatPolicyKey)
+	if val != "" {
+		err = mpi.CheckPolicy(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.MPICompatPolicyKey, err)
+		}
+		cfg.MPICompatPolicy = val
+	}
+	val = kv.GetValue(sympiKVs, sy.RunLayoutKey)
+	if val != "" {
+		err = sys.CheckRunLayout(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.RunLayoutKey, err)
+		}
+		cfg.RunLayout = val
+	}
+	val = kv.GetValue(sympiKVs, sy.PathOrderKey)
+	if val != "" {
+		err = sys.CheckPathOrder(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.PathOrderKey, err)
+		}
+		cfg.PathOrder = val
+	}
+	val = kv.GetValue(sympiKVs, sy.MPICHPMIKey)
+	if val != "" {
+		err = mpich.CheckPMI(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.MPICHPMIKey, err)
+		}
+		cfg.MPICHPMI = val
+	}
+	for _, h := range []struct {
+		key  string
+		hook *sys.Hook
+	}{{sy.PreInstallKey, &cfg.PreInstallHook}, {sy.PostInstallKey, &cfg.PostInstallHook}} {
+		h.hook.Cmd = kv.GetValue(sympiKVs, h.key)
+		val = kv.GetValue(sympiKVs, h.key+sy.BestEffortKeySuffix)
+		if val != "" {
+			h.hook.BestEffort, err = strconv.ParseBool(val)
+			if err != nil {
+				return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", h.key+sy.BestEffortKeySuffix, err)
+			}
+		}
+	}
+	cfg.ModulefilesDir = kv.GetValue(sympiKVs, sy.ModulefilesDirKey)
+	cfg.ModulefileFormat = modulefile.DefaultFormat
+	val = kv.GetValue(sympiKVs, sy.ModulefileFormatKey)
+	if val != "" {
+		err = modulefile.CheckFormat(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.ModulefileFormatKey, err)
+		}
+		cfg.ModulefileFormat = val
+	}
+	cfg.MapBy = kv.GetValue(sympiKVs, sy.MapByKey)
+	cfg.RankBy = kv.GetValue(sympiKVs, sy.RankByKey)
+	cfg.BindTo = kv.GetValue(sympiKVs, sy.BindToKey)
+	err = mpi.CheckAffinity(&cfg)
+	if err != nil {
+		return cfg, jobmgr, net, fmt.Errorf("invalid value for %s, %s or %s: %w", sy.MapByKey, sy.RankByKey, sy.BindToKey, err)
+	}
+	cfg.UCXTLS = kv.GetValue(sympiKVs, sy.UCXTLSKey)
+	cfg.OFIProvider = kv.GetValue(sympiKVs, sy.OFIProviderKey)
+	cfg.ExportEnv = ParseVarNames(kv.GetValue(sympiKVs, sy.ExportEnvKey))
+	cfg.SingularityCacheDir = kv.GetValue(sympiKVs, sy.SingularityCacheDirKey)
+	cfg.SingularityTmpDir = kv.GetValue(sympiKVs, sy.SingularityTmpDirKey)
+	val = kv.GetValue(sympiKVs, sy.SingularityMinFreeSpaceKey)
+	if val == "" {
+		val = sy.DefaultSingularityMinFreeSpace
+	}
+	cfg.SingularityMinFreeSpace, err = scratch.ParseSize(val)
+	if err != nil {
+		return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.SingularityMinFreeSpaceKey, err)
+	}
+	cfg.ScratchDirs = make(map[string]string)
+	for _, entry := range sympiKVs {
+		if strings.HasPrefix(entry.Key, sy.ScratchDirKeyPrefix) && entry.Value != "" {
+			cfg.ScratchDirs[strings.TrimPrefix(entry.Key, sy.ScratchDirKeyPrefix)] = entry.Value
+		}
+	}
+	val = kv.GetValue(sympiKVs, sy.ScratchMaxAgeKey)
+	if val != "" {
+		cfg.ScratchMaxAge, err = time.ParseDuration(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.ScratchMaxAgeKey, err)
+		}
+	}
+	val = kv.GetValue(sympiKVs, sy.CacheMaxSizeKey)
+	if val != "" {
+		cfg.CacheMaxSize, err = scratch.ParseSize(val)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", sy.CacheMaxSizeKey, err)
+		}
+	}
+	cfg.DefaultMpirunArgs = make(map[string][]string)
+	for _, id := range []string{implem.OMPI, implem.MPICH, implem.IMPI} {
+		args := strings.Fields(kv.GetValue(sympiKVs, id+sy.MpirunArgsKeySuffix))
+		if len(args) > 0 {
+			cfg.DefaultMpirunArgs[id] = args
+		}
+	}
+	cfg.PMIEnv, err = ParsePMIEnv(sympiKVs)
+	if err != nil {
+		return cfg, jobmgr, net, fmt.Errorf("invalid PMI environment: %w", err)
+	}
+	cfg.Profiles, err = ParseProfiles(sympiKVs)
+	if err != nil {
+		return cfg, jobmgr, net, fmt.Errorf("invalid profile: %w", err)
+	}
+
+	// The templates of job scripts are validated now so errors are reported before anything is started
+	cfg.JobTemplates = make(map[string]*template.Template)
+	for _, id := range jm.TemplateIDs {
+		path := kv.GetValue(sympiKVs, id+jm.TemplateKeySuffix)
+		if path == "" {
+			continue
+		}
+		cfg.JobTemplates[id], err = jm.LoadTemplate(path)
+		if err != nil {
+			return cfg, jobmgr, net, fmt.Errorf("invalid value for %s: %w", id+jm.TemplateKeySuffix, err)
+		}
+	}
 
 	// Load the job manager component first
 	jobmgr = jm.Detect()
@@ -142,7 +324,7 @@ func SaveErrorDetails(hostMPI *implem.Info, containerMPI *implem.Info, sysCfg *s
 	// If the directory exists, we delete it to start fresh
 	err := util.DirInit(targetDir)
 	if err != nil {
-		return fmt.Errorf("impossible to initialize directory %s: %s", targetDir, err)
+		return fmt.Errorf("impossible to initialize directory %s: %w", targetDir, err)
 	}
 
 	stderrFile := filepath.Join(targetDir, "stderr.txt")
@@ -171,8 +353,38 @@ func SaveErrorDetails(hostMPI *implem.Info, containerMPI *implem.Info, sysCfg *s
 	return nil
 }
 
-// Run executes a container with a specific version of MPI on the host
-func Run(appInfo *app.Info, hostMPI *mpi.Config, hostBuildEnv *buildenv.Info, containerMPI *mpi.Config, jobmgr *jm.JM, sysCfg *sys.Config) (results.Result, syexec.Result) {
+// Composition describes the auxiliary containers launched with the primary container,
+// all sharing the same allocation
+type Composition struct {
+	// NP is the number of ranks of the primary container; the default is used if 0
+	NP int64
+
+	// NTasksPerNode is the number of ranks per node (optional); the number of nodes is then
+	// derived from the number of ranks
+	NTasksPerNode int64
+
+	// Segments are the auxiliary containers
+	Segments []job.Segment
+
+	// HetComponents are the allocations of the containers when they do not share the same
+	// nodes (optional), one per container starting with the primary container
+	HetComponents []job.HetComponent
+
+	// Array makes the job a job array over the values of a parameter of the primary container
+	// (optional), only supported with Slurm
+	Array *job.Array
+}
+
+// Run executes a container with a specific version of MPI on the host. Cancelling the context
+// terminates the job submission or execution.
+func Run(ctx context.Context, appInfo *app.Info, hostMPI *mpi.Config, hostBuildEnv *buildenv.Info, containerMPI *mpi.Config, jobmgr *jm.JM, sysCfg *sys.Config) (results.Result, syexec.Result) {
+	return RunComposition(ctx, appInfo, hostMPI, hostBuildEnv, containerMPI, &Composition{}, jobmgr, sysCfg)
+}
+
+// RunComposition executes a primary container and a set of auxiliary containers within the
+// same job, using the MPMD syntax of mpirun. All the containers use the same version of MPI
+// on the host.
+func RunComposition(ctx context.Context, appInfo *app.Info, hostMPI *mpi.Config, hostBuildEnv *buildenv.Info, containerMPI *mpi.Config, comp *Composition, jobmgr *jm.JM, sysCfg *sys.Config) (results.Result, syexec.Result) {
 	var execRes syexec.Result
 	var expRes results.Result
 
@@ -181,39 +393,132 @@ func Run(appInfo *app.Info, hostMPI *mpi.Config, hostBuildEnv *buildenv.Info, co
 	mpiJob.HostCfg = &hostMPI.Implem
 	mpiJob.Container = &containerMPI.Container
 	mpiJob.App.BinPath = appInfo.BinPath
+	mpiJob.App.Args = appInfo.Args
+	mpiJob.App.WorkDir = appInfo.WorkDir
 	mpiJob.NNodes = 2
 	mpiJob.NP = 2
+	if comp.NP > 0 {
+		mpiJob.NP = comp.NP
+	}
+	if comp.NTasksPerNode > 0 {
+		mpiJob.NNodes = 0
+		mpiJob.NTasksPerNode = comp.NTasksPerNode
+	}
+	mpiJob.Segments = comp.Segments
+	mpiJob.HetComponents = comp.HetComponents
+	mpiJob.Array = comp.Array
+	if comp.Array != nil && comp.Array.Param == job.ArrayNP {
+		// The allocation is the one of the task with the most ranks
+		mpiJob.NP = comp.Array.GetMaxNP()
+	}
+	expRes.NP = int(mpiJob.NP)
+	expRes.NNodes = int(mpiJob.NNodes)
+	if nodes, _, err := job.GetAllocation(mpiJob.NNodes, mpiJob.NP, mpiJob.NTasksPerNode); err == nil {
+		expRes.NNodes = int(nodes)
+	}
+	if len(mpiJob.HetComponents) > 0 {
+		// The number of nodes is then the sum of the nodes of the components, unknown if a
+		// component relies on the default of the job manager
+		expRes.NNodes = 0
+		for _, c := range mpiJob.HetComponents {
+			if c.NNodes == 0 {
+				expRes.NNodes = 0
+				break
+			}
+			expRes.NNodes += int(c.NNodes)
+		}
+	}
+
+	// The transport providers are selected for all the containers of the job
+	providerEnv := network.GetProviderEnv(sysCfg)
+	if len(providerEnv) > 0 {
+		c := containerMPI.Container
+		c.Env = append(append([]string{}, providerEnv...), c.Env...)
+		mpiJob.Container = &c
+		mpiJob.Segments = make([]job.Segment, len(comp.Segments))
+		for i, s := range comp.Segments {
+			if s.Container != nil {
+				sc := *s.Container
+				sc.Env = append(append([]string{}, providerEnv...), sc.Env...)
+				s.Container = &sc
+			}
+			mpiJob.Segments[i] = s
+		}
+	}
+
+	// With the per-run layout, the script, output and errors of the run are saved in a directory
+	// of its own; the configuration of the run points to it
+	if sysCfg.RunLayout == sys.RunLayoutPerRun && sysCfg.RunDir == "" {
+		name := containerMPI.Container.Name
+		if name == "" {
+			name = appInfo.Name
+		}
+		dir, err := AllocateRunDir(GetRunsDir(), name, &hostMPI.Implem, time.Now())
+		if err != nil {
+			execRes.Err = fmt.Errorf("failed to allocate the directory of the run: %w", err)
+			expRes.Pass = false
+			return expRes, execRes
+		}
+		log.Printf("* Files of the run saved in %s", dir)
+		runCfg := *sysCfg
+		runCfg.RunDir = dir
+		sysCfg = &runCfg
+		expRes.RunDir = dir
+		defer func() {
+			err := saveRunOutput(dir, &execRes)
+			if err != nil {
+				log.Printf("[WARN] %s", err)
+			}
+		}()
+	}
 
 	// We submit the job
 	var submitCmd syexec.SyCmd
-	submitCmd, execRes.Err = prepareLaunchCmd(&mpiJob, jobmgr, hostBuildEnv, sysCfg)
+	submitCmd, execRes.Err = prepareLaunchCmd(ctx, &mpiJob, jobmgr, hostBuildEnv, sysCfg)
 	if execRes.Err != nil {
-		execRes.Err = fmt.Errorf("failed to prepare the launch command: %s", execRes.Err)
+		execRes.Err = fmt.Errorf("failed to prepare the launch command: %w", execRes.Err)
 		expRes.Pass = false
 		return expRes, execRes
 	}
 
-	var stdout, stderr bytes.Buffer
-	submitCmd.Cmd.Stdout = &stdout
-	submitCmd.Cmd.Stderr = &stderr
 	defer submitCmd.CancelFn()
 
+	// Singularity is started by the job, with the environment of the command submitting it
+	syEnv, envErr := sysCfg.GetSingularityEnv()
+	if envErr != nil {
+		execRes.Err = fmt.Errorf("failed to set the environment of Singularity: %w", envErr)
+		expRes.Pass = false
+		return expRes, execRes
+	}
+	if len(syEnv) > 0 {
+		if submitCmd.Env == nil {
+			submitCmd.Env = os.Environ()
+		}
+		submitCmd.Env = append(submitCmd.Env, syEnv...)
+	}
+
 	// Regex to catch errors where mpirun returns 0 but is known to have failed because displaying the help message
 	var re = regexp.MustCompile(`^(\n?)Usage:`)
 
-	err := submitCmd.Cmd.Run()
+	r := sys.WithExecOptions(sysCfg.GetRunner(), "", submitCmd.Env, false)
+	stdout, stderr, exitCode, err := r.Run(submitCmd.Ctx, submitCmd.BinPath, submitCmd.CmdArgs...)
 	// Get the command out/err
-	execRes.Stderr = stderr.String()
-	execRes.Stdout = stdout.String()
+	execRes.Stderr = stderr
+	execRes.Stdout = stdout
+	execRes.ExitCode = exitCode
 	// And add the job out/err (for when we actually use a real job manager such as Slurm)
 	execRes.Stdout += mpiJob.GetOutput(&mpiJob, sysCfg)
 	execRes.Stderr += mpiJob.GetError(&mpiJob, sysCfg)
-	if err != nil || submitCmd.Ctx.Err() == context.DeadlineExceeded || re.Match(stdout.Bytes()) {
-		log.Printf("[INFO] mpirun command failed - stdout: %s - stderr: %s - err: %s\n", stdout.String(), stderr.String(), err)
+	if err != nil || submitCmd.Ctx.Err() != nil || re.MatchString(stdout) {
+		log.Printf("[INFO] mpirun command failed - stdout: %s - stderr: %s - err: %s\n", stdout, stderr, err)
 		execRes.Err = err
+		if execRes.Err == nil {
+			// The context error reports a timeout or a cancellation
+			execRes.Err = submitCmd.Ctx.Err()
+		}
 		err = SaveErrorDetails(&hostMPI.Implem, &containerMPI.Implem, sysCfg, &execRes)
 		if err != nil {
-			execRes.Err = fmt.Errorf("impossible to cleanly handle error: %s", err)
+			execRes.Err = fmt.Errorf("impossible to cleanly handle error: %w", err)
 			expRes.Pass = false
 			return expRes, execRes
 		}
@@ -222,5 +527,14 @@ func Run(appInfo *app.Info, hostMPI *mpi.Config, hostBuildEnv *buildenv.Info, co
 	}
 
 	expRes.Pass = true
+	if mpiJob.GetUsage != nil {
+		var note string
+		expRes.Usage, note = mpiJob.GetUsage(&mpiJob, stdout, sysCfg)
+		if note != "" {
+			log.Printf("[INFO] resource usage not available: %s", note)
+			expRes.Note = note
+		}
+		expRes.Tasks = mpiJob.TaskUsages
+	}
 	return expRes, execRes
 }
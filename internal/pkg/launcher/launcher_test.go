@@ -0,0 +1,138 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/app"
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/jm"
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestCheckEtcDir(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "launcher-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = CheckEtcDir(filepath.Join(tempDir, "missing"))
+	if err == nil {
+		t.Fatalf("CheckEtcDir() succeeded with a missing directory")
+	}
+	err = CheckEtcDir(tempDir)
+	if err == nil {
+		t.Fatalf("CheckEtcDir() succeeded without configuration files")
+	}
+
+	for _, f := range requiredConfigFiles {
+		err := ioutil.WriteFile(filepath.Join(tempDir, f), nil, 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", f, err)
+		}
+	}
+	err = CheckEtcDir(tempDir)
+	if err != nil {
+		t.Fatalf("CheckEtcDir() failed: %s", err)
+	}
+
+	// The configuration files distributed with the tool
+	err = CheckEtcDir(filepath.Join("..", "..", "..", "etc"))
+	if err != nil {
+		t.Fatalf("CheckEtcDir() failed with the configuration files of the tool: %s", err)
+	}
+}
+
+// getEnvValue returns the value of a variable in an environment; the last definition prevails
+// as when executing a command
+func getEnvValue(env []string, name string) (string, bool) {
+	value, found := "", false
+	for _, v := range env {
+		if strings.HasPrefix(v, name+"=") {
+			value, found = strings.TrimPrefix(v, name+"="), true
+		}
+	}
+	return value, found
+}
+
+func TestPrepareLaunchCmdEnv(t *testing.T) {
+	mpiDir, err := ioutil.TempDir("", "launcher-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(mpiDir)
+	err = os.MkdirAll(filepath.Join(mpiDir, "bin"), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(mpiDir, "bin", "mpirun"), nil, 0755)
+	}
+	if err != nil {
+		t.Fatalf("failed to create the host MPI: %s", err)
+	}
+
+	btl, hasBTL := os.LookupEnv("OMPI_MCA_btl")
+	os.Setenv("OMPI_MCA_btl", "self")
+	defer func() {
+		if hasBTL {
+			os.Setenv("OMPI_MCA_btl", btl)
+		} else {
+			os.Unsetenv("OMPI_MCA_btl")
+		}
+	}()
+
+	tests := []struct {
+		name      string
+		model     container.Model
+		expectBTL bool
+	}{
+		{name: "hybrid", model: container.HybridModel, expectBTL: false},
+		{name: "bind", model: container.BindModel, expectBTL: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobmgr, err := jm.FromID(jm.NativeID)
+			if err != nil {
+				t.Fatalf("unable to select the native job manager: %s", err)
+			}
+			j := job.Job{
+				HostCfg:   &implem.Info{ID: implem.OMPI, Version: "4.0.2"},
+				Container: &container.Config{Name: "test", Path: "/tmp/test.sif", Model: tt.model},
+				App:       app.Info{Name: "test", BinPath: "/opt/test"},
+			}
+			env := buildenv.Info{InstallDir: mpiDir}
+			sysCfg := sys.Config{PMIEnv: []string{"PMIX_MCA_gds=hash"}}
+
+			cmd, err := prepareLaunchCmd(context.Background(), &j, &jobmgr, &env, &sysCfg)
+			if err != nil {
+				t.Fatalf("prepareLaunchCmd() failed: %s", err)
+			}
+			defer cmd.CancelFn()
+
+			if val, _ := getEnvValue(cmd.Env, "PMIX_MCA_gds"); val != "hash" {
+				t.Fatalf("PMIX_MCA_gds is %q instead of hash", val)
+			}
+			if val, _ := getEnvValue(cmd.Env, "PATH"); !strings.HasPrefix(val, filepath.Join(mpiDir, "bin")+":") {
+				t.Fatalf("PATH %s does not start with the bin directory of the MPI", val)
+			}
+			if val, _ := getEnvValue(cmd.Env, "LD_LIBRARY_PATH"); !strings.HasPrefix(val, filepath.Join(mpiDir, "lib")+":") {
+				t.Fatalf("LD_LIBRARY_PATH %s does not start with the lib directory of the MPI", val)
+			}
+			if _, found := getEnvValue(cmd.Env, "OMPI_MCA_btl"); found != tt.expectBTL {
+				t.Fatalf("OMPI_MCA_btl in the environment: %t, expected: %t", found, tt.expectBTL)
+			}
+		})
+	}
+}
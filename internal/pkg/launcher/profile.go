@@ -0,0 +1,98 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+	"github.com/sylabs/singularity-mpi/internal/pkg/util/sy"
+)
+
+// ParseProfiles gets the run profiles from the entries of the sympi configuration file. A
+// profile is a named set of settings of a container, using the keys of the run specs, e.g.:
+//
+//	profile.small.np = 4
+//	profile.small.nodes = 1
+//	profile.small.partition = debug
+//	profile.small.binds = /scratch:/scratch,/data:/data
+//
+// Lists, i.e., binds and env, are comma-separated.
+func ParseProfiles(kvs []kv.KV) (map[string]map[string]string, error) {
+	profiles := make(map[string]map[string]string)
+	for _, entry := range kvs {
+		if !strings.HasPrefix(entry.Key, sy.ProfileKeyPrefix) {
+			continue
+		}
+		words := strings.SplitN(strings.TrimPrefix(entry.Key, sy.ProfileKeyPrefix), ".", 2)
+		if len(words) != 2 || words[0] == "" || words[1] == "" {
+			return nil, fmt.Errorf("%s does not follow the %s<name>.<setting> format", entry.Key, sy.ProfileKeyPrefix)
+		}
+		if profiles[words[0]] == nil {
+			profiles[words[0]] = make(map[string]string)
+		}
+		profiles[words[0]][words[1]] = entry.Value
+	}
+
+	// The settings are checked now so errors are reported before anything is started
+	for name, settings := range profiles {
+		var c ContainerSpec
+		err := applySettings(&c, settings)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+
+	return profiles, nil
+}
+
+// applySettings applies the settings of a profile to a container
+func applySettings(c *ContainerSpec, settings map[string]string) error {
+	var keys []string
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var err error
+		switch k {
+		case "name":
+			err = fmt.Errorf("the container cannot be set by a profile")
+		case "binds", "env":
+			for _, val := range strings.Split(settings[k], ",") {
+				val = strings.TrimSpace(val)
+				if val == "" {
+					continue
+				}
+				err = c.addListValue(k, val)
+				if err != nil {
+					break
+				}
+			}
+		default:
+			err = c.setValue(k, settings[k])
+		}
+		if err != nil {
+			return fmt.Errorf("invalid setting %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// ApplyProfile applies the settings of a profile of the sympi configuration file to a container;
+// settings specified on the command line are expected to be applied afterwards so they take
+// precedence
+func ApplyProfile(c *ContainerSpec, name string, sysCfg *sys.Config) error {
+	settings, ok := sysCfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %s", name)
+	}
+	return applySettings(c, settings)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestApplyProfile(t *testing.T) {
+	tests := []struct {
+		name        string
+		kvs         []kv.KV
+		profile     string
+		expected    ContainerSpec
+		expectedErr bool
+	}{
+		{
+			name: "small",
+			kvs: []kv.KV{
+				{Key: "download_timeout", Value: "10m"},
+				{Key: "profile.small.np", Value: "4"},
+				{Key: "profile.small.nodes", Value: "1"},
+				{Key: "profile.small.partition", Value: "debug"},
+				{Key: "profile.small.binds", Value: "/scratch:/scratch, /data:/data"},
+				{Key: "profile.large.np", Value: "64"},
+			},
+			profile:  "small",
+			expected: ContainerSpec{Name: "mycontainer", NP: 4, Nodes: 1, Partition: "debug", Binds: []string{"/scratch:/scratch", "/data:/data"}},
+		},
+		{
+			name:        "unknown profile",
+			kvs:         []kv.KV{{Key: "profile.small.np", Value: "4"}},
+			profile:     "large",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid value",
+			kvs:         []kv.KV{{Key: "profile.small.np", Value: "four"}},
+			profile:     "small",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown setting",
+			kvs:         []kv.KV{{Key: "profile.small.ranks", Value: "4"}},
+			profile:     "small",
+			expectedErr: true,
+		},
+		{
+			name:        "container",
+			kvs:         []kv.KV{{Key: "profile.small.name", Value: "other"}},
+			profile:     "small",
+			expectedErr: true,
+		},
+		{
+			name:        "no setting",
+			kvs:         []kv.KV{{Key: "profile.small", Value: "4"}},
+			profile:     "small",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sysCfg sys.Config
+			var err error
+			sysCfg.Profiles, err = ParseProfiles(tt.kvs)
+			if err == nil {
+				c := ContainerSpec{Name: "mycontainer"}
+				err = ApplyProfile(&c, tt.profile, &sysCfg)
+				if err == nil && !reflect.DeepEqual(c, tt.expected) {
+					t.Fatalf("got %+v instead of %+v", c, tt.expected)
+				}
+			}
+			if tt.expectedErr && err == nil {
+				t.Fatalf("profile %s successfully applied", tt.profile)
+			}
+			if !tt.expectedErr && err != nil {
+				t.Fatalf("failed to apply profile %s: %s", tt.profile, err)
+			}
+		})
+	}
+}
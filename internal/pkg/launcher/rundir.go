@@ -0,0 +1,87 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/syexec"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+const (
+	// RunsDir is the name of the directory in the sympi directory where the directories of the
+	// runs are created with the per-run layout
+	RunsDir = "runs"
+
+	// RunStdoutFile is the name of the file of a run directory with the output of the run
+	RunStdoutFile = "stdout"
+
+	// RunStderrFile is the name of the file of a run directory with the errors of the run
+	RunStderrFile = "stderr"
+
+	// runDirTimeFormat is the format of the time in the name of the run directories
+	runDirTimeFormat = "20060102-150405"
+)
+
+// GetRunsDir returns the directory where the directories of the runs are created
+func GetRunsDir() string {
+	return filepath.Join(sys.GetSympiDir(), RunsDir)
+}
+
+// getRunDirContainerName returns the name of a container used in the name of its run
+// directories: containers run from the path to their image, e.g., ~/img/helloworld.sif, are
+// named after the image file, without extension
+func getRunDirContainerName(containerName string) string {
+	name := strings.TrimSuffix(filepath.Base(containerName), ".sif")
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return "container"
+	}
+	return name
+}
+
+// AllocateRunDir creates the directory of a run in a base directory, named after the container,
+// the host MPI and the time of the run, e.g., helloworld_openmpi-4.1.4_20191014-150405. Runs
+// started within the same second get a suffix so that each of them has its own directory.
+func AllocateRunDir(baseDir string, containerName string, hostMPI *implem.Info, t time.Time) (string, error) {
+	err := os.MkdirAll(baseDir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", baseDir, err)
+	}
+
+	name := strings.Join([]string{getRunDirContainerName(containerName), hostMPI.ID + "-" + hostMPI.Version, t.Format(runDirTimeFormat)}, "_")
+	dir := filepath.Join(baseDir, name)
+	for i := 1; ; i++ {
+		err = os.Mkdir(dir, 0755)
+		if err == nil {
+			return dir, nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		dir = filepath.Join(baseDir, name+"-"+strconv.Itoa(i))
+	}
+}
+
+// saveRunOutput saves the output of a run in its directory
+func saveRunOutput(dir string, execRes *syexec.Result) error {
+	err := ioutil.WriteFile(filepath.Join(dir, RunStdoutFile), []byte(execRes.Stdout), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save the output of the run: %w", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, RunStderrFile), []byte(execRes.Stderr), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save the errors of the run: %w", err)
+	}
+	return nil
+}
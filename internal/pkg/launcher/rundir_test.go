@@ -0,0 +1,56 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+)
+
+func TestAllocateRunDir(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(baseDir)
+	runsDir := filepath.Join(baseDir, RunsDir)
+
+	hostMPI := implem.Info{ID: implem.OMPI, Version: "4.1.4"}
+	start := time.Date(2019, time.October, 14, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		containerName string
+		time          time.Time
+		expectedDir   string
+	}{
+		{name: "first run", containerName: "helloworld", time: start, expectedDir: "helloworld_openmpi-4.1.4_20191014-150405"},
+		{name: "same second", containerName: "helloworld", time: start, expectedDir: "helloworld_openmpi-4.1.4_20191014-150405-1"},
+		{name: "next second", containerName: "helloworld", time: start.Add(time.Second), expectedDir: "helloworld_openmpi-4.1.4_20191014-150406"},
+		{name: "image path", containerName: "/home/user/img/netpipe.sif", time: start, expectedDir: "netpipe_openmpi-4.1.4_20191014-150405"},
+		{name: "relative image path", containerName: "img/netpipe.sif", time: start, expectedDir: "netpipe_openmpi-4.1.4_20191014-150405-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := AllocateRunDir(runsDir, tt.containerName, &hostMPI, tt.time)
+			if err != nil {
+				t.Fatalf("AllocateRunDir() failed: %s", err)
+			}
+			if dir != filepath.Join(runsDir, tt.expectedDir) {
+				t.Fatalf("run directory is %s instead of %s", dir, tt.expectedDir)
+			}
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				t.Fatalf("%s is not created", dir)
+			}
+		})
+	}
+}
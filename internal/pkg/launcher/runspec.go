@@ -0,0 +1,278 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+)
+
+// ContainerSpec describes one of the containers of a run spec
+type ContainerSpec struct {
+	// Name is the name of the container, as displayed by 'sympi -list'
+	Name string
+
+	// NP is the number of ranks to start in the container
+	NP int64
+
+	// Binds is the set of additional directories to bind-mount in the container
+	Binds []string
+
+	// Env is the set of environment variables (KEY=VALUE) to set in the container
+	Env []string
+
+	// WorkDir is the directory in the container from where the application is started
+	WorkDir string
+
+	// AppExe is the command to start in the container instead of the application of the image (optional)
+	AppExe string
+
+	// Nodes is the number of nodes allocated to the container (optional)
+	Nodes int64
+
+	// NTasksPerNode is the number of ranks per node of the container (optional); the number of
+	// nodes or ranks is then derived if not specified
+	NTasksPerNode int64
+
+	// Partition is the partition of the nodes allocated to the container (optional)
+	Partition string
+
+	// Constraint is the list of features of the nodes allocated to the container (optional)
+	Constraint string
+
+	// HostMPI is the host MPI to use with the container, e.g., openmpi:4.0.2; selected
+	// according to the compatibility policy if empty. Only used for the primary container.
+	HostMPI string
+
+	// Array runs the container as a job array, e.g., over the scales of -scales (optional); not
+	// available in run specs. Only used for the primary container.
+	Array *job.Array
+}
+
+// RunSpec describes a set of containers launched together within the same allocation.
+// The first container is the primary one, the other ones are auxiliary containers.
+//
+// Run specs are small YAML files with the following format:
+//
+//	containers:
+//	  - name: ubuntu-disco-openmpi-4.0.1-server-bind
+//	    np: 1
+//	    binds:
+//	      - /data:/data
+//	    env:
+//	      - MODE=server
+//	  - name: ubuntu-disco-openmpi-4.0.1-client-bind
+//	    np: 4
+//	    pwd: /opt/client
+//	    exe: /opt/client/bin/client
+//
+// When a container specifies nodes, partition or constraint, each container gets its own
+// allocation, i.e., the containers are started as a heterogeneous job. ntasks_per_node sets
+// the number of ranks per node, from which the number of nodes or ranks is derived when not
+// specified.
+//
+// Only the subset of YAML required by this format is supported.
+type RunSpec struct {
+	// Containers are the containers to launch, the first one being the primary container
+	Containers []ContainerSpec
+}
+
+// LoadRunSpec loads a run spec from a file
+func LoadRunSpec(path string) (*RunSpec, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	spec, err := parseRunSpec(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid run spec %s: %w", path, err)
+	}
+
+	return spec, nil
+}
+
+func getIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func stripComment(line string) string {
+	if strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return ""
+	}
+	idx := strings.Index(line, " #")
+	if idx >= 0 {
+		return line[:idx]
+	}
+	return line
+}
+
+func unquote(val string) string {
+	if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		return val[1 : len(val)-1]
+	}
+	return val
+}
+
+func (c *ContainerSpec) setValue(key string, val string) error {
+	switch key {
+	case "name":
+		c.Name = val
+	case "np":
+		np, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number of ranks %s: %w", val, err)
+		}
+		c.NP = np
+	case "nodes":
+		nodes, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number of nodes %s: %w", val, err)
+		}
+		c.Nodes = nodes
+	case "ntasks_per_node":
+		perNode, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number of ranks per node %s: %w", val, err)
+		}
+		c.NTasksPerNode = perNode
+	case "partition":
+		c.Partition = val
+	case "constraint":
+		c.Constraint = val
+	case "pwd":
+		c.WorkDir = val
+	case "exe":
+		c.AppExe = val
+	case "binds", "env":
+		if val != "" {
+			return fmt.Errorf("%s must be a list", key)
+		}
+	default:
+		return fmt.Errorf("unknown key %s", key)
+	}
+	return nil
+}
+
+func (c *ContainerSpec) addListValue(key string, val string) error {
+	switch key {
+	case "binds":
+		err := container.CheckBind(val)
+		if err != nil {
+			return err
+		}
+		c.Binds = append(c.Binds, val)
+	case "env":
+		c.Env = append(c.Env, val)
+	default:
+		return fmt.Errorf("%s is not a list", key)
+	}
+	return nil
+}
+
+func parseRunSpec(content string) (*RunSpec, error) {
+	spec := new(RunSpec)
+	var cur *ContainerSpec
+	curKey := ""
+	itemIndent := -1
+	inContainers := false
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := getIndent(line)
+		trimmed := strings.TrimSpace(line)
+
+		if indent == 0 {
+			if trimmed != "containers:" {
+				return nil, fmt.Errorf("line %d: unknown section %s", i+1, trimmed)
+			}
+			inContainers = true
+			continue
+		}
+		if !inContainers {
+			return nil, fmt.Errorf("line %d: unexpected content outside of a section", i+1)
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			item := strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if itemIndent == -1 {
+				itemIndent = indent
+			}
+			if indent > itemIndent && cur != nil && curKey != "" {
+				// Value of a list, e.g., a bind
+				err := cur.addListValue(curKey, unquote(item))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", i+1, err)
+				}
+				continue
+			}
+			if indent != itemIndent {
+				return nil, fmt.Errorf("line %d: invalid indentation", i+1)
+			}
+			// New container
+			spec.Containers = append(spec.Containers, ContainerSpec{})
+			cur = &spec.Containers[len(spec.Containers)-1]
+			curKey = ""
+			if item == "" {
+				continue
+			}
+			trimmed = item
+		} else if cur == nil {
+			return nil, fmt.Errorf("line %d: a container must start with '-'", i+1)
+		}
+
+		tokens := strings.SplitN(trimmed, ":", 2)
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("line %d: invalid format, 'key: value' expected", i+1)
+		}
+		curKey = strings.TrimSpace(tokens[0])
+		err := cur.setValue(curKey, unquote(strings.TrimSpace(tokens[1])))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+
+	if len(spec.Containers) == 0 {
+		return nil, fmt.Errorf("no container specified")
+	}
+	for _, c := range spec.Containers {
+		if c.Name == "" {
+			return nil, fmt.Errorf("container without a name")
+		}
+	}
+
+	return spec, nil
+}
+
+// GetHetComponents returns the allocations of a set of containers, the first one being the primary
+// container. Nil is returned if none of the containers specifies its own allocation, in which case
+// all the containers share the same allocation.
+func GetHetComponents(containers []ContainerSpec) []job.HetComponent {
+	heterogeneous := false
+	for _, c := range containers {
+		if c.Nodes > 0 || c.Partition != "" || c.Constraint != "" {
+			heterogeneous = true
+			break
+		}
+	}
+	if !heterogeneous {
+		return nil
+	}
+
+	var components []job.HetComponent
+	for _, c := range containers {
+		components = append(components, job.HetComponent{NNodes: c.Nodes, NTasksPerNode: c.NTasksPerNode, Partition: c.Partition, Constraint: c.Constraint})
+	}
+	return components
+}
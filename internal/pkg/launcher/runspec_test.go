@@ -0,0 +1,140 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+)
+
+func TestParseRunSpec(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    []ContainerSpec
+		expectedErr bool
+	}{
+		{
+			name: "client/server",
+			content: `# Example
+containers:
+  - name: server
+    np: 1
+    binds:
+      - /data:/data
+    env:
+      - MODE=server # comment
+  - name: "client"
+    np: 4
+    pwd: /opt/client
+`,
+			expected: []ContainerSpec{
+				{Name: "server", NP: 1, Binds: []string{"/data:/data"}, Env: []string{"MODE=server"}},
+				{Name: "client", NP: 4, WorkDir: "/opt/client"},
+			},
+		},
+		{
+			name: "heterogeneous",
+			content: `containers:
+  - name: ocean
+    np: 16
+    nodes: 4
+    partition: cpu
+  - name: atmosphere
+    np: 2
+    nodes: 1
+    ntasks_per_node: 2
+    constraint: gpu
+`,
+			expected: []ContainerSpec{
+				{Name: "ocean", NP: 16, Nodes: 4, Partition: "cpu"},
+				{Name: "atmosphere", NP: 2, Nodes: 1, NTasksPerNode: 2, Constraint: "gpu"},
+			},
+		},
+		{
+			name:     "read-only bind",
+			content:  "containers:\n  - name: test\n    binds:\n      - /ref:/ref:ro\n      - /out:/out:rw\n",
+			expected: []ContainerSpec{{Name: "test", Binds: []string{"/ref:/ref:ro", "/out:/out:rw"}}},
+		},
+		{
+			name:        "invalid bind mode",
+			content:     "containers:\n  - name: test\n    binds:\n      - /ref:/ref:readonly\n",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid nodes",
+			content:     "containers:\n  - name: test\n    nodes: all\n",
+			expectedErr: true,
+		},
+		{
+			name:        "empty",
+			content:     "containers:\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown key",
+			content:     "containers:\n  - name: test\n    foo: bar\n",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid np",
+			content:     "containers:\n  - name: test\n    np: two\n",
+			expectedErr: true,
+		},
+		{
+			name:        "missing name",
+			content:     "containers:\n  - np: 2\n",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseRunSpec(tt.content)
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatalf("parsing succeeded while expected to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsing failed: %s", err)
+			}
+			if !reflect.DeepEqual(spec.Containers, tt.expected) {
+				t.Fatalf("got %+v instead of %+v", spec.Containers, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetHetComponents(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []ContainerSpec
+		expected   []job.HetComponent
+	}{
+		{
+			name:       "shared allocation",
+			containers: []ContainerSpec{{Name: "server", NP: 1}, {Name: "client", NP: 4}},
+		},
+		{
+			name:       "heterogeneous",
+			containers: []ContainerSpec{{Name: "ocean", Nodes: 4, Partition: "cpu"}, {Name: "atmosphere", NTasksPerNode: 2, Constraint: "gpu"}},
+			expected:   []job.HetComponent{{NNodes: 4, Partition: "cpu"}, {NTasksPerNode: 2, Constraint: "gpu"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			components := GetHetComponents(tt.containers)
+			if !reflect.DeepEqual(components, tt.expected) {
+				t.Fatalf("got %+v instead of %+v", components, tt.expected)
+			}
+		})
+	}
+}
@@ -6,7 +6,6 @@
 package ldd
 
 import (
-	"bytes"
 	"context"
 	"log"
 	"os/exec"
@@ -49,7 +48,7 @@ func parseDpkgOutput(dependencies []string, output string) []string {
 
 // DebianGetDependencies parses the ldd output and figure out the required
 // dependencies in term of Debian packages
-func DebianGetDependencies(output string) []string {
+func DebianGetDependencies(output string, r sys.Runner) []string {
 	var dependencies []string
 
 	// Get path to dpkg
@@ -69,17 +68,13 @@ func DebianGetDependencies(output string) []string {
 		words := strings.Split(lines[i], " ")
 		words[0] = strings.Trim(words[0], " \t")
 		// Run dpkg -S <file>
-		cmd := exec.CommandContext(ctx, dpkgPath, "-S", words[0])
-		var dpkgStdout, dpkgStderr bytes.Buffer
-		cmd.Stdout = &dpkgStdout
-		cmd.Stderr = &dpkgStderr
-		err = cmd.Run()
+		dpkgStdout, dpkgStderr, _, err := r.Run(ctx, dpkgPath, "-S", words[0])
 		if err != nil {
-			log.Printf("dpkg returned an error for %s, skipping... (%s; stdout: %s; stderr: %s)", words[0], err, dpkgStdout.String(), dpkgStderr.String())
+			log.Printf("dpkg returned an error for %s, skipping... (%s; stdout: %s; stderr: %s)", words[0], err, dpkgStdout, dpkgStderr)
 			continue
 		}
 
-		dependencies = parseDpkgOutput(dependencies, dpkgStdout.String())
+		dependencies = parseDpkgOutput(dependencies, dpkgStdout)
 	}
 
 	return dependencies
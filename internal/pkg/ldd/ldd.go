@@ -6,7 +6,6 @@
 package ldd
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"log"
@@ -18,8 +17,9 @@ import (
 
 // GetDependenciesFn is a function "pointer" for a distribution-specific
 // function that parses the output of ldd and find the binary packages associated
-// to the dependencies expressed in the ldd output.
-type GetDependenciesFn func(string) []string
+// to the dependencies expressed in the ldd output, executing the commands it needs
+// through a runner.
+type GetDependenciesFn func(string, sys.Runner) []string
 
 // Module represents a distribution-specific module that can handle output
 // from ldd.
@@ -30,7 +30,7 @@ type Module struct {
 // GetPackageDependenciesForFile finds all the binary-package dependencies
 // for a specific file, by running ldd and the appropriate module for the
 // target linux distribution
-func (m *Module) GetPackageDependenciesForFile(file string) []string {
+func (m *Module) GetPackageDependenciesForFile(file string, sysCfg *sys.Config) []string {
 	var dependencies []string
 
 	// Get the path to ldd
@@ -43,18 +43,15 @@ func (m *Module) GetPackageDependenciesForFile(file string) []string {
 	// Run ldd against the binary
 	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, lddPath, file)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
+	r := sysCfg.GetRunner()
+	stdout, stderr, _, err := r.Run(ctx, lddPath, file)
 	if err != nil {
-		log.Printf("failed to execute dpkg: %s; stdout: %s; stderr: %s", err, stdout.String(), stderr.String())
+		log.Printf("failed to execute dpkg: %s; stdout: %s; stderr: %s", err, stdout, stderr)
 		return dependencies
 	}
 
 	// Parse the result
-	dependencies = m.GetDependencies(stdout.String())
+	dependencies = m.GetDependencies(stdout, r)
 
 	return dependencies
 }
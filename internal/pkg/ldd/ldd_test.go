@@ -23,7 +23,7 @@ func TestPackageDependenciesForFile(t *testing.T) {
 		t.Skipf("%s not available, skipping test", testBin)
 	}
 
-	packages := lddMod.GetPackageDependenciesForFile(testBin)
+	packages := lddMod.GetPackageDependenciesForFile(testBin, nil)
 	if len(packages) == 0 {
 		t.Fatal("We did not find any dependencies, which is not possible")
 	}
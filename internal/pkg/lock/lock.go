@@ -0,0 +1,85 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package lock
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+)
+
+const (
+	// FileName is the name of the lock file in the sympi directory
+	FileName = ".sympi.lock"
+
+	// DefaultTimeout is the default maximum time we wait for the lock
+	DefaultTimeout = 5 * time.Minute
+
+	// retryInterval is the time between two attempts to get the lock
+	retryInterval = 500 * time.Millisecond
+)
+
+// Lock is a file-based lock (flock) protecting the state of a sympi directory
+type Lock struct {
+	f *os.File
+}
+
+// Acquire gets the lock of a sympi directory, waiting for at most timeout. waitFn, if not nil,
+// is called once if the lock is held by another process and we need to wait.
+func Acquire(dir string, timeout time.Duration, waitFn func()) (*Lock, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, FileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			log.Printf("* Lock %s acquired", path)
+			return &Lock{f: f}, nil
+		}
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("gave up after %s: %w", timeout, sympierr.ErrLocked)
+		}
+		if !waiting && waitFn != nil {
+			waitFn()
+		}
+		waiting = true
+		time.Sleep(retryInterval)
+	}
+}
+
+// Release releases the lock
+func (l *Lock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	defer l.f.Close()
+	err := syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	l.f = nil
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package lock
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+)
+
+func TestAcquire(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "lock-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	l, err := Acquire(tempDir, time.Second, nil)
+	if err != nil {
+		t.Fatalf("failed to acquire lock: %s", err)
+	}
+
+	// flock locks are associated to open files, so a second acquisition conflicts
+	// with the first one even within the same process
+	waited := false
+	_, err = Acquire(tempDir, time.Second, func() { waited = true })
+	if !errors.Is(err, sympierr.ErrLocked) {
+		t.Fatalf("lock acquired twice: %v", err)
+	}
+	if !waited {
+		t.Fatalf("wait function was not called")
+	}
+
+	err = l.Release()
+	if err != nil {
+		t.Fatalf("failed to release lock: %s", err)
+	}
+	l, err = Acquire(tempDir, time.Second, nil)
+	if err != nil {
+		t.Fatalf("failed to acquire lock after release: %s", err)
+	}
+	l.Release()
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRunner(t *testing.T) {
+	r := &Runner{
+		Results: map[string]Result{
+			"sbatch": {Stdout: "Submitted batch job 42\n"},
+			"sacct":  {Stderr: "invalid job", ExitCode: 1},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		cmd      string
+		args     []string
+		stdout   string
+		stderr   string
+		exitCode int
+		fails    bool
+	}{
+		{name: "canned output", cmd: "/usr/bin/sbatch", args: []string{"job.sh"}, stdout: "Submitted batch job 42\n"},
+		{name: "failure", cmd: "sacct", args: []string{"-j", "42"}, stderr: "invalid job", exitCode: 1, fails: true},
+		{name: "no result", cmd: "make", args: []string{"install"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, exitCode, err := r.Run(context.Background(), tt.cmd, tt.args...)
+			if stdout != tt.stdout || stderr != tt.stderr || exitCode != tt.exitCode {
+				t.Fatalf("Run() returned (%q, %q, %d) instead of (%q, %q, %d)", stdout, stderr, exitCode, tt.stdout, tt.stderr, tt.exitCode)
+			}
+			if (err != nil) != tt.fails {
+				t.Fatalf("Run() returned %v", err)
+			}
+		})
+	}
+
+	expected := []string{"/usr/bin/sbatch job.sh", "sacct -j 42", "make install"}
+	if !reflect.DeepEqual(r.Calls(), expected) {
+		t.Fatalf("calls are %v instead of %v", r.Calls(), expected)
+	}
+}
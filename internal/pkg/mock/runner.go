@@ -0,0 +1,67 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package mock provides mocks of the external commands used by sympi, e.g., singularity or
+// sbatch, so the code interacting with them can be tested on systems where they are not installed.
+package mock
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// Result is the canned result of a command executed through a mock runner
+type Result struct {
+	// Stdout is the output the command displays on stdout
+	Stdout string
+
+	// Stderr is the output the command displays on stderr
+	Stderr string
+
+	// ExitCode is the exit code of the command; an error is returned when it is not 0
+	ExitCode int
+
+	// Err is the error returned when executing the command, e.g., to simulate a missing binary
+	Err error
+}
+
+// Runner is a sys.Runner recording the commands instead of executing them
+type Runner struct {
+	// Results are the results of the commands, indexed by the name of the binary, e.g., sbatch
+	// for /usr/bin/sbatch. Commands without result succeed without displaying anything.
+	Results map[string]Result
+
+	lock  sync.Mutex
+	calls []string
+}
+
+var _ sys.Runner = (*Runner)(nil)
+
+// Run records a command and returns its canned result
+func (r *Runner) Run(ctx context.Context, cmd string, args ...string) (string, string, int, error) {
+	r.lock.Lock()
+	r.calls = append(r.calls, strings.TrimSpace(cmd+" "+strings.Join(args, " ")))
+	r.lock.Unlock()
+
+	res := r.Results[filepath.Base(cmd)]
+	err := res.Err
+	if err == nil && res.ExitCode != 0 {
+		err = fmt.Errorf("exit status %d", res.ExitCode)
+	}
+	return res.Stdout, res.Stderr, res.ExitCode, err
+}
+
+// Calls returns the commands executed through the runner, one string per command with
+// the binary and its arguments
+func (r *Runner) Calls() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.calls...)
+}
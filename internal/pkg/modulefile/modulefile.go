@@ -0,0 +1,138 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package modulefile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+// Formats of the modulefiles
+const (
+	// TclFormat is the format supported by environment-modules and Lmod
+	TclFormat = "tcl"
+
+	// LuaFormat is the format of Lmod
+	LuaFormat = "lua"
+
+	// DefaultFormat is the format used when none is specified
+	DefaultFormat = TclFormat
+)
+
+// Data gathers the fields available to the templates of the modulefiles
+type Data struct {
+	// Name is the name of the module, i.e., the software, e.g., openmpi
+	Name string
+
+	// Version is the version of the software
+	Version string
+
+	// InstallDir is the directory where the software is installed
+	InstallDir string
+}
+
+const tclTemplate = `#%Module1.0
+##
+## {{.Name}} {{.Version}}, installed by sympi in {{.InstallDir}}
+##
+module-whatis "{{.Name}} {{.Version}}"
+conflict {{.Name}}
+
+prepend-path PATH {{.InstallDir}}/bin
+prepend-path LD_LIBRARY_PATH {{.InstallDir}}/lib
+prepend-path MANPATH {{.InstallDir}}/share/man
+`
+
+const luaTemplate = `-- {{.Name}} {{.Version}}, installed by sympi in {{.InstallDir}}
+whatis("{{.Name}} {{.Version}}")
+conflict("{{.Name}}")
+
+prepend_path("PATH", "{{.InstallDir}}/bin")
+prepend_path("LD_LIBRARY_PATH", "{{.InstallDir}}/lib")
+prepend_path("MANPATH", "{{.InstallDir}}/share/man")
+`
+
+var templates = map[string]*template.Template{
+	TclFormat: template.Must(template.New(TclFormat).Parse(tclTemplate)),
+	LuaFormat: template.Must(template.New(LuaFormat).Parse(luaTemplate)),
+}
+
+// CheckFormat makes sure that a format of modulefiles is supported
+func CheckFormat(format string) error {
+	if _, ok := templates[format]; !ok {
+		return fmt.Errorf("unknown modulefile format %q, supported formats are %s and %s", format, TclFormat, LuaFormat)
+	}
+	return nil
+}
+
+// GetPath returns the path to the modulefile of a software in a modulefiles directory, i.e.,
+// <dir>/<name>/<version> with the Tcl format and <dir>/<name>/<version>.lua with the Lua format
+func GetPath(dir string, format string, name string, version string) string {
+	path := filepath.Join(dir, name, version)
+	if format == LuaFormat {
+		path += ".lua"
+	}
+	return path
+}
+
+// Generate returns the content of a modulefile setting PATH, LD_LIBRARY_PATH and MANPATH for a software
+func Generate(format string, data *Data) (string, error) {
+	if format == "" {
+		format = DefaultFormat
+	}
+	err := CheckFormat(format)
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	err = templates[format].Execute(&content, data)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate the modulefile: %w", err)
+	}
+	return content.String(), nil
+}
+
+// Write creates the modulefile of a software in a modulefiles directory and returns its path
+func Write(dir string, format string, data *Data) (string, error) {
+	if format == "" {
+		format = DefaultFormat
+	}
+	content, err := Generate(format, data)
+	if err != nil {
+		return "", err
+	}
+
+	path := GetPath(dir, format, data.Name, data.Version)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	// Users may load the module while it is being written
+	err = util.WriteFileAtomic(path, []byte(content), 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// Remove removes the modulefile of a software from a modulefiles directory, if it exists
+func Remove(dir string, format string, name string, version string) error {
+	if format == "" {
+		format = DefaultFormat
+	}
+	path := GetPath(dir, format, name, version)
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package modulefile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteRemove(t *testing.T) {
+	tests := []struct {
+		format       string
+		expectedPath string
+		expected     []string
+	}{
+		{
+			format:       "",
+			expectedPath: filepath.Join("openmpi", "4.0.2"),
+			expected: []string{
+				"#%Module1.0\n",
+				"prepend-path PATH /opt/sympi/mpi_install_openmpi-4.0.2/bin\n",
+				"prepend-path LD_LIBRARY_PATH /opt/sympi/mpi_install_openmpi-4.0.2/lib\n",
+				"prepend-path MANPATH /opt/sympi/mpi_install_openmpi-4.0.2/share/man\n",
+			},
+		},
+		{
+			format:       LuaFormat,
+			expectedPath: filepath.Join("openmpi", "4.0.2.lua"),
+			expected: []string{
+				`prepend_path("PATH", "/opt/sympi/mpi_install_openmpi-4.0.2/bin")`,
+				`prepend_path("LD_LIBRARY_PATH", "/opt/sympi/mpi_install_openmpi-4.0.2/lib")`,
+				`prepend_path("MANPATH", "/opt/sympi/mpi_install_openmpi-4.0.2/share/man")`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expectedPath, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "modulefile")
+			if err != nil {
+				t.Fatalf("failed to create temporary directory: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			data := Data{Name: "openmpi", Version: "4.0.2", InstallDir: "/opt/sympi/mpi_install_openmpi-4.0.2"}
+			path, err := Write(dir, tt.format, &data)
+			if err != nil {
+				t.Fatalf("Write() failed: %s", err)
+			}
+			if path != filepath.Join(dir, tt.expectedPath) {
+				t.Fatalf("modulefile created in %s instead of %s", path, filepath.Join(dir, tt.expectedPath))
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", path, err)
+			}
+			for _, e := range tt.expected {
+				if !strings.Contains(string(content), e) {
+					t.Fatalf("%q is missing from the modulefile:\n%s", e, string(content))
+				}
+			}
+
+			err = Remove(dir, tt.format, data.Name, data.Version)
+			if err != nil {
+				t.Fatalf("Remove() failed: %s", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("%s still exists", path)
+			}
+			err = Remove(dir, tt.format, data.Name, data.Version)
+			if err != nil {
+				t.Fatalf("Remove() failed with a missing modulefile: %s", err)
+			}
+		})
+	}
+
+	_, err := Generate("yaml", &Data{Name: "openmpi"})
+	if err == nil {
+		t.Fatalf("Generate() succeeded with an invalid format")
+	}
+}
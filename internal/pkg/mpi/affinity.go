@@ -0,0 +1,266 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// The affinity of the ranks is specified with the syntax of the --map-by, --rank-by and --bind-to
+// options of Open MPI and translated for the other implementations and srun:
+//
+//	setting            Open MPI           MPICH                 Intel MPI                      srun
+//	map-by slot        --map-by slot      (default)             (default)                      --distribution=block
+//	map-by node        --map-by node      -rr                   -rr                            --distribution=cyclic
+//	map-by core        --map-by core      -map-by core          -                              --distribution=block
+//	map-by socket      --map-by socket    -map-by socket        -                              --distribution=block:cyclic
+//	map-by X:PE=n      --map-by X:PE=n    -                     -                              --cpus-per-task=n
+//	rank-by X          --rank-by X        -                     -                              -
+//	bind-to none       --bind-to none     -bind-to none         -genv I_MPI_PIN 0              --cpu-bind=none
+//	bind-to core       --bind-to core     -bind-to core         -genv I_MPI_PIN_DOMAIN core    --cpu-bind=cores
+//	bind-to socket     --bind-to socket   -bind-to socket       -genv I_MPI_PIN_DOMAIN socket  --cpu-bind=sockets
+//	bind-to numa       --bind-to numa     -bind-to numa         -genv I_MPI_PIN_DOMAIN numa    --cpu-bind=ldoms
+//
+// Settings without translation ("-") are refused rather than silently ignored.
+
+// AffinityNone is the binding leaving the ranks free to run on any CPU
+const AffinityNone = "none"
+
+// mappingObjects are the objects of the topology the ranks can be mapped on and ranked by
+var mappingObjects = []string{"slot", "hwthread", "core", "l1cache", "l2cache", "l3cache", "socket", "numa", "board", "node"}
+
+// bindingObjects are the objects of the topology the ranks can be bound to
+var bindingObjects = []string{AffinityNone, "hwthread", "core", "l1cache", "l2cache", "l3cache", "socket", "numa", "board"}
+
+// mappingModifiers, rankingModifiers and bindingModifiers are the modifiers, e.g., socket:span,
+// accepted by each option in addition to PE=n for the mapping
+var mappingModifiers = []string{"span", "oversubscribe", "nooversubscribe"}
+var rankingModifiers = []string{"span", "fill"}
+var bindingModifiers = []string{"overload-allowed", "if-supported"}
+
+// affinitySetting is a parsed affinity setting, e.g., ppr:2:socket:PE=4
+type affinitySetting struct {
+	object    string
+	ppr       int
+	pe        int
+	modifiers []string
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAffinitySetting parses the value of an affinity option, the PE and ppr forms being only
+// valid for the mapping
+func parseAffinitySetting(option string, value string, objects []string, modifiers []string) (affinitySetting, error) {
+	var s affinitySetting
+	tokens := strings.Split(value, ":")
+	if tokens[0] == "ppr" && option == "map-by" {
+		if len(tokens) < 3 {
+			return s, fmt.Errorf("invalid %s %s, it should be ppr:<N>:<object>", option, value)
+		}
+		n, err := strconv.Atoi(tokens[1])
+		if err != nil || n <= 0 {
+			return s, fmt.Errorf("invalid number of processes per resource in %s %s", option, value)
+		}
+		s.ppr = n
+		tokens = tokens[2:]
+	}
+	s.object = strings.ToLower(tokens[0])
+	if !contains(objects, s.object) {
+		return s, fmt.Errorf("invalid %s %s, the object should be one of %s", option, value, strings.Join(objects, ", "))
+	}
+	for _, m := range tokens[1:] {
+		if strings.HasPrefix(strings.ToUpper(m), "PE=") && option == "map-by" {
+			n, err := strconv.Atoi(m[len("PE="):])
+			if err != nil || n <= 0 {
+				return s, fmt.Errorf("invalid number of processing elements in %s %s", option, value)
+			}
+			s.pe = n
+			continue
+		}
+		if !contains(modifiers, strings.ToLower(m)) {
+			return s, fmt.Errorf("unsupported modifier %s in %s %s", m, option, value)
+		}
+		s.modifiers = append(s.modifiers, strings.ToLower(m))
+	}
+	return s, nil
+}
+
+// parseAffinity parses and validates the affinity settings of the configuration, unset settings
+// being left to MPI
+func parseAffinity(sysCfg *sys.Config) (mapBy, rankBy, bindTo *affinitySetting, err error) {
+	if sysCfg.MapBy != "" {
+		s, err := parseAffinitySetting("map-by", sysCfg.MapBy, mappingObjects, mappingModifiers)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		mapBy = &s
+	}
+	if sysCfg.RankBy != "" {
+		s, err := parseAffinitySetting("rank-by", sysCfg.RankBy, mappingObjects, rankingModifiers)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rankBy = &s
+	}
+	if sysCfg.BindTo != "" {
+		s, err := parseAffinitySetting("bind-to", sysCfg.BindTo, bindingObjects, bindingModifiers)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		bindTo = &s
+	}
+
+	// Several processing elements per rank only make sense when the rank is bound to them
+	if mapBy != nil && mapBy.pe > 0 && bindTo != nil && bindTo.object != "core" && bindTo.object != "hwthread" {
+		return nil, nil, nil, fmt.Errorf("map-by %s requires to bind to core or hwthread, not %s", sysCfg.MapBy, sysCfg.BindTo)
+	}
+	return mapBy, rankBy, bindTo, nil
+}
+
+// CheckAffinity checks that the affinity settings of the configuration are valid and consistent
+func CheckAffinity(sysCfg *sys.Config) error {
+	_, _, _, err := parseAffinity(sysCfg)
+	return err
+}
+
+// GetAffinityDesc returns a description of the affinity settings of the configuration, e.g.,
+// "map-by=socket bind-to=core" (empty when the affinity is left to MPI)
+func GetAffinityDesc(sysCfg *sys.Config) string {
+	var desc []string
+	if sysCfg.MapBy != "" {
+		desc = append(desc, "map-by="+sysCfg.MapBy)
+	}
+	if sysCfg.RankBy != "" {
+		desc = append(desc, "rank-by="+sysCfg.RankBy)
+	}
+	if sysCfg.BindTo != "" {
+		desc = append(desc, "bind-to="+sysCfg.BindTo)
+	}
+	return strings.Join(desc, " ")
+}
+
+func errUnsupportedAffinity(option string, value string, launcher string) error {
+	return fmt.Errorf("%s %s is not supported with %s", option, value, launcher)
+}
+
+// impiPinDomains are the Intel MPI pinning domains equivalent to the binding objects
+var impiPinDomains = map[string]string{"core": "core", "socket": "socket", "numa": "numa", "l1cache": "cache1", "l2cache": "cache2", "l3cache": "cache3"}
+
+// getHydraMapping returns the arguments of the Hydra process manager of MPICH and Intel MPI
+// to map the ranks
+func getHydraMapping(s *affinitySetting, value string, myHostMPICfg *implem.Info) ([]string, error) {
+	if s.ppr > 0 || s.pe > 0 || len(s.modifiers) > 0 {
+		return nil, errUnsupportedAffinity("map-by", value, myHostMPICfg.ID)
+	}
+	switch s.object {
+	case "slot":
+		return nil, nil
+	case "node":
+		return []string{"-rr"}, nil
+	}
+	if myHostMPICfg.ID == implem.IMPI {
+		return nil, errUnsupportedAffinity("map-by", value, myHostMPICfg.ID)
+	}
+	return []string{"-map-by", s.object}, nil
+}
+
+// GetAffinityArgs returns the mpirun arguments implementing the affinity settings of the configuration
+func GetAffinityArgs(myHostMPICfg *implem.Info, sysCfg *sys.Config) ([]string, error) {
+	mapBy, rankBy, bindTo, err := parseAffinity(sysCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if myHostMPICfg.ID == implem.OMPI {
+		if mapBy != nil {
+			args = append(args, "--map-by", sysCfg.MapBy)
+		}
+		if rankBy != nil {
+			args = append(args, "--rank-by", sysCfg.RankBy)
+		}
+		if bindTo != nil {
+			args = append(args, "--bind-to", sysCfg.BindTo)
+		}
+		return args, nil
+	}
+
+	if rankBy != nil {
+		return nil, errUnsupportedAffinity("rank-by", sysCfg.RankBy, myHostMPICfg.ID)
+	}
+	if mapBy != nil {
+		mapArgs, err := getHydraMapping(mapBy, sysCfg.MapBy, myHostMPICfg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, mapArgs...)
+	}
+	if bindTo != nil {
+		if len(bindTo.modifiers) > 0 {
+			return nil, errUnsupportedAffinity("bind-to", sysCfg.BindTo, myHostMPICfg.ID)
+		}
+		if myHostMPICfg.ID != implem.IMPI {
+			return append(args, "-bind-to", bindTo.object), nil
+		}
+		// Intel MPI pins the ranks based on its own variables
+		if bindTo.object == AffinityNone {
+			return append(args, "-genv", "I_MPI_PIN", "0"), nil
+		}
+		domain, ok := impiPinDomains[bindTo.object]
+		if !ok {
+			return nil, errUnsupportedAffinity("bind-to", sysCfg.BindTo, myHostMPICfg.ID)
+		}
+		args = append(args, "-genv", "I_MPI_PIN_DOMAIN", domain)
+	}
+	return args, nil
+}
+
+// srunDistributions and srunCPUBinds are the srun options equivalent to the mapping and binding objects
+var srunDistributions = map[string]string{"slot": "block", "hwthread": "block", "core": "block", "socket": "block:cyclic", "numa": "block:cyclic", "node": "cyclic"}
+var srunCPUBinds = map[string]string{AffinityNone: "none", "hwthread": "threads", "core": "cores", "socket": "sockets", "numa": "ldoms"}
+
+// GetSrunAffinityArgs returns the srun arguments implementing the affinity settings of the configuration
+func GetSrunAffinityArgs(sysCfg *sys.Config) ([]string, error) {
+	mapBy, rankBy, bindTo, err := parseAffinity(sysCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if rankBy != nil {
+		return nil, errUnsupportedAffinity("rank-by", sysCfg.RankBy, "srun")
+	}
+	if mapBy != nil {
+		distribution, ok := srunDistributions[mapBy.object]
+		if !ok || mapBy.ppr > 0 || len(mapBy.modifiers) > 0 {
+			return nil, errUnsupportedAffinity("map-by", sysCfg.MapBy, "srun")
+		}
+		args = append(args, "--distribution="+distribution)
+		if mapBy.pe > 0 {
+			args = append(args, "--cpus-per-task="+strconv.Itoa(mapBy.pe))
+		}
+	}
+	if bindTo != nil {
+		cpuBind, ok := srunCPUBinds[bindTo.object]
+		if !ok || len(bindTo.modifiers) > 0 {
+			return nil, errUnsupportedAffinity("bind-to", sysCfg.BindTo, "srun")
+		}
+		args = append(args, "--cpu-bind="+cpuBind)
+	}
+	return args, nil
+}
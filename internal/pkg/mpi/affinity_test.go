@@ -0,0 +1,87 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestCheckAffinity(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           sys.Config
+		expectedError bool
+	}{
+		{name: "default", cfg: sys.Config{}},
+		{name: "objects", cfg: sys.Config{MapBy: "socket", RankBy: "core", BindTo: "core"}},
+		{name: "modifiers", cfg: sys.Config{MapBy: "ppr:2:socket:PE=4", RankBy: "core:span", BindTo: "core:overload-allowed"}},
+		{name: "invalid object", cfg: sys.Config{MapBy: "rack"}, expectedError: true},
+		{name: "invalid modifier", cfg: sys.Config{BindTo: "core:span"}, expectedError: true},
+		{name: "invalid ppr", cfg: sys.Config{MapBy: "ppr:zero:socket"}, expectedError: true},
+		{name: "ppr only for mapping", cfg: sys.Config{BindTo: "ppr:2:socket"}, expectedError: true},
+		{name: "invalid processing elements", cfg: sys.Config{MapBy: "socket:PE=0"}, expectedError: true},
+		{name: "processing elements without binding", cfg: sys.Config{MapBy: "socket:PE=2", BindTo: "none"}, expectedError: true},
+		{name: "processing elements bound to socket", cfg: sys.Config{MapBy: "socket:PE=2", BindTo: "socket"}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckAffinity(&tt.cfg)
+			if tt.expectedError && err == nil {
+				t.Fatalf("invalid affinity accepted")
+			}
+			if !tt.expectedError && err != nil {
+				t.Fatalf("CheckAffinity() failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetAffinityArgs(t *testing.T) {
+	ompi := implem.Info{ID: implem.OMPI, Version: "4.1.4"}
+	mpich := implem.Info{ID: implem.MPICH, Version: "3.3"}
+	impi := implem.Info{ID: implem.IMPI, Version: "2019"}
+
+	tests := []struct {
+		name          string
+		mpi           implem.Info
+		cfg           sys.Config
+		expectedArgs  []string
+		expectedError bool
+	}{
+		{name: "default", mpi: ompi, cfg: sys.Config{}},
+		{name: "open mpi", mpi: ompi, cfg: sys.Config{MapBy: "ppr:2:socket", RankBy: "core", BindTo: "core"}, expectedArgs: []string{"--map-by", "ppr:2:socket", "--rank-by", "core", "--bind-to", "core"}},
+		{name: "mpich", mpi: mpich, cfg: sys.Config{MapBy: "socket", BindTo: "core"}, expectedArgs: []string{"-map-by", "socket", "-bind-to", "core"}},
+		{name: "mpich round robin", mpi: mpich, cfg: sys.Config{MapBy: "node"}, expectedArgs: []string{"-rr"}},
+		{name: "mpich ranking", mpi: mpich, cfg: sys.Config{RankBy: "core"}, expectedError: true},
+		{name: "mpich processing elements", mpi: mpich, cfg: sys.Config{MapBy: "socket:PE=2"}, expectedError: true},
+		{name: "intel mpi", mpi: impi, cfg: sys.Config{BindTo: "l3cache"}, expectedArgs: []string{"-genv", "I_MPI_PIN_DOMAIN", "cache3"}},
+		{name: "intel mpi without binding", mpi: impi, cfg: sys.Config{BindTo: "none"}, expectedArgs: []string{"-genv", "I_MPI_PIN", "0"}},
+		{name: "intel mpi mapping", mpi: impi, cfg: sys.Config{MapBy: "socket"}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := GetAffinityArgs(&tt.mpi, &tt.cfg)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("GetAffinityArgs() succeeded with %v", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetAffinityArgs() failed: %s", err)
+			}
+			if !reflect.DeepEqual(args, tt.expectedArgs) {
+				t.Fatalf("GetAffinityArgs() returned %v instead of %v", args, tt.expectedArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+)
+
+// Rules used to select a host MPI compatible with the MPI of a container, from the most to the least strict
+const (
+	// MatchExact is the rule selecting the same implementation and version
+	MatchExact = "exact"
+
+	// MatchSameMinor is the rule selecting the same implementation with the same major and minor versions
+	MatchSameMinor = "same-minor"
+
+	// MatchSameMajor is the rule selecting the same implementation with the same major version
+	MatchSameMajor = "same-major"
+
+	// MatchABIFamily is the rule selecting an implementation from the same ABI family, e.g., MPICH and Intel MPI
+	MatchABIFamily = "ABI-family"
+)
+
+// Policies specifying how strict the selection of a host MPI is
+const (
+	// PolicyExact only accepts the same version of MPI
+	PolicyExact = "exact"
+
+	// PolicyMinor accepts versions with the same major and minor versions
+	PolicyMinor = "minor"
+
+	// PolicyMajor accepts versions with the same major version, as well as implementations from the same ABI family
+	PolicyMajor = "major"
+
+	// DefaultPolicy is the policy used when none is specified
+	DefaultPolicy = PolicyMinor
+)
+
+// policyRules associates each policy to the rules it allows, from the most to the least strict
+var policyRules = map[string][]string{
+	PolicyExact: {MatchExact},
+	PolicyMinor: {MatchExact, MatchSameMinor},
+	PolicyMajor: {MatchExact, MatchSameMinor, MatchSameMajor, MatchABIFamily},
+}
+
+// CheckPolicy makes sure that a compatibility policy is valid
+func CheckPolicy(policy string) error {
+	if _, ok := policyRules[policy]; !ok {
+		return fmt.Errorf("unknown compatibility policy %q, supported policies are %s, %s and %s", policy, PolicyExact, PolicyMinor, PolicyMajor)
+	}
+	return nil
+}
+
+// abiFamilies associates an implementation of MPI to the name of its ABI family
+var abiFamilies = map[string]string{
+	implem.MPICH: "mpich",
+	implem.IMPI:  "mpich",
+}
+
+// MatchCandidate is a host MPI considered while looking for a MPI compatible with a container
+type MatchCandidate struct {
+	// MPI is the host MPI
+	MPI implem.Info
+
+	// Rule is the rule accepting the candidate, empty if the candidate is rejected
+	Rule string
+
+	// Reason explains why the candidate is rejected
+	Reason string
+}
+
+// MatchResult gathers the details of the selection of a host MPI compatible with a container
+type MatchResult struct {
+	// Target is the MPI of the container
+	Target implem.Info
+
+	// Policy is the compatibility policy used to accept candidates
+	Policy string
+
+	// Candidates is the list of host MPIs that were considered
+	Candidates []MatchCandidate
+
+	// Selected is the host MPI that was selected
+	Selected implem.Info
+
+	// Rule is the rule that selected the host MPI, empty if none was selected
+	Rule string
+}
+
+func getMajor(version string) string {
+	return strings.Split(version, ".")[0]
+}
+
+func getMinor(version string) string {
+	tokens := strings.Split(version, ".")
+	if len(tokens) < 2 {
+		return tokens[0]
+	}
+	return tokens[0] + "." + tokens[1]
+}
+
+// evaluateCandidate checks whether a host MPI is compatible with a target MPI. The variants of
+// a version, e.g., 4.1.4+gcc11, are compatible like the version itself.
+func evaluateCandidate(target implem.Info, candidate implem.Info, rules []string) MatchCandidate {
+	c := MatchCandidate{MPI: candidate}
+	candidateVersion, _ := implem.SplitVariant(candidate.Version)
+	targetVersion, _ := implem.SplitVariant(target.Version)
+	switch {
+	case candidate.ID == target.ID && candidateVersion == targetVersion:
+		c.Rule = MatchExact
+	case candidate.ID == target.ID && getMinor(candidateVersion) == getMinor(targetVersion):
+		c.Rule = MatchSameMinor
+	case candidate.ID == target.ID && getMajor(candidateVersion) == getMajor(targetVersion):
+		c.Rule = MatchSameMajor
+	case candidate.ID == target.ID:
+		c.Reason = "different major version"
+	case abiFamilies[candidate.ID] != "" && abiFamilies[candidate.ID] == abiFamilies[target.ID]:
+		c.Rule = MatchABIFamily
+	default:
+		c.Reason = "different implementation"
+	}
+
+	if c.Rule != "" {
+		allowed := false
+		for _, r := range rules {
+			if r == c.Rule {
+				allowed = true
+			}
+		}
+		if !allowed {
+			c.Reason = c.Rule + " match not allowed by the policy"
+			c.Rule = ""
+		}
+	}
+	return c
+}
+
+// CheckCompatibility evaluates whether a host MPI can be used with a container using a given MPI,
+// according to a compatibility policy (DefaultPolicy if empty)
+func CheckCompatibility(target implem.Info, hostMPI implem.Info, policy string) MatchCandidate {
+	if policy == "" {
+		policy = DefaultPolicy
+	}
+	return evaluateCandidate(target, hostMPI, policyRules[policy])
+}
+
+// isPreferred checks whether a version is preferred over another one matching with the same
+// rule: the most recent version and, for the same version, the default build over a variant
+func isPreferred(version string, other string) bool {
+	v1, variant1 := implem.SplitVariant(version)
+	v2, variant2 := implem.SplitVariant(other)
+	cmp := implem.CompareVersions(v1, v2)
+	return cmp > 0 || (cmp == 0 && variant1 == "" && variant2 != "")
+}
+
+// isBetterMatch checks whether a version matching with the rule of index rule is a better match
+// than the selected version, matching with the rule of index selectedRule (none if empty). Debug
+// builds are meant for troubleshooting, the optimized builds are preferred over them whatever
+// the rule; otherwise the strictest rule wins, then the preferred version.
+func isBetterMatch(version string, rule int, selected string, selectedRule int) bool {
+	if selected == "" {
+		return true
+	}
+	if debug := implem.IsDebugVersion(version); debug != implem.IsDebugVersion(selected) {
+		return !debug
+	}
+	return rule < selectedRule || (rule == selectedRule && isPreferred(version, selected))
+}
+
+// MatchHostMPI selects among the host MPIs the one to use with a container using a given MPI,
+// only accepting the candidates allowed by the compatibility policy (DefaultPolicy if empty).
+// The strictest rule wins and, for a given rule, the most recent version is selected, the
+// default build of a version being preferred over its variants. Debug builds are only selected
+// when no optimized build is compatible.
+func MatchHostMPI(target implem.Info, hostMPIs []implem.Info, policy string) MatchResult {
+	if policy == "" {
+		policy = DefaultPolicy
+	}
+	result := MatchResult{Target: target, Policy: policy}
+	rules := policyRules[policy]
+	bestRule := len(rules)
+	for _, hostMPI := range hostMPIs {
+		c := evaluateCandidate(target, hostMPI, rules)
+		result.Candidates = append(result.Candidates, c)
+		for i, r := range rules {
+			if c.Rule != r {
+				continue
+			}
+			if isBetterMatch(hostMPI.Version, i, result.Selected.Version, bestRule) {
+				bestRule = i
+				result.Selected = hostMPI
+				result.Rule = r
+			}
+		}
+	}
+	return result
+}
+
+// Explain returns a human-readable description of how the host MPI was selected
+func (r *MatchResult) Explain() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Container MPI: %s %s\n", r.Target.ID, r.Target.Version)
+	fmt.Fprintf(&sb, "Compatibility policy: %s\n", r.Policy)
+	if len(r.Candidates) == 0 {
+		sb.WriteString("No MPI installed on the host\n")
+	} else {
+		sb.WriteString("Host MPI installs considered:\n")
+		for _, c := range r.Candidates {
+			if c.Rule != "" {
+				fmt.Fprintf(&sb, "\t%s %s: accepted (%s)\n", c.MPI.ID, c.MPI.Version, c.Rule)
+			} else {
+				fmt.Fprintf(&sb, "\t%s %s: rejected (%s)\n", c.MPI.ID, c.MPI.Version, c.Reason)
+			}
+		}
+	}
+	if r.Rule == "" {
+		sb.WriteString("No compatible host MPI\n")
+	} else {
+		fmt.Fprintf(&sb, "Selected: %s %s (rule: %s)\n", r.Selected.ID, r.Selected.Version, r.Rule)
+	}
+	return sb.String()
+}
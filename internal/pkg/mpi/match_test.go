@@ -0,0 +1,143 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpi
+
+import (
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+)
+
+func TestMatchHostMPI(t *testing.T) {
+	hostMPIs := []implem.Info{
+		{ID: implem.OMPI, Version: "3.1.4"},
+		{ID: implem.OMPI, Version: "4.0.1"},
+		{ID: implem.OMPI, Version: "4.0.10"},
+		{ID: implem.OMPI, Version: "4.0.2+gcc11"},
+		{ID: implem.OMPI, Version: "4.0.2"},
+		{ID: implem.OMPI, Version: "3.1.5+intel"},
+		{ID: implem.OMPI, Version: "3.1.5+debug"},
+		{ID: implem.OMPI, Version: "4.0.12+debug"},
+		{ID: implem.OMPI, Version: "5.0.0+debug"},
+		{ID: implem.IMPI, Version: "2019.6"},
+	}
+
+	tests := []struct {
+		name            string
+		target          implem.Info
+		policy          string
+		expectedVersion string
+		expectedRule    string
+	}{
+		{
+			name:            "exact",
+			target:          implem.Info{ID: implem.OMPI, Version: "4.0.2"},
+			expectedVersion: "4.0.2",
+			expectedRule:    MatchExact,
+		},
+		{
+			name:            "variant",
+			target:          implem.Info{ID: implem.OMPI, Version: "3.1.5"},
+			policy:          PolicyExact,
+			expectedVersion: "3.1.5+intel",
+			expectedRule:    MatchExact,
+		},
+		{
+			name:            "optimized build over debug build",
+			target:          implem.Info{ID: implem.OMPI, Version: "4.0.12"},
+			expectedVersion: "4.0.10",
+			expectedRule:    MatchSameMinor,
+		},
+		{
+			name:            "debug build",
+			target:          implem.Info{ID: implem.OMPI, Version: "5.0.1"},
+			expectedVersion: "5.0.0+debug",
+			expectedRule:    MatchSameMinor,
+		},
+		{
+			name:            "exact policy",
+			target:          implem.Info{ID: implem.OMPI, Version: "4.0.3"},
+			policy:          PolicyExact,
+			expectedVersion: "",
+			expectedRule:    "",
+		},
+		{
+			name:            "same minor",
+			target:          implem.Info{ID: implem.OMPI, Version: "4.0.3"},
+			expectedVersion: "4.0.10",
+			expectedRule:    MatchSameMinor,
+		},
+		{
+			name:            "minor policy",
+			target:          implem.Info{ID: implem.OMPI, Version: "4.1.0"},
+			policy:          PolicyMinor,
+			expectedVersion: "",
+			expectedRule:    "",
+		},
+		{
+			name:            "same major",
+			target:          implem.Info{ID: implem.OMPI, Version: "4.1.0"},
+			policy:          PolicyMajor,
+			expectedVersion: "4.0.10",
+			expectedRule:    MatchSameMajor,
+		},
+		{
+			name:            "abi family",
+			target:          implem.Info{ID: implem.MPICH, Version: "3.3"},
+			policy:          PolicyMajor,
+			expectedVersion: "2019.6",
+			expectedRule:    MatchABIFamily,
+		},
+		{
+			name:            "no match",
+			target:          implem.Info{ID: implem.OMPI, Version: "2.1.0"},
+			policy:          PolicyMajor,
+			expectedVersion: "",
+			expectedRule:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := MatchHostMPI(tt.target, hostMPIs, tt.policy)
+			if res.Rule != tt.expectedRule || res.Selected.Version != tt.expectedVersion {
+				t.Fatalf("selected %s with rule %q instead of %s with rule %q:\n%s", res.Selected.Version, res.Rule, tt.expectedVersion, tt.expectedRule, res.Explain())
+			}
+			if len(res.Candidates) != len(hostMPIs) {
+				t.Fatalf("%d candidates considered instead of %d", len(res.Candidates), len(hostMPIs))
+			}
+		})
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	hostMPI := implem.Info{ID: implem.OMPI, Version: "4.1.4"}
+
+	tests := []struct {
+		name         string
+		target       implem.Info
+		policy       string
+		expectedRule string
+	}{
+		{name: "exact", target: implem.Info{ID: implem.OMPI, Version: "4.1.4"}, expectedRule: MatchExact},
+		{name: "same minor", target: implem.Info{ID: implem.OMPI, Version: "4.1.2"}, expectedRule: MatchSameMinor},
+		{name: "same minor with exact policy", target: implem.Info{ID: implem.OMPI, Version: "4.1.2"}, policy: PolicyExact},
+		{name: "same major", target: implem.Info{ID: implem.OMPI, Version: "4.0.2"}, policy: PolicyMajor, expectedRule: MatchSameMajor},
+		{name: "different implementation", target: implem.Info{ID: implem.MPICH, Version: "3.3"}, policy: PolicyMajor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := CheckCompatibility(tt.target, hostMPI, tt.policy)
+			if c.Rule != tt.expectedRule {
+				t.Fatalf("compatible with rule %q instead of %q (%s)", c.Rule, tt.expectedRule, c.Reason)
+			}
+			if c.Rule == "" && c.Reason == "" {
+				t.Fatalf("incompatibility is not explained")
+			}
+		})
+	}
+}
@@ -6,14 +6,22 @@
 package mpi
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/sylabs/singularity-mpi/internal/pkg/app"
 	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
 	"github.com/sylabs/singularity-mpi/internal/pkg/container"
 	"github.com/sylabs/singularity-mpi/internal/pkg/impi"
 	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+	"github.com/sylabs/singularity-mpi/internal/pkg/kv"
 	"github.com/sylabs/singularity-mpi/internal/pkg/openmpi"
 	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 )
@@ -42,6 +50,20 @@ func GetPathToMpirun(mpiCfg *implem.Info, env *buildenv.Info) string {
 	return filepath.Join(env.InstallDir, "bin", "mpirun")
 }
 
+// GetPathToLauncher returns the path to the command starting the ranks with a MPI installation:
+// mpirun or, for installations only providing it, mpiexec. An error naming the installation
+// directory is returned when neither can be found, e.g., for a broken installation.
+func GetPathToLauncher(mpiCfg *implem.Info, env *buildenv.Info) (string, error) {
+	mpirun := GetPathToMpirun(mpiCfg, env)
+	binDir := filepath.Dir(mpirun)
+	for _, path := range []string{mpirun, filepath.Join(binDir, "mpiexec")} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("neither mpirun nor mpiexec found in %s, the installation in %s is incomplete or broken", binDir, env.InstallDir)
+}
+
 func getBindArguments(hostMPI *implem.Info, hostBuildenv *buildenv.Info, c *container.Config) []string {
 	var bindArgs []string
 
@@ -52,25 +74,234 @@ func getBindArguments(hostMPI *implem.Info, hostBuildenv *buildenv.Info, c *cont
 		bindStr := hostBuildenv.InstallDir + ":" + c.MPIDir
 		bindArgs = append(bindArgs, bindStr)
 	}
+	bindArgs = append(bindArgs, c.Binds...)
 
 	return bindArgs
 }
 
-// GetMpirunArgs returns the arguments required by a mpirun
-func GetMpirunArgs(myHostMPICfg *implem.Info, hostBuildEnv *buildenv.Info, app *app.Info, syContainer *container.Config, sysCfg *sys.Config) ([]string, error) {
-	args := []string{"singularity", "exec"}
+// getCompilerEnv returns the environment variables that make the compiler wrappers used in a
+// container target the MPI bind-mounted from the host, e.g., for images compiling code at runtime
+func getCompilerEnv(hostMPI *implem.Info, c *container.Config) []string {
+	if c.Model != container.BindModel || c.MPIDir == "" {
+		return nil
+	}
+
+	binDir := filepath.Join(c.MPIDir, "bin")
+	env := []string{
+		"MPICC=" + filepath.Join(binDir, "mpicc"),
+		"MPICXX=" + filepath.Join(binDir, "mpicxx"),
+		"MPIFC=" + filepath.Join(binDir, "mpifort"),
+	}
+	if hostMPI.ID == implem.OMPI {
+		// Open MPI is mounted in a different directory than where it has been installed on the host:
+		// its wrappers need to know where to find their data files, and so does the library to find
+		// its components, which is why the variable is set for the application as well
+		env = append(env, "OPAL_PREFIX="+c.MPIDir)
+	}
+
+	return env
+}
+
+// getPathEnv returns the variable, without the prefix of the runtime, that makes the runtime
+// prepend the bin directory of the MPI bind-mounted from the host to the PATH of the container,
+// so the wrappers and mpirun can be called by name; env cannot do it since the default PATH of
+// the container is not known outside of it
+func getPathEnv(c *container.Config) string {
+	if c.Model != container.BindModel || c.MPIDir == "" {
+		return ""
+	}
+	return "PREPEND_PATH=" + filepath.Join(c.MPIDir, "bin")
+}
+
+// getRuntimeEnvPrefix returns the prefix of the host variables that the runtime sets in the container
+func getRuntimeEnvPrefix(sysCfg *sys.Config) string {
+	if sysCfg.ContainerRuntime == sys.ApptainerRuntime {
+		return "APPTAINERENV_"
+	}
+	return "SINGULARITYENV_"
+}
+
+// getRuntime returns the name of the container runtime; the command is executed by mpirun,
+// potentially on other nodes, so we use the name of the runtime rather than its path
+func getRuntime(sysCfg *sys.Config) string {
+	if sysCfg.ContainerRuntime != "" {
+		return sysCfg.ContainerRuntime
+	}
+	return sys.SingularityRuntime
+}
+
+// getContainerOptions returns the options of the singularity command starting a container
+func getContainerOptions(myHostMPICfg *implem.Info, hostBuildEnv *buildenv.Info, app *app.Info, syContainer *container.Config, sysCfg *sys.Config) []string {
+	var args []string
 
 	if sysCfg.Nopriv {
 		args = append(args, "-u")
 	}
 
+	if sysCfg.CleanEnv {
+		args = append(args, "--cleanenv")
+	}
+	if sysCfg.ContainAll {
+		args = append(args, "--containall")
+	}
+
+	args = append(args, container.GetGPUArgs(syContainer)...)
+
 	bindArgs := getBindArguments(myHostMPICfg, hostBuildEnv, syContainer)
 	if len(bindArgs) > 0 {
-		args = append(args, "--bind")
-		args = append(args, bindArgs...)
+		args = append(args, "--bind", strings.Join(bindArgs, ","))
+	}
+
+	if app.WorkDir != "" {
+		args = append(args, "--pwd", app.WorkDir)
+	}
+
+	return args
+}
+
+// getContainerEnv returns the environment variables specific to a container
+func getContainerEnv(myHostMPICfg *implem.Info, syContainer *container.Config) []string {
+	// The container's own environment comes last so it can overwrite the compiler settings
+	return append(getCompilerEnv(myHostMPICfg, syContainer), syContainer.Env...)
+}
+
+// GetContainerCmd returns the command that mpirun needs to execute to start the application
+// in a container, i.e., the singularity command and its arguments, preceded in the bind model
+// by the variable making the runtime prepend the MPI of the host to the PATH of the container
+func GetContainerCmd(myHostMPICfg *implem.Info, hostBuildEnv *buildenv.Info, app *app.Info, syContainer *container.Config, sysCfg *sys.Config) []string {
+	var args []string
+	if pathEnv := getPathEnv(syContainer); pathEnv != "" {
+		args = append(args, "env", getRuntimeEnvPrefix(sysCfg)+pathEnv)
+	}
+	args = append(args, getRuntime(sysCfg), "exec")
+	args = append(args, getContainerOptions(myHostMPICfg, hostBuildEnv, app, syContainer, sysCfg)...)
+	args = append(args, syContainer.Path)
+
+	// Environment variables specific to the container are set with env, which is available in
+	// all images and does not require a recent version of Singularity
+	containerEnv := getContainerEnv(myHostMPICfg, syContainer)
+	if len(containerEnv) > 0 {
+		args = append(args, "env")
+		args = append(args, containerEnv...)
+	}
+
+	args = append(args, app.BinPath)
+	return append(args, app.Args...)
+}
+
+// GetShellCmd returns the command starting an interactive shell in a container set up like for
+// running its application, i.e., with the same binds and environment, and the environment
+// variables passing the environment specific to the container to the runtime
+func GetShellCmd(myHostMPICfg *implem.Info, hostBuildEnv *buildenv.Info, app *app.Info, syContainer *container.Config, sysCfg *sys.Config) ([]string, []string) {
+	args := []string{getRuntime(sysCfg), "shell"}
+	args = append(args, getContainerOptions(myHostMPICfg, hostBuildEnv, app, syContainer, sysCfg)...)
+	args = append(args, syContainer.Path)
+
+	// A shell cannot be started with env, the runtime sets the variables with its own prefix instead
+	prefix := getRuntimeEnvPrefix(sysCfg)
+	var env []string
+	if pathEnv := getPathEnv(syContainer); pathEnv != "" {
+		env = append(env, prefix+pathEnv)
+	}
+	for _, e := range getContainerEnv(myHostMPICfg, syContainer) {
+		env = append(env, prefix+e)
+	}
+
+	return args, env
+}
+
+// GetNPFlag returns the mpirun option to specify the number of ranks
+func GetNPFlag(myHostMPICfg *implem.Info) string {
+	switch myHostMPICfg.ID {
+	case implem.OMPI:
+		return "-np"
+	default:
+		// MPICH and Intel MPI rely on Hydra
+		return "-n"
+	}
+}
+
+// GetLabelFlag returns the mpirun option prefixing each line of the output with the rank that displayed it
+func GetLabelFlag(myHostMPICfg *implem.Info) string {
+	switch myHostMPICfg.ID {
+	case implem.OMPI:
+		return "--tag-output"
+	default:
+		// MPICH and Intel MPI rely on Hydra
+		return "-prepend-rank"
+	}
+}
+
+// keyedMpirunOptions are the mpirun options that can be repeated with different keys, e.g.,
+// --mca <param> <value>; the key is then part of the identity of the option
+var keyedMpirunOptions = map[string]bool{"mca": true, "gmca": true, "x": true, "genv": true, "env": true}
+
+// splitMpirunOptions splits mpirun arguments into options, i.e., a flag followed by its values
+func splitMpirunOptions(args []string) [][]string {
+	var opts [][]string
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") || len(opts) == 0 {
+			opts = append(opts, []string{a})
+			continue
+		}
+		opts[len(opts)-1] = append(opts[len(opts)-1], a)
+	}
+	return opts
+}
+
+// getMpirunOptionID returns the identity of a mpirun option, used to detect conflicting options:
+// the flag without its dashes and, for keyed options, the key, e.g., "mca btl"
+func getMpirunOptionID(opt []string) string {
+	id := strings.TrimLeft(opt[0], "-")
+	if keyedMpirunOptions[id] && len(opt) > 1 {
+		id += " " + strings.SplitN(opt[1], "=", 2)[0]
+	}
+	return id
+}
+
+// MergeMpirunArgs merges the default mpirun arguments of a MPI implementation with the arguments
+// of a run. The arguments of the run come last; when they set an option that is also set by the
+// default arguments, e.g., --mca btl, the option and its values are dropped from the defaults.
+func MergeMpirunArgs(defaults []string, args []string) []string {
+	overridden := make(map[string]bool)
+	for _, opt := range splitMpirunOptions(args) {
+		overridden[getMpirunOptionID(opt)] = true
+	}
+
+	var merged []string
+	for _, opt := range splitMpirunOptions(defaults) {
+		if overridden[getMpirunOptionID(opt)] {
+			log.Printf("* default mpirun option %s overridden", strings.Join(opt, " "))
+			continue
+		}
+		merged = append(merged, opt...)
+	}
+	return append(merged, args...)
+}
+
+// GetMpirunArgs returns the arguments required by a mpirun. When segments are specified, the
+// command follows the MPMD syntax where the application and each segment contribute their own
+// "-np N <command>" section, the sections being separated by ':'.
+func GetMpirunArgs(myHostMPICfg *implem.Info, hostBuildEnv *buildenv.Info, app *app.Info, syContainer *container.Config, sysCfg *sys.Config, segments ...job.Segment) ([]string, error) {
+	args := GetContainerCmd(myHostMPICfg, hostBuildEnv, app, syContainer, sysCfg)
+	if len(segments) > 0 && app.NP > 0 {
+		args = append([]string{GetNPFlag(myHostMPICfg), strconv.FormatInt(app.NP, 10)}, args...)
+	}
+	for i := range segments {
+		s := &segments[i]
+		if s.Container == nil {
+			return nil, fmt.Errorf("container of %s is undefined", s.App.Name)
+		}
+		if s.App.BinPath == "" {
+			return nil, fmt.Errorf("binary of %s is undefined", s.App.Name)
+		}
+		args = append(args, ":")
+		if s.App.NP > 0 {
+			args = append(args, GetNPFlag(myHostMPICfg), strconv.FormatInt(s.App.NP, 10))
+		}
+		args = append(args, GetContainerCmd(myHostMPICfg, hostBuildEnv, &s.App, s.Container, sysCfg)...)
 	}
 
-	args = append(args, syContainer.Path, app.BinPath)
 	var extraArgs []string
 
 	// We really do not want to do this but MPICH is being picky about args so for now, it will do the job.
@@ -82,6 +313,15 @@ func GetMpirunArgs(myHostMPICfg *implem.Info, hostBuildEnv *buildenv.Info, app *
 	case implem.OMPI:
 		extraArgs = append(extraArgs, openmpi.GetExtraMpirunArgs(sysCfg)...)
 	}
+	affinityArgs, err := GetAffinityArgs(myHostMPICfg, sysCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid affinity: %w", err)
+	}
+	extraArgs = append(extraArgs, affinityArgs...)
+	extraArgs = append(extraArgs, MergeMpirunArgs(sysCfg.DefaultMpirunArgs[myHostMPICfg.ID], sysCfg.ExtraMpirunArgs)...)
+	if sysCfg.LabelOutput {
+		extraArgs = append(extraArgs, GetLabelFlag(myHostMPICfg))
+	}
 
 	if len(extraArgs) > 0 {
 		args = append(extraArgs, args...)
@@ -94,3 +334,27 @@ func GetMpirunArgs(myHostMPICfg *implem.Info, hostBuildEnv *buildenv.Info, app *
 func GetMPIConfigFile(id string, sysCfg *sys.Config) string {
 	return filepath.Join(sysCfg.EtcDir, id+".conf")
 }
+
+// RemoteConfigCacheDir is the name of the directory in the cache of sympi where the configuration
+// files fetched from a remote source are cached
+const RemoteConfigCacheDir = "config"
+
+// LoadMPIConfig loads the configuration of a given MPI implementation, i.e., the versions that can
+// be installed and their URLs. With a remote source of configuration files, the configuration is
+// fetched from it, the local drop-in files still being applied; the local configuration file is
+// only used when the remote configuration is not available and was never cached.
+func LoadMPIConfig(ctx context.Context, id string, sysCfg *sys.Config) ([]kv.KV, error) {
+	path := GetMPIConfigFile(id, sysCfg)
+	if sysCfg.MPIConfigURL == "" {
+		return kv.LoadKeyValueConfigWithDropIns(path)
+	}
+
+	opts := kv.RemoteOptions{
+		CacheDir: filepath.Join(sys.GetCacheDir(), RemoteConfigCacheDir),
+		TTL:      sysCfg.MPIConfigTTL,
+		Offline:  sysCfg.Offline,
+		Client:   &http.Client{Timeout: sysCfg.DownloadTimeout},
+	}
+	u := strings.TrimSuffix(sysCfg.MPIConfigURL, "/") + "/" + id + ".conf"
+	return kv.LoadRemoteKeyValueConfigWithDropIns(ctx, u, path, opts)
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/app"
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestGetMpirunArgs(t *testing.T) {
+	mpich := implem.Info{ID: implem.MPICH, Version: "3.3"}
+	ompi := implem.Info{ID: implem.OMPI, Version: "4.0.2"}
+	env := buildenv.Info{InstallDir: "/opt/mpich"}
+	server := container.Config{Path: "/tmp/server.sif"}
+	client := container.Config{Path: "/tmp/client.sif", Env: []string{"MODE=client"}}
+	bind := container.Config{Path: "/tmp/bind.sif", Model: container.BindModel, MPIDir: "/opt/mpi"}
+	var sysCfg sys.Config
+
+	tests := []struct {
+		name     string
+		hostMPI  *implem.Info
+		app      app.Info
+		segments []job.Segment
+		expected []string
+	}{
+		{
+			name:     "single program",
+			app:      app.Info{BinPath: "/opt/server", NP: 2},
+			expected: []string{"singularity", "exec", "/tmp/server.sif", "/opt/server"},
+		},
+		{
+			name: "mpmd",
+			app:  app.Info{BinPath: "/opt/server", NP: 1},
+			segments: []job.Segment{
+				{App: app.Info{BinPath: "/opt/client", Args: []string{"-v"}, NP: 4}, Container: &client},
+			},
+			expected: []string{"-n", "1", "singularity", "exec", "/tmp/server.sif", "/opt/server",
+				":", "-n", "4", "singularity", "exec", "/tmp/client.sif", "env", "MODE=client", "/opt/client", "-v"},
+		},
+		{
+			name: "bind model",
+			app:  app.Info{BinPath: "/opt/server", NP: 1},
+			segments: []job.Segment{
+				{App: app.Info{BinPath: "/opt/client", NP: 1}, Container: &bind},
+			},
+			expected: []string{"-n", "1", "singularity", "exec", "/tmp/server.sif", "/opt/server",
+				":", "-n", "1", "env", "SINGULARITYENV_PREPEND_PATH=/opt/mpi/bin", "singularity", "exec", "--bind", "/opt/mpich:/opt/mpi", "/tmp/bind.sif", "env",
+				"MPICC=/opt/mpi/bin/mpicc", "MPICXX=/opt/mpi/bin/mpicxx", "MPIFC=/opt/mpi/bin/mpifort", "/opt/client"},
+		},
+		{
+			name:    "bind model with open mpi",
+			hostMPI: &ompi,
+			app:     app.Info{BinPath: "/opt/server", NP: 1},
+			segments: []job.Segment{
+				{App: app.Info{BinPath: "/opt/client", NP: 1}, Container: &bind},
+			},
+			expected: []string{"-np", "1", "singularity", "exec", "/tmp/server.sif", "/opt/server",
+				":", "-np", "1", "env", "SINGULARITYENV_PREPEND_PATH=/opt/mpi/bin", "singularity", "exec", "--bind", "/opt/mpich:/opt/mpi", "/tmp/bind.sif", "env",
+				"MPICC=/opt/mpi/bin/mpicc", "MPICXX=/opt/mpi/bin/mpicxx", "MPIFC=/opt/mpi/bin/mpifort", "OPAL_PREFIX=/opt/mpi", "/opt/client"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostMPI := tt.hostMPI
+			if hostMPI == nil {
+				hostMPI = &mpich
+			}
+			args, err := GetMpirunArgs(hostMPI, &env, &tt.app, &server, &sysCfg, tt.segments...)
+			if err != nil {
+				t.Fatalf("GetMpirunArgs() failed: %s", err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Fatalf("got %v instead of %v", args, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMergeMpirunArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults []string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "defaults only",
+			defaults: []string{"--mca", "btl_openib_allow_ib", "true", "--bind-to", "core"},
+			expected: []string{"--mca", "btl_openib_allow_ib", "true", "--bind-to", "core"},
+		},
+		{
+			name:     "appended",
+			defaults: []string{"--mca", "btl_openib_allow_ib", "true"},
+			args:     []string{"--mca", "btl", "self,vader", "--oversubscribe"},
+			expected: []string{"--mca", "btl_openib_allow_ib", "true", "--mca", "btl", "self,vader", "--oversubscribe"},
+		},
+		{
+			name:     "overridden",
+			defaults: []string{"--mca", "btl", "self,openib", "--bind-to", "core", "-x", "FOO=1"},
+			args:     []string{"-mca", "btl", "self,vader", "--bind-to", "none", "-x", "FOO=2"},
+			expected: []string{"-mca", "btl", "self,vader", "--bind-to", "none", "-x", "FOO=2"},
+		},
+		{
+			name:     "flags only",
+			defaults: []string{"--oversubscribe", "-genv", "I_MPI_DEBUG", "5"},
+			args:     []string{"-genv", "I_MPI_FABRICS", "shm"},
+			expected: []string{"--oversubscribe", "-genv", "I_MPI_DEBUG", "5", "-genv", "I_MPI_FABRICS", "shm"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := MergeMpirunArgs(tt.defaults, tt.args)
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Fatalf("got %v instead of %v", args, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetShellCmd(t *testing.T) {
+	hostMPI := implem.Info{ID: implem.OMPI, Version: "4.0.2"}
+	env := buildenv.Info{InstallDir: "/opt/openmpi"}
+	bind := container.Config{Path: "/tmp/bind.sif", Model: container.BindModel, MPIDir: "/opt/mpi", Env: []string{"MODE=debug"}}
+
+	tests := []struct {
+		name        string
+		sysCfg      sys.Config
+		expectedCmd []string
+		expectedEnv []string
+	}{
+		{
+			name:        "singularity",
+			expectedCmd: []string{"singularity", "shell", "--bind", "/opt/openmpi:/opt/mpi", "--pwd", "/work", "/tmp/bind.sif"},
+			expectedEnv: []string{"SINGULARITYENV_PREPEND_PATH=/opt/mpi/bin", "SINGULARITYENV_MPICC=/opt/mpi/bin/mpicc", "SINGULARITYENV_MPICXX=/opt/mpi/bin/mpicxx",
+				"SINGULARITYENV_MPIFC=/opt/mpi/bin/mpifort", "SINGULARITYENV_OPAL_PREFIX=/opt/mpi", "SINGULARITYENV_MODE=debug"},
+		},
+		{
+			name:        "apptainer",
+			sysCfg:      sys.Config{ContainerRuntime: sys.ApptainerRuntime, CleanEnv: true},
+			expectedCmd: []string{"apptainer", "shell", "--cleanenv", "--bind", "/opt/openmpi:/opt/mpi", "--pwd", "/work", "/tmp/bind.sif"},
+			expectedEnv: []string{"APPTAINERENV_PREPEND_PATH=/opt/mpi/bin", "APPTAINERENV_MPICC=/opt/mpi/bin/mpicc", "APPTAINERENV_MPICXX=/opt/mpi/bin/mpicxx",
+				"APPTAINERENV_MPIFC=/opt/mpi/bin/mpifort", "APPTAINERENV_OPAL_PREFIX=/opt/mpi", "APPTAINERENV_MODE=debug"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, cmdEnv := GetShellCmd(&hostMPI, &env, &app.Info{WorkDir: "/work"}, &bind, &tt.sysCfg)
+			if !reflect.DeepEqual(cmd, tt.expectedCmd) {
+				t.Fatalf("got %v instead of %v", cmd, tt.expectedCmd)
+			}
+			if !reflect.DeepEqual(cmdEnv, tt.expectedEnv) {
+				t.Fatalf("got environment %v instead of %v", cmdEnv, tt.expectedEnv)
+			}
+		})
+	}
+}
+
+func TestGetPathToLauncher(t *testing.T) {
+	hostMPI := implem.Info{ID: implem.OMPI, Version: "4.0.2"}
+
+	tests := []struct {
+		name          string
+		launchers     []string
+		expected      string
+		expectedError bool
+	}{
+		{name: "mpirun", launchers: []string{"mpirun", "mpiexec"}, expected: "mpirun"},
+		{name: "mpiexec only", launchers: []string{"mpiexec"}, expected: "mpiexec"},
+		{name: "no launcher", launchers: []string{"mpicc"}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatalf("failed to create a temporary directory: %s", err)
+			}
+			defer os.RemoveAll(dir)
+			binDir := filepath.Join(dir, "bin")
+			err = os.MkdirAll(binDir, 0755)
+			if err != nil {
+				t.Fatalf("failed to create %s: %s", binDir, err)
+			}
+			for _, l := range tt.launchers {
+				err = ioutil.WriteFile(filepath.Join(binDir, l), []byte("#!/bin/sh\n"), 0755)
+				if err != nil {
+					t.Fatalf("failed to create %s: %s", l, err)
+				}
+			}
+
+			path, err := GetPathToLauncher(&hostMPI, &buildenv.Info{InstallDir: dir})
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("GetPathToLauncher() succeeded with %s", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPathToLauncher() failed: %s", err)
+			}
+			if path != filepath.Join(binDir, tt.expected) {
+				t.Fatalf("got %s instead of %s", path, filepath.Join(binDir, tt.expected))
+			}
+		})
+	}
+}
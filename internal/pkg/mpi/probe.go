@@ -0,0 +1,133 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/app"
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// HostLibsDir is the directory of the containers where the runtime places the libraries bound
+// from the host, e.g., with --nv; it is always in the LD_LIBRARY_PATH of the containers
+const HostLibsDir = "/.singularity.d/libs"
+
+// probedFiles are the files of a MPI installation, relative to its installation directory,
+// whose dependencies must be found when the installation is bind-mounted in a container
+var probedFiles = []string{filepath.Join("bin", "mpirun"), filepath.Join("lib", "libmpi.so")}
+
+// ProbeResult is the result of the probe of a host MPI bind-mounted in a container
+type ProbeResult struct {
+	// Missing are the libraries the host MPI depends on that cannot be found in the container
+	Missing []string
+
+	// HostPaths are the paths on the host of the missing libraries, indexed by name; libraries
+	// that cannot be found on the host either are not included
+	HostPaths map[string]string
+}
+
+// parseLddOutput returns the libraries ldd cannot find and the paths of the ones it found,
+// indexed by name, e.g., "libfabric.so.1 => /usr/lib64/libfabric.so.1 (0x00007f...)"
+func parseLddOutput(output string) ([]string, map[string]string) {
+	var missing []string
+	resolved := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		tokens := strings.SplitN(strings.TrimSpace(line), " => ", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		name := tokens[0]
+		if strings.TrimSpace(tokens[1]) == "not found" {
+			if !seen[name] {
+				seen[name] = true
+				missing = append(missing, name)
+			}
+			continue
+		}
+		fields := strings.Fields(tokens[1])
+		if len(fields) > 0 && filepath.IsAbs(fields[0]) {
+			resolved[name] = fields[0]
+		}
+	}
+	return missing, resolved
+}
+
+// ProbeBoundMPI checks that the dependencies of the host MPI bind-mounted in a container can
+// be found in the container, by running ldd in the container on mpirun and libmpi. For the
+// missing libraries, the paths of the libraries used by the host MPI on the host are returned
+// so they can be bound in the container. Containers that do not use the bind model are not probed.
+func ProbeBoundMPI(ctx context.Context, myHostMPICfg *implem.Info, hostBuildEnv *buildenv.Info, syContainer *container.Config, sysCfg *sys.Config) (ProbeResult, error) {
+	var res ProbeResult
+	if syContainer.Model != container.BindModel || syContainer.MPIDir == "" {
+		return res, nil
+	}
+
+	var hostFiles []string
+	var containerFiles []string
+	for _, f := range probedFiles {
+		if _, err := os.Stat(filepath.Join(hostBuildEnv.InstallDir, f)); err != nil {
+			continue
+		}
+		hostFiles = append(hostFiles, filepath.Join(hostBuildEnv.InstallDir, f))
+		containerFiles = append(containerFiles, filepath.Join(syContainer.MPIDir, f))
+	}
+	if len(hostFiles) == 0 {
+		return res, fmt.Errorf("neither %s found in %s", strings.Join(probedFiles, " nor "), hostBuildEnv.InstallDir)
+	}
+
+	r := sysCfg.GetRunner()
+	args := []string{"exec"}
+	args = append(args, getContainerOptions(myHostMPICfg, hostBuildEnv, &app.Info{}, syContainer, sysCfg)...)
+	args = append(args, syContainer.Path, "ldd")
+	args = append(args, containerFiles...)
+	log.Printf("-> Running %s %s\n", sysCfg.SingularityBin, strings.Join(args, " "))
+	stdout, stderr, _, err := r.Run(ctx, sysCfg.SingularityBin, args...)
+	res.Missing, _ = parseLddOutput(stdout)
+	if len(res.Missing) == 0 {
+		if err != nil {
+			return res, fmt.Errorf("failed to run ldd in %s: %s: %w", syContainer.Path, strings.TrimSpace(stderr), err)
+		}
+		return res, nil
+	}
+	sort.Strings(res.Missing)
+
+	// The libraries are looked up like when the host MPI runs on the host
+	env := append(os.Environ(), "LD_LIBRARY_PATH="+hostBuildEnv.GetEnvLDPath())
+	stdout, stderr, _, err = sys.WithExecOptions(r, "", env, false).Run(ctx, "ldd", hostFiles...)
+	if err != nil {
+		log.Printf("[WARN] failed to run ldd on %s: %s: %s", strings.Join(hostFiles, " "), strings.TrimSpace(stderr), err)
+	}
+	_, resolved := parseLddOutput(stdout)
+	res.HostPaths = make(map[string]string)
+	for _, lib := range res.Missing {
+		if path, ok := resolved[lib]; ok {
+			res.HostPaths[lib] = path
+		}
+	}
+	return res, nil
+}
+
+// GetHostLibBinds returns the binds making libraries of the host available in a container
+// through HostLibsDir, e.g., the missing libraries of a ProbeResult
+func GetHostLibBinds(hostPaths map[string]string) []string {
+	var binds []string
+	for name, path := range hostPaths {
+		binds = append(binds, path+":"+filepath.Join(HostLibsDir, name))
+	}
+	sort.Strings(binds)
+	return binds
+}
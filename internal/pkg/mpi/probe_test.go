@@ -0,0 +1,110 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpi
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/container"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+const containerLddOutput = `/opt/mpi/bin/mpirun:
+	linux-vdso.so.1 (0x00007ffd4ad9e000)
+	libopen-rte.so.40 => /opt/mpi/lib/libopen-rte.so.40 (0x00007f3c1a000000)
+	libhwloc.so.15 => not found
+	libc.so.6 => /lib64/libc.so.6 (0x00007f3c19c00000)
+/opt/mpi/lib/libmpi.so:
+	libhwloc.so.15 => not found
+	libfabric.so.1 => not found
+`
+
+const hostLddOutput = `/sympi/mpi_install_openmpi-4.1.4/bin/mpirun:
+	libhwloc.so.15 => /usr/lib64/libhwloc.so.15 (0x00007f3c1a200000)
+/sympi/mpi_install_openmpi-4.1.4/lib/libmpi.so:
+	libhwloc.so.15 => /usr/lib64/libhwloc.so.15 (0x00007f3c1a200000)
+	libfabric.so.1 => not found
+`
+
+func TestProbeBoundMPI(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(installDir)
+	for _, f := range probedFiles {
+		path := filepath.Join(installDir, f)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, nil, 0755)
+		}
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", path, err)
+		}
+	}
+
+	tests := []struct {
+		name            string
+		model           container.Model
+		results         map[string]mock.Result
+		expectedMissing []string
+		expectedPaths   map[string]string
+		expectedError   bool
+	}{
+		{name: "hybrid", model: container.HybridModel},
+		{name: "resolved", model: container.BindModel, results: map[string]mock.Result{"singularity": {Stdout: "\tlibc.so.6 => /lib64/libc.so.6 (0x00007f3c19c00000)\n"}}},
+		{
+			name:            "missing",
+			model:           container.BindModel,
+			results:         map[string]mock.Result{"singularity": {Stdout: containerLddOutput}, "ldd": {Stdout: hostLddOutput}},
+			expectedMissing: []string{"libfabric.so.1", "libhwloc.so.15"},
+			expectedPaths:   map[string]string{"libhwloc.so.15": "/usr/lib64/libhwloc.so.15"},
+		},
+		{name: "ldd not available", model: container.BindModel, results: map[string]mock.Result{"singularity": {ExitCode: 127, Stderr: "ldd: not found"}}, expectedError: true},
+	}
+
+	hostMPI := implem.Info{ID: implem.OMPI, Version: "4.1.4"}
+	hostBuildEnv := buildenv.Info{InstallDir: installDir}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mock.Runner{Results: tt.results}
+			sysCfg := sys.Config{SingularityBin: "/usr/bin/singularity", Runner: r}
+			c := container.Config{Path: "/images/app.sif", Model: tt.model, MPIDir: "/opt/mpi"}
+			res, err := ProbeBoundMPI(context.Background(), &hostMPI, &hostBuildEnv, &c, &sysCfg)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("probe succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("probe failed: %s", err)
+			}
+			if !reflect.DeepEqual(res.Missing, tt.expectedMissing) {
+				t.Fatalf("missing libraries are %v instead of %v", res.Missing, tt.expectedMissing)
+			}
+			if len(tt.expectedPaths) > 0 && !reflect.DeepEqual(res.HostPaths, tt.expectedPaths) {
+				t.Fatalf("host libraries are %v instead of %v", res.HostPaths, tt.expectedPaths)
+			}
+		})
+	}
+}
+
+func TestGetHostLibBinds(t *testing.T) {
+	binds := GetHostLibBinds(map[string]string{"libhwloc.so.15": "/usr/lib64/libhwloc.so.15", "libevent-2.1.so.7": "/usr/lib64/libevent-2.1.so.7"})
+	expected := []string{"/usr/lib64/libevent-2.1.so.7:" + HostLibsDir + "/libevent-2.1.so.7", "/usr/lib64/libhwloc.so.15:" + HostLibsDir + "/libhwloc.so.15"}
+	if !reflect.DeepEqual(binds, expected) {
+		t.Fatalf("binds are %v instead of %v", binds, expected)
+	}
+}
@@ -6,27 +6,77 @@
 package mpich
 
 import (
+	"fmt"
+
 	"github.com/sylabs/singularity-mpi/internal/pkg/deffile"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
 )
 
 const (
 	// VersionTag is the tag used to refer to the MPI version in MPICH template(s)
 	VersionTag = "MPICHVERSION"
 	// URLTag is the tag used to refer to the MPI URL in MPICH template(s)
-	URLTag     = "MPICHURL"
+	URLTag = "MPICHURL"
 	// TarballTag is the tag used to refer to the MPI tarball in MPICH template(s)
 	TarballTag = "MPICHTARBALL"
 )
 
+// PMI versions MPICH can be built with
+const (
+	// PMI1 is PMI-1 with the Hydra process manager, the default of MPICH
+	PMI1 = "pmi1"
+
+	// PMI2 is PMI-2 with the Hydra process manager
+	PMI2 = "pmi2"
+
+	// PMIx is PMIx without process manager, the ranks being started by the job manager, e.g., srun
+	PMIx = "pmix"
+)
+
+// pmiConfigureArgs associates each PMI version to the arguments configuring MPICH for it
+var pmiConfigureArgs = map[string][]string{
+	PMI1: {"--with-pm=hydra", "--with-pmi=simple"},
+	PMI2: {"--with-pm=hydra", "--with-pmi=pmi2/simple"},
+	PMIx: {"--with-pm=none", "--with-pmi=pmix"},
+}
+
+// slurmMPITypes associates each PMI version to the matching srun --mpi= plugin
+var slurmMPITypes = map[string]string{
+	PMI1: "none",
+	PMI2: "pmi2",
+	PMIx: "pmix",
+}
+
+// CheckPMI makes sure that a PMI version is supported
+func CheckPMI(pmi string) error {
+	if _, ok := pmiConfigureArgs[pmi]; !ok {
+		return fmt.Errorf("unknown PMI %q, supported PMIs are %s, %s and %s", pmi, PMI1, PMI2, PMIx)
+	}
+	return nil
+}
+
+// GetSlurmMPIType returns the srun --mpi= plugin matching a PMI version; empty if the PMI is not specified
+func GetSlurmMPIType(pmi string) string {
+	return slurmMPITypes[pmi]
+}
+
 // MPICHGetExtraMpirunArgs returns the extra mpirun arguments required by MPICH for a specific configuration
 func MPICHGetExtraMpirunArgs() []string {
 	var extraArgs []string
 	return extraArgs
 }
 
-// MPICHGetConfigureExtraArgs returns the extra arguments required to configure MPICH
-func MPICHGetConfigureExtraArgs() []string {
+// debugConfigureArgs are the arguments of configure to build MPICH with debug symbols and without optimizations
+var debugConfigureArgs = []string{"--enable-g=dbg", "--enable-fast=O0"}
+
+// MPICHGetConfigureExtraArgs returns the extra arguments required to configure MPICH, i.e., the
+// process manager and PMI when a PMI version is specified
+func MPICHGetConfigureExtraArgs(sysCfg *sys.Config) []string {
 	var extraArgs []string
+	extraArgs = append(extraArgs, pmiConfigureArgs[sysCfg.MPICHPMI]...)
+	if sysCfg.DebugBuild {
+		extraArgs = append(extraArgs, debugConfigureArgs...)
+	}
 	return extraArgs
 }
 
@@ -38,4 +88,3 @@ func GetDeffileTemplateTags() deffile.TemplateTags {
 	tags.Version = VersionTag
 	return tags
 }
-
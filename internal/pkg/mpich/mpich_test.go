@@ -0,0 +1,51 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpich
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestMPICHGetConfigureExtraArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		pmi      string
+		debug    bool
+		expected []string
+	}{
+		{name: "default", pmi: "", expected: nil},
+		{name: PMI1, pmi: PMI1, expected: []string{"--with-pm=hydra", "--with-pmi=simple"}},
+		{name: PMI2, pmi: PMI2, expected: []string{"--with-pm=hydra", "--with-pmi=pmi2/simple"}},
+		{name: PMIx, pmi: PMIx, expected: []string{"--with-pm=none", "--with-pmi=pmix"}},
+		{name: "debug", pmi: PMI2, debug: true, expected: []string{"--with-pm=hydra", "--with-pmi=pmi2/simple", "--enable-g=dbg", "--enable-fast=O0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sysCfg := sys.Config{MPICHPMI: tt.pmi, DebugBuild: tt.debug}
+			args := MPICHGetConfigureExtraArgs(&sysCfg)
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Fatalf("configure arguments are %v instead of %v", args, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckPMI(t *testing.T) {
+	for _, pmi := range []string{PMI1, PMI2, PMIx} {
+		err := CheckPMI(pmi)
+		if err != nil {
+			t.Fatalf("%s is rejected: %s", pmi, err)
+		}
+	}
+	err := CheckPMI("pmi3")
+	if err == nil {
+		t.Fatalf("invalid PMI is accepted")
+	}
+}
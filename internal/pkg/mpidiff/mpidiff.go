@@ -0,0 +1,254 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package mpidiff compares two MPI installed on the host, e.g., to understand why a container
+// runs with one of them but not with another one of the same family. The installations are
+// compared based on their provenance, the libraries they provide and, for Open MPI, the
+// values of their MCA parameters.
+package mpidiff
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/provenance"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// Install is a MPI installed on the host
+type Install struct {
+	// ID identifies the MPI, e.g., openmpi:4.1.4
+	ID string
+
+	// Dir is the installation directory
+	Dir string
+}
+
+// Difference is a difference between the provenance of two installations
+type Difference struct {
+	// Item is the element of the provenance that differs, e.g., the compiler
+	Item string
+
+	// A is the value of the first installation
+	A string
+
+	// B is the value of the second installation
+	B string
+}
+
+// ListDiff gives the elements of a list that are only in one of the installations
+type ListDiff struct {
+	// OnlyA are the elements only in the first installation
+	OnlyA []string
+
+	// OnlyB are the elements only in the second installation
+	OnlyB []string
+}
+
+// Report gathers the differences between two installations
+type Report struct {
+	// A and B are the compared installations
+	A, B Install
+
+	// Provenance are the differences between the provenance of the installations
+	Provenance []Difference
+
+	// Notes report what could not be compared, e.g., an installation without provenance
+	Notes []string
+
+	// Libraries are the differences between the libraries of the installations
+	Libraries ListDiff
+
+	// Params are the differences between the MCA parameters of the installations (Open MPI only)
+	Params ListDiff
+}
+
+// CompareLists returns the elements that are only in one of two lists, sorted
+func CompareLists(a []string, b []string) ListDiff {
+	var diff ListDiff
+	inA := make(map[string]bool)
+	inB := make(map[string]bool)
+	for _, e := range a {
+		inA[e] = true
+	}
+	for _, e := range b {
+		inB[e] = true
+	}
+	for e := range inA {
+		if !inB[e] {
+			diff.OnlyA = append(diff.OnlyA, e)
+		}
+	}
+	for e := range inB {
+		if !inA[e] {
+			diff.OnlyB = append(diff.OnlyB, e)
+		}
+	}
+	sort.Strings(diff.OnlyA)
+	sort.Strings(diff.OnlyB)
+	return diff
+}
+
+// CompareProvenance returns the differences between the provenance of two installations
+func CompareProvenance(a *provenance.Provenance, b *provenance.Provenance) []Difference {
+	items := []struct {
+		name string
+		a    string
+		b    string
+	}{
+		{name: "build type", a: a.BuildType, b: b.BuildType},
+		{name: "source URL", a: a.SourceURL, b: b.SourceURL},
+		{name: "configure arguments", a: strings.Join(a.ConfigureArgs, " "), b: strings.Join(b.ConfigureArgs, " ")},
+		{name: "compiler flags", a: strings.Join(a.CompilerFlags, " "), b: strings.Join(b.CompilerFlags, " ")},
+		{name: "compiler", a: a.Compiler, b: b.Compiler},
+		{name: "sympi version", a: a.ToolVersion, b: b.ToolVersion},
+	}
+
+	var diffs []Difference
+	for _, i := range items {
+		if i.a != i.b {
+			diffs = append(diffs, Difference{Item: i.name, A: i.a, B: i.b})
+		}
+	}
+	return diffs
+}
+
+// GetLibraries returns the names of the libraries of an installation, i.e., the files in its
+// lib directory
+func GetLibraries(dir string) ([]string, error) {
+	libDir := filepath.Join(dir, "lib")
+	entries, err := ioutil.ReadDir(libDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", libDir, err)
+	}
+	var libs []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			libs = append(libs, e.Name())
+		}
+	}
+	return libs, nil
+}
+
+// getOMPIParams returns the values of the MCA parameters of an Open MPI installation, as
+// displayed by ompi_info in its parsable format
+func getOMPIParams(ctx context.Context, dir string, sysCfg *sys.Config) ([]string, error) {
+	ompiInfo := filepath.Join(dir, "bin", "ompi_info")
+	env := append(os.Environ(), "LD_LIBRARY_PATH="+filepath.Join(dir, "lib")+":"+os.Getenv("LD_LIBRARY_PATH"))
+	r := sys.WithExecOptions(sysCfg.GetRunner(), "", env, false)
+	stdout, stderr, _, err := r.Run(ctx, ompiInfo, "--param", "all", "all", "--level", "9", "--parsable")
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %s: %w", ompiInfo, strings.TrimSpace(stderr), err)
+	}
+
+	// Only the values are compared, the other lines describe the parameters
+	var params []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.HasPrefix(line, "mca:") && strings.Contains(line, ":value:") {
+			params = append(params, line)
+		}
+	}
+	return params, nil
+}
+
+// getImplemID returns the implementation of an installation, e.g., openmpi for openmpi:4.1.4
+func getImplemID(id string) string {
+	return strings.Split(id, ":")[0]
+}
+
+// Compare compares two installations. What cannot be compared, e.g., because an installation
+// has no provenance, is reported in the notes of the report.
+func Compare(ctx context.Context, a Install, b Install, sysCfg *sys.Config) (*Report, error) {
+	report := &Report{A: a, B: b}
+
+	provA, err := provenance.Load(a.Dir)
+	if err != nil {
+		return nil, err
+	}
+	provB, err := provenance.Load(b.Dir)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case provA == nil && provB == nil:
+		report.Notes = append(report.Notes, "no provenance recorded for "+a.ID+" and "+b.ID)
+	case provA == nil:
+		report.Notes = append(report.Notes, "no provenance recorded for "+a.ID)
+	case provB == nil:
+		report.Notes = append(report.Notes, "no provenance recorded for "+b.ID)
+	default:
+		report.Provenance = CompareProvenance(provA, provB)
+	}
+
+	libsA, err := GetLibraries(a.Dir)
+	if err != nil {
+		return nil, err
+	}
+	libsB, err := GetLibraries(b.Dir)
+	if err != nil {
+		return nil, err
+	}
+	report.Libraries = CompareLists(libsA, libsB)
+
+	if getImplemID(a.ID) != implem.OMPI || getImplemID(b.ID) != implem.OMPI {
+		report.Notes = append(report.Notes, "MCA parameters are only compared between Open MPI installations")
+		return report, nil
+	}
+	paramsA, err := getOMPIParams(ctx, a.Dir, sysCfg)
+	if err != nil {
+		return nil, err
+	}
+	paramsB, err := getOMPIParams(ctx, b.Dir, sysCfg)
+	if err != nil {
+		return nil, err
+	}
+	report.Params = CompareLists(paramsA, paramsB)
+
+	return report, nil
+}
+
+func formatListDiff(sb *strings.Builder, title string, diff ListDiff) {
+	if len(diff.OnlyA) == 0 && len(diff.OnlyB) == 0 {
+		fmt.Fprintf(sb, "%s: identical\n", title)
+		return
+	}
+	fmt.Fprintf(sb, "%s:\n", title)
+	for _, e := range diff.OnlyA {
+		fmt.Fprintf(sb, "\t- %s\n", e)
+	}
+	for _, e := range diff.OnlyB {
+		fmt.Fprintf(sb, "\t+ %s\n", e)
+	}
+}
+
+// Format returns a human-readable description of the differences, the elements only in the
+// first installation being prefixed with - and the elements only in the second one with +
+func (r *Report) Format() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s (%s)\n+++ %s (%s)\n", r.A.ID, r.A.Dir, r.B.ID, r.B.Dir)
+
+	if len(r.Provenance) == 0 {
+		sb.WriteString("Provenance: identical\n")
+	} else {
+		sb.WriteString("Provenance:\n")
+		for _, d := range r.Provenance {
+			fmt.Fprintf(&sb, "\t%s:\n\t\t- %s\n\t\t+ %s\n", d.Item, d.A, d.B)
+		}
+	}
+	formatListDiff(&sb, "Libraries", r.Libraries)
+	if getImplemID(r.A.ID) == implem.OMPI && getImplemID(r.B.ID) == implem.OMPI {
+		formatListDiff(&sb, "MCA parameters", r.Params)
+	}
+	for _, n := range r.Notes {
+		fmt.Fprintf(&sb, "Note: %s\n", n)
+	}
+	return sb.String()
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpidiff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/provenance"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestCompareLists(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        []string
+		b        []string
+		expected ListDiff
+	}{
+		{name: "identical", a: []string{"libmpi.so", "libopen-pal.so"}, b: []string{"libopen-pal.so", "libmpi.so"}},
+		{
+			name:     "different",
+			a:        []string{"libmpi.so", "libmpi_cxx.so", "libopen-pal.so"},
+			b:        []string{"libucp.so", "libmpi.so", "libhwloc.so"},
+			expected: ListDiff{OnlyA: []string{"libmpi_cxx.so", "libopen-pal.so"}, OnlyB: []string{"libhwloc.so", "libucp.so"}},
+		},
+		{name: "empty", a: nil, b: []string{"libmpi.so"}, expected: ListDiff{OnlyB: []string{"libmpi.so"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := CompareLists(tt.a, tt.b); !reflect.DeepEqual(diff, tt.expected) {
+				t.Fatalf("comparison gave %v instead of %v", diff, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompareProvenance(t *testing.T) {
+	a := &provenance.Provenance{
+		BuildType:     provenance.ReleaseBuild,
+		ConfigureArgs: []string{"--with-ucx"},
+		Compiler:      "gcc (GCC) 9.3.0",
+	}
+	b := &provenance.Provenance{
+		BuildType:     provenance.ReleaseBuild,
+		ConfigureArgs: []string{"--with-ucx", "--enable-debug"},
+		Compiler:      "gcc (GCC) 9.3.0",
+	}
+
+	expected := []Difference{{Item: "configure arguments", A: "--with-ucx", B: "--with-ucx --enable-debug"}}
+	if diffs := CompareProvenance(a, b); !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("comparison gave %v instead of %v", diffs, expected)
+	}
+	if diffs := CompareProvenance(a, a); len(diffs) != 0 {
+		t.Fatalf("comparison of identical provenance gave %v", diffs)
+	}
+}
+
+func createInstall(t *testing.T, dir string, libs []string, p *provenance.Provenance) {
+	err := os.MkdirAll(filepath.Join(dir, "lib", "openmpi"), 0755)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", dir, err)
+	}
+	for _, l := range libs {
+		err := ioutil.WriteFile(filepath.Join(dir, "lib", l), nil, 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", l, err)
+		}
+	}
+	if p != nil {
+		err := provenance.Write(dir, p)
+		if err != nil {
+			t.Fatalf("failed to write the provenance of %s: %s", dir, err)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mpidiff-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := Install{ID: "openmpi:4.1.4", Dir: filepath.Join(dir, "openmpi-4.1.4")}
+	b := Install{ID: "openmpi:4.1.2", Dir: filepath.Join(dir, "openmpi-4.1.2")}
+	createInstall(t, a.Dir, []string{"libmpi.so", "libucp.so"}, &provenance.Provenance{Compiler: "gcc 9"})
+	createInstall(t, b.Dir, []string{"libmpi.so"}, &provenance.Provenance{Compiler: "gcc 8"})
+
+	// The mock runner gives the same output for both installations, the values are therefore identical
+	ompiInfo := "mca:btl:tcp:param:btl_tcp_if_include:value:\n" +
+		"mca:btl:tcp:param:btl_tcp_if_include:help:Comma-delimited list of devices\n"
+	r := &mock.Runner{Results: map[string]mock.Result{"ompi_info": {Stdout: ompiInfo}}}
+	report, err := Compare(context.Background(), a, b, &sys.Config{Runner: r})
+	if err != nil {
+		t.Fatalf("comparison failed: %s", err)
+	}
+
+	expectedProv := []Difference{{Item: "compiler", A: "gcc 9", B: "gcc 8"}}
+	if !reflect.DeepEqual(report.Provenance, expectedProv) {
+		t.Fatalf("provenance differences are %v instead of %v", report.Provenance, expectedProv)
+	}
+	expectedLibs := ListDiff{OnlyA: []string{"libucp.so"}}
+	if !reflect.DeepEqual(report.Libraries, expectedLibs) {
+		t.Fatalf("library differences are %v instead of %v", report.Libraries, expectedLibs)
+	}
+	if len(r.Calls()) != 2 {
+		t.Fatalf("ompi_info executed %d times instead of 2", len(r.Calls()))
+	}
+	out := report.Format()
+	for _, s := range []string{"\t- libucp.so\n", "\t\t- gcc 9\n\t\t+ gcc 8\n", "MCA parameters: identical\n"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("%q is not in the report:\n%s", s, out)
+		}
+	}
+
+	// Without provenance and with another implementation, only the libraries are compared
+	c := Install{ID: "mpich:3.3.2", Dir: filepath.Join(dir, "mpich-3.3.2")}
+	createInstall(t, c.Dir, []string{"libmpi.so"}, nil)
+	report, err = Compare(context.Background(), a, c, &sys.Config{Runner: r})
+	if err != nil {
+		t.Fatalf("comparison failed: %s", err)
+	}
+	if len(report.Provenance) != 0 || len(report.Notes) != 2 {
+		t.Fatalf("unexpected provenance differences %v and notes %v", report.Provenance, report.Notes)
+	}
+	if len(r.Calls()) != 2 {
+		t.Fatalf("ompi_info executed for %s", c.ID)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+const (
+	// UCXTLSEnv is the environment variable used to select the UCX transports
+	UCXTLSEnv = "UCX_TLS"
+
+	// OFIProviderEnv is the environment variable used to select the libfabric provider
+	OFIProviderEnv = "FI_PROVIDER"
+)
+
+// ucxTransports is the list of UCX transports we know about
+var ucxTransports = []string{
+	"all", "self", "sm", "shm", "mm", "posix", "sysv", "cma", "knem", "xpmem",
+	"tcp", "ib", "rc", "rc_v", "rc_x", "rc_verbs", "rc_mlx5", "ud", "ud_v", "ud_x", "ud_verbs", "ud_mlx5",
+	"dc", "dc_x", "dc_mlx5", "cuda", "cuda_copy", "cuda_ipc", "gdr_copy", "rocm", "rocm_copy", "rocm_ipc",
+	"ugni", "ugni_rdma", "ugni_udt", "ugni_smsg",
+}
+
+// ofiProviders is the list of libfabric providers we know about
+var ofiProviders = []string{
+	"tcp", "sockets", "udp", "verbs", "psm", "psm2", "psm3", "efa", "shm", "rxm", "ofi_rxm", "rxd", "ofi_rxd",
+	"gni", "cxi", "opx", "usnic", "mlx", "ucx", "netdir",
+}
+
+func isKnown(name string, known []string) bool {
+	for _, k := range known {
+		if name == k {
+			return true
+		}
+	}
+	return false
+}
+
+// getUnknown returns the names from a list of transports/providers that are not known. The
+// list may be prefixed by '^' to exclude names and may use ',' or ';' as separator.
+func getUnknown(list string, known []string) []string {
+	var unknown []string
+	list = strings.TrimPrefix(list, "^")
+	names := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ';'
+	})
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" && !isKnown(strings.ToLower(name), known) {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// CheckUCXTLS returns the transports of an UCX_TLS value that are unknown
+func CheckUCXTLS(tls string) []string {
+	return getUnknown(tls, ucxTransports)
+}
+
+// CheckOFIProvider returns the providers of a FI_PROVIDER value that are unknown
+func CheckOFIProvider(provider string) []string {
+	return getUnknown(provider, ofiProviders)
+}
+
+// GetProviderEnv returns the environment variables selecting the transport providers
+// requested by the configuration, to be set for the application in the container
+func GetProviderEnv(sysCfg *sys.Config) []string {
+	var env []string
+	if sysCfg.UCXTLS != "" {
+		env = append(env, UCXTLSEnv+"="+sysCfg.UCXTLS)
+	}
+	if sysCfg.OFIProvider != "" {
+		env = append(env, OFIProviderEnv+"="+sysCfg.OFIProvider)
+	}
+	return env
+}
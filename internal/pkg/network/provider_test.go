@@ -0,0 +1,47 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestCheckProviders(t *testing.T) {
+	tests := []struct {
+		name     string
+		ucx      string
+		ofi      string
+		expected []string
+	}{
+		{name: "empty"},
+		{name: "known ucx", ucx: "rc,sm,self"},
+		{name: "excluded ucx", ucx: "^tcp,cuda_ipc"},
+		{name: "unknown ucx", ucx: "rc,foo", expected: []string{"foo"}},
+		{name: "known ofi", ofi: "verbs;ofi_rxm"},
+		{name: "unknown ofi", ofi: "^shm,bar", expected: []string{"bar"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unknown := append(CheckUCXTLS(tt.ucx), CheckOFIProvider(tt.ofi)...)
+			if !reflect.DeepEqual(unknown, tt.expected) {
+				t.Fatalf("got %v instead of %v", unknown, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetProviderEnv(t *testing.T) {
+	sysCfg := sys.Config{UCXTLS: "rc,sm", OFIProvider: "verbs"}
+	expected := []string{"UCX_TLS=rc,sm", "FI_PROVIDER=verbs"}
+	env := GetProviderEnv(&sysCfg)
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("got %v instead of %v", env, expected)
+	}
+}
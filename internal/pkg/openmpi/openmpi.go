@@ -6,6 +6,7 @@
 package openmpi
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -30,14 +31,17 @@ const (
 )
 
 // Configure executes the appropriate command to configure Open MPI on the target platform
-func Configure(env *buildenv.Info, sysCfg *sys.Config, extraArgs []string) error {
+func Configure(ctx context.Context, env *buildenv.Info, sysCfg *sys.Config, extraArgs []string) error {
 	var ac autotools.Config
 
 	ac.Install = env.InstallDir
 	ac.Source = env.SrcDir
 	ac.ExtraConfigureArgs = extraArgs
+	ac.LiveOutput = env.LiveOutput
+	ac.Env = env.Env
+	ac.Runner = sysCfg.Runner
 
-	err := autotools.Configure(&ac)
+	err := autotools.Configure(ctx, &ac)
 	if err != nil {
 		return fmt.Errorf("Unable to run configure: %s", err)
 	}
@@ -66,6 +70,10 @@ func GetExtraConfigureArgs(sysCfg *sys.Config) []string {
 		extraArgs = append(extraArgs, "--with-slurm")
 	}
 
+	if sysCfg.DebugBuild {
+		extraArgs = append(extraArgs, "--enable-debug")
+	}
+
 	if sysCfg.IBEnabled {
 		kvs, err := sy.LoadMPIConfigFile()
 		if err != nil {
@@ -0,0 +1,168 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package osu
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	// LatencyBenchmark is the name of the binary of the OSU latency benchmark
+	LatencyBenchmark = "osu_latency"
+
+	// BandwidthBenchmark is the name of the binary of the OSU bandwidth benchmark
+	BandwidthBenchmark = "osu_bw"
+
+	// NP is the number of ranks used to run the point-to-point benchmarks
+	NP = 2
+)
+
+// Benchmarks is the list of OSU benchmarks that we run
+var Benchmarks = []string{LatencyBenchmark, BandwidthBenchmark}
+
+// Measurement is the result of a benchmark for a given message size
+type Measurement struct {
+	// Size is the size of the messages in bytes
+	Size int64
+
+	// Value is the measured value, e.g., the latency
+	Value float64
+}
+
+// Result gathers all the measurements of a benchmark
+type Result struct {
+	// Benchmark is the name of the benchmark
+	Benchmark string
+
+	// Unit is the unit of the measurements, as displayed by the benchmark
+	Unit string
+
+	// Measurements are the measurements sorted by message size
+	Measurements []Measurement
+}
+
+// ContainerResults gathers the results of all the benchmarks for a container
+type ContainerResults struct {
+	// Name is the name of the container
+	Name string
+
+	// Model is the MPI model of the container, e.g., bind or hybrid
+	Model string
+
+	// Results are the results of the benchmarks, indexed by benchmark name
+	Results map[string]Result
+}
+
+// ParseOutput parses the output of an OSU benchmark
+func ParseOutput(benchmark string, output string) (Result, error) {
+	var res Result
+	res.Benchmark = benchmark
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// Header with the unit, e.g., "# Size          Latency (us)"
+			if strings.Contains(line, "Size") {
+				start := strings.Index(line, "(")
+				end := strings.Index(line, ")")
+				if start >= 0 && end > start {
+					res.Unit = line[start+1 : end]
+				}
+			}
+			continue
+		}
+
+		tokens := strings.Fields(line)
+		if len(tokens) != 2 {
+			// We may get other output, e.g., from the job manager
+			continue
+		}
+		size, err := strconv.ParseInt(tokens[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(tokens[1], 64)
+		if err != nil {
+			return res, fmt.Errorf("invalid measurement for size %d: %s: %w", size, tokens[1], err)
+		}
+		res.Measurements = append(res.Measurements, Measurement{Size: size, Value: value})
+	}
+
+	if len(res.Measurements) == 0 {
+		return res, fmt.Errorf("no measurement found in the output of %s", benchmark)
+	}
+
+	return res, nil
+}
+
+// PrintReport writes a report comparing the results of the benchmarks for a set of containers,
+// one column per container
+func PrintReport(w io.Writer, containers []ContainerResults) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, benchmark := range Benchmarks {
+		unit := ""
+		var sizes []int64
+		values := make([]map[int64]float64, len(containers))
+		for i, c := range containers {
+			values[i] = make(map[int64]float64)
+			res, ok := c.Results[benchmark]
+			if !ok {
+				continue
+			}
+			if unit == "" {
+				unit = res.Unit
+			}
+			for _, m := range res.Measurements {
+				if !containsSize(sizes, m.Size) {
+					sizes = append(sizes, m.Size)
+				}
+				values[i][m.Size] = m.Value
+			}
+		}
+		if len(sizes) == 0 {
+			fmt.Fprintf(tw, "%s: no result\n\n", benchmark)
+			continue
+		}
+		sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+		fmt.Fprintf(tw, "%s (%s)\n", benchmark, unit)
+		fmt.Fprintf(tw, "Size")
+		for _, c := range containers {
+			fmt.Fprintf(tw, "\t%s (%s)", c.Name, c.Model)
+		}
+		fmt.Fprintf(tw, "\n")
+		for _, size := range sizes {
+			fmt.Fprintf(tw, "%d", size)
+			for i := range containers {
+				if v, ok := values[i][size]; ok {
+					fmt.Fprintf(tw, "\t%.2f", v)
+				} else {
+					fmt.Fprintf(tw, "\t-")
+				}
+			}
+			fmt.Fprintf(tw, "\n")
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	tw.Flush()
+}
+
+func containsSize(sizes []int64, size int64) bool {
+	for _, s := range sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package osu
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		output       string
+		expectedUnit string
+		expected     []Measurement
+		expectedErr  bool
+	}{
+		{
+			name: "latency",
+			output: `# OSU MPI Latency Test v5.6.2
+# Size          Latency (us)
+0                       0.23
+1                       0.25
+`,
+			expectedUnit: "us",
+			expected:     []Measurement{{Size: 0, Value: 0.23}, {Size: 1, Value: 0.25}},
+		},
+		{
+			name: "bandwidth with extra output",
+			output: `Warning: something from the job manager
+# OSU MPI Bandwidth Test v5.6.2
+# Size      Bandwidth (MB/s)
+1                       3.02
+`,
+			expectedUnit: "MB/s",
+			expected:     []Measurement{{Size: 1, Value: 3.02}},
+		},
+		{
+			name:        "no measurement",
+			output:      "mpirun: command not found\n",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ParseOutput(LatencyBenchmark, tt.output)
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatalf("parsing succeeded while expected to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsing failed: %s", err)
+			}
+			if res.Unit != tt.expectedUnit {
+				t.Fatalf("got unit %s instead of %s", res.Unit, tt.expectedUnit)
+			}
+			if !reflect.DeepEqual(res.Measurements, tt.expected) {
+				t.Fatalf("got %v instead of %v", res.Measurements, tt.expected)
+			}
+		})
+	}
+}
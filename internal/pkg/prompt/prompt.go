@@ -0,0 +1,115 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package prompt asks questions to the user, e.g., for the interactive run wizard of sympi.
+// Invalid answers are reported and the question is asked again; an empty answer selects
+// the default value.
+package prompt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Prompter asks questions on an output and reads the answers from an input
+type Prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// New returns a prompter reading the answers from in and writing the questions to out
+func New(in io.Reader, out io.Writer) *Prompter {
+	return &Prompter{in: bufio.NewReader(in), out: out}
+}
+
+// readAnswer reads the next answer. The end of the input without an answer is an error
+// since the questions would otherwise be asked forever.
+func (p *Prompter) readAnswer() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the answer: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// Choose asks to select one of the options and returns its index. def is the index of the
+// default option, -1 if there is no default.
+func (p *Prompter) Choose(question string, options []string, def int) (int, error) {
+	if len(options) == 0 {
+		return -1, fmt.Errorf("no option to choose from")
+	}
+	for {
+		fmt.Fprintf(p.out, "%s\n", question)
+		for i, o := range options {
+			fmt.Fprintf(p.out, "\t%d) %s\n", i+1, o)
+		}
+		if def >= 0 {
+			fmt.Fprintf(p.out, "Choice [%d]: ", def+1)
+		} else {
+			fmt.Fprintf(p.out, "Choice: ")
+		}
+		answer, err := p.readAnswer()
+		if err != nil {
+			return -1, err
+		}
+		if answer == "" && def >= 0 {
+			return def, nil
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		fmt.Fprintf(p.out, "Invalid choice %q, please enter a number between 1 and %d\n", answer, len(options))
+	}
+}
+
+// Int asks for a strictly positive number
+func (p *Prompter) Int(question string, def int64) (int64, error) {
+	for {
+		fmt.Fprintf(p.out, "%s [%d]: ", question, def)
+		answer, err := p.readAnswer()
+		if err != nil {
+			return 0, err
+		}
+		if answer == "" {
+			return def, nil
+		}
+		n, err := strconv.ParseInt(answer, 10, 64)
+		if err == nil && n > 0 {
+			return n, nil
+		}
+		fmt.Fprintf(p.out, "Invalid number %q, please enter a number greater than 0\n", answer)
+	}
+}
+
+// Confirm asks a yes/no question
+func (p *Prompter) Confirm(question string, def bool) (bool, error) {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, choices)
+		answer, err := p.readAnswer()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintf(p.out, "Invalid answer %q, please answer y or n\n", answer)
+	}
+}
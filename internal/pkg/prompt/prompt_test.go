@@ -0,0 +1,110 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package prompt
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestChoose(t *testing.T) {
+	options := []string{"helloworld", "netpipe", "imb"}
+	tests := []struct {
+		name     string
+		input    string
+		def      int
+		expected int
+		fail     bool
+	}{
+		{name: "valid choice", input: "2\n", def: -1, expected: 1},
+		{name: "default", input: "\n", def: 2, expected: 2},
+		{name: "no default", input: "\n3\n", def: -1, expected: 2},
+		{name: "invalid then valid", input: "0\nfoo\n4\n1\n", def: -1, expected: 0},
+		{name: "last line without newline", input: "3", def: -1, expected: 2},
+		{name: "end of input", input: "7\n", def: -1, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(strings.NewReader(tt.input), ioutil.Discard)
+			idx, err := p.Choose("Container to run?", options, tt.def)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("choice with %q succeeded", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("choice with %q failed: %s", tt.input, err)
+			}
+			if idx != tt.expected {
+				t.Fatalf("%q selected %d instead of %d", tt.input, idx, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInt(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected int64
+		fail     bool
+	}{
+		{name: "valid number", input: "8\n", expected: 8},
+		{name: "default", input: "\n", expected: 2},
+		{name: "invalid then valid", input: "-1\n0\nfour\n4\n", expected: 4},
+		{name: "end of input", input: "", fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(strings.NewReader(tt.input), ioutil.Discard)
+			n, err := p.Int("Number of ranks", 2)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("number with %q succeeded", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("number with %q failed: %s", tt.input, err)
+			}
+			if n != tt.expected {
+				t.Fatalf("%q gave %d instead of %d", tt.input, n, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		def      bool
+		expected bool
+	}{
+		{name: "yes", input: "y\n", expected: true},
+		{name: "no", input: "No\n", def: true, expected: false},
+		{name: "default yes", input: "\n", def: true, expected: true},
+		{name: "default no", input: "\n", expected: false},
+		{name: "invalid then valid", input: "maybe\nYES\n", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(strings.NewReader(tt.input), ioutil.Discard)
+			ok, err := p.Confirm("Run the container?", tt.def)
+			if err != nil {
+				t.Fatalf("confirmation with %q failed: %s", tt.input, err)
+			}
+			if ok != tt.expected {
+				t.Fatalf("%q gave %t instead of %t", tt.input, ok, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package provenance
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteBuildStats writes a summary of the durations of the builds recorded in provenances: the
+// duration of each phase of each build, then the average duration of the builds of each
+// implementation, e.g., to decide which versions to build in advance. Builds without recorded
+// durations are only counted.
+func WriteBuildStats(w io.Writer, provs []*Provenance) error {
+	var recorded []*Provenance
+	for _, p := range provs {
+		if p != nil && p.BuildSeconds > 0 {
+			recorded = append(recorded, p)
+		}
+	}
+	sort.Slice(recorded, func(i, j int) bool {
+		if recorded[i].ID != recorded[j].ID {
+			return recorded[i].ID < recorded[j].ID
+		}
+		return recorded[i].Version < recorded[j].Version
+	})
+	if len(recorded) == 0 {
+		_, err := fmt.Fprintf(w, "No build time recorded\n")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "MPI\ttotal\t%s\n", strings.Join(Phases, "\t"))
+	totals := make(map[string]float64)
+	counts := make(map[string]int)
+	var ids []string
+	for _, p := range recorded {
+		line := []string{p.ID + ":" + p.Version, FormatSeconds(p.BuildSeconds)}
+		for _, phase := range Phases {
+			duration := "-"
+			if seconds, ok := p.PhaseSeconds[phase]; ok {
+				duration = FormatSeconds(seconds)
+			}
+			line = append(line, duration)
+		}
+		fmt.Fprintf(tw, "%s\n", strings.Join(line, "\t"))
+
+		if counts[p.ID] == 0 {
+			ids = append(ids, p.ID)
+		}
+		totals[p.ID] += p.BuildSeconds
+		counts[p.ID]++
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\n")
+	for _, id := range ids {
+		fmt.Fprintf(w, "%s: %d build(s), %s on average\n", id, counts[id], FormatSeconds(totals[id]/float64(counts[id])))
+	}
+	if n := len(provs) - len(recorded); n > 0 {
+		fmt.Fprintf(w, "%d installation(s) without recorded build time\n", n)
+	}
+	return nil
+}
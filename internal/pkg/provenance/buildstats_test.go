@@ -0,0 +1,50 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package provenance
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteBuildStats(t *testing.T) {
+	ompi3 := Provenance{ID: "openmpi", Version: "3.1.6", BuildSeconds: 600, PhaseSeconds: map[string]float64{PhaseDownload: 10, PhaseCompile: 500}}
+	ompi4 := Provenance{ID: "openmpi", Version: "4.1.4", BuildSeconds: 720.4, PhaseSeconds: map[string]float64{PhaseDownload: 12, PhaseUnpack: 2, PhaseConfigure: 60, PhaseCompile: 600, PhaseInstall: 46.4}}
+	mpich := Provenance{ID: "mpich", Version: "3.3", BuildSeconds: 300}
+
+	tests := []struct {
+		name     string
+		provs    []*Provenance
+		expected string
+	}{
+		{name: "nothing recorded", provs: []*Provenance{nil, {ID: "mpich", Version: "3.2"}}, expected: "No build time recorded\n"},
+		{
+			name:  "builds",
+			provs: []*Provenance{&ompi4, &mpich, nil, &ompi3},
+			expected: "MPI            total  download  unpack  configure  compile  install\n" +
+				"mpich:3.3      5m0s   -         -       -          -        -\n" +
+				"openmpi:3.1.6  10m0s  10s       -       -          8m20s    -\n" +
+				"openmpi:4.1.4  12m0s  12s       2s      1m0s       10m0s    46s\n" +
+				"\n" +
+				"mpich: 1 build(s), 5m0s on average\n" +
+				"openmpi: 2 build(s), 11m0s on average\n" +
+				"1 installation(s) without recorded build time\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteBuildStats(&buf, tt.provs)
+			if err != nil {
+				t.Fatalf("WriteBuildStats() failed: %s", err)
+			}
+			if buf.String() != tt.expected {
+				t.Fatalf("wrote %q instead of %q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
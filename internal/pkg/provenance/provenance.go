@@ -0,0 +1,181 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package provenance records in the installation directory of a MPI how it was built, e.g.,
+// for audits or to understand why two installations of the same version behave differently.
+package provenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+const (
+	// File is the name of the file describing the build in the installation directory
+	File = "provenance.json"
+
+	// ReleaseBuild is the type of the optimized builds
+	ReleaseBuild = "release"
+
+	// DebugBuild is the type of the builds with debug symbols and without optimizations
+	DebugBuild = "debug"
+)
+
+// Phases of the builds whose durations are recorded
+const (
+	PhaseDownload  = "download"
+	PhaseUnpack    = "unpack"
+	PhaseConfigure = "configure"
+	PhaseCompile   = "compile"
+	PhaseInstall   = "install"
+)
+
+// Phases are the phases of the builds in the order they are executed
+var Phases = []string{PhaseDownload, PhaseUnpack, PhaseConfigure, PhaseCompile, PhaseInstall}
+
+// Provenance describes how a MPI was built
+type Provenance struct {
+	// ID is the implementation of MPI, e.g., openmpi
+	ID string `json:"id"`
+
+	// Version is the version that was installed, e.g., 4.1.4 or 4.1.4+debug
+	Version string `json:"version"`
+
+	// SourceURL is the URL of the source that was built
+	SourceURL string `json:"source_url"`
+
+	// ConfigureArgs are the arguments given to configure, in addition to the installation prefix
+	ConfigureArgs []string `json:"configure_args"`
+
+	// CompilerFlags are the compiler flags set in the environment of the build, e.g., CFLAGS=-g -O0
+	CompilerFlags []string `json:"compiler_flags"`
+
+	// Compiler identifies the C compiler, e.g., the first line of gcc --version
+	Compiler string `json:"compiler"`
+
+	// BuildDate is the date at which the build completed
+	BuildDate time.Time `json:"build_date"`
+
+	// ToolVersion is the version of sympi that built MPI
+	ToolVersion string `json:"tool_version"`
+
+	// BuildType is the type of the build: release or debug
+	BuildType string `json:"build_type"`
+
+	// Verified specifies whether the smoke test passed after the installation
+	Verified bool `json:"verified,omitempty"`
+
+	// BuildSeconds is the total duration of the build in seconds, from the download to the installation
+	BuildSeconds float64 `json:"build_seconds,omitempty"`
+
+	// PhaseSeconds are the durations of the phases of the build in seconds, indexed by phase
+	PhaseSeconds map[string]float64 `json:"phase_seconds,omitempty"`
+}
+
+// FormatSeconds returns a human-readable duration, rounded to the second, e.g., 12m3s
+func FormatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// DescribeBuildTime returns a human-readable description of the durations of the build, e.g.,
+// "12m3s (download 3s, unpack 1s, configure 42s, compile 10m47s, install 30s)"; empty for
+// builds whose durations were not recorded, e.g., by previous versions of sympi
+func (p *Provenance) DescribeBuildTime() string {
+	if p.BuildSeconds == 0 {
+		return ""
+	}
+	var phases []string
+	for _, phase := range Phases {
+		if seconds, ok := p.PhaseSeconds[phase]; ok {
+			phases = append(phases, phase+" "+FormatSeconds(seconds))
+		}
+	}
+	if len(phases) == 0 {
+		return FormatSeconds(p.BuildSeconds)
+	}
+	return FormatSeconds(p.BuildSeconds) + " (" + strings.Join(phases, ", ") + ")"
+}
+
+// valueOrUnknown returns a value to display, unknown if the value is not set
+func valueOrUnknown(val string) string {
+	if val == "" {
+		return "unknown"
+	}
+	return val
+}
+
+// Describe returns a human-readable description of the provenance
+func (p *Provenance) Describe() string {
+	date := ""
+	if !p.BuildDate.IsZero() {
+		date = p.BuildDate.Format(time.RFC3339)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "MPI: %s %s\n", p.ID, p.Version)
+	fmt.Fprintf(&sb, "Build type: %s\n", valueOrUnknown(p.BuildType))
+	fmt.Fprintf(&sb, "Source URL: %s\n", valueOrUnknown(p.SourceURL))
+	fmt.Fprintf(&sb, "Configure arguments: %s\n", strings.Join(p.ConfigureArgs, " "))
+	fmt.Fprintf(&sb, "Compiler flags: %s\n", strings.Join(p.CompilerFlags, " "))
+	fmt.Fprintf(&sb, "Compiler: %s\n", valueOrUnknown(p.Compiler))
+	fmt.Fprintf(&sb, "Build date: %s\n", valueOrUnknown(date))
+	fmt.Fprintf(&sb, "Built by sympi %s\n", valueOrUnknown(p.ToolVersion))
+	if buildTime := p.DescribeBuildTime(); buildTime != "" {
+		fmt.Fprintf(&sb, "Build time: %s\n", buildTime)
+	}
+	if p.Verified {
+		fmt.Fprintf(&sb, "Verified by a smoke test\n")
+	}
+	return sb.String()
+}
+
+// Write saves the provenance of a build in its installation directory
+func Write(installDir string, p *Provenance) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the provenance: %w", err)
+	}
+	return util.WriteFileAtomic(filepath.Join(installDir, File), append(data, '\n'), 0644)
+}
+
+// Load reads the provenance of a build from its installation directory. Installations
+// created by previous versions of sympi, e.g., do not have a provenance: nil is then returned
+// without error.
+func Load(installDir string) (*Provenance, error) {
+	path := filepath.Join(installDir, File)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	p := new(Provenance)
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// IsComplete checks whether an installation of MPI completed, i.e., has mpirun or mpiexec and a
+// provenance: the provenance is only recorded once the build is installed so an installation
+// without it was interrupted, e.g., by a failed make install. Links to a MPI installed outside of
+// sympi, e.g., registered with -register, have no provenance and only need mpirun or mpiexec.
+func IsComplete(installDir string) bool {
+	hasLauncher := util.FileExists(filepath.Join(installDir, "bin", "mpirun")) || util.FileExists(filepath.Join(installDir, "bin", "mpiexec"))
+	if fi, err := os.Lstat(installDir); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return hasLauncher
+	}
+	return hasLauncher && util.FileExists(filepath.Join(installDir, File))
+}
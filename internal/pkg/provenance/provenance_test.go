@@ -0,0 +1,203 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package provenance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var fullProvenance = Provenance{
+	ID:            "openmpi",
+	Version:       "4.1.4",
+	SourceURL:     "https://download.open-mpi.org/release/open-mpi/v4.1/openmpi-4.1.4.tar.bz2",
+	ConfigureArgs: []string{"--with-slurm"},
+	CompilerFlags: []string{"CFLAGS=-O2"},
+	Compiler:      "gcc (GCC) 11.3.0",
+	BuildDate:     time.Date(2022, 6, 1, 10, 30, 0, 0, time.UTC),
+	ToolVersion:   "1.0.0",
+	BuildType:     ReleaseBuild,
+}
+
+func TestProvenance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provenance-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		content  string
+		write    *Provenance
+		expected *Provenance
+		fail     bool
+	}{
+		{name: "no provenance", expected: nil},
+		{name: "debug build", write: &Provenance{BuildType: DebugBuild}, expected: &Provenance{BuildType: DebugBuild}},
+		{
+			name:     "full provenance",
+			write:    &fullProvenance,
+			expected: &fullProvenance,
+		},
+		{name: "unknown fields", content: `{"build_type": "release", "future": 1}`, expected: &Provenance{BuildType: ReleaseBuild}},
+		{name: "invalid", content: "build_type = debug", fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installDir := filepath.Join(dir, tt.name)
+			err := os.MkdirAll(installDir, 0755)
+			if err != nil {
+				t.Fatalf("failed to create %s: %s", installDir, err)
+			}
+			if tt.content != "" {
+				err = ioutil.WriteFile(filepath.Join(installDir, File), []byte(tt.content), 0644)
+			}
+			if tt.write != nil {
+				err = Write(installDir, tt.write)
+			}
+			if err != nil {
+				t.Fatalf("failed to write the provenance: %s", err)
+			}
+
+			p, err := Load(installDir)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("loading %q succeeded", tt.content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to load the provenance: %s", err)
+			}
+			if !reflect.DeepEqual(p, tt.expected) {
+				t.Fatalf("loaded %v instead of %v", p, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        Provenance
+		expected string
+	}{
+		{
+			name: "full provenance",
+			p:    fullProvenance,
+			expected: "MPI: openmpi 4.1.4\n" +
+				"Build type: release\n" +
+				"Source URL: https://download.open-mpi.org/release/open-mpi/v4.1/openmpi-4.1.4.tar.bz2\n" +
+				"Configure arguments: --with-slurm\n" +
+				"Compiler flags: CFLAGS=-O2\n" +
+				"Compiler: gcc (GCC) 11.3.0\n" +
+				"Build date: 2022-06-01T10:30:00Z\n" +
+				"Built by sympi 1.0.0\n",
+		},
+		{
+			name: "partial provenance",
+			p:    Provenance{ID: "mpich", Version: "3.3+debug", BuildType: DebugBuild},
+			expected: "MPI: mpich 3.3+debug\n" +
+				"Build type: debug\n" +
+				"Source URL: unknown\n" +
+				"Configure arguments: \n" +
+				"Compiler flags: \n" +
+				"Compiler: unknown\n" +
+				"Build date: unknown\n" +
+				"Built by sympi unknown\n",
+		},
+		{
+			name: "build time",
+			p:    Provenance{ID: "mpich", Version: "3.3", BuildType: ReleaseBuild, BuildSeconds: 125.6, PhaseSeconds: map[string]float64{PhaseConfigure: 20.2, PhaseCompile: 100}},
+			expected: "MPI: mpich 3.3\n" +
+				"Build type: release\n" +
+				"Source URL: unknown\n" +
+				"Configure arguments: \n" +
+				"Compiler flags: \n" +
+				"Compiler: unknown\n" +
+				"Build date: unknown\n" +
+				"Built by sympi unknown\n" +
+				"Build time: 2m6s (configure 20s, compile 1m40s)\n",
+		},
+		{
+			name: "verified",
+			p:    Provenance{ID: "mpich", Version: "3.3", BuildType: ReleaseBuild, Verified: true},
+			expected: "MPI: mpich 3.3\n" +
+				"Build type: release\n" +
+				"Source URL: unknown\n" +
+				"Configure arguments: \n" +
+				"Compiler flags: \n" +
+				"Compiler: unknown\n" +
+				"Build date: unknown\n" +
+				"Built by sympi unknown\n" +
+				"Verified by a smoke test\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := tt.p.Describe(); d != tt.expected {
+				t.Fatalf("described as %q instead of %q", d, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsComplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provenance-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		files      []string
+		link       bool
+		isComplete bool
+	}{
+		{name: "complete", files: []string{"bin/mpirun", File}, isComplete: true},
+		{name: "interrupted", files: []string{"bin/mpirun"}},
+		{name: "mpiexec only", files: []string{"bin/mpiexec", File}, isComplete: true},
+		{name: "no mpirun", files: []string{File}},
+		{name: "no launcher", files: []string{"bin/mpicc", File}},
+		{name: "missing"},
+		{name: "registered", files: []string{"bin/mpiexec"}, link: true, isComplete: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installDir := filepath.Join(dir, tt.name)
+			for _, f := range tt.files {
+				path := filepath.Join(installDir, f)
+				err := os.MkdirAll(filepath.Dir(path), 0755)
+				if err == nil {
+					err = ioutil.WriteFile(path, nil, 0755)
+				}
+				if err != nil {
+					t.Fatalf("failed to create %s: %s", path, err)
+				}
+			}
+			if tt.link {
+				link := installDir + "-link"
+				err := os.Symlink(installDir, link)
+				if err != nil {
+					t.Fatalf("failed to create %s: %s", link, err)
+				}
+				installDir = link
+			}
+			if IsComplete(installDir) != tt.isComplete {
+				t.Fatalf("IsComplete(%s) returned %v", installDir, !tt.isComplete)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package remote runs containers on a remote host, e.g., the login node of a cluster, over
+// SSH. The image is copied to the remote host and sympi, which must be installed there, runs
+// the container: it detects the job manager of the remote host and submits the job as it
+// does locally. The output of the remote sympi is streamed back to the console.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+const (
+	// SSHBin is the command used to execute commands on the remote host
+	SSHBin = "ssh"
+
+	// SCPBin is the command used to copy the images to the remote host
+	SCPBin = "scp"
+)
+
+// Options are the options of the run forwarded to the remote sympi
+type Options struct {
+	// Args are the flags of the run passed to the remote sympi, e.g., -np=4 or -jm=slurm (optional)
+	Args []string
+}
+
+// quote quotes a value for the shell of the remote host
+func quote(val string) string {
+	return "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+}
+
+// getPrepareCmd returns the remote command checking that sympi is available and creating
+// the directory of the container, which it displays
+func getPrepareCmd(name string) string {
+	return `command -v sympi >/dev/null || { echo "sympi is not installed" >&2; exit 127; }; ` +
+		`dir="${` + sys.SYMPI_INSTALL_DIR_ENV + `:-$HOME/` + sys.DefaultSympiInstallDir + `}"/` + quote(sys.ContainerInstallDirPrefix+name) + `; ` +
+		`mkdir -p "$dir" && echo "$dir"`
+}
+
+// getRunCmd returns the remote command running the container
+func getRunCmd(name string, opts Options) string {
+	args := []string{"sympi", "-run", quote(name)}
+	for _, a := range opts.Args {
+		args = append(args, quote(a))
+	}
+	return strings.Join(args, " ")
+}
+
+// Run copies the image of a container to a remote host, e.g., user@login, and runs the
+// container there with sympi
+func Run(ctx context.Context, target string, name string, imgPath string, opts Options, sysCfg *sys.Config) error {
+	if target == "" || strings.HasPrefix(target, "-") {
+		return fmt.Errorf("invalid remote host %q", target)
+	}
+	r := sysCfg.GetRunner()
+
+	log.Printf("* Preparing %s to run %s...", target, name)
+	stdout, stderr, _, err := r.Run(ctx, SSHBin, target, getPrepareCmd(name))
+	if err != nil {
+		return fmt.Errorf("failed to prepare %s: %s: %w", target, strings.TrimSpace(stderr), err)
+	}
+	remoteDir := strings.TrimSpace(stdout)
+	if remoteDir == "" {
+		return fmt.Errorf("failed to get the directory of %s on %s", name, target)
+	}
+
+	log.Printf("* Copying %s to %s:%s...", imgPath, target, remoteDir)
+	_, stderr, _, err = r.Run(ctx, SCPBin, imgPath, target+":"+remoteDir+"/"+name+".sif")
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %s: %w", imgPath, target, strings.TrimSpace(stderr), err)
+	}
+
+	// The output of the remote sympi is displayed while it runs
+	log.Printf("* Running %s on %s...", name, target)
+	_, _, _, err = sys.WithExecOptions(r, "", nil, true).Run(ctx, SSHBin, target, getRunCmd(name, opts))
+	if err != nil {
+		return fmt.Errorf("failed to run %s on %s: %w", name, target, err)
+	}
+
+	return nil
+}
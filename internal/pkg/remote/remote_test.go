@@ -0,0 +1,107 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestRun(t *testing.T) {
+	const remoteDir = "/home/user/.sympi/mpi_container_helloworld"
+	prepareCmd := getPrepareCmd("helloworld")
+
+	tests := []struct {
+		name     string
+		target   string
+		opts     Options
+		results  map[string]mock.Result
+		expected []string
+		fail     bool
+	}{
+		{
+			name:    "run",
+			target:  "user@login",
+			results: map[string]mock.Result{SSHBin: {Stdout: remoteDir + "\n"}},
+			expected: []string{
+				"ssh user@login " + prepareCmd,
+				"scp /tmp/helloworld.sif user@login:" + remoteDir + "/helloworld.sif",
+				"ssh user@login sympi -run 'helloworld'",
+			},
+		},
+		{
+			name:    "options",
+			target:  "login",
+			opts:    Options{Args: []string{"-pwd=/opt/my app", "-jm=slurm", "-np=4"}},
+			results: map[string]mock.Result{SSHBin: {Stdout: remoteDir + "\n"}},
+			expected: []string{
+				"ssh login " + prepareCmd,
+				"scp /tmp/helloworld.sif login:" + remoteDir + "/helloworld.sif",
+				"ssh login sympi -run 'helloworld' '-pwd=/opt/my app' '-jm=slurm' '-np=4'",
+			},
+		},
+		{
+			name:     "sympi missing",
+			target:   "user@login",
+			results:  map[string]mock.Result{SSHBin: {Stderr: "sympi is not installed", ExitCode: 127}},
+			expected: []string{"ssh user@login " + prepareCmd},
+			fail:     true,
+		},
+		{
+			name:     "copy failure",
+			target:   "user@login",
+			results:  map[string]mock.Result{SSHBin: {Stdout: remoteDir + "\n"}, SCPBin: {ExitCode: 1}},
+			expected: []string{"ssh user@login " + prepareCmd, "scp /tmp/helloworld.sif user@login:" + remoteDir + "/helloworld.sif"},
+			fail:     true,
+		},
+		{
+			name:     "invalid target",
+			target:   "-oProxyCommand=evil",
+			expected: []string{},
+			fail:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mock.Runner{Results: tt.results}
+			sysCfg := &sys.Config{Runner: r}
+			err := Run(context.Background(), tt.target, "helloworld", "/tmp/helloworld.sif", tt.opts, sysCfg)
+			if tt.fail && err == nil {
+				t.Fatalf("run on %s succeeded", tt.target)
+			}
+			if !tt.fail && err != nil {
+				t.Fatalf("run on %s failed: %s", tt.target, err)
+			}
+			if calls := r.Calls(); !reflect.DeepEqual(calls, tt.expected) {
+				t.Fatalf("executed %q instead of %q", calls, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		val      string
+		expected string
+	}{
+		{val: "helloworld", expected: "'helloworld'"},
+		{val: "it's", expected: `'it'\''s'`},
+		{val: "$HOME; rm -rf /", expected: "'$HOME; rm -rf /'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			if q := quote(tt.val); q != tt.expected {
+				t.Fatalf("%s quoted as %s instead of %s", tt.val, q, tt.expected)
+			}
+		})
+	}
+}
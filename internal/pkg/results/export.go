@@ -0,0 +1,116 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package results
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ExportSchemaVersion is the version of the format used to export the results of the runs.
+// It must be increased whenever a field is renamed or removed, or its meaning changes, so
+// that the tools parsing the exports can adapt; adding a field does not require a new version.
+const ExportSchemaVersion = 1
+
+// exportedRun is a run as exported by sympi
+type exportedRun struct {
+	Container       string  `json:"container"`
+	HostMPI         string  `json:"host_mpi"`
+	ContainerMPI    string  `json:"container_mpi"`
+	Model           string  `json:"model"`
+	NP              int     `json:"np"`
+	NNodes          int     `json:"nodes"`
+	Result          string  `json:"result"`
+	ExitCode        int     `json:"exit_code"`
+	WallTimeSeconds float64 `json:"wall_time_seconds"`
+	SacctCPUTime    string  `json:"sacct_cputime"`
+	SacctMaxRSS     string  `json:"sacct_maxrss"`
+	SacctElapsed    string  `json:"sacct_elapsed"`
+	Note            string  `json:"note"`
+	Affinity        string  `json:"affinity"`
+	RunDir          string  `json:"run_dir"`
+	Scale           int     `json:"scale"`
+	Transport       string  `json:"transport"`
+}
+
+// export is the document created when exporting the results of the runs in JSON
+type export struct {
+	SchemaVersion int           `json:"schema_version"`
+	Runs          []exportedRun `json:"runs"`
+}
+
+// csvHeader is the first line of the CSV exports
+var csvHeader = []string{"schema_version", "container", "host_mpi", "container_mpi", "model", "np", "nodes", "result", "exit_code", "wall_time_seconds", "sacct_cputime", "sacct_maxrss", "sacct_elapsed", "note", "affinity", "run_dir", "scale", "transport"}
+
+func getExportedRun(r RunResult) exportedRun {
+	result := "FAIL"
+	if r.Pass {
+		result = "PASS"
+	}
+	return exportedRun{
+		Container:       r.Container,
+		HostMPI:         r.HostMPI,
+		ContainerMPI:    r.ContainerMPI,
+		Model:           r.Model,
+		NP:              r.NP,
+		NNodes:          r.NNodes,
+		Result:          result,
+		ExitCode:        r.ExitCode,
+		WallTimeSeconds: r.WallTime.Seconds(),
+		SacctCPUTime:    r.Usage.CPUTime,
+		SacctMaxRSS:     r.Usage.MaxRSS,
+		SacctElapsed:    r.Usage.Elapsed,
+		Note:            r.Note,
+		Affinity:        r.Affinity,
+		RunDir:          r.RunDir,
+		Scale:           r.Scale,
+		Transport:       r.Transport,
+	}
+}
+
+// WriteJSON exports the results of the runs in JSON. The document specifies the version of its schema.
+func WriteJSON(w io.Writer, runs []RunResult) error {
+	doc := export{SchemaVersion: ExportSchemaVersion, Runs: []exportedRun{}}
+	for _, r := range runs {
+		doc.Runs = append(doc.Runs, getExportedRun(r))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode the results: %w", err)
+	}
+	return nil
+}
+
+// WriteCSV exports the results of the runs in CSV, with a header line. The version of the
+// schema is the first column of each line so that it is kept when lines are filtered or merged.
+func WriteCSV(w io.Writer, runs []RunResult) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(csvHeader)
+	if err != nil {
+		return fmt.Errorf("failed to write the header: %w", err)
+	}
+
+	version := strconv.Itoa(ExportSchemaVersion)
+	for _, r := range runs {
+		e := getExportedRun(r)
+		err = cw.Write([]string{version, e.Container, e.HostMPI, e.ContainerMPI, e.Model,
+			strconv.Itoa(e.NP), strconv.Itoa(e.NNodes), e.Result, strconv.Itoa(e.ExitCode),
+			strconv.FormatFloat(e.WallTimeSeconds, 'f', -1, 64),
+			e.SacctCPUTime, e.SacctMaxRSS, e.SacctElapsed, e.Note, e.Affinity, e.RunDir, strconv.Itoa(e.Scale), e.Transport})
+		if err != nil {
+			return fmt.Errorf("failed to write the result of %s: %w", r.Container, err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
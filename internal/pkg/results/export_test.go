@@ -0,0 +1,91 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var exportedRuns = []RunResult{
+	{Container: "helloworld", HostMPI: "openmpi:4.0.2", ContainerMPI: "openmpi:4.0.2", Model: "bind", NP: 2, NNodes: 2, Pass: true, WallTime: 2500 * time.Millisecond, Usage: Usage{CPUTime: "00:00:04", MaxRSS: "2048K", Elapsed: "00:00:02"}, Affinity: "map-by=socket bind-to=core", Transport: "UCX_TLS=rc,sm"},
+	{Container: "netpipe", HostMPI: "mpich:3.3", ContainerMPI: "mpich:3.3", Model: "hybrid", NP: 4, NNodes: 2, ExitCode: 1, WallTime: time.Second, Note: "failed, \"timeout\"", Scale: 4},
+}
+
+func TestWriteJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		runs []RunResult
+	}{
+		{name: "no run", runs: nil},
+		{name: "runs", runs: exportedRuns},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteJSON(&buf, tt.runs)
+			if err != nil {
+				t.Fatalf("failed to export the runs: %s", err)
+			}
+
+			var doc map[string]interface{}
+			err = json.Unmarshal(buf.Bytes(), &doc)
+			if err != nil {
+				t.Fatalf("invalid JSON %q: %s", buf.String(), err)
+			}
+			if doc["schema_version"] != float64(ExportSchemaVersion) {
+				t.Fatalf("invalid schema version in %q", buf.String())
+			}
+			runs, ok := doc["runs"].([]interface{})
+			if !ok || len(runs) != len(tt.runs) {
+				t.Fatalf("invalid runs in %q", buf.String())
+			}
+			for i, r := range runs {
+				run := r.(map[string]interface{})
+				if run["container"] != tt.runs[i].Container || run["wall_time_seconds"] != tt.runs[i].WallTime.Seconds() || run["sacct_maxrss"] != tt.runs[i].Usage.MaxRSS {
+					t.Fatalf("invalid run %v for %v", run, tt.runs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		runs     []RunResult
+		expected string
+	}{
+		{
+			name:     "no run",
+			runs:     nil,
+			expected: "schema_version,container,host_mpi,container_mpi,model,np,nodes,result,exit_code,wall_time_seconds,sacct_cputime,sacct_maxrss,sacct_elapsed,note,affinity,run_dir,scale,transport\n",
+		},
+		{
+			name: "runs",
+			runs: exportedRuns,
+			expected: "schema_version,container,host_mpi,container_mpi,model,np,nodes,result,exit_code,wall_time_seconds,sacct_cputime,sacct_maxrss,sacct_elapsed,note,affinity,run_dir,scale,transport\n" +
+				"1,helloworld,openmpi:4.0.2,openmpi:4.0.2,bind,2,2,PASS,0,2.5,00:00:04,2048K,00:00:02,,map-by=socket bind-to=core,,0,\"UCX_TLS=rc,sm\"\n" +
+				"1,netpipe,mpich:3.3,mpich:3.3,hybrid,4,2,FAIL,1,1,,,,\"failed, \"\"timeout\"\"\",,,4,\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteCSV(&buf, tt.runs)
+			if err != nil {
+				t.Fatalf("failed to export the runs: %s", err)
+			}
+			if buf.String() != tt.expected {
+				t.Fatalf("exported %q instead of %q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
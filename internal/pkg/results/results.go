@@ -18,12 +18,30 @@ import (
 	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
 )
 
+// Usage represents the resources used by a job, as recorded by the job manager
+type Usage struct {
+	// CPUTime is the total CPU time used by the job
+	CPUTime string
+
+	// MaxRSS is the maximum resident set size of the job's tasks
+	MaxRSS string
+
+	// Elapsed is the wall time of the job
+	Elapsed string
+}
+
 // Result represents the result of a given experiment
 type Result struct {
 	HostMPI      implem.Info
 	ContainerMPI implem.Info
 	Pass         bool
 	Note         string
+	Usage        Usage
+	NP           int
+	NNodes       int
+	RunDir       string
+	// Tasks are the resources used by each task of a job array, in the order of the values of the array
+	Tasks []Usage
 }
 
 func lookupResult(r []Result, hostVersion string, containerVersion string) bool {
@@ -0,0 +1,221 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package results
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+// RunsFile is the name of the file in the sympi directory where the results of the runs are stored
+const RunsFile = "run-results.txt"
+
+// RunResult represents the result of the execution of a container
+type RunResult struct {
+	// Container is the name of the container
+	Container string
+
+	// HostMPI is the host MPI used for the run, e.g., openmpi:4.0.2 (empty if unknown)
+	HostMPI string
+
+	// Pass specifies whether the run succeeded
+	Pass bool
+
+	// Note gives details about the result, e.g., the reason of a failure
+	Note string
+
+	// ContainerMPI is the MPI of the container, e.g., openmpi:4.0.2 (empty if unknown)
+	ContainerMPI string
+
+	// Model is the MPI model of the container, e.g., hybrid (empty if unknown)
+	Model string
+
+	// NP is the number of MPI ranks of the job (0 if unknown)
+	NP int
+
+	// NNodes is the number of nodes of the job (0 if unknown)
+	NNodes int
+
+	// ExitCode is the exit code of the command that executed the job
+	ExitCode int
+
+	// WallTime is the time it took to execute the job, as measured by sympi
+	WallTime time.Duration
+
+	// Usage is the resource usage reported by the job manager, if any
+	Usage Usage
+
+	// Affinity describes the affinity settings of the run, e.g., map-by=socket bind-to=core (empty if left to MPI)
+	Affinity string
+
+	// RunDir is the directory with the script, output and metadata of the run with the per-run
+	// layout (empty otherwise)
+	RunDir string
+
+	// Scale is the number of ranks requested for the run by a scaling study, e.g., with -scales;
+	// each scale of a container has its own result (0 for the other runs)
+	Scale int
+
+	// WorkDir is the directory in the container from where the application was started, e.g.,
+	// with -pwd (empty if the default one)
+	WorkDir string
+
+	// Transport describes the transport provider selected for the run, e.g., UCX_TLS=rc,sm (empty
+	// if left to MPI)
+	Transport string
+
+	// Tasks are the resources used by each task when the run is a job array, in the order of the
+	// values of the array; not saved, each task being recorded as a result of its own
+	Tasks []Usage
+}
+
+// runFields is the number of fields of a line of the runs file. Files written by previous
+// versions of sympi only have the first 4 fields, or the first detailsRunFields fields and
+// possibly some of the next ones; the missing fields are then left unset when loading the runs.
+const runFields = 18
+
+// detailsRunFields is the number of fields of the runs files written before the affinity and
+// the directory of the runs were recorded
+const detailsRunFields = 13
+
+// LoadRuns reads the results of the runs from a file. A missing file means there is no result yet.
+func LoadRuns(path string) ([]RunResult, error) {
+	var runs []RunResult
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return runs, nil
+	}
+	if err != nil {
+		return runs, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+		words := strings.Split(line, "\t")
+		if len(words) < 3 {
+			return runs, fmt.Errorf("invalid format: %s", line)
+		}
+		r := RunResult{Container: words[0], HostMPI: words[1]}
+		switch words[2] {
+		case "PASS":
+			r.Pass = true
+		case "FAIL":
+			r.Pass = false
+		default:
+			return runs, fmt.Errorf("invalid run result: %s", words[2])
+		}
+		if len(words) > 3 {
+			r.Note = words[3]
+		}
+		if len(words) > 4 {
+			err = parseRunDetails(&r, words)
+			if err != nil {
+				return runs, fmt.Errorf("invalid format: %s: %w", line, err)
+			}
+		}
+		runs = append(runs, r)
+	}
+
+	return runs, nil
+}
+
+// parseRunDetails sets the details of a run that are stored after the note in the runs file
+func parseRunDetails(r *RunResult, words []string) error {
+	if len(words) < detailsRunFields || len(words) > runFields {
+		return fmt.Errorf("%d fields instead of %d", len(words), runFields)
+	}
+	r.ContainerMPI = words[4]
+	r.Model = words[5]
+
+	var err error
+	r.NP, err = strconv.Atoi(words[6])
+	if err != nil {
+		return fmt.Errorf("invalid number of ranks: %w", err)
+	}
+	r.NNodes, err = strconv.Atoi(words[7])
+	if err != nil {
+		return fmt.Errorf("invalid number of nodes: %w", err)
+	}
+	r.ExitCode, err = strconv.Atoi(words[8])
+	if err != nil {
+		return fmt.Errorf("invalid exit code: %w", err)
+	}
+	r.WallTime, err = time.ParseDuration(words[9])
+	if err != nil {
+		return fmt.Errorf("invalid wall time: %w", err)
+	}
+	r.Usage = Usage{CPUTime: words[10], MaxRSS: words[11], Elapsed: words[12]}
+	if len(words) > 13 {
+		r.Affinity = words[13]
+	}
+	if len(words) > 14 {
+		r.RunDir = words[14]
+	}
+	if len(words) > 15 {
+		r.Scale, err = strconv.Atoi(words[15])
+		if err != nil {
+			return fmt.Errorf("invalid scale: %w", err)
+		}
+	}
+	if len(words) > 16 {
+		r.WorkDir = words[16]
+	}
+	if len(words) > 17 {
+		r.Transport = words[17]
+	}
+	return nil
+}
+
+// SaveRuns writes the results of the runs to a file
+func SaveRuns(path string, runs []RunResult) error {
+	var sb strings.Builder
+	for _, r := range runs {
+		result := "FAIL"
+		if r.Pass {
+			result = "PASS"
+		}
+		// Notes are free text, they must not break the format of the file
+		note := strings.NewReplacer("\t", " ", "\n", " ").Replace(r.Note)
+		fields := []string{r.Container, r.HostMPI, result, note,
+			r.ContainerMPI, r.Model, strconv.Itoa(r.NP), strconv.Itoa(r.NNodes), strconv.Itoa(r.ExitCode), r.WallTime.String(),
+			r.Usage.CPUTime, r.Usage.MaxRSS, r.Usage.Elapsed, r.Affinity, r.RunDir, strconv.Itoa(r.Scale), r.WorkDir, r.Transport}
+		sb.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+	return util.WriteFileAtomic(path, []byte(sb.String()), 0644)
+}
+
+// UpdateRun sets the result of the run of a container, replacing the previous result if any,
+// i.e., the previous result of the same scale with the same host MPI. A previous result with an
+// unknown host MPI, e.g., when no compatible MPI was found, is replaced by the result of any host MPI.
+func UpdateRun(runs []RunResult, r RunResult) []RunResult {
+	for i := range runs {
+		if runs[i].Container == r.Container && runs[i].Scale == r.Scale && (runs[i].HostMPI == r.HostMPI || runs[i].HostMPI == "") {
+			runs[i] = r
+			return runs
+		}
+	}
+	return append(runs, r)
+}
+
+// GetFailedRuns returns the runs that failed
+func GetFailedRuns(runs []RunResult) []RunResult {
+	var failed []RunResult
+	for _, r := range runs {
+		if !r.Pass {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package results
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRuns(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "runs-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, RunsFile)
+
+	runs, err := LoadRuns(path)
+	if err != nil || len(runs) != 0 {
+		t.Fatalf("unexpected results without file: %v (%v)", runs, err)
+	}
+
+	runs = UpdateRun(runs, RunResult{Container: "helloworld", HostMPI: "openmpi:4.0.2", Pass: true})
+	runs = UpdateRun(runs, RunResult{Container: "netpipe", HostMPI: "mpich:3.3", Pass: false, Note: "job\tcancelled\n", ContainerMPI: "mpich:3.3", Model: "hybrid", NP: 2, NNodes: 2, ExitCode: 137, WallTime: 1500 * time.Millisecond, Usage: Usage{CPUTime: "00:00:02", MaxRSS: "1024K", Elapsed: "00:00:01"}, Affinity: "map-by=socket bind-to=core", RunDir: "/sympi/runs/netpipe_mpich-3.3_20191014-150405", WorkDir: "/data", Transport: "FI_PROVIDER=verbs"})
+	err = SaveRuns(path, runs)
+	if err != nil {
+		t.Fatalf("failed to save results: %s", err)
+	}
+
+	loadedRuns, err := LoadRuns(path)
+	if err != nil {
+		t.Fatalf("failed to load results: %s", err)
+	}
+	runs[1].Note = "job cancelled "
+	if !reflect.DeepEqual(runs, loadedRuns) {
+		t.Fatalf("loaded %v instead of %v", loadedRuns, runs)
+	}
+
+	failed := GetFailedRuns(loadedRuns)
+	if len(failed) != 1 || failed[0].Container != "netpipe" {
+		t.Fatalf("invalid failed runs: %v", failed)
+	}
+
+	loadedRuns = UpdateRun(loadedRuns, RunResult{Container: "netpipe", HostMPI: "mpich:3.3", Pass: true})
+	if len(loadedRuns) != 2 || len(GetFailedRuns(loadedRuns)) != 0 {
+		t.Fatalf("result not updated: %v", loadedRuns)
+	}
+
+	// Each scale of a scaling study has its own result
+	loadedRuns = UpdateRun(loadedRuns, RunResult{Container: "netpipe", HostMPI: "mpich:3.3", NP: 4, Scale: 4})
+	if len(loadedRuns) != 3 || loadedRuns[1].Scale != 0 || loadedRuns[2].Scale != 4 {
+		t.Fatalf("result of the scale not added: %v", loadedRuns)
+	}
+
+	// Each host MPI has its own result, the results with an unknown host MPI are replaced
+	loadedRuns = UpdateRun(loadedRuns, RunResult{Container: "netpipe", HostMPI: "mpich:3.4", Pass: false})
+	if len(loadedRuns) != 4 || !loadedRuns[1].Pass {
+		t.Fatalf("result of the host MPI not added: %v", loadedRuns)
+	}
+	loadedRuns = UpdateRun(loadedRuns, RunResult{Container: "osu", Pass: false})
+	loadedRuns = UpdateRun(loadedRuns, RunResult{Container: "osu", HostMPI: "openmpi:4.0.2", Pass: true})
+	if len(loadedRuns) != 5 || loadedRuns[4].HostMPI != "openmpi:4.0.2" {
+		t.Fatalf("result with an unknown host MPI not replaced: %v", loadedRuns)
+	}
+}
+
+func TestLoadRunsFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []RunResult
+		fail     bool
+	}{
+		{
+			name:     "previous format",
+			content:  "helloworld\topenmpi:4.0.2\tPASS\t\nnetpipe\t\tFAIL\ttimeout\n",
+			expected: []RunResult{{Container: "helloworld", HostMPI: "openmpi:4.0.2", Pass: true}, {Container: "netpipe", Note: "timeout"}},
+		},
+		{
+			name:     "details",
+			content:  "helloworld\topenmpi:4.0.2\tPASS\t\topenmpi:4.0.2\tbind\t4\t2\t0\t2m3s\t\t\t\n",
+			expected: []RunResult{{Container: "helloworld", HostMPI: "openmpi:4.0.2", Pass: true, ContainerMPI: "openmpi:4.0.2", Model: "bind", NP: 4, NNodes: 2, WallTime: 123 * time.Second}},
+		},
+		{
+			name:     "affinity",
+			content:  "helloworld\topenmpi:4.0.2\tPASS\t\topenmpi:4.0.2\tbind\t4\t2\t0\t2m3s\t\t\t\tbind-to=core\n",
+			expected: []RunResult{{Container: "helloworld", HostMPI: "openmpi:4.0.2", Pass: true, ContainerMPI: "openmpi:4.0.2", Model: "bind", NP: 4, NNodes: 2, WallTime: 123 * time.Second, Affinity: "bind-to=core"}},
+		},
+		{
+			name:     "scale",
+			content:  "helloworld\topenmpi:4.0.2\tPASS\t\topenmpi:4.0.2\tbind\t8\t2\t0\t2m3s\t\t\t\t\t\t8\n",
+			expected: []RunResult{{Container: "helloworld", HostMPI: "openmpi:4.0.2", Pass: true, ContainerMPI: "openmpi:4.0.2", Model: "bind", NP: 8, NNodes: 2, WallTime: 123 * time.Second, Scale: 8}},
+		},
+		{
+			name:     "work directory",
+			content:  "helloworld\topenmpi:4.0.2\tPASS\t\topenmpi:4.0.2\tbind\t8\t2\t0\t2m3s\t\t\t\t\t\t0\t/data\n",
+			expected: []RunResult{{Container: "helloworld", HostMPI: "openmpi:4.0.2", Pass: true, ContainerMPI: "openmpi:4.0.2", Model: "bind", NP: 8, NNodes: 2, WallTime: 123 * time.Second, WorkDir: "/data"}},
+		},
+		{
+			name:    "missing details",
+			content: "helloworld\topenmpi:4.0.2\tPASS\t\topenmpi:4.0.2\tbind\n",
+			fail:    true,
+		},
+		{
+			name:    "invalid wall time",
+			content: "helloworld\topenmpi:4.0.2\tPASS\t\topenmpi:4.0.2\tbind\t4\t2\t0\tlong\t\t\t\n",
+			fail:    true,
+		},
+	}
+
+	tempDir, err := ioutil.TempDir("", "runs-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, RunsFile)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ioutil.WriteFile(path, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("failed to write %s: %s", path, err)
+			}
+			runs, err := LoadRuns(path)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("loading %q succeeded", tt.content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to load %q: %s", tt.content, err)
+			}
+			if !reflect.DeepEqual(runs, tt.expected) {
+				t.Fatalf("loaded %v instead of %v", runs, tt.expected)
+			}
+		})
+	}
+}
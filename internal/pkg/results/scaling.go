@@ -0,0 +1,100 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package results
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ParseScales parses a comma-separated list of numbers of ranks, e.g., 1,2,4,8; the duplicates
+// are ignored and the scales keep their order
+func ParseScales(list string) ([]int, error) {
+	var scales []int
+	seen := make(map[int]bool)
+	for _, s := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid number of ranks %q in %s", s, list)
+		}
+		if !seen[n] {
+			seen[n] = true
+			scales = append(scales, n)
+		}
+	}
+	return scales, nil
+}
+
+// ParseElapsed parses an elapsed time reported by sacct, e.g., 01:02:03, 2-01:02:03 or 02:03.456
+func ParseElapsed(elapsed string) (time.Duration, error) {
+	var days int
+	s := elapsed
+	if i := strings.Index(s, "-"); i >= 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days in %s", elapsed)
+		}
+		days = n
+		s = s[i+1:]
+	}
+	tokens := strings.Split(s, ":")
+	if len(tokens) < 2 || len(tokens) > 3 {
+		return 0, fmt.Errorf("invalid elapsed time %s", elapsed)
+	}
+	seconds, err := strconv.ParseFloat(tokens[len(tokens)-1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid elapsed time %s", elapsed)
+	}
+	d := time.Duration(days)*24*time.Hour + time.Duration(seconds*float64(time.Second))
+	units := []time.Duration{time.Minute, time.Hour}
+	for i, unit := range units[:len(tokens)-1] {
+		n, err := strconv.Atoi(tokens[len(tokens)-2-i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid elapsed time %s", elapsed)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// WriteScalingTable writes the results of the runs of a scaling study, by increasing scale,
+// with the speedup and the parallel efficiency of each scale relative to the smallest scale
+// that succeeded, i.e., for a strong-scaling study with the same problem size at all scales
+func WriteScalingTable(w io.Writer, runs []RunResult) error {
+	sorted := append([]RunResult{}, runs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Scale < sorted[j].Scale })
+
+	var base *RunResult
+	for i := range sorted {
+		if sorted[i].Pass && sorted[i].WallTime > 0 {
+			base = &sorted[i]
+			break
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ranks\tnodes\tresult\twall time\tspeedup\tefficiency\n")
+	for _, r := range sorted {
+		result := "FAIL"
+		if r.Pass {
+			result = "PASS"
+		}
+		speedup := "-"
+		efficiency := "-"
+		if base != nil && r.Pass && r.WallTime > 0 {
+			s := base.WallTime.Seconds() / r.WallTime.Seconds()
+			speedup = strconv.FormatFloat(s, 'f', 2, 64)
+			efficiency = strconv.FormatFloat(100*s*float64(base.Scale)/float64(r.Scale), 'f', 0, 64) + "%"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\n", r.Scale, r.NNodes, result, r.WallTime.Round(time.Millisecond), speedup, efficiency)
+	}
+	return tw.Flush()
+}
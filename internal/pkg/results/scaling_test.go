@@ -0,0 +1,120 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package results
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseScales(t *testing.T) {
+	tests := []struct {
+		list          string
+		expected      []int
+		expectedError bool
+	}{
+		{list: "4", expected: []int{4}},
+		{list: "1,2,4,8", expected: []int{1, 2, 4, 8}},
+		{list: "8, 2,8", expected: []int{8, 2}},
+		{list: "", expectedError: true},
+		{list: "1,,2", expectedError: true},
+		{list: "1,0", expectedError: true},
+		{list: "two", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			scales, err := ParseScales(tt.list)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("ParseScales() succeeded with %v", scales)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseScales() failed: %s", err)
+			}
+			if !reflect.DeepEqual(scales, tt.expected) {
+				t.Fatalf("ParseScales() returned %v instead of %v", scales, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseElapsed(t *testing.T) {
+	tests := []struct {
+		elapsed       string
+		expected      time.Duration
+		expectedError bool
+	}{
+		{elapsed: "00:00:07", expected: 7 * time.Second},
+		{elapsed: "01:02:03", expected: time.Hour + 2*time.Minute + 3*time.Second},
+		{elapsed: "2-01:00:00", expected: 49 * time.Hour},
+		{elapsed: "02:03.456", expected: 2*time.Minute + 3456*time.Millisecond},
+		{elapsed: "", expectedError: true},
+		{elapsed: "7", expectedError: true},
+		{elapsed: "aa:00:00", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.elapsed, func(t *testing.T) {
+			d, err := ParseElapsed(tt.elapsed)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("ParseElapsed() succeeded with %s", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseElapsed() failed: %s", err)
+			}
+			if d != tt.expected {
+				t.Fatalf("ParseElapsed() returned %s instead of %s", d, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteScalingTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		runs     []RunResult
+		expected string
+	}{
+		{
+			name: "strong scaling",
+			runs: []RunResult{
+				{Scale: 4, NP: 4, NNodes: 2, Pass: true, WallTime: 30 * time.Second},
+				{Scale: 1, NP: 1, NNodes: 1, Pass: true, WallTime: 100 * time.Second},
+				{Scale: 8, NP: 8, NNodes: 2, Pass: false, WallTime: time.Second},
+			},
+			expected: "ranks  nodes  result  wall time  speedup  efficiency\n" +
+				"1      1      PASS    1m40s      1.00     100%\n" +
+				"4      2      PASS    30s        3.33     83%\n" +
+				"8      2      FAIL    1s         -        -\n",
+		},
+		{
+			name:     "all failed",
+			runs:     []RunResult{{Scale: 2, NP: 2, NNodes: 1, WallTime: 1500 * time.Millisecond}},
+			expected: "ranks  nodes  result  wall time  speedup  efficiency\n" + "2      1      FAIL    1.5s       -        -\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteScalingTable(&buf, tt.runs)
+			if err != nil {
+				t.Fatalf("WriteScalingTable() failed: %s", err)
+			}
+			if buf.String() != tt.expected {
+				t.Fatalf("wrote %q instead of %q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package scratch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// ParseSize parses a size in bytes with an optional binary suffix, e.g., 500M or 10G
+func ParseSize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B"), "I")
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	return n * multiplier, nil
+}
+
+// GetScratchDirs returns the scratch directories sympi may have used for the different MPI
+// implementations, based on the current configuration and on the default location
+func GetScratchDirs(sysCfg *sys.Config) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, id := range []string{implem.OMPI, implem.MPICH, implem.IMPI} {
+		mpi := implem.Info{ID: id}
+		for _, dir := range []string{buildenv.GetDefaultScratchDir(&mpi, sysCfg), buildenv.GetDefaultScratchDir(&mpi, nil)} {
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// getLastModTime returns the most recent modification time of a file or of the content of a directory
+func getLastModTime(path string) (time.Time, error) {
+	var last time.Time
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.ModTime().After(last) {
+			last = fi.ModTime()
+		}
+		return nil
+	})
+	return last, err
+}
+
+// PruneOld removes the entries of a directory that were not modified for more than maxAge. An
+// entry is kept as long as one of the files it contains is recent, e.g., while a build is still
+// running. It returns the removed entries.
+func PruneOld(dir string, maxAge time.Duration, now time.Time) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		last, err := getLastModTime(path)
+		if err != nil {
+			log.Printf("[WARN] unable to get the age of %s: %s", path, err)
+			continue
+		}
+		if now.Sub(last) <= maxAge {
+			continue
+		}
+		err = os.RemoveAll(path)
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// PruneCache removes the oldest files of a cache until its size is at most maxSize. It returns
+// the removed files.
+func PruneCache(dir string, maxSize int64) ([]string, error) {
+	type cachedFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []cachedFile
+	var total int64
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			files = append(files, cachedFile{path: p, size: fi.Size(), modTime: fi.ModTime()})
+			total += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	var removed []string
+	for _, f := range files {
+		if total <= maxSize {
+			break
+		}
+		err := os.Remove(f.path)
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", f.path, err)
+		}
+		total -= f.size
+		removed = append(removed, f.path)
+	}
+	return removed, nil
+}
+
+// Prune applies the scratch management policy of the configuration: the scratch and build
+// artifacts older than sysCfg.ScratchMaxAge are removed and the oldest files of the cache are
+// removed until its size is at most sysCfg.CacheMaxSize. It returns the removed files and
+// directories.
+func Prune(sysCfg *sys.Config) ([]string, error) {
+	var removed []string
+	if sysCfg.ScratchMaxAge > 0 {
+		now := time.Now()
+		for _, dir := range GetScratchDirs(sysCfg) {
+			r, err := PruneOld(dir, sysCfg.ScratchMaxAge, now)
+			removed = append(removed, r...)
+			if err != nil {
+				return removed, err
+			}
+		}
+	}
+	if sysCfg.CacheMaxSize > 0 {
+		r, err := PruneCache(sys.GetCacheDir(), sysCfg.CacheMaxSize)
+		removed = append(removed, r...)
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
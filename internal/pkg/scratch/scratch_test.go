@@ -0,0 +1,138 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package scratch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size        string
+		expected    int64
+		expectedErr bool
+	}{
+		{size: "1024", expected: 1024},
+		{size: "500M", expected: 500 << 20},
+		{size: "10G", expected: 10 << 30},
+		{size: "10GiB", expected: 10 << 30},
+		{size: "2kb", expected: 2 << 10},
+		{size: "", expectedErr: true},
+		{size: "ten", expectedErr: true},
+		{size: "-1G", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			size, err := ParseSize(tt.size)
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatalf("%s successfully parsed", tt.size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse %s: %s", tt.size, err)
+			}
+			if size != tt.expected {
+				t.Fatalf("%s parsed as %d instead of %d", tt.size, size, tt.expected)
+			}
+		})
+	}
+}
+
+// createFile creates a file with a given size and modification time
+func createFile(t *testing.T, path string, size int, modTime time.Time) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", filepath.Dir(path), err)
+	}
+	err = ioutil.WriteFile(path, make([]byte, size), 0644)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", path, err)
+	}
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatalf("failed to set the modification time of %s: %s", path, err)
+	}
+}
+
+func TestPruneOld(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	createFile(t, filepath.Join(dir, "mpi_build_openmpi_4.0.2", "Makefile"), 1, old)
+	createFile(t, filepath.Join(dir, "mpi_build_openmpi_4.1.4", "Makefile"), 1, old)
+	createFile(t, filepath.Join(dir, "mpi_build_openmpi_4.1.4", "src", "libmpi.so"), 1, now)
+	createFile(t, filepath.Join(dir, "openmpi-4.0.2.tar.bz2"), 1, old)
+	// Directories are created with the current time
+	for _, d := range []string{"mpi_build_openmpi_4.0.2", "mpi_build_openmpi_4.1.4"} {
+		os.Chtimes(filepath.Join(dir, d), old, old)
+	}
+	os.Chtimes(filepath.Join(dir, "mpi_build_openmpi_4.1.4", "src"), old, old)
+
+	removed, err := PruneOld(dir, 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("PruneOld() failed: %s", err)
+	}
+	expected := []string{filepath.Join(dir, "mpi_build_openmpi_4.0.2"), filepath.Join(dir, "openmpi-4.0.2.tar.bz2")}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Fatalf("removed %v instead of %v", removed, expected)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mpi_build_openmpi_4.1.4")); err != nil {
+		t.Fatalf("recent build directory was removed: %s", err)
+	}
+
+	removed, err = PruneOld(filepath.Join(dir, "missing"), time.Hour, now)
+	if err != nil || len(removed) != 0 {
+		t.Fatalf("pruning a missing directory removed %v: %v", removed, err)
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	createFile(t, filepath.Join(dir, "openmpi-4.0.2.tar.bz2"), 100, now.Add(-3*time.Hour))
+	createFile(t, filepath.Join(dir, "config", "abcd_openmpi.conf"), 10, now.Add(-2*time.Hour))
+	createFile(t, filepath.Join(dir, "openmpi-4.1.4.tar.bz2"), 100, now.Add(-1*time.Hour))
+
+	tests := []struct {
+		name     string
+		maxSize  int64
+		expected []string
+	}{
+		{name: "under the cap", maxSize: 1000},
+		{name: "oldest removed", maxSize: 150, expected: []string{filepath.Join(dir, "openmpi-4.0.2.tar.bz2")}},
+		{name: "several removed", maxSize: 50, expected: []string{filepath.Join(dir, "config", "abcd_openmpi.conf"), filepath.Join(dir, "openmpi-4.1.4.tar.bz2")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, err := PruneCache(dir, tt.maxSize)
+			if err != nil {
+				t.Fatalf("PruneCache() failed: %s", err)
+			}
+			if !reflect.DeepEqual(removed, tt.expected) {
+				t.Fatalf("removed %v instead of %v", removed, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package session
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// MPIDirEnv is the environment variable marking the MPI loaded by default with its installation directory
+	MPIDirEnv = "SYMPI_LOADED_MPI_DIR"
+
+	// SingularityDirEnv is the environment variable marking the Singularity loaded with its installation directory
+	SingularityDirEnv = "SYMPI_LOADED_SINGULARITY_DIR"
+)
+
+// Loaded is a software loaded by sympi in a session. The environment variable marking it records
+// its installation directory, i.e., exactly the entries sympi added to PATH and LD_LIBRARY_PATH,
+// so that unloading it removes these entries and nothing else.
+type Loaded struct {
+	// Env is the environment variable marking the software, e.g., MPIDirEnv
+	Env string
+
+	// Dir is the installation directory of the software
+	Dir string
+}
+
+// isMarker checks whether an environment variable marks a software loaded by sympi
+func isMarker(name string) bool {
+	return name == MPIDirEnv || name == SingularityDirEnv || parseNamespaceEnv(name) != ""
+}
+
+// GetLoaded returns the software loaded by sympi based on the markers of an environment, e.g.,
+// os.Environ(), sorted by marker
+func GetLoaded(environ []string) []Loaded {
+	var loaded []Loaded
+	for _, e := range environ {
+		tokens := strings.SplitN(e, "=", 2)
+		if len(tokens) != 2 || tokens[1] == "" || !isMarker(tokens[0]) {
+			continue
+		}
+		loaded = append(loaded, Loaded{Env: tokens[0], Dir: tokens[1]})
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Env < loaded[j].Env })
+	return loaded
+}
+
+// GetLoadedDir returns the installation directory of the software marked by an environment
+// variable in a list of loaded software; empty if the software is not loaded
+func GetLoadedDir(loaded []Loaded, env string) string {
+	for _, l := range loaded {
+		if l.Env == env {
+			return l.Dir
+		}
+	}
+	return ""
+}
+
+// GetPathEntries returns the entries a software installed in a directory adds to PATH and LD_LIBRARY_PATH
+func GetPathEntries(dir string) (string, string) {
+	return filepath.Join(dir, "bin"), filepath.Join(dir, "lib")
+}
+
+// RemoveEntries removes entries from a list of paths such as PATH, the entries being matched exactly
+func RemoveEntries(list []string, entries ...string) []string {
+	var res []string
+	for _, e := range list {
+		keep := true
+		for _, r := range entries {
+			if filepath.Clean(e) == filepath.Clean(r) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// GenerateEnvFile returns the content of a session file setting PATH, LD_LIBRARY_PATH and the
+// markers of the loaded software; the markers of the unloaded software are unset
+func GenerateEnvFile(path string, ldlib string, loaded []Loaded, unloaded []string) string {
+	content := "export PATH=" + path + "\n" + "export LD_LIBRARY_PATH=" + ldlib + "\n"
+	for _, l := range loaded {
+		content += "export " + l.Env + "=" + l.Dir + "\n"
+	}
+	for _, env := range unloaded {
+		content += "unset " + env + "\n"
+	}
+	return content
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package session
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetLoaded(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"SYMPI_LOADED_MPI_DIR=/opt/sympi/mpi_install_mpich-3.3",
+		"SYMPI_LOADED_SINGULARITY_DIR=",
+		"SYMPI_MPI_TOOLS_DIR=/opt/sympi/mpi_install_openmpi-4.0.2",
+		"SYMPI_OTHER_DIR=/opt/other",
+	}
+	expected := []Loaded{
+		{Env: MPIDirEnv, Dir: "/opt/sympi/mpi_install_mpich-3.3"},
+		{Env: "SYMPI_MPI_TOOLS_DIR", Dir: "/opt/sympi/mpi_install_openmpi-4.0.2"},
+	}
+	loaded := GetLoaded(environ)
+	if !reflect.DeepEqual(loaded, expected) {
+		t.Fatalf("GetLoaded() returned %v instead of %v", loaded, expected)
+	}
+	if dir := GetLoadedDir(loaded, SingularityDirEnv); dir != "" {
+		t.Fatalf("Singularity loaded from %s", dir)
+	}
+}
+
+func TestRemoveEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     []string
+		entries  []string
+		expected []string
+	}{
+		{name: "exact match", list: []string{"/opt/mpi/bin", "/usr/bin"}, entries: []string{"/opt/mpi/bin"}, expected: []string{"/usr/bin"}},
+		{name: "trailing slash", list: []string{"/opt/mpi/bin/", "/usr/bin"}, entries: []string{"/opt/mpi/bin"}, expected: []string{"/usr/bin"}},
+		{name: "no substring match", list: []string{"/opt/mpi/bin2", "/home/user/opt/mpi/bin"}, entries: []string{"/opt/mpi/bin"}, expected: []string{"/opt/mpi/bin2", "/home/user/opt/mpi/bin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := RemoveEntries(tt.list, tt.entries...)
+			if !reflect.DeepEqual(res, tt.expected) {
+				t.Fatalf("RemoveEntries() returned %v instead of %v", res, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateEnvFile(t *testing.T) {
+	loaded := []Loaded{{Env: MPIDirEnv, Dir: "/opt/sympi/mpi_install_openmpi-4.0.2"}}
+	expected := "export PATH=/opt/sympi/mpi_install_openmpi-4.0.2/bin:/usr/bin\n" +
+		"export LD_LIBRARY_PATH=/opt/sympi/mpi_install_openmpi-4.0.2/lib\n" +
+		"export SYMPI_LOADED_MPI_DIR=/opt/sympi/mpi_install_openmpi-4.0.2\n" +
+		"unset SYMPI_MPI_OLD_DIR\n"
+	content := GenerateEnvFile("/opt/sympi/mpi_install_openmpi-4.0.2/bin:/usr/bin", "/opt/sympi/mpi_install_openmpi-4.0.2/lib", loaded, []string{GetNamespaceEnv("old")})
+	if content != expected {
+		t.Fatalf("GenerateEnvFile() returned %q instead of %q", content, expected)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// namespaceEnvPrefix and namespaceEnvSuffix surround the name of a namespace in the name of
+	// the environment variable marking the MPI loaded in it, e.g., SYMPI_MPI_TOOLS_DIR
+	namespaceEnvPrefix = "SYMPI_MPI_"
+	namespaceEnvSuffix = "_DIR"
+)
+
+var namespaceRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// NamespacedMPI is a MPI loaded in a namespace. Unlike the MPI loaded by default, of which there
+// is only one, MPIs loaded in different namespaces coexist in the session and are unloaded individually.
+type NamespacedMPI struct {
+	// Namespace is the name of the namespace, e.g., tools
+	Namespace string
+
+	// Dir is the installation directory of the MPI
+	Dir string
+}
+
+// CheckNamespace checks that the name of a namespace is valid, i.e., lowercase letters, digits and
+// underscores starting with a letter, so it can be part of the name of an environment variable
+func CheckNamespace(namespace string) error {
+	if !namespaceRegexp.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace %q, it should only have lowercase letters, digits and underscores and start with a letter", namespace)
+	}
+	return nil
+}
+
+// GetNamespaceEnv returns the environment variable with the installation directory of the MPI
+// loaded in a namespace, e.g., SYMPI_MPI_TOOLS_DIR for the tools namespace
+func GetNamespaceEnv(namespace string) string {
+	return namespaceEnvPrefix + strings.ToUpper(namespace) + namespaceEnvSuffix
+}
+
+// parseNamespaceEnv returns the namespace of the environment variable marking the MPI loaded in
+// it, or an empty string when the variable is not such a marker
+func parseNamespaceEnv(name string) string {
+	if len(name) <= len(namespaceEnvPrefix)+len(namespaceEnvSuffix) || !strings.HasPrefix(name, namespaceEnvPrefix) || !strings.HasSuffix(name, namespaceEnvSuffix) {
+		return ""
+	}
+	namespace := strings.ToLower(name[len(namespaceEnvPrefix) : len(name)-len(namespaceEnvSuffix)])
+	if CheckNamespace(namespace) != nil {
+		return ""
+	}
+	return namespace
+}
+
+// GetNamespacedMPIs returns the MPIs loaded in namespaces based on the markers of an environment,
+// e.g., os.Environ(), sorted by namespace
+func GetNamespacedMPIs(environ []string) []NamespacedMPI {
+	var mpis []NamespacedMPI
+	for _, l := range GetLoaded(environ) {
+		if namespace := parseNamespaceEnv(l.Env); namespace != "" {
+			mpis = append(mpis, NamespacedMPI{Namespace: namespace, Dir: l.Dir})
+		}
+	}
+	sort.Slice(mpis, func(i, j int) bool { return mpis[i].Namespace < mpis[j].Namespace })
+	return mpis
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package session
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckNamespace(t *testing.T) {
+	tests := []struct {
+		namespace     string
+		expectedError bool
+	}{
+		{namespace: "tools"},
+		{namespace: "ompi_4"},
+		{namespace: "", expectedError: true},
+		{namespace: "Tools", expectedError: true},
+		{namespace: "4tools", expectedError: true},
+		{namespace: "my-tools", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			err := CheckNamespace(tt.namespace)
+			if tt.expectedError && err == nil {
+				t.Fatalf("invalid namespace accepted")
+			}
+			if !tt.expectedError && err != nil {
+				t.Fatalf("CheckNamespace() failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetNamespacedMPIs(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"SYMPI_MPI_TOOLS_DIR=/opt/sympi/mpi_install_openmpi-4.0.2",
+		"SYMPI_MPI_DIR=/opt/sympi/mpi_install_mpich-3.3",
+		"SYMPI_MPI_OLD_MPI_DIR=/opt/sympi/mpi_install_mpich-3.3",
+		"SYMPI_MPI_EMPTY_DIR=",
+	}
+	expected := []NamespacedMPI{
+		{Namespace: "old_mpi", Dir: "/opt/sympi/mpi_install_mpich-3.3"},
+		{Namespace: "tools", Dir: "/opt/sympi/mpi_install_openmpi-4.0.2"},
+	}
+	mpis := GetNamespacedMPIs(environ)
+	if !reflect.DeepEqual(mpis, expected) {
+		t.Fatalf("GetNamespacedMPIs() returned %v instead of %v", mpis, expected)
+	}
+}
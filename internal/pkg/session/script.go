@@ -0,0 +1,77 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// Software is a software loaded in a session, e.g., MPI or Singularity
+type Software struct {
+	// Name is the name of the software, also used as the name of its module, e.g., openmpi
+	Name string
+
+	// Version is the version of the software
+	Version string
+
+	// InstallDir is the directory where the software is installed
+	InstallDir string
+
+	// ModulefilesDir is the directory with the modulefile of the software; none if empty
+	ModulefilesDir string
+
+	// Namespace is the namespace a MPI is loaded in, e.g., tools; empty for the MPI loaded by default
+	Namespace string
+}
+
+// quote quotes a string for POSIX shells
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// getPathUpdate returns the command adding a directory to a list of paths such as PATH in a
+// given order, without an empty entry when the variable is not set
+func getPathUpdate(envVar string, dir string, order string) string {
+	if order == sys.PathOrderAppend {
+		return fmt.Sprintf("export %s=${%s:+$%s:}%s\n", envVar, envVar, envVar, quote(dir))
+	}
+	return fmt.Sprintf("export %s=%s${%s:+:$%s}\n", envVar, quote(dir), envVar, envVar)
+}
+
+// GenerateScript returns a POSIX shell script setting up the environment to use software, e.g.,
+// in another shell or a batch script. Software with a modulefile is loaded with the module
+// command when available, its installation directories being in any case added to PATH and
+// LD_LIBRARY_PATH in a given order.
+func GenerateScript(software []Software, order string) string {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n# Environment saved by sympi -save-env\n")
+	for _, s := range software {
+		if s.Namespace == "" {
+			script.WriteString(fmt.Sprintf("\n# %s %s\n", s.Name, s.Version))
+		} else {
+			// The marker of the namespace lets the scripts find the MPI loaded in it
+			script.WriteString(fmt.Sprintf("\n# %s %s (namespace %s)\n", s.Name, s.Version, s.Namespace))
+			script.WriteString("export " + GetNamespaceEnv(s.Namespace) + "=" + quote(s.InstallDir) + "\n")
+		}
+		pathUpdates := getPathUpdate("PATH", filepath.Join(s.InstallDir, "bin"), order) +
+			getPathUpdate("LD_LIBRARY_PATH", filepath.Join(s.InstallDir, "lib"), order)
+		if s.ModulefilesDir == "" {
+			script.WriteString(pathUpdates)
+			continue
+		}
+		script.WriteString("if command -v module >/dev/null 2>&1; then\n")
+		script.WriteString("\tmodule use " + quote(s.ModulefilesDir) + "\n")
+		script.WriteString("\tmodule load " + quote(s.Name+"/"+s.Version) + "\n")
+		script.WriteString("else\n")
+		script.WriteString("\t" + strings.Replace(strings.TrimSuffix(pathUpdates, "\n"), "\n", "\n\t", -1) + "\n")
+		script.WriteString("fi\n")
+	}
+	return script.String()
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package session
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestGenerateScript(t *testing.T) {
+	ompi := Software{Name: "openmpi", Version: "4.0.2", InstallDir: "/opt/sympi/mpi_install_openmpi-4.0.2"}
+	ompiModule := ompi
+	ompiModule.ModulefilesDir = "/opt/modulefiles"
+	sy := Software{Name: "singularity", Version: "3.5.2", InstallDir: "/opt/sympi/install_singularity-3.5.2"}
+	tools := Software{Name: "mpich", Version: "3.3", InstallDir: "/opt/sympi/mpi_install_mpich-3.3", Namespace: "tools"}
+
+	tests := []struct {
+		name     string
+		software []Software
+		order    string
+		expected []string
+	}{
+		{
+			name:     "prepend",
+			software: []Software{ompi, sy},
+			order:    sys.PathOrderPrepend,
+			expected: []string{
+				"export PATH='/opt/sympi/mpi_install_openmpi-4.0.2/bin'${PATH:+:$PATH}\n",
+				"export LD_LIBRARY_PATH='/opt/sympi/mpi_install_openmpi-4.0.2/lib'${LD_LIBRARY_PATH:+:$LD_LIBRARY_PATH}\n",
+				"export PATH='/opt/sympi/install_singularity-3.5.2/bin'${PATH:+:$PATH}\n",
+			},
+		},
+		{
+			name:     "namespace",
+			software: []Software{ompi, tools},
+			expected: []string{
+				"# mpich 3.3 (namespace tools)\nexport SYMPI_MPI_TOOLS_DIR='/opt/sympi/mpi_install_mpich-3.3'\n",
+				"export PATH='/opt/sympi/mpi_install_mpich-3.3/bin'${PATH:+:$PATH}\n",
+			},
+		},
+		{
+			name:     "append",
+			software: []Software{ompi},
+			order:    sys.PathOrderAppend,
+			expected: []string{"export PATH=${PATH:+$PATH:}'/opt/sympi/mpi_install_openmpi-4.0.2/bin'\n"},
+		},
+		{
+			name:     "module",
+			software: []Software{ompiModule},
+			expected: []string{
+				"\tmodule use '/opt/modulefiles'\n\tmodule load 'openmpi/4.0.2'\nelse\n",
+				"\texport PATH='/opt/sympi/mpi_install_openmpi-4.0.2/bin'${PATH:+:$PATH}\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := GenerateScript(tt.software, tt.order)
+			if !strings.HasPrefix(script, "#!/bin/sh\n") {
+				t.Fatalf("invalid script %q", script)
+			}
+			for _, e := range tt.expected {
+				if !strings.Contains(script, e) {
+					t.Fatalf("%q not in %q", e, script)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package session locates the session file of the shell started by sympi_init, which the shell
+// sources before each prompt so that sympi can modify its environment, e.g., when loading MPI.
+package session
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+)
+
+const (
+	// FileEnv is the environment variable set by sympi_init with the path to the session file
+	// sourced by its shell
+	FileEnv = "SYMPI_SESSION_FILE"
+
+	// DefaultProcDir is the directory with the information about the processes
+	DefaultProcDir = "/proc"
+
+	// filePrefix is the prefix of the session files, followed by the pid of the process that created them
+	filePrefix = "sympi_"
+
+	// fileDir is the directory of the session files; it is the one hardcoded in sympi_init,
+	// whatever TMPDIR is, so the files of the sessions it starts can be found
+	fileDir = "/tmp"
+)
+
+// ErrStaleSession is the error returned when the session file is not the one of a live session
+// of the user, e.g., after the shell of the session exited
+var ErrStaleSession = errors.New("stale SyMPI session")
+
+// GetDefaultFile returns the default path of the session file created by a process
+func GetDefaultFile(pid int) string {
+	return filepath.Join(fileDir, filePrefix+strconv.Itoa(pid))
+}
+
+// getParentPID returns the pid of the parent of a process
+func getParentPID(procDir string, pid int) (int, error) {
+	statusFile := filepath.Join(procDir, strconv.Itoa(pid), "status")
+	f, err := os.Open(statusFile)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open %s: %w", statusFile, err)
+	}
+	defer f.Close()
+	for s := bufio.NewScanner(f); s.Scan(); {
+		var ppid int
+		if n, _ := fmt.Sscanf(s.Text(), "PPid:\t%d", &ppid); n == 1 {
+			return ppid, nil
+		}
+	}
+	return -1, fmt.Errorf("no parent in %s", statusFile)
+}
+
+// GetFile returns the session file of the shell a command is executed from, ppid being the pid
+// of the shell: the file set by sympi_init in the environment or, for sessions started by
+// previous versions of sympi_init, the file named after the pid of sympi_init, the parent of the shell.
+func GetFile(procDir string, ppid int) (string, error) {
+	if file := os.Getenv(FileEnv); file != "" {
+		return file, nil
+	}
+	pppid, err := getParentPID(procDir, ppid)
+	if err != nil {
+		return "", fmt.Errorf("failed to get PPPID: %w", err)
+	}
+	return GetDefaultFile(pppid), nil
+}
+
+// getOwner returns the uid of the owner of a file
+func getOwner(fi os.FileInfo) int {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int(st.Uid)
+	}
+	return -1
+}
+
+// Check checks that a session file is the file of a live session of the user: the process that
+// created it, whose pid is in the name of the file, must still run as the user and the file must
+// belong to the user. Otherwise, sympi could modify the environment of another shell or user.
+func Check(procDir string, file string) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("file %s does not exist: %w", file, sympierr.ErrNotInitialized)
+	}
+	if owner := getOwner(fi); owner != os.Getuid() {
+		return fmt.Errorf("%s belongs to user %d: %w", file, owner, ErrStaleSession)
+	}
+
+	name := filepath.Base(file)
+	if !strings.HasPrefix(name, filePrefix) {
+		// Custom session files are not named after a process
+		return nil
+	}
+	pid, err := strconv.Atoi(strings.TrimPrefix(name, filePrefix))
+	if err != nil {
+		return nil
+	}
+	if pid <= 1 {
+		// The shell was adopted by init, the process that created its session exited
+		return fmt.Errorf("%s is not the file of a session: %w", file, ErrStaleSession)
+	}
+	pfi, err := os.Stat(filepath.Join(procDir, strconv.Itoa(pid)))
+	if err != nil {
+		return fmt.Errorf("process %d that created %s has exited: %w", pid, file, ErrStaleSession)
+	}
+	if owner := getOwner(pfi); owner != os.Getuid() {
+		return fmt.Errorf("process %d that created %s now belongs to user %d: %w", pid, file, owner, ErrStaleSession)
+	}
+	return nil
+}
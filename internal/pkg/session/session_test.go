@@ -0,0 +1,118 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package session
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+)
+
+// createProcess simulates a process in a proc directory
+func createProcess(t *testing.T, procDir string, pid int, ppid int) {
+	dir := filepath.Join(procDir, strconv.Itoa(pid))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", dir, err)
+	}
+	status := "Name:\tbash\nPid:\t" + strconv.Itoa(pid) + "\nPPid:\t" + strconv.Itoa(ppid) + "\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644)
+	if err != nil {
+		t.Fatalf("failed to create the status of %d: %s", pid, err)
+	}
+}
+
+func TestGetFile(t *testing.T) {
+	procDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(procDir)
+	createProcess(t, procDir, 200, 100)
+
+	// sympi_init always creates the session files in /tmp
+	tmpDir := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", procDir)
+	defer os.Setenv("TMPDIR", tmpDir)
+
+	tests := []struct {
+		name          string
+		env           string
+		ppid          int
+		expectedFile  string
+		expectedError bool
+	}{
+		{name: "environment", env: "/tmp/custom", ppid: 200, expectedFile: "/tmp/custom"},
+		{name: "parent of the shell", ppid: 200, expectedFile: "/tmp/sympi_100"},
+		{name: "missing shell", ppid: 300, expectedError: true},
+	}
+
+	defer os.Unsetenv(FileEnv)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(FileEnv, tt.env)
+			file, err := GetFile(procDir, tt.ppid)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("GetFile() succeeded with %s", file)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetFile() failed: %s", err)
+			}
+			if file != tt.expectedFile {
+				t.Fatalf("session file is %s instead of %s", file, tt.expectedFile)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	procDir := filepath.Join(tempDir, "proc")
+	createProcess(t, procDir, 100, 1)
+
+	for _, f := range []string{filePrefix + "100", filePrefix + "1", filePrefix + "4242", "custom"} {
+		err := ioutil.WriteFile(filepath.Join(tempDir, f), nil, 0644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", f, err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		file          string
+		expectedError error
+	}{
+		{name: "live session", file: filePrefix + "100"},
+		{name: "custom file", file: "custom"},
+		{name: "shell adopted by init", file: filePrefix + "1", expectedError: ErrStaleSession},
+		{name: "missing pppid", file: filePrefix + "4242", expectedError: ErrStaleSession},
+		{name: "missing file", file: filePrefix + "200", expectedError: sympierr.ErrNotInitialized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(procDir, filepath.Join(tempDir, tt.file))
+			if tt.expectedError == nil && err != nil {
+				t.Fatalf("Check() failed: %s", err)
+			}
+			if tt.expectedError != nil && !errors.Is(err, tt.expectedError) {
+				t.Fatalf("Check() returned %v instead of %s", err, tt.expectedError)
+			}
+		})
+	}
+}
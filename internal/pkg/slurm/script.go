@@ -0,0 +1,171 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package slurm
+
+import (
+	"github.com/sylabs/singularity-mpi/internal/pkg/job"
+)
+
+// HetGroup gathers the directives of one of the components of a heterogeneous job
+type HetGroup struct {
+	// Partition is the partition where the component is allocated (optional)
+	Partition string
+
+	// Constraint is the list of features required by the nodes of the component (optional)
+	Constraint string
+
+	// Nodes is the number of nodes of the component; 0 if not specified
+	Nodes int64
+
+	// NTasks is the number of ranks of the component; 0 if not specified
+	NTasks int64
+
+	// NTasksPerNode is the number of ranks per node of the component; 0 if not specified
+	NTasksPerNode int64
+}
+
+// ScriptData gathers the fields available to the template of a batch script
+type ScriptData struct {
+	// Job is the job the script starts, e.g., {{.Job.App.Name}} is the name of the application
+	Job *job.Job
+
+	// Partition is the partition where the job is submitted (optional)
+	Partition string
+
+	// Account is the account charged for the job (optional)
+	Account string
+
+	// Time is the time limit of the job (optional)
+	Time string
+
+	// HetGroups are the components of a heterogeneous job; empty for other jobs, in which case
+	// Nodes and NTasks describe the allocation
+	HetGroups []HetGroup
+
+	// Nodes is the number of nodes of the job; 0 if not specified
+	Nodes int64
+
+	// NTasks is the total number of ranks of the job; 0 if not specified
+	NTasks int64
+
+	// NTasksPerNode is the number of ranks per node; 0 if not specified
+	NTasksPerNode int64
+
+	// Array is the range of the indexes of the tasks of a job array, e.g., 0-3; empty for other jobs
+	Array string
+
+	// ArrayValues are the values of the parameter of the tasks of a job array, quoted for the
+	// shell; the task with index i sets the variable job.ArrayValueVar to the value i
+	ArrayValues []string
+
+	// ErrorFile is the path to the file where stderr of the job is saved
+	ErrorFile string
+
+	// OutputFile is the path to the file where stdout of the job is saved
+	OutputFile string
+
+	// MPIDir is the directory where the host MPI used to start the job is installed
+	MPIDir string
+
+	// ExportEnv are the host environment variables forwarded to the job, as shell assignments, e.g., OMP_NUM_THREADS='4'
+	ExportEnv []string
+
+	// PMIEnv are the variables tuning PMI/PMIx set for the job, as shell assignments, e.g., PMIX_MCA_gds='hash'
+	PMIEnv []string
+
+	// JobScratchDir is the job-local scratch directory the job runs from; empty if not enabled
+	JobScratchDir string
+
+	// MpirunCmd is the complete command starting the application(s): mpirun, or srun with one
+	// --het-group section per component for heterogeneous jobs
+	MpirunCmd string
+}
+
+// DefaultScriptTemplate is the built-in template of the batch scripts. With a heterogeneous job, the
+// options of the whole job, e.g., the time limit, are set with the first component.
+const DefaultScriptTemplate = `#!/bin/bash
+#
+{{- if .HetGroups}}
+{{- range $i, $g := .HetGroups}}
+{{- if $i}}
+` + ScriptCmdPrefix + ` hetjob
+{{- end}}
+{{- if $g.Partition}}
+` + ScriptCmdPrefix + ` --partition={{$g.Partition}}
+{{- end}}
+{{- if $g.Constraint}}
+` + ScriptCmdPrefix + ` --constraint={{$g.Constraint}}
+{{- end}}
+{{- if $g.Nodes}}
+` + ScriptCmdPrefix + ` --nodes={{$g.Nodes}}
+{{- end}}
+{{- if $g.NTasks}}
+` + ScriptCmdPrefix + ` --ntasks={{$g.NTasks}}
+{{- end}}
+{{- if $g.NTasksPerNode}}
+` + ScriptCmdPrefix + ` --ntasks-per-node={{$g.NTasksPerNode}}
+{{- end}}
+{{- if not $i}}
+{{- if $.Account}}
+` + ScriptCmdPrefix + ` --account={{$.Account}}
+{{- end}}
+{{- if $.Time}}
+` + ScriptCmdPrefix + ` --time={{$.Time}}
+{{- end}}
+` + ScriptCmdPrefix + ` --error={{$.ErrorFile}}
+` + ScriptCmdPrefix + ` --output={{$.OutputFile}}
+{{- end}}
+{{- end}}
+{{- else}}
+{{- if .Partition}}
+` + ScriptCmdPrefix + ` --partition={{.Partition}}
+{{- end}}
+{{- if .Account}}
+` + ScriptCmdPrefix + ` --account={{.Account}}
+{{- end}}
+{{- if .Nodes}}
+` + ScriptCmdPrefix + ` --nodes={{.Nodes}}
+{{- end}}
+{{- if .NTasks}}
+` + ScriptCmdPrefix + ` --ntasks={{.NTasks}}
+{{- end}}
+{{- if .NTasksPerNode}}
+` + ScriptCmdPrefix + ` --ntasks-per-node={{.NTasksPerNode}}
+{{- end}}
+{{- if .Time}}
+` + ScriptCmdPrefix + ` --time={{.Time}}
+{{- end}}
+{{- if .Array}}
+` + ScriptCmdPrefix + ` --array={{.Array}}
+{{- end}}
+` + ScriptCmdPrefix + ` --error={{.ErrorFile}}
+` + ScriptCmdPrefix + ` --output={{.OutputFile}}
+{{- end}}
+
+export PATH={{.MPIDir}}/bin:$PATH
+export LD_LIBRARY_PATH={{.MPIDir}}/lib:$LD_LIBRARY_PATH
+{{- range .ExportEnv}}
+export {{.}}
+{{- end}}
+{{- range .PMIEnv}}
+export {{.}}
+{{- end}}
+{{- if .ArrayValues}}
+# Each task of the array runs with the value of the parameter selected by its index
+SYMPI_ARRAY_VALUES=({{range $i, $v := .ArrayValues}}{{if $i}} {{end}}{{$v}}{{end}})
+` + job.ArrayValueVar + `=${SYMPI_ARRAY_VALUES[$SLURM_ARRAY_TASK_ID]}
+{{- end}}
+{{- if .JobScratchDir}}
+
+# The output and error files are still written in a persistent directory
+JOB_SCRATCH={{.JobScratchDir}}/sympi-$SLURM_JOB_ID
+mkdir -p $JOB_SCRATCH
+trap 'rm -rf $JOB_SCRATCH' EXIT
+cd $JOB_SCRATCH
+{{- end}}
+
+{{.MpirunCmd}}
+`
@@ -15,4 +15,28 @@ const (
 
 	// ScriptCmdPrefix is the prefix to add to a script
 	ScriptCmdPrefix = "#SBATCH"
+
+	// JobScratchKey is the key used to specify whether jobs shall run from a job-local scratch
+	// directory, e.g., a node-local tmpfs, instead of the scratch directory of the login node
+	JobScratchKey = "slurm_job_scratch"
+
+	// JobScratchDirKey is the key used to specify the job-local scratch directory, resolved when
+	// the job starts, e.g., $SLURM_TMPDIR
+	JobScratchDirKey = "slurm_job_scratch_dir"
+
+	// DefaultJobScratchDir is the default job-local scratch directory
+	DefaultJobScratchDir = "${SLURM_TMPDIR:-/dev/shm}"
+
+	// AccountKey is the key used to specify the account charged for the jobs
+	AccountKey = "slurm_account"
+
+	// TimeKey is the key used to specify the time limit of the jobs, in a format supported by sbatch, e.g., 01:00:00
+	TimeKey = "slurm_time"
+
+	// MPIKey is the key used to specify the MPI plugin of srun (--mpi=) when ranks are started by Slurm,
+	// e.g., pmix; the default of the system if not set
+	MPIKey = "slurm_mpi"
+
+	// TemplateKey is the key used to specify the path to a template of batch script replacing the default one
+	TemplateKey = "slurm_template"
 )
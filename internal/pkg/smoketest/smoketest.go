@@ -0,0 +1,120 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package smoketest checks that a MPI installed on the host actually works by compiling and
+// running a small MPI program against it.
+package smoketest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mpi"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+// NP is the number of ranks of the smoke test
+const NP = 2
+
+// source is the MPI program of the smoke test, each rank displaying a line parsed by checkOutput
+const source = `#include <stdio.h>
+#include <mpi.h>
+
+int main(int argc, char **argv)
+{
+	int rank, size;
+
+	MPI_Init(&argc, &argv);
+	MPI_Comm_rank(MPI_COMM_WORLD, &rank);
+	MPI_Comm_size(MPI_COMM_WORLD, &size);
+	MPI_Barrier(MPI_COMM_WORLD);
+	printf("sympi smoke test: rank %d of %d\n", rank, size);
+	MPI_Finalize();
+
+	return 0;
+}
+`
+
+// checkOutput checks that all the ranks of the smoke test displayed their line
+func checkOutput(output string, np int) error {
+	var missing []string
+	for rank := 0; rank < np; rank++ {
+		if !strings.Contains(output, fmt.Sprintf("sympi smoke test: rank %d of %d", rank, np)) {
+			missing = append(missing, fmt.Sprintf("%d", rank))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("rank(s) %s did not complete", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// getMpirunArgs returns the arguments of mpirun to run the smoke test on the local host
+func getMpirunArgs(mpiCfg *implem.Info, binPath string) []string {
+	var args []string
+	if mpiCfg.ID == implem.OMPI {
+		// The host may have fewer cores than ranks, and tests may be executed as root, e.g., in CI
+		args = append(args, "--oversubscribe")
+		if os.Geteuid() == 0 {
+			args = append(args, "--allow-run-as-root")
+		}
+	}
+	return append(args, mpi.GetNPFlag(mpiCfg), fmt.Sprintf("%d", NP), binPath)
+}
+
+// Run compiles the smoke test with the compiler wrapper of a MPI installed on the host and runs it
+// with NP ranks. The returned error includes the output of the step that failed.
+func Run(ctx context.Context, mpiCfg *implem.Info, env *buildenv.Info, sysCfg *sys.Config) error {
+	dir, err := ioutil.TempDir("", "sympi-smoketest-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "smoketest.c")
+	err = ioutil.WriteFile(srcPath, []byte(source), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", srcPath, err)
+	}
+
+	// The MPI is not loaded yet, its binaries and libraries are added to the environment; the
+	// ranks are started with mpiexec by installations without mpirun
+	mpirun, err := mpi.GetPathToLauncher(mpiCfg, env)
+	if err != nil {
+		return err
+	}
+	binDir := filepath.Dir(mpirun)
+	libDir := filepath.Join(filepath.Dir(binDir), "lib")
+	cmdEnv := append(os.Environ(),
+		"PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"LD_LIBRARY_PATH="+libDir+string(os.PathListSeparator)+os.Getenv("LD_LIBRARY_PATH"))
+	r := sys.WithExecOptions(sysCfg.GetRunner(), dir, cmdEnv, false)
+
+	ctx, cancel := context.WithTimeout(ctx, sys.CmdTimeout*time.Minute)
+	defer cancel()
+
+	binPath := filepath.Join(dir, "smoketest")
+	stdout, stderr, _, err := r.Run(ctx, filepath.Join(binDir, "mpicc"), "-o", binPath, srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to compile the smoke test: %w - stdout: %s - stderr: %s", err, stdout, stderr)
+	}
+
+	stdout, stderr, _, err = r.Run(ctx, mpirun, getMpirunArgs(mpiCfg, binPath)...)
+	if err != nil {
+		return fmt.Errorf("failed to run the smoke test: %w - stdout: %s - stderr: %s", err, stdout, stderr)
+	}
+	err = checkOutput(stdout, NP)
+	if err != nil {
+		return fmt.Errorf("invalid output of the smoke test: %w - stdout: %s - stderr: %s", err, stdout, stderr)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package smoketest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/implem"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+)
+
+func TestRun(t *testing.T) {
+	mpiCfg := implem.Info{ID: implem.MPICH, Version: "3.3"}
+	output := "sympi smoke test: rank 1 of 2\nsympi smoke test: rank 0 of 2\n"
+
+	tests := []struct {
+		name        string
+		launcher    string
+		results     map[string]mock.Result
+		expectedErr string
+	}{
+		{
+			name:     "success",
+			launcher: "mpirun",
+			results:  map[string]mock.Result{"mpirun": {Stdout: output}},
+		},
+		{
+			name:     "mpiexec only",
+			launcher: "mpiexec",
+			results:  map[string]mock.Result{"mpiexec": {Stdout: output}},
+		},
+		{
+			name:        "no launcher",
+			expectedErr: "neither mpirun nor mpiexec found",
+		},
+		{
+			name:        "compilation failure",
+			launcher:    "mpirun",
+			results:     map[string]mock.Result{"mpicc": {Stderr: "mpi.h: No such file or directory", ExitCode: 1}},
+			expectedErr: "failed to compile",
+		},
+		{
+			name:        "run failure",
+			launcher:    "mpirun",
+			results:     map[string]mock.Result{"mpirun": {Stderr: "unable to launch", ExitCode: 1}},
+			expectedErr: "failed to run",
+		},
+		{
+			name:        "missing rank",
+			launcher:    "mpirun",
+			results:     map[string]mock.Result{"mpirun": {Stdout: "sympi smoke test: rank 0 of 2\n"}},
+			expectedErr: "rank(s) 1 did not complete",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installDir, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatalf("failed to create temporary directory: %s", err)
+			}
+			defer os.RemoveAll(installDir)
+			binDir := filepath.Join(installDir, "bin")
+			err = os.MkdirAll(binDir, 0755)
+			if err == nil && tt.launcher != "" {
+				err = ioutil.WriteFile(filepath.Join(binDir, tt.launcher), nil, 0755)
+			}
+			if err != nil {
+				t.Fatalf("failed to create the installation of MPI: %s", err)
+			}
+
+			r := &mock.Runner{Results: tt.results}
+			sysCfg := sys.Config{Runner: r}
+			env := buildenv.Info{InstallDir: installDir}
+			err = Run(context.Background(), &mpiCfg, &env, &sysCfg)
+			if tt.expectedErr == "" && err != nil {
+				t.Fatalf("smoke test failed: %s", err)
+			}
+			if tt.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedErr)) {
+				t.Fatalf("got error %v instead of %s", err, tt.expectedErr)
+			}
+
+			calls := r.Calls()
+			if tt.launcher == "" {
+				if len(calls) > 0 {
+					t.Fatalf("commands executed without launcher: %v", calls)
+				}
+				return
+			}
+			if !strings.HasPrefix(calls[0], filepath.Join(binDir, "mpicc")+" -o ") {
+				t.Fatalf("unexpected compilation command: %s", calls[0])
+			}
+			if len(calls) > 1 && !strings.HasPrefix(calls[1], filepath.Join(binDir, tt.launcher)+" -n 2 ") {
+				t.Fatalf("unexpected run command: %s", calls[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+// Constants defining the type of artifact a Singularity URL points to
+const (
+	// SourceArtifact is a source tarball that needs to be compiled
+	SourceArtifact = "source"
+
+	// TarballArtifact is a tarball of prebuilt binaries
+	TarballArtifact = "tarball"
+
+	// RPMArtifact is a prebuilt RPM package
+	RPMArtifact = "rpm"
+
+	// DEBArtifact is a prebuilt DEB package
+	DEBArtifact = "deb"
+)
+
+// binaryTarballRegexp matches the name of tarballs of prebuilt binaries, which by convention
+// specify the target architecture, e.g., singularity-3.5.0-linux-amd64.tar.gz, or have a bin
+// component, e.g., apptainer-1.1.9-bin.tar.gz; the components are separated by '-', '_' or '.'
+var binaryTarballRegexp = regexp.MustCompile(`(^|[-_.])(x86_64|amd64|aarch64|arm64|ppc64le|bin)([-_.]|$)`)
+
+// starterSuid is the path, relative to the installation directory, of the setuid starter of Apptainer
+var starterSuid = filepath.Join("libexec", sys.ApptainerRuntime, "bin", "starter-suid")
+
+// DetectArtifactType detects from its URL the type of artifact used to install Singularity
+func DetectArtifactType(url string) string {
+	filename := path.Base(url)
+	switch {
+	case strings.HasSuffix(filename, ".rpm"):
+		return RPMArtifact
+	case strings.HasSuffix(filename, ".deb"):
+		return DEBArtifact
+	case util.DetectTarballFormat(filename) != util.UnknownFormat && binaryTarballRegexp.MatchString(filename):
+		return TarballArtifact
+	}
+	return SourceArtifact
+}
+
+// DetectRuntime detects from its URL whether a package is Singularity or Apptainer
+func DetectRuntime(url string) string {
+	if strings.Contains(path.Base(url), sys.ApptainerRuntime) {
+		return sys.ApptainerRuntime
+	}
+	return sys.SingularityRuntime
+}
+
+// IsBinaryArtifact checks whether a URL points to a prebuilt version of Singularity
+func IsBinaryArtifact(url string) bool {
+	return DetectArtifactType(url) != SourceArtifact
+}
+
+func runCmd(ctx context.Context, r sys.Runner, dir string, name string, args ...string) error {
+	log.Printf("-> Executing from %s: %s %s\n", dir, name, strings.Join(args, " "))
+	stdout, stderr, _, err := sys.WithExecOptions(r, dir, nil, false).Run(ctx, name, args...)
+	if err != nil {
+		return fmt.Errorf("command failed: %w - stdout: %s - stderr: %s", err, stdout, stderr)
+	}
+	return nil
+}
+
+// shellQuote quotes a value so it is not interpreted by the shell
+func shellQuote(val string) string {
+	return "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+}
+
+func extractArtifact(ctx context.Context, r sys.Runner, artifactType string, artifact string, dir string) error {
+	switch artifactType {
+	case RPMArtifact:
+		// rpm2cpio and cpio do not require privileges, unlike rpm -i
+		return runCmd(ctx, r, dir, "sh", "-c", "rpm2cpio "+shellQuote(artifact)+" | cpio -idm")
+	case DEBArtifact:
+		return runCmd(ctx, r, dir, "dpkg-deb", "-x", artifact, dir)
+	case TarballArtifact:
+		return runCmd(ctx, r, dir, "tar", util.GetTarArgs(util.DetectTarballFormat(artifact)), artifact)
+	}
+	return fmt.Errorf("unsupported artifact type: %s", artifactType)
+}
+
+// getInstallRoot finds the prefix of the extracted files, e.g., usr for packages
+func getInstallRoot(dir string) string {
+	entries, err := ioutil.ReadDir(dir)
+	if err == nil && len(entries) == 1 && entries[0].IsDir() {
+		// Tarballs usually have a single top directory
+		if !util.PathExists(filepath.Join(dir, "bin")) && entries[0].Name() != "usr" {
+			dir = filepath.Join(dir, entries[0].Name())
+		}
+	}
+
+	for _, prefix := range []string{filepath.Join("usr", "local"), "usr"} {
+		if util.PathExists(filepath.Join(dir, prefix, "bin")) {
+			return filepath.Join(dir, prefix)
+		}
+	}
+	return dir
+}
+
+// InstallRelease installs a prebuilt version of Singularity, i.e., a binary tarball, a RPM or a DEB,
+// in env.InstallDir. There is no configuration or compilation step.
+//
+// Prebuilt versions are compiled for a prefix, e.g., /usr, where they look for their configuration and
+// helpers, so they are moved to env.InstallDir. Only Apptainer supports it, by finding its files relative
+// to its binary when it is not installed setuid: its setuid starter is removed, the containers then
+// being started with user namespaces. Prebuilt versions of Singularity are not supported.
+func InstallRelease(ctx context.Context, name string, url string, mirrors []string, env *buildenv.Info, sysCfg *sys.Config) error {
+	artifactType := DetectArtifactType(url)
+	if artifactType == SourceArtifact {
+		return fmt.Errorf("%s is not a prebuilt version of Singularity", url)
+	}
+	runtime := DetectRuntime(url)
+	if runtime != sys.ApptainerRuntime {
+		return fmt.Errorf("%s cannot be installed in %s: prebuilt versions of Singularity only work in the prefix they were compiled with, use its source or a prebuilt version of Apptainer", url, env.InstallDir)
+	}
+
+	var s buildenv.SoftwarePackage
+	s.URL = url
+	s.Mirrors = mirrors
+	s.Name = name
+	err := env.Get(ctx, &s, sysCfg)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", url, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sys.CmdTimeout*time.Minute)
+	defer cancel()
+
+	extractDir := filepath.Join(env.ScratchDir, "release")
+	err = os.MkdirAll(extractDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", extractDir, err)
+	}
+	defer os.RemoveAll(extractDir)
+
+	log.Printf("- Extracting %s (%s)...", env.SrcPath, artifactType)
+	err = extractArtifact(ctx, sysCfg.GetRunner(), artifactType, env.SrcPath, extractDir)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", env.SrcPath, err)
+	}
+
+	root := getInstallRoot(extractDir)
+	if !util.PathExists(filepath.Join(root, "bin", runtime)) {
+		return fmt.Errorf("%s does not provide bin/%s", url, runtime)
+	}
+
+	log.Printf("- Installing %s in %s...", root, env.InstallDir)
+	err = os.MkdirAll(filepath.Dir(env.InstallDir), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(env.InstallDir), err)
+	}
+	err = os.RemoveAll(env.InstallDir)
+	if err != nil {
+		return fmt.Errorf("failed to clean %s: %w", env.InstallDir, err)
+	}
+	err = os.Rename(root, env.InstallDir)
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", root, env.InstallDir, err)
+	}
+
+	// Packages install the configuration files outside of the prefix, we keep them with the binaries
+	etcDir := filepath.Join(extractDir, "etc")
+	targetEtcDir := filepath.Join(env.InstallDir, "etc")
+	if root != extractDir && util.PathExists(etcDir) && !util.PathExists(targetEtcDir) {
+		err = os.Rename(etcDir, targetEtcDir)
+		if err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", etcDir, targetEtcDir, err)
+		}
+	}
+
+	// A setuid starter prevents Apptainer from being relocated, it cannot be setuid root anyway
+	// when installed without privileges
+	err = os.RemoveAll(filepath.Join(env.InstallDir, starterSuid))
+	if err != nil {
+		return fmt.Errorf("failed to remove the setuid starter: %w", err)
+	}
+
+	return nil
+}
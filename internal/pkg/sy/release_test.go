@@ -0,0 +1,174 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/buildenv"
+	"github.com/sylabs/singularity-mpi/internal/pkg/mock"
+	"github.com/sylabs/singularity-mpi/internal/pkg/sys"
+	util "github.com/sylabs/singularity-mpi/internal/pkg/util/file"
+)
+
+func TestDetectRuntime(t *testing.T) {
+	if DetectRuntime("https://github.com/apptainer/apptainer/releases/download/v1.1.9/apptainer-1.1.9.tar.gz") != sys.ApptainerRuntime {
+		t.Fatalf("apptainer not detected")
+	}
+	if DetectRuntime("https://github.com/sylabs/singularity/releases/download/v3.4.0/singularity-3.4.0.tar.gz") != sys.SingularityRuntime {
+		t.Fatalf("singularity not detected")
+	}
+}
+
+func TestDetectArtifactType(t *testing.T) {
+	tests := []struct {
+		url          string
+		expectedType string
+	}{
+		{
+			url:          "https://github.com/sylabs/singularity/releases/download/v3.4.0/singularity-3.4.0.tar.gz",
+			expectedType: SourceArtifact,
+		},
+		{
+			url:          "https://example.com/singularity-3.5.0-linux-amd64.tar.gz",
+			expectedType: TarballArtifact,
+		},
+		{
+			url:          "https://example.com/singularity-3.5.0-1.el7.x86_64.rpm",
+			expectedType: RPMArtifact,
+		},
+		{
+			url:          "file:///tmp/singularity-container_3.5.0_amd64.deb",
+			expectedType: DEBArtifact,
+		},
+		{
+			url:          "https://example.com/apptainer-1.1.9-bin.tar.gz",
+			expectedType: TarballArtifact,
+		},
+		{
+			url:          "https://example.com/singularity-binding-3.5.0.tar.gz",
+			expectedType: SourceArtifact,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			artifactType := DetectArtifactType(tt.url)
+			if artifactType != tt.expectedType {
+				t.Fatalf("%s was detected as %s instead of %s", tt.url, artifactType, tt.expectedType)
+			}
+		})
+	}
+}
+
+func TestExtractArtifact(t *testing.T) {
+	tests := []struct {
+		artifactType string
+		artifact     string
+		expectedCall string
+	}{
+		{
+			artifactType: RPMArtifact,
+			artifact:     "/tmp/my packages/apptainer-1.1.9-1.x86_64.rpm",
+			expectedCall: "sh -c rpm2cpio '/tmp/my packages/apptainer-1.1.9-1.x86_64.rpm' | cpio -idm",
+		},
+		{
+			artifactType: DEBArtifact,
+			artifact:     "/tmp/apptainer_1.1.9_amd64.deb",
+			expectedCall: "dpkg-deb -x /tmp/apptainer_1.1.9_amd64.deb /tmp/release",
+		},
+		{
+			artifactType: TarballArtifact,
+			artifact:     "/tmp/apptainer-1.1.9-linux-amd64.tar.gz",
+			expectedCall: "tar -xzf /tmp/apptainer-1.1.9-linux-amd64.tar.gz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.artifactType, func(t *testing.T) {
+			var r mock.Runner
+			err := extractArtifact(context.Background(), &r, tt.artifactType, tt.artifact, "/tmp/release")
+			if err != nil {
+				t.Fatalf("extractArtifact() failed: %s", err)
+			}
+			expected := []string{tt.expectedCall}
+			if !reflect.DeepEqual(r.Calls(), expected) {
+				t.Fatalf("executed %q instead of %q", r.Calls(), expected)
+			}
+		})
+	}
+}
+
+func TestInstallRelease(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "release-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	rpm := filepath.Join(tempDir, "apptainer-1.1.9-1.x86_64.rpm")
+	env := buildenv.Info{
+		BuildDir:   filepath.Join(tempDir, "build"),
+		ScratchDir: filepath.Join(tempDir, "scratch"),
+		InstallDir: filepath.Join(tempDir, "sympi", sys.SingularityInstallDirPrefix+"1.1.9"),
+	}
+	// The mock runner does not extract anything, the files of the package are created beforehand
+	extractDir := filepath.Join(env.ScratchDir, "release")
+	files := []string{
+		rpm,
+		filepath.Join(extractDir, "usr", "bin", "apptainer"),
+		filepath.Join(extractDir, "usr", starterSuid),
+		filepath.Join(extractDir, "etc", "apptainer", "apptainer.conf"),
+	}
+	for _, f := range files {
+		err := os.MkdirAll(filepath.Dir(f), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(f, nil, 0755)
+		}
+		if err != nil {
+			t.Fatalf("failed to create %s: %s", f, err)
+		}
+	}
+	err = os.MkdirAll(env.BuildDir, 0755)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", env.BuildDir, err)
+	}
+
+	var r mock.Runner
+	sysCfg := sys.Config{Runner: &r}
+	err = InstallRelease(context.Background(), "apptainer-1.1.9", "file://"+rpm, nil, &env, &sysCfg)
+	if err != nil {
+		t.Fatalf("InstallRelease() failed: %s", err)
+	}
+	expected := []string{"sh -c rpm2cpio '" + filepath.Join(env.BuildDir, filepath.Base(rpm)) + "' | cpio -idm"}
+	if !reflect.DeepEqual(r.Calls(), expected) {
+		t.Fatalf("executed %q instead of %q", r.Calls(), expected)
+	}
+	for _, f := range []string{filepath.Join("bin", "apptainer"), filepath.Join("etc", "apptainer", "apptainer.conf")} {
+		if !util.FileExists(filepath.Join(env.InstallDir, f)) {
+			t.Fatalf("%s was not installed", f)
+		}
+	}
+	if util.PathExists(filepath.Join(env.InstallDir, starterSuid)) {
+		t.Fatalf("the setuid starter was installed")
+	}
+
+	// Prebuilt versions of Singularity cannot be moved to the installation directory
+	var syRunner mock.Runner
+	sysCfg.Runner = &syRunner
+	err = InstallRelease(context.Background(), "singularity-3.5.0", "file:///tmp/singularity-3.5.0-1.el7.x86_64.rpm", nil, &env, &sysCfg)
+	if err == nil {
+		t.Fatalf("InstallRelease() succeeded with a prebuilt version of Singularity")
+	}
+	if len(syRunner.Calls()) != 0 {
+		t.Fatalf("commands executed for a prebuilt version of Singularity: %q", syRunner.Calls())
+	}
+}
@@ -6,12 +6,10 @@
 package sy
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -42,18 +40,15 @@ func updateEnviron(buildEnv *buildenv.Info) []string {
 }
 
 // Configure is the function to call to configure Singularity
-func Configure(env *buildenv.Info, sysCfg *sys.Config, extraArgs []string) error {
+func Configure(ctx context.Context, env *buildenv.Info, sysCfg *sys.Config, extraArgs []string) error {
 	// Singularity changed the mconfig flags over time so we need to figure out how the prefix is specified
-	ctx, cancel := context.WithTimeout(context.Background(), sys.CmdTimeout*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, sys.CmdTimeout*time.Minute)
 	defer cancel()
-	var stdout bytes.Buffer
-	cmd := exec.CommandContext(ctx, "./mconfig", "-h")
-	cmd.Dir = env.SrcDir
-	cmd.Stdout = &stdout
-	cmd.Run() // mconfig -h always returns 2 (no idea why, it just does)
+	r := sysCfg.GetRunner()
+	help, _, _, _ := sys.WithExecOptions(r, env.SrcDir, nil, false).Run(ctx, "./mconfig", "-h") // mconfig -h always returns 2 (no idea why, it just does)
 
 	args := []string{"--prefix=" + env.InstallDir}
-	if strings.Contains(stdout.String(), "-p prefix") {
+	if strings.Contains(help, "-p prefix") {
 		args = []string{"-p", env.InstallDir}
 	}
 
@@ -62,15 +57,9 @@ func Configure(env *buildenv.Info, sysCfg *sys.Config, extraArgs []string) error
 	newEnv := updateEnviron(env)
 	env.Env = newEnv
 	log.Printf("-> Using env: %s\n", strings.Join(newEnv, "\n"))
-	var stderr bytes.Buffer
-	cmd = exec.CommandContext(ctx, "./mconfig", args...)
-	cmd.Dir = env.SrcDir
-	cmd.Env = newEnv
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	err := cmd.Run()
+	stdout, stderr, _, err := sys.WithExecOptions(r, env.SrcDir, newEnv, env.LiveOutput).Run(ctx, "./mconfig", args...)
 	if err != nil {
-		return fmt.Errorf("failed to run mconfig: %s (stderr: %s; stdout: %s)", err, stderr.String(), stdout.String())
+		return fmt.Errorf("failed to run mconfig: %w (stderr: %s; stdout: %s)", err, stderr, stdout)
 	}
 
 	return nil
@@ -6,7 +6,10 @@
 package syexec
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"os"
 	"os/exec"
 )
 
@@ -18,6 +21,8 @@ type Result struct {
 	Stdout string
 	// Stderr is the messages that were displayed on stderr during the execution of the command
 	Stderr string
+	// ExitCode is the exit code of the command
+	ExitCode int
 }
 
 // SyCmd represents a command to be executed
@@ -32,7 +37,7 @@ type SyCmd struct {
 	CmdArgs []string
 
 	// Env is a slice of string representing the environment to be used with the command
-	Env     []string
+	Env []string
 
 	// Ctx is the context of the command to execute to submit a job
 	Ctx context.Context
@@ -40,3 +45,15 @@ type SyCmd struct {
 	// CancelFn is the function to cancel the command to submit a job
 	CancelFn context.CancelFunc
 }
+
+// CaptureOutput redirects the output of a command to the stdout and stderr buffers.
+// When live is true, the output is also displayed on the console while the command runs.
+func CaptureOutput(cmd *exec.Cmd, stdout *bytes.Buffer, stderr *bytes.Buffer, live bool) {
+	if !live {
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return
+	}
+	cmd.Stdout = io.MultiWriter(stdout, os.Stdout)
+	cmd.Stderr = io.MultiWriter(stderr, os.Stderr)
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package syexec
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+)
+
+func TestCaptureOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		live bool
+	}{
+		{name: "captured", live: false},
+		{name: "live", live: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command("sh", "-c", "echo out; echo err 1>&2")
+			CaptureOutput(cmd, &stdout, &stderr, tt.live)
+			err := cmd.Run()
+			if err != nil {
+				t.Fatalf("command failed: %s", err)
+			}
+			if stdout.String() != "out\n" {
+				t.Fatalf("stdout is %q instead of %q", stdout.String(), "out\n")
+			}
+			if stderr.String() != "err\n" {
+				t.Fatalf("stderr is %q instead of %q", stderr.String(), "err\n")
+			}
+		})
+	}
+}
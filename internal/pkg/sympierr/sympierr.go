@@ -15,3 +15,33 @@ var ErrFileExists = errors.New("file already exists")
 
 // ErrSingularityNotInstalled is the error returned when Singularity is not installed
 var ErrSingularityNotInstalled = errors.New("Singularity not available")
+
+// ErrMPINotInstalled is the error returned when a version of MPI is not installed on the host
+var ErrMPINotInstalled = errors.New("MPI not installed")
+
+// ErrAlreadyInstalled is the error returned when installing a software that is already installed
+var ErrAlreadyInstalled = errors.New("already installed")
+
+// ErrVersionNotFound is the error returned when a version is not known, i.e., not in the configuration files
+var ErrVersionNotFound = errors.New("version not found")
+
+// ErrIncompatibleMPI is the error returned when no compatible version of MPI is available
+var ErrIncompatibleMPI = errors.New("incompatible MPI")
+
+// ErrNotInitialized is the error returned when SyMPI has not been initialized, i.e., sympi_init was not executed
+var ErrNotInitialized = errors.New("SyMPI not initialized")
+
+// ErrNotInCache is the error returned when running in offline mode and a file is not in the download cache
+var ErrNotInCache = errors.New("not in cache")
+
+// ErrGlibcMismatch is the error returned when the host MPI requires a version of glibc that is more recent than the one in the container
+var ErrGlibcMismatch = errors.New("host glibc more recent than container glibc")
+
+// ErrLocked is the error returned when the sympi directory is locked by another sympi operation
+var ErrLocked = errors.New("another sympi operation is in progress")
+
+// ErrMissingPrerequisite is the error returned when a software required on the host is missing or too old
+var ErrMissingPrerequisite = errors.New("missing prerequisite")
+
+// ErrNotEnoughSpace is the error returned when a filesystem does not have enough free space for an operation
+var ErrNotEnoughSpace = errors.New("not enough free space")
@@ -0,0 +1,95 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sys
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/syexec"
+)
+
+// Runner executes external commands. Going through a runner lets tests replace the commands
+// by mocks and check how the commands are built.
+type Runner interface {
+	// Run executes a command and returns the messages it displayed on stdout and stderr, as
+	// well as its exit code. An error is returned if the command could not be executed or
+	// if it failed.
+	Run(ctx context.Context, cmd string, args ...string) (stdout string, stderr string, exitCode int, err error)
+}
+
+// ExecRunner is the default runner, executing the commands on the host
+type ExecRunner struct {
+	// Dir is the directory from which the commands are executed; the current directory if empty
+	Dir string
+
+	// Env is the environment of the commands; the environment of sympi if nil
+	Env []string
+
+	// Live specifies whether the output of the commands is also displayed on the console while they run
+	Live bool
+
+	// Stdin is the input of the commands; none if nil
+	Stdin io.Reader
+}
+
+// Run executes a command on the host
+func (r ExecRunner) Run(ctx context.Context, cmd string, args ...string) (string, string, int, error) {
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, cmd, args...)
+	c.Dir = r.Dir
+	c.Env = r.Env
+	c.Stdin = r.Stdin
+	syexec.CaptureOutput(c, &stdout, &stderr, r.Live)
+
+	err := c.Run()
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	return stdout.String(), stderr.String(), exitCode, err
+}
+
+// GetRunner returns the runner to use to execute external commands: the runner of the
+// configuration if set, an ExecRunner otherwise. It can be called on a nil configuration.
+func (cfg *Config) GetRunner() Runner {
+	if cfg == nil || cfg.Runner == nil {
+		return ExecRunner{}
+	}
+	return cfg.Runner
+}
+
+// WithExecOptions returns a runner executing the commands from a directory, with an environment
+// and optionally displaying their output. Only an ExecRunner is affected by the options, other
+// runners, e.g., mocks, are returned as is.
+func WithExecOptions(r Runner, dir string, env []string, live bool) Runner {
+	execRunner, ok := r.(ExecRunner)
+	if !ok {
+		return r
+	}
+	execRunner.Dir = dir
+	execRunner.Env = env
+	execRunner.Live = live
+	return execRunner
+}
+
+// WithStdin returns a runner executing the commands with an input. As for WithExecOptions,
+// runners other than an ExecRunner are returned as is.
+func WithStdin(r Runner, stdin io.Reader) Runner {
+	execRunner, ok := r.(ExecRunner)
+	if !ok {
+		return r
+	}
+	execRunner.Stdin = stdin
+	return execRunner
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sys
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExecRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		runner   Runner
+		cmd      string
+		args     []string
+		stdout   string
+		stderr   string
+		exitCode int
+		fails    bool
+	}{
+		{name: "stdout", runner: ExecRunner{}, cmd: "echo", args: []string{"hello"}, stdout: "hello\n"},
+		{name: "stderr and exit code", runner: ExecRunner{}, cmd: "sh", args: []string{"-c", "echo oops >&2; exit 3"}, stderr: "oops\n", exitCode: 3, fails: true},
+		{name: "missing binary", runner: ExecRunner{}, cmd: "sympi-missing-binary", exitCode: -1, fails: true},
+		{name: "directory", runner: WithExecOptions(ExecRunner{}, dir, nil, false), cmd: "pwd", stdout: dir + "\n"},
+		{name: "environment", runner: WithExecOptions(ExecRunner{}, "", []string{"SYMPI_TEST=1"}, false), cmd: "sh", args: []string{"-c", "echo $SYMPI_TEST"}, stdout: "1\n"},
+		{name: "stdin", runner: WithStdin(ExecRunner{}, strings.NewReader("passphrase")), cmd: "cat", stdout: "passphrase"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, exitCode, err := tt.runner.Run(context.Background(), tt.cmd, tt.args...)
+			if stdout != tt.stdout || stderr != tt.stderr || exitCode != tt.exitCode {
+				t.Fatalf("Run() returned (%q, %q, %d) instead of (%q, %q, %d)", stdout, stderr, exitCode, tt.stdout, tt.stderr, tt.exitCode)
+			}
+			if (err != nil) != tt.fails {
+				t.Fatalf("Run() returned %v", err)
+			}
+		})
+	}
+}
+
+func TestGetRunner(t *testing.T) {
+	var nilCfg *Config
+	if _, ok := nilCfg.GetRunner().(ExecRunner); !ok {
+		t.Fatalf("default runner is not an ExecRunner")
+	}
+
+	cfg := Config{Runner: WithExecOptions(ExecRunner{}, "/tmp", nil, false)}
+	if r, ok := cfg.GetRunner().(ExecRunner); !ok || r.Dir != "/tmp" {
+		t.Fatalf("the runner of the configuration is not used")
+	}
+}
@@ -6,8 +6,17 @@
 package sys
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
 )
 
 const (
@@ -15,13 +24,46 @@ const (
 	// directory used to install MPI and store container images
 	SYMPI_INSTALL_DIR_ENV = "SYMPI_INSTALL_DIR"
 
+	// SYMPI_SYSTEM_DIR_ENV is the name of the environment variable to set the system-wide
+	// directory where administrators install MPI for all users
+	SYMPI_SYSTEM_DIR_ENV = "SYMPI_SYSTEM_DIR"
+
+	// SYMPI_ETC_ENV is the name of the environment variable to set the directory with the
+	// configuration files, e.g., etc/openmpi.conf
+	SYMPI_ETC_ENV = "SYMPI_ETC"
+
+	// RunLayoutFlat is the layout of the files of the runs where all the runs share the same
+	// directories, e.g., the installation directory of the container
+	RunLayoutFlat = "flat"
+
+	// RunLayoutPerRun is the layout of the files of the runs where each run has its own
+	// directory with its script, output and metadata
+	RunLayoutPerRun = "per-run"
+
+	// PathOrderPrepend is the order placing the directories of the loaded software before the
+	// directories already in PATH and LD_LIBRARY_PATH
+	PathOrderPrepend = "prepend"
+
+	// PathOrderAppend is the order placing the directories of the loaded software after the
+	// directories already in PATH and LD_LIBRARY_PATH, e.g., so a system MPI takes precedence
+	PathOrderAppend = "append"
+
+	// DefaultSystemSympiDir is the default system-wide directory where MPI is installed for all users
+	DefaultSystemSympiDir = "/opt/sympi"
+
 	// DefaultSympiInstallDir is the name of the default directory in $HOME to store
 	// image containers and install MPI
 	DefaultSympiInstallDir = ".sympi"
 
+	// DefaultCacheDir is the name of the directory in the sympi directory where downloaded source code is cached
+	DefaultCacheDir = "cache"
+
 	// CmdTimetout is the maximum time we allow a command to run
 	CmdTimeout = 10
 
+	// DefaultDownloadTimeout is the default maximum time we allow a download to take
+	DefaultDownloadTimeout = 30 * time.Minute
+
 	// DefaultUbuntuDistro is the default Ubuntu distribution we use
 	DefaultUbuntuDistro = "disco"
 
@@ -42,8 +84,27 @@ const (
 
 	// ContainerInstallDirPrefix is the default prefix for the directory name where an MPI-based container is stored
 	ContainerInstallDirPrefix = "mpi_container_"
+
+	// SingularityRuntime is the name of the Singularity binary
+	SingularityRuntime = "singularity"
+
+	// ApptainerRuntime is the name of the Apptainer binary, Apptainer being the fork of Singularity
+	ApptainerRuntime = "apptainer"
 )
 
+// Version is the version of the tool, set when building it, e.g.,
+// go build -ldflags "-X github.com/sylabs/singularity-mpi/internal/pkg/sys.Version=1.0.0"
+var Version = "dev"
+
+// Hook is a command executed at a given stage of the installation of a software package
+type Hook struct {
+	// Cmd is the shell command to execute; no hook if empty
+	Cmd string
+
+	// BestEffort specifies whether the installation continues when the command fails
+	BestEffort bool
+}
+
 // SetConfigFn is a "function pointer" that lets us store the configuration of a given job manager
 type SetConfigFn func() error
 
@@ -74,12 +135,102 @@ type Config struct {
 	// ScratchDir is the path where a copy generated files are saved for debugging
 	ScratchDir string
 
+	// ScratchBaseDir is the base directory for scratch directories, overwriting ScratchDirs and the default (e.g., from the -scratch flag)
+	ScratchBaseDir string
+
+	// ScratchDirs are the base scratch directories to use for specific MPI implementations, indexed by implementation ID
+	ScratchDirs map[string]string
+
+	// ScratchMaxAge is the age after which the scratch and build artifacts are removed when sympi starts; never removed if 0
+	ScratchMaxAge time.Duration
+
+	// CacheMaxSize is the maximum size in bytes of the cache of downloaded files, the oldest files being removed when sympi starts; no limit if 0
+	CacheMaxSize int64
+
+	// DefaultMpirunArgs are the mpirun arguments always used with specific MPI implementations, indexed by implementation ID
+	DefaultMpirunArgs map[string][]string
+
+	// ExtraMpirunArgs are mpirun arguments used for all the runs, overriding the default arguments of conflicting options (e.g., from the -mpirun-args flag)
+	ExtraMpirunArgs []string
+
+	// Profiles are the named sets of run settings (np, nodes, partition, binds, etc.) applied with -profile, indexed by name
+	Profiles map[string]map[string]string
+
+	// SingularityCacheDir is the cache directory of Singularity, e.g., for pulled images (SINGULARITY_CACHEDIR)
+	SingularityCacheDir string
+
+	// SingularityTmpDir is the temporary directory of Singularity, e.g., for builds (SINGULARITY_TMPDIR)
+	SingularityTmpDir string
+
+	// SingularityMinFreeSpace is the free space in bytes required on the filesystems of the cache
+	// and temporary directories of Singularity before building or pulling an image; not checked if 0
+	SingularityMinFreeSpace int64
+
+	// UCXTLS is the list of UCX transports to use when running containers (UCX_TLS)
+	UCXTLS string
+
+	// OFIProvider is the libfabric provider to use when running containers (FI_PROVIDER)
+	OFIProvider string
+
+	// ExportEnv is the list of the host environment variables forwarded to the batch scripts of the jobs
+	ExportEnv []string
+
+	// PMIEnv is the list of the variables tuning PMI/PMIx exported by the batch scripts of the jobs, e.g., PMIX_MCA_gds=hash
+	PMIEnv []string
+
+	// KeepMPIEnv specifies whether the MPI configuration of the host is kept in the environment of containers using their own MPI
+	KeepMPIEnv bool
+
+	// CleanEnv specifies whether containers are executed with a clean environment (--cleanenv)
+	CleanEnv bool
+
+	// ContainAll specifies whether containers are executed fully isolated from the host (--containall)
+	ContainAll bool
+
+	// LabelOutput specifies whether each line of the output of the ranks is prefixed with the rank
+	// that displayed it, e.g., mpirun --tag-output
+	LabelOutput bool
+
+	// RunLayout is the layout of the files of the runs: flat (default) or per-run
+	RunLayout string
+
+	// RunDir is the directory of the current run with the per-run layout, where its script,
+	// output and metadata are saved; empty otherwise
+	RunDir string
+
+	// BindMissingLibs specifies whether the libraries the host MPI depends on that are missing in
+	// a bind-mode container are bound from the host without asking
+	BindMissingLibs bool
+
+	// SkipGlibcCheck specifies whether the glibc of bind-mode containers is not compared to the
+	// glibc of the host before a run, e.g., when the host MPI is known to work with older versions
+	SkipGlibcCheck bool
+
+	// MapBy is how the ranks are mapped on the hardware, with the syntax of --map-by of Open MPI,
+	// e.g., socket; left to MPI if empty
+	MapBy string
+
+	// RankBy is how the ranks are numbered, with the syntax of --rank-by of Open MPI, e.g., core;
+	// left to MPI if empty
+	RankBy string
+
+	// BindTo is what the ranks are bound to, with the syntax of --bind-to of Open MPI, e.g., core;
+	// left to MPI if empty
+	BindTo string
+
+	// VerifyGPUs is the number of GPUs each rank must see, checked after running a container; no
+	// check if 0
+	VerifyGPUs int
+
 	// SedBin is the path to the sed binary
 	SedBin string
 
 	// SingularityBin is the path to the singularity binary
 	SingularityBin string
 
+	// ContainerRuntime is the name of the container runtime in use, i.e., singularity or apptainer
+	ContainerRuntime string
+
 	// OutputFile is the path the output file
 	OutputFile string
 
@@ -98,6 +249,9 @@ type Config struct {
 	// Verbose mode is active/inactive
 	Verbose bool
 
+	// VerboseBuild specifies whether the output of configure/make is displayed on the console while building software
+	VerboseBuild bool
+
 	// Debug mode is active/inactive
 	Debug bool
 
@@ -107,6 +261,9 @@ type Config struct {
 	// AppContainizer is the path to the configuration for automatic containerization of app
 	AppContainizer string
 
+	// AppExe is the path of the application's executable inside the container, overriding the app_exe_path key of the containerization configuration
+	AppExe string
+
 	// Registry is the optinal user registery where images can be uploaded
 	Registry string
 
@@ -133,6 +290,69 @@ type Config struct {
 
 	// SudoBin is the path to sudo on the host
 	SudoBin string
+
+	// DownloadTimeout is the maximum time a download can take
+	DownloadTimeout time.Duration
+
+	// MPIConfigURL is the http(s) URL of the directory with the configuration files of the MPI
+	// implementations, which are then fetched instead of read from EtcDir (optional)
+	MPIConfigURL string
+
+	// MPIConfigTTL is how long the configuration files fetched from MPIConfigURL are cached
+	MPIConfigTTL time.Duration
+
+	// GPU is the GPU support to enable in containers (nv or rocm); if empty, it is detected
+	GPU string
+
+	// Offline specifies whether we are forbidden to access the network, in which case sources must be in the cache
+	Offline bool
+
+	// DebugBuild specifies whether MPI is built with debug symbols and without optimizations
+	DebugBuild bool
+
+	// VerifyInstall specifies whether a smoke test is compiled and run against the MPI installed on the host
+	VerifyInstall bool
+
+	// RollbackUnverified specifies whether a MPI failing the smoke test is uninstalled
+	RollbackUnverified bool
+
+	// NoAutoInstall specifies whether running a container must fail instead of installing the MPI
+	// of the container when no compatible MPI is installed on the host
+	NoAutoInstall bool
+
+	// ForceReinstall specifies whether a MPI that is already installed on the host is removed and
+	// rebuilt from scratch instead of being skipped
+	ForceReinstall bool
+
+	// PreInstallHook is the command executed before configuring the software packages installed on the host
+	PreInstallHook Hook
+
+	// PostInstallHook is the command executed after installing the software packages on the host
+	PostInstallHook Hook
+
+	// ModulefilesDir is the directory where a modulefile is created for each software installed on the host; none if empty
+	ModulefilesDir string
+
+	// ModulefileFormat is the format of the modulefiles: tcl or lua
+	ModulefileFormat string
+
+	// MPICHPMI is the PMI used when building MPICH: pmi1, pmi2 or pmix; MPICH's default if empty
+	MPICHPMI string
+
+	// PathOrder specifies whether the directories of the loaded software are prepended (default) or appended to PATH and LD_LIBRARY_PATH
+	PathOrder string
+
+	// MPICompatPolicy is the policy used to select a host MPI compatible with a container: exact, minor or major
+	MPICompatPolicy string
+
+	// JobManager is the ID of the job manager to use instead of the one that is detected
+	JobManager string
+
+	// Runner is the runner used to execute external commands; an ExecRunner if nil
+	Runner Runner
+
+	// JobTemplates are the templates of job scripts specified by the user, indexed by the ID of the job manager
+	JobTemplates map[string]*template.Template
 }
 
 // GetSympiDir returns the directory where MPI is installed and container images
@@ -144,3 +364,233 @@ func GetSympiDir() string {
 		return filepath.Join(os.Getenv("HOME"), DefaultSympiInstallDir)
 	}
 }
+
+// checkWritable checks whether files can be created in a directory or, when it does not exist
+// yet, in its closest existing parent
+func checkWritable(dir string) error {
+	for {
+		_, err := os.Stat(dir)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	f, err := ioutil.TempFile(dir, ".sympi-write-check-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// CheckSympiDirWritable checks that software can be installed in or removed from the sympi
+// directory, which may be read-only on shared systems where it is managed by administrators
+func CheckSympiDirWritable() error {
+	dir := GetSympiDir()
+	err := checkWritable(dir)
+	if err != nil {
+		return fmt.Errorf("install directory %s is not writable; set %s to a writable location: %w", dir, SYMPI_INSTALL_DIR_ENV, err)
+	}
+	return nil
+}
+
+// GetEtcDir returns the directory with the configuration files: the directory set with SYMPI_ETC
+// if any, the etc directory of the sources otherwise
+func GetEtcDir() string {
+	if os.Getenv(SYMPI_ETC_ENV) != "" {
+		return os.Getenv(SYMPI_ETC_ENV)
+	}
+	return filepath.Join(os.Getenv("GOPATH"), "src", "github.com", "sylabs", "singularity-mpi", "etc")
+}
+
+// GetSystemSympiDir returns the system-wide directory where MPI is installed for all users
+func GetSystemSympiDir() string {
+	if os.Getenv(SYMPI_SYSTEM_DIR_ENV) != "" {
+		return os.Getenv(SYMPI_SYSTEM_DIR_ENV)
+	}
+	return DefaultSystemSympiDir
+}
+
+// CheckRunLayout checks that a layout of the files of the runs is valid
+func CheckRunLayout(layout string) error {
+	switch layout {
+	case RunLayoutFlat, RunLayoutPerRun:
+		return nil
+	}
+	return fmt.Errorf("unsupported layout %s, it should be %s or %s", layout, RunLayoutFlat, RunLayoutPerRun)
+}
+
+// CheckPathOrder checks that an order of PATH-like variables is valid
+func CheckPathOrder(order string) error {
+	switch order {
+	case PathOrderPrepend, PathOrderAppend:
+		return nil
+	}
+	return fmt.Errorf("unsupported order %s, it should be %s or %s", order, PathOrderPrepend, PathOrderAppend)
+}
+
+// AddToPathList adds a directory to the entries of a PATH-like variable, e.g., LD_LIBRARY_PATH,
+// according to an order (PathOrderPrepend if empty), and returns the value of the variable.
+// Empty entries are dropped since they would add the current directory to the search path.
+func AddToPathList(entries []string, dir string, order string) string {
+	var list []string
+	if order != PathOrderAppend {
+		list = append(list, dir)
+	}
+	for _, e := range entries {
+		if e != "" {
+			list = append(list, e)
+		}
+	}
+	if order == PathOrderAppend {
+		list = append(list, dir)
+	}
+	return strings.Join(list, ":")
+}
+
+// LookupSingularity finds the container runtime to use: singularity is preferred and apptainer
+// is used when singularity is not available. It returns the path to the binary and the name of
+// the runtime.
+func LookupSingularity() (string, string, error) {
+	for _, runtime := range []string{SingularityRuntime, ApptainerRuntime} {
+		path, err := exec.LookPath(runtime)
+		if err == nil {
+			return path, runtime, nil
+		}
+	}
+	return "", "", fmt.Errorf("neither %s nor %s are available", SingularityRuntime, ApptainerRuntime)
+}
+
+// SetSingularityBin sets the path to the container runtime if it is not already set
+func (cfg *Config) SetSingularityBin() error {
+	if cfg.SingularityBin != "" {
+		if cfg.ContainerRuntime == "" {
+			cfg.ContainerRuntime = SingularityRuntime
+			if filepath.Base(cfg.SingularityBin) == ApptainerRuntime {
+				cfg.ContainerRuntime = ApptainerRuntime
+			}
+		}
+		return nil
+	}
+
+	var err error
+	cfg.SingularityBin, cfg.ContainerRuntime, err = LookupSingularity()
+	return err
+}
+
+// GetSingularityEnv returns the environment variables (KEY=VALUE) making Singularity use the
+// cache and temporary directories of the configuration. A directory that is not set is derived
+// from ScratchBaseDir, unless the matching variable is already set in the environment of sympi.
+// The directories are created if needed.
+func (cfg *Config) GetSingularityEnv() ([]string, error) {
+	var vars []string
+	for _, d := range cfg.getSingularityDirs() {
+		if d.dir == "" {
+			continue
+		}
+		err := os.MkdirAll(d.dir, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the %s directory of %s: %w", d.name, cfg.getSingularityEnvPrefix(), err)
+		}
+		vars = append(vars, d.varName+"="+d.dir)
+	}
+	return vars, nil
+}
+
+// singularityDir is a directory used by Singularity and the variable pointing to it
+type singularityDir struct {
+	name    string
+	dir     string
+	varName string
+}
+
+// getSingularityEnvPrefix returns the prefix of the environment variables of the container
+// runtime, Apptainer using its own variables
+func (cfg *Config) getSingularityEnvPrefix() string {
+	if cfg.ContainerRuntime == ApptainerRuntime {
+		return "APPTAINER"
+	}
+	return "SINGULARITY"
+}
+
+// getSingularityDirs returns the cache and temporary directories of the configuration, a
+// directory that is not set being derived from ScratchBaseDir unless the matching variable is
+// set in the environment of sympi (empty if none applies)
+func (cfg *Config) getSingularityDirs() []singularityDir {
+	prefix := cfg.getSingularityEnvPrefix() + "_"
+	dirs := []singularityDir{
+		{name: "cache", dir: cfg.SingularityCacheDir, varName: prefix + "CACHEDIR"},
+		{name: "temporary", dir: cfg.SingularityTmpDir, varName: prefix + "TMPDIR"},
+	}
+	subdirs := []string{"singularity-cache", "singularity-tmp"}
+	for i := range dirs {
+		if dirs[i].dir == "" && cfg.ScratchBaseDir != "" && os.Getenv(dirs[i].varName) == "" {
+			dirs[i].dir = filepath.Join(cfg.ScratchBaseDir, subdirs[i])
+		}
+	}
+	return dirs
+}
+
+// getFreeSpace returns the free space in bytes, for unprivileged users, on the filesystem of a
+// directory or, if it does not exist yet, of its closest existing parent
+func getFreeSpace(dir string) (int64, error) {
+	for filepath.Dir(dir) != dir {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the free space of %s: %w", dir, err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// CheckSingularityFreeSpace checks that the filesystems of the cache and temporary directories
+// Singularity uses to build or pull images, i.e., to create SIF files, have at least
+// SingularityMinFreeSpace bytes available, so the build does not fail with "no space left on
+// device" after a long time. Directories that are neither configured nor set in the
+// environment are checked at the default locations of Singularity.
+func (cfg *Config) CheckSingularityFreeSpace() error {
+	if cfg.SingularityMinFreeSpace <= 0 {
+		return nil
+	}
+
+	runtime := strings.ToLower(cfg.getSingularityEnvPrefix())
+	defaults := map[string]string{
+		"cache":     filepath.Join(os.Getenv("HOME"), "."+runtime, "cache"),
+		"temporary": os.TempDir(),
+	}
+	for _, d := range cfg.getSingularityDirs() {
+		dir := d.dir
+		if dir == "" {
+			dir = os.Getenv(d.varName)
+		}
+		if dir == "" {
+			dir = defaults[d.name]
+		}
+		free, err := getFreeSpace(dir)
+		if err != nil {
+			return err
+		}
+		if free < cfg.SingularityMinFreeSpace {
+			return fmt.Errorf("only %d MiB available in the %s directory %s of %s, %d MiB required (%s): %w", free>>20, d.name, dir, runtime, cfg.SingularityMinFreeSpace>>20, d.varName, sympierr.ErrNotEnoughSpace)
+		}
+	}
+	return nil
+}
+
+// GetCacheDir returns the directory where downloaded source code is cached
+func GetCacheDir() string {
+	return filepath.Join(GetSympiDir(), DefaultCacheDir)
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sys
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity-mpi/internal/pkg/sympierr"
+)
+
+func TestGetSingularityEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	tmpDir := filepath.Join(dir, "tmp")
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		env      map[string]string
+		expected []string
+	}{
+		{name: "no directory", cfg: Config{}, expected: nil},
+		{
+			name:     "directories",
+			cfg:      Config{SingularityCacheDir: cacheDir, SingularityTmpDir: tmpDir},
+			expected: []string{"SINGULARITY_CACHEDIR=" + cacheDir, "SINGULARITY_TMPDIR=" + tmpDir},
+		},
+		{
+			name:     "apptainer",
+			cfg:      Config{ContainerRuntime: ApptainerRuntime, SingularityCacheDir: cacheDir},
+			expected: []string{"APPTAINER_CACHEDIR=" + cacheDir},
+		},
+		{
+			name:     "scratch",
+			cfg:      Config{ScratchBaseDir: dir, SingularityTmpDir: tmpDir},
+			expected: []string{"SINGULARITY_CACHEDIR=" + filepath.Join(dir, "singularity-cache"), "SINGULARITY_TMPDIR=" + tmpDir},
+		},
+		{
+			name:     "scratch with environment",
+			cfg:      Config{ScratchBaseDir: dir},
+			env:      map[string]string{"SINGULARITY_CACHEDIR": "/fast/cache"},
+			expected: []string{"SINGULARITY_TMPDIR=" + filepath.Join(dir, "singularity-tmp")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, v := range []string{"SINGULARITY_CACHEDIR", "SINGULARITY_TMPDIR", "APPTAINER_CACHEDIR", "APPTAINER_TMPDIR"} {
+				prev, ok := os.LookupEnv(v)
+				os.Unsetenv(v)
+				if val, set := tt.env[v]; set {
+					os.Setenv(v, val)
+				}
+				defer func(v string) {
+					if ok {
+						os.Setenv(v, prev)
+					} else {
+						os.Unsetenv(v)
+					}
+				}(v)
+			}
+
+			vars, err := tt.cfg.GetSingularityEnv()
+			if err != nil {
+				t.Fatalf("failed to get the environment: %s", err)
+			}
+			if !reflect.DeepEqual(vars, tt.expected) {
+				t.Fatalf("got %v instead of %v", vars, tt.expected)
+			}
+			for _, d := range []string{tt.cfg.SingularityCacheDir, tt.cfg.SingularityTmpDir} {
+				if _, err := os.Stat(d); d != "" && err != nil {
+					t.Fatalf("%s was not created: %s", d, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSingularityFreeSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	notCreated := filepath.Join(dir, "not", "created")
+
+	tests := []struct {
+		name          string
+		cfg           Config
+		expectedError bool
+	}{
+		{name: "no check", cfg: Config{SingularityCacheDir: dir, SingularityTmpDir: dir}},
+		{name: "enough space", cfg: Config{SingularityCacheDir: dir, SingularityTmpDir: dir, SingularityMinFreeSpace: 1}},
+		{name: "directory not created yet", cfg: Config{SingularityCacheDir: notCreated, SingularityTmpDir: notCreated, SingularityMinFreeSpace: 1}},
+		{name: "not enough space", cfg: Config{SingularityCacheDir: dir, SingularityTmpDir: dir, SingularityMinFreeSpace: 1 << 62}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.CheckSingularityFreeSpace()
+			if tt.expectedError {
+				if !errors.Is(err, sympierr.ErrNotEnoughSpace) {
+					t.Fatalf("CheckSingularityFreeSpace() returned %v instead of %s", err, sympierr.ErrNotEnoughSpace)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CheckSingularityFreeSpace() failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	readOnlyDir := filepath.Join(dir, "readonly")
+	err = os.Mkdir(readOnlyDir, 0555)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", readOnlyDir, err)
+	}
+
+	tests := []struct {
+		name          string
+		dir           string
+		expectedError bool
+	}{
+		{name: "writable", dir: dir},
+		{name: "not created yet", dir: filepath.Join(dir, "new", "sympi")},
+		{name: "read-only", dir: readOnlyDir, expectedError: true},
+		{name: "read-only parent", dir: filepath.Join(readOnlyDir, "sympi"), expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectedError && os.Geteuid() == 0 {
+				t.Skip("permissions are not enforced for root")
+			}
+			err := checkWritable(tt.dir)
+			if tt.expectedError && err == nil {
+				t.Fatalf("%s is reported as writable", tt.dir)
+			}
+			if !tt.expectedError && err != nil {
+				t.Fatalf("checkWritable() failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestAddToPathList(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []string
+		order    string
+		expected string
+	}{
+		{name: "default", entries: []string{"/usr/bin", "/bin"}, expected: "/sympi/bin:/usr/bin:/bin"},
+		{name: "prepend", entries: []string{"/usr/bin", "/bin"}, order: PathOrderPrepend, expected: "/sympi/bin:/usr/bin:/bin"},
+		{name: "append", entries: []string{"/usr/bin", "/bin"}, order: PathOrderAppend, expected: "/usr/bin:/bin:/sympi/bin"},
+		{name: "empty variable", entries: []string{""}, expected: "/sympi/bin"},
+		{name: "empty variable with append", entries: []string{""}, order: PathOrderAppend, expected: "/sympi/bin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := AddToPathList(tt.entries, "/sympi/bin", tt.order)
+			if path != tt.expected {
+				t.Fatalf("AddToPathList() returned %s instead of %s", path, tt.expected)
+			}
+		})
+	}
+}
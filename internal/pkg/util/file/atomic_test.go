@@ -0,0 +1,82 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package util
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	partialWrite := func(w io.Writer, data []byte) error {
+		w.Write(data[:len(data)/2])
+		return fmt.Errorf("interrupted")
+	}
+
+	tests := []struct {
+		name            string
+		write           writeFn
+		expectedSuccess bool
+		expectedContent string
+	}{
+		{
+			name:            "complete",
+			write:           writeAll,
+			expectedSuccess: true,
+			expectedContent: "export PATH=/new/bin\nexport LD_LIBRARY_PATH=/new/lib\n",
+		},
+		{
+			name:            "partial",
+			write:           partialWrite,
+			expectedSuccess: false,
+			expectedContent: "export PATH=/old/bin\nexport LD_LIBRARY_PATH=/old/lib\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir, err := ioutil.TempDir("", "atomic-")
+			if err != nil {
+				t.Fatalf("failed to create temporary directory: %s", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			path := filepath.Join(tempDir, "sympi_1234")
+			err = ioutil.WriteFile(path, []byte("export PATH=/old/bin\nexport LD_LIBRARY_PATH=/old/lib\n"), 0644)
+			if err != nil {
+				t.Fatalf("failed to create %s: %s", path, err)
+			}
+
+			err = writeFileAtomic(path, []byte("export PATH=/new/bin\nexport LD_LIBRARY_PATH=/new/lib\n"), 0644, tt.write)
+			if tt.expectedSuccess && err != nil {
+				t.Fatalf("write failed: %s", err)
+			}
+			if !tt.expectedSuccess && err == nil {
+				t.Fatalf("write succeeded while expected to fail")
+			}
+
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", path, err)
+			}
+			if string(content) != tt.expectedContent {
+				t.Fatalf("%s contains %q instead of %q", path, content, tt.expectedContent)
+			}
+
+			entries, err := ioutil.ReadDir(tempDir)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", tempDir, err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("temporary file left behind in %s", tempDir)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSHA256File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test")
+	err = ioutil.WriteFile(path, []byte("hello\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to create %s: %s", path, err)
+	}
+
+	sum, err := SHA256File(path)
+	if err != nil {
+		t.Fatalf("SHA256File() failed: %s", err)
+	}
+	expected := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	if sum != expected {
+		t.Fatalf("checksum is %s instead of %s", sum, expected)
+	}
+
+	_, err = SHA256File(filepath.Join(dir, "missing"))
+	if err == nil {
+		t.Fatalf("SHA256File() succeeded with a missing file")
+	}
+}
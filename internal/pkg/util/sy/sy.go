@@ -38,6 +38,98 @@ const (
 
 	// SudoCmdsKey is the key used to specify which Singularity commands need to be executed with sudo
 	SudoCmdsKey = "singularity_sudo_cmds"
+
+	// DownloadTimeoutKey is the key used to specify the maximum time a download can take, e.g., 10m
+	DownloadTimeoutKey = "download_timeout"
+
+	// MPICompatPolicyKey is the key used to specify how strict the selection of a host MPI compatible with a container is: exact, minor or major
+	MPICompatPolicyKey = "mpi_compat_policy"
+
+	// PreInstallKey is the key used to specify a command executed before configuring the software installed on the host
+	PreInstallKey = "pre_install"
+
+	// PostInstallKey is the key used to specify a command executed after installing software on the host, e.g., to patch RPATHs
+	PostInstallKey = "post_install"
+
+	// BestEffortKeySuffix is the suffix of the keys specifying whether a hook can fail without failing the installation,
+	// e.g., post_install_best_effort
+	BestEffortKeySuffix = "_best_effort"
+
+	// ModulefilesDirKey is the key used to specify the directory where modulefiles are created for the software installed on the host
+	ModulefilesDirKey = "modulefiles_dir"
+
+	// ModulefileFormatKey is the key used to specify the format of the modulefiles: tcl (default) or lua
+	ModulefileFormatKey = "modulefile_format"
+
+	// MPICHPMIKey is the key used to specify the PMI used when building MPICH: pmi1, pmi2 or pmix
+	MPICHPMIKey = "mpich_pmi"
+
+	// RunLayoutKey is the key used to specify whether the files of each run, e.g., script and output, are saved in a directory of their own: flat (default) or per-run
+	RunLayoutKey = "run_layout"
+
+	// PathOrderKey is the key used to specify whether loading software prepends (default) or appends its directories to PATH and LD_LIBRARY_PATH
+	PathOrderKey = "path_order"
+
+	// ScratchDirKeyPrefix is the prefix of the keys used to specify the base scratch directory of a given MPI implementation, e.g., scratch_dir_openmpi
+	ScratchDirKeyPrefix = "scratch_dir_"
+
+	// MpirunArgsKeySuffix is the suffix of the keys used to specify the default mpirun arguments of a given MPI implementation, e.g., openmpi_mpirun_args
+	MpirunArgsKeySuffix = "_mpirun_args"
+
+	// PMIEnvKeyPrefix is the prefix of the keys used to specify the PMI/PMIx environment variables
+	// exported by the batch scripts of the jobs, e.g., pmi_env.PMIX_MCA_gds = hash
+	PMIEnvKeyPrefix = "pmi_env."
+
+	// ProfileKeyPrefix is the prefix of the keys used to specify the settings of a named run profile, e.g., profile.small.np
+	ProfileKeyPrefix = "profile."
+
+	// MapByKey is the key used to specify how the ranks are mapped on the hardware, e.g., socket (--map-by of Open MPI)
+	MapByKey = "map_by"
+
+	// RankByKey is the key used to specify how the ranks are numbered, e.g., core (--rank-by of Open MPI)
+	RankByKey = "rank_by"
+
+	// BindToKey is the key used to specify what the ranks are bound to, e.g., core (--bind-to of Open MPI)
+	BindToKey = "bind_to"
+
+	// UCXTLSKey is the key used to specify the UCX transports to use when running containers, e.g., rc,sm,self
+	UCXTLSKey = "ucx_tls"
+
+	// OFIProviderKey is the key used to specify the libfabric provider to use when running containers, e.g., verbs
+	OFIProviderKey = "ofi_provider"
+
+	// ExportEnvKey is the key used to specify the host environment variables forwarded to the jobs,
+	// e.g., OMP_NUM_THREADS,LM_LICENSE_FILE
+	ExportEnvKey = "export_env"
+
+	// SingularityCacheDirKey is the key used to specify the cache directory of Singularity (SINGULARITY_CACHEDIR)
+	SingularityCacheDirKey = "singularity_cachedir"
+
+	// SingularityTmpDirKey is the key used to specify the temporary directory of Singularity (SINGULARITY_TMPDIR)
+	SingularityTmpDirKey = "singularity_tmpdir"
+
+	// SingularityMinFreeSpaceKey is the key used to specify the free space required in the cache and
+	// temporary directories of Singularity to build or pull images, e.g., 20G; 0 disables the check
+	SingularityMinFreeSpaceKey = "singularity_min_free_space"
+
+	// DefaultSingularityMinFreeSpace is the free space required in the cache and temporary
+	// directories of Singularity when not specified in the configuration file
+	DefaultSingularityMinFreeSpace = "2G"
+
+	// ScratchMaxAgeKey is the key used to specify the age after which the scratch and build artifacts of sympi are removed, e.g., 168h
+	ScratchMaxAgeKey = "scratch_max_age"
+
+	// CacheMaxSizeKey is the key used to specify the maximum size of the cache of downloaded files, e.g., 10G
+	CacheMaxSizeKey = "cache_max_size"
+
+	// MPIConfigURLKey is the key used to specify the http(s) URL of a central directory with the
+	// configuration files of the MPI implementations, e.g., https://example.org/sympi to get
+	// https://example.org/sympi/openmpi.conf
+	MPIConfigURLKey = "mpi_config_url"
+
+	// MPIConfigTTLKey is the key used to specify how long the MPI configuration files fetched from
+	// mpi_config_url are cached, e.g., 24h
+	MPIConfigTTLKey = "mpi_config_ttl"
 )
 
 // GetPathToSyMPIConfigFile returns the path to the tool's configuration file
@@ -57,7 +149,8 @@ func saveMPIConfigFile(path string, data []string) error {
 
 func initMPIConfigFile() ([]string, error) {
 	buildPrivilegeEntry := BuildPrivilegeKey + " = true"
-	err := checker.CheckBuildPrivilege()
+	// The configuration file is created before the configuration is loaded, so the default runner is used
+	err := checker.CheckBuildPrivilege(nil)
 	if err != nil {
 		log.Printf("* [INFO] Cannot build singularity images: %s", err)
 		buildPrivilegeEntry = BuildPrivilegeKey + " = false"
@@ -150,7 +243,7 @@ func getRegistryConfigFilePath(mpiCfg *implem.Info, sysCfg *sys.Config) string {
 func GetImageURL(mpiCfg *implem.Info, sysCfg *sys.Config) string {
 	registryConfigFile := getRegistryConfigFilePath(mpiCfg, sysCfg)
 	log.Printf("* Getting image URL for %s from %s...", mpiCfg.ID+"-"+mpiCfg.Version, registryConfigFile)
-	kvs, err := kv.LoadKeyValueConfig(registryConfigFile)
+	kvs, err := kv.LoadKeyValueConfigWithDropIns(registryConfigFile)
 	if err != nil {
 		return ""
 	}
@@ -174,7 +267,7 @@ func getSingularityConfigFilePath(sysCfg *sys.Config) string {
 
 func LoadSingularityReleaseConf(sysCfg *sys.Config) ([]kv.KV, error) {
 	file := getSingularityConfigFilePath(sysCfg)
-	kvs, err := kv.LoadKeyValueConfig(file)
+	kvs, err := kv.LoadKeyValueConfigWithDropIns(file)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read configuration from %s: %s", file, err)
 	}
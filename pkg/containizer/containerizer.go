@@ -6,6 +6,7 @@
 package containizer
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -28,6 +29,9 @@ import (
 
 const (
 	mpiModelKey = "mpi_model"
+
+	// appExePathKey is the configuration key specifying the path of the application's executable inside the container
+	appExePathKey = "app_exe_path"
 )
 
 type appConfig struct {
@@ -55,7 +59,7 @@ func getMPIURL(mpi string, version string, sysCfg *sys.Config) string {
 	}
 
 	path := filepath.Join(sysCfg.EtcDir, mpiCfgFile)
-	kvs, err := kv.LoadKeyValueConfig(path)
+	kvs, err := kv.LoadKeyValueConfigWithDropIns(path)
 	if err != nil {
 		log.Printf("[WARN] Cannot load configuration from %s: %s", path, err)
 		return ""
@@ -120,6 +124,7 @@ func generateMPIDeffile(app *appConfig, mpiCfg *mpi.Config, sysCfg *sys.Config)
 	deffileCfg.MpiImplm = &mpiCfg.Implem
 	deffileCfg.InternalEnv = &mpiCfg.Buildenv
 	deffileCfg.Model = mpiCfg.Container.Model
+	deffileCfg.AppExe = mpiCfg.Container.AppExe
 
 	switch mpiCfg.Container.Model {
 	case container.HybridModel:
@@ -136,7 +141,7 @@ func generateMPIDeffile(app *appConfig, mpiCfg *mpi.Config, sysCfg *sys.Config)
 
 		var hostAppBuildEnv buildenv.Info
 		log.Println("Bind mode: compiling application on the host...")
-		err = b.CompileAppOnHost(&app.info, mpiCfg, &hostAppBuildEnv, sysCfg)
+		err = b.CompileAppOnHost(context.Background(), &app.info, mpiCfg, &hostAppBuildEnv, sysCfg)
 		if err != nil {
 			return def, fmt.Errorf("failed to compile the application on the host: %s", err)
 		}
@@ -162,7 +167,7 @@ func getCommonContainerConfiguration(kvs []kv.KV, containerMPI *mpi.Config, sysC
 	containerMPI.Container.Distro = kv.GetValue(kvs, "distro")
 	containerMPI.Implem.ID = kv.GetValue(kvs, "mpi")
 	containerMPI.Implem.Version = kv.GetValue(kvs, "container_mpi")
-	containerMPI.Implem.URL = getMPIURL(kv.GetValue(kvs, "mpi"), containerMPI.Implem.Version, sysCfg)
+	containerMPI.Implem.SetURLs(getMPIURL(kv.GetValue(kvs, "mpi"), containerMPI.Implem.Version, sysCfg))
 
 	// These different structures are used during different stage of the creation of the container
 	// so yes we have some duplication in term of value stored in elements of different structures
@@ -253,7 +258,7 @@ func installMPIonHost(kvs []kv.KV, hostBuildEnv *buildenv.Info, app *appConfig,
 	hostMPI.Implem.Version = kv.GetValue(kvs, "host_mpi")
 	mpiDir := hostMPI.Implem.ID + "-" + hostMPI.Implem.Version
 	hostBuildEnv.InstallDir = filepath.Join(kv.GetValue(kvs, "output_dir"), "install", mpiDir)
-	hostMPI.Implem.URL = getMPIURL(kv.GetValue(kvs, "mpi"), hostMPI.Implem.Version, sysCfg)
+	hostMPI.Implem.SetURLs(getMPIURL(kv.GetValue(kvs, "mpi"), hostMPI.Implem.Version, sysCfg))
 
 	// todo: this should be part of hostMPI, not app
 	app.envScript = filepath.Join(kv.GetValue(kvs, "output_dir"), hostMPI.Implem.ID+"-"+hostMPI.Implem.Version+".env")
@@ -279,7 +284,7 @@ func installMPIonHost(kvs []kv.KV, hostBuildEnv *buildenv.Info, app *appConfig,
 	if err != nil {
 		return fmt.Errorf("unable to create a builder: %s", err)
 	}
-	res := b.InstallOnHost(&hostMPI.Implem, hostBuildEnv, sysCfg)
+	res := b.InstallOnHost(context.Background(), &hostMPI.Implem, hostBuildEnv, sysCfg)
 	if res.Err != nil {
 		return fmt.Errorf("failed to install MPI on the host: %s", res.Err)
 	}
@@ -334,7 +339,13 @@ func ContainerizeApp(sysCfg *sys.Config) (container.Config, error) {
 	var containerBuildEnv buildenv.Info
 	var cleanup func()
 
-	switch kv.GetValue(kvs, mpiModelKey) {
+	model, err := container.ParseModel(kv.GetValue(kvs, mpiModelKey))
+	if err != nil {
+		return containerMPI.Container, fmt.Errorf("invalid %s: %w", mpiModelKey, err)
+	}
+	switch model {
+	case container.UnknownModel:
+		return containerMPI.Container, fmt.Errorf("%s is not defined", mpiModelKey)
 	case container.HybridModel:
 		containerBuildEnv, cleanup, err = getHybridConfiguration(kvs, &containerMPI, sysCfg)
 		if err != nil {
@@ -375,6 +386,13 @@ func ContainerizeApp(sysCfg *sys.Config) (container.Config, error) {
 	if app.info.InstallCmd == "" {
 		return containerMPI.Container, fmt.Errorf("application's compilation command is not defined")
 	}
+	containerMPI.Container.AppExe = kv.GetValue(kvs, appExePathKey)
+	if sysCfg.AppExe != "" {
+		containerMPI.Container.AppExe = sysCfg.AppExe
+	}
+	if containerMPI.Container.AppExe == "" && model == container.HybridModel {
+		log.Printf("[WARN] %s is not defined, the container will not record the path to the application's executable", appExePathKey)
+	}
 
 	err = containerMPI.Buildenv.Init(sysCfg)
 	if err != nil {
@@ -403,6 +421,7 @@ func ContainerizeApp(sysCfg *sys.Config) (container.Config, error) {
 	log.Printf("-> Container Linux distribution: %s\n", containerMPI.Container.Distro)
 	log.Printf("-> Container path: %s\n", containerMPI.Container.Path)
 	log.Printf("-> Container MPI model: %s\n", containerMPI.Container.Model)
+	log.Printf("-> Application executable: %s\n", containerMPI.Container.AppExe)
 	log.Printf("-> Target container image: %s\n", containerMPI.Container.Path)
 
 	// Make sure the image already exists, if so, stop, we do not overwrite images, ever
@@ -6,6 +6,7 @@
 package experiments
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -94,10 +95,10 @@ func createNewContainer(myContainerMPICfg *mpi.Config, exp Config, sysCfg *sys.C
 	if res.Err != nil {
 		err := launcher.SaveErrorDetails(&exp.HostMPI, &myContainerMPICfg.Implem, sysCfg, &res)
 		if err != nil {
-			res.Err = fmt.Errorf("failed to save error details: %s", err)
+			res.Err = fmt.Errorf("failed to save error details: %w", err)
 			return res
 		}
-		res.Err = fmt.Errorf("failed to create container: %s", res.Err)
+		res.Err = fmt.Errorf("failed to create container: %w", res.Err)
 		return res
 	}
 
@@ -118,7 +119,7 @@ func Run(exp Config, sysCfg *sys.Config, syConfig *sy.MPIToolConfig) (bool, resu
 	if !util.PathExists(myHostMPICfg.Buildenv.BuildDir) {
 		err := os.MkdirAll(myHostMPICfg.Buildenv.BuildDir, 0755)
 		if err != nil {
-			execRes.Err = fmt.Errorf("failed to create %s: %s", myHostMPICfg.Buildenv.BuildDir, err)
+			execRes.Err = fmt.Errorf("failed to create %s: %w", myHostMPICfg.Buildenv.BuildDir, err)
 			return false, expRes, execRes
 		}
 	} else {
@@ -127,7 +128,7 @@ func Run(exp Config, sysCfg *sys.Config, syConfig *sy.MPIToolConfig) (bool, resu
 	if !util.PathExists(myHostMPICfg.Buildenv.ScratchDir) {
 		err := os.MkdirAll(myHostMPICfg.Buildenv.ScratchDir, 0755)
 		if err != nil {
-			execRes.Err = fmt.Errorf("failed to create %s: %s", myHostMPICfg.Buildenv.ScratchDir, err)
+			execRes.Err = fmt.Errorf("failed to create %s: %w", myHostMPICfg.Buildenv.ScratchDir, err)
 			return false, expRes, execRes
 		}
 	} else {
@@ -147,7 +148,7 @@ func Run(exp Config, sysCfg *sys.Config, syConfig *sy.MPIToolConfig) (bool, resu
 	if !util.PathExists(myContainerMPICfg.Buildenv.BuildDir) {
 		err := os.MkdirAll(myContainerMPICfg.Buildenv.BuildDir, 0755)
 		if err != nil {
-			execRes.Err = fmt.Errorf("failed to create %s: %s", myContainerMPICfg.Buildenv.BuildDir, err)
+			execRes.Err = fmt.Errorf("failed to create %s: %w", myContainerMPICfg.Buildenv.BuildDir, err)
 			return false, expRes, execRes
 		}
 	} else {
@@ -156,7 +157,7 @@ func Run(exp Config, sysCfg *sys.Config, syConfig *sy.MPIToolConfig) (bool, resu
 	if !util.PathExists(myContainerMPICfg.Buildenv.ScratchDir) {
 		err := os.MkdirAll(myContainerMPICfg.Buildenv.ScratchDir, 0755)
 		if err != nil {
-			execRes.Err = fmt.Errorf("failed to create %s: %s", myContainerMPICfg.Buildenv.ScratchDir, err)
+			execRes.Err = fmt.Errorf("failed to create %s: %w", myContainerMPICfg.Buildenv.ScratchDir, err)
 			return false, expRes, execRes
 		}
 	} else {
@@ -175,16 +176,16 @@ func Run(exp Config, sysCfg *sys.Config, syConfig *sy.MPIToolConfig) (bool, resu
 	jobmgr := jm.Detect()
 	b, err := builder.Load(&myHostMPICfg.Implem)
 	if err != nil {
-		execRes.Err = fmt.Errorf("unable to load a builder: %s", err)
+		execRes.Err = fmt.Errorf("unable to load a builder: %w", err)
 		return false, expRes, execRes
 	}
 
-	execRes = b.InstallOnHost(&myHostMPICfg.Implem, &myHostMPICfg.Buildenv, sysCfg)
+	execRes = b.InstallOnHost(context.Background(), &myHostMPICfg.Implem, &myHostMPICfg.Buildenv, sysCfg)
 	if execRes.Err != nil {
-		execRes.Err = fmt.Errorf("failed to install host MPI: %s", execRes.Err)
+		execRes.Err = fmt.Errorf("failed to install host MPI: %w", execRes.Err)
 		err = launcher.SaveErrorDetails(&exp.HostMPI, &myContainerMPICfg.Implem, sysCfg, &execRes)
 		if err != nil {
-			execRes.Err = fmt.Errorf("failed to save error details: %s", err)
+			execRes.Err = fmt.Errorf("failed to save error details: %w", err)
 		}
 		expRes.Pass = false
 		return false, expRes, execRes
@@ -210,14 +211,14 @@ func Run(exp Config, sysCfg *sys.Config, syConfig *sy.MPIToolConfig) (bool, resu
 	if syConfig.BuildPrivilege {
 		execRes = createNewContainer(&myContainerMPICfg, exp, sysCfg, syConfig)
 		if execRes.Err != nil {
-			execRes.Err = fmt.Errorf("failed to create container: %s", err)
+			execRes.Err = fmt.Errorf("failed to create container: %w", err)
 			expRes.Pass = false
 			return false, expRes, execRes
 		}
 	} else {
 		err = container.PullContainerImage(&myContainerMPICfg.Container, &myContainerMPICfg.Implem, sysCfg, syConfig)
 		if err != nil {
-			execRes.Err = fmt.Errorf("failed to pull container: %s", err)
+			execRes.Err = fmt.Errorf("failed to pull container: %w", err)
 			expRes.Pass = false
 			return false, expRes, execRes
 		}
@@ -227,7 +228,7 @@ func Run(exp Config, sysCfg *sys.Config, syConfig *sy.MPIToolConfig) (bool, resu
 
 	log.Println("Running Test(s)...")
 
-	expRes, execRes = launcher.Run(&exp.App, &myHostMPICfg, &exp.HostBuildEnv, &myContainerMPICfg, &jobmgr, sysCfg)
+	expRes, execRes = launcher.Run(context.Background(), &exp.App, &myHostMPICfg, &exp.HostBuildEnv, &myContainerMPICfg, &jobmgr, sysCfg)
 	if !expRes.Pass {
 		return false, expRes, execRes
 	}
@@ -237,7 +238,7 @@ func Run(exp Config, sysCfg *sys.Config, syConfig *sy.MPIToolConfig) (bool, resu
 	log.Println("Handling data...")
 	expRes.Note, err = postExecutionDataMgt(sysCfg, execRes.Stdout)
 	if err != nil {
-		execRes.Err = fmt.Errorf("failed to handle data: %s", err)
+		execRes.Err = fmt.Errorf("failed to handle data: %w", err)
 		expRes.Pass = false
 		return false, expRes, execRes
 	}